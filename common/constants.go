@@ -33,6 +33,12 @@ var DefaultCollapseSidebar = false // default value of collapse sidebar
 var SessionSecret = uuid.New().String()
 var CryptoSecret = uuid.New().String()
 
+// BodyLogSecret 请求内容记录的加密密钥
+var BodyLogSecret string
+
+// MediaSignSecret 媒体存储签名链接的密钥
+var MediaSignSecret string
+
 var OptionMap map[string]string
 var OptionMapRWMutex sync.RWMutex
 
@@ -117,6 +123,12 @@ var SyncFrequency int // unit is second
 var BatchUpdateEnabled = false
 var BatchUpdateInterval int
 
+// 日志异步批量写入
+var LogBatchWriteEnabled = false
+var LogBatchWriteSize int
+var LogBatchWriteInterval int
+var LogBatchWriteQueueSize int
+
 var RelayTimeout int // unit is second
 
 var GeminiSafetySetting string
@@ -243,6 +255,7 @@ const (
 	ChannelTypeCoze           = 49
 	ChannelTypeKling          = 50
 	ChannelTypeCustomPass     = 51
+	ChannelTypeDeclarative    = 52
 	ChannelTypeDummy          // this one is only for count, do not add any channel after this
 
 )
@@ -300,4 +313,5 @@ var ChannelBaseURLs = []string{
 	"https://api.coze.cn",                       //49
 	"https://api.klingai.com",                   //50
 	"",                                          //51
+	"",                                          //52
 }
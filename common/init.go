@@ -15,13 +15,15 @@ var (
 	PrintVersion = flag.Bool("version", false, "print version and exit")
 	PrintHelp    = flag.Bool("help", false, "print help and exit")
 	LogDir       = flag.String("log-dir", "./logs", "specify the log directory")
+
+	MigrateMidjourney = flag.Bool("migrate-midjourney", false, "migrate legacy midjourney tasks into the task table and exit")
 )
 
 func printHelp() {
 	fmt.Println("New API " + Version + " - All in one API service for OpenAI API.")
 	fmt.Println("Copyright (C) 2023 JustSong. All rights reserved.")
 	fmt.Println("GitHub: https://github.com/songquanpeng/one-api")
-	fmt.Println("Usage: one-api [--port <port>] [--log-dir <log directory>] [--version] [--help]")
+	fmt.Println("Usage: one-api [--port <port>] [--log-dir <log directory>] [--migrate-midjourney] [--version] [--help]")
 }
 
 func LoadEnv() {
@@ -81,6 +83,10 @@ func LoadEnv() {
 	// Initialize variables with GetEnvOrDefault
 	SyncFrequency = GetEnvOrDefault("SYNC_FREQUENCY", 60)
 	BatchUpdateInterval = GetEnvOrDefault("BATCH_UPDATE_INTERVAL", 5)
+	LogBatchWriteEnabled = GetEnvOrDefaultBool("LOG_BATCH_WRITE_ENABLED", false)
+	LogBatchWriteSize = GetEnvOrDefault("LOG_BATCH_WRITE_SIZE", 500)
+	LogBatchWriteInterval = GetEnvOrDefault("LOG_BATCH_WRITE_INTERVAL", 1)
+	LogBatchWriteQueueSize = GetEnvOrDefault("LOG_BATCH_WRITE_QUEUE_SIZE", 20000)
 	RelayTimeout = GetEnvOrDefault("RELAY_TIMEOUT", 0)
 
 	// Initialize string variables with GetEnvOrDefaultString
@@ -95,4 +101,28 @@ func LoadEnv() {
 	GlobalWebRateLimitEnable = GetEnvOrDefaultBool("GLOBAL_WEB_RATE_LIMIT_ENABLE", true)
 	GlobalWebRateLimitNum = GetEnvOrDefault("GLOBAL_WEB_RATE_LIMIT", 60)
 	GlobalWebRateLimitDuration = int64(GetEnvOrDefault("GLOBAL_WEB_RATE_LIMIT_DURATION", 180))
+
+	// Prometheus 指标
+	MetricsEnabled = GetEnvOrDefaultBool("METRICS_ENABLED", false)
+	MetricsToken = os.Getenv("METRICS_TOKEN")
+
+	// 请求内容记录的加密密钥，只使用显式配置的环境变量：未配置时 SessionSecret 为每次启动随机生成的值，
+	// 重启或其他节点将无法解密已写入的记录，此时不允许开启加密记录
+	BodyLogSecret = os.Getenv("BODY_LOG_SECRET")
+	if BodyLogSecret == "" {
+		BodyLogSecret = os.Getenv("CRYPTO_SECRET")
+	}
+	if BodyLogSecret == "" {
+		BodyLogSecret = os.Getenv("SESSION_SECRET")
+	}
+
+	// 媒体存储签名链接的密钥，与请求内容记录一样只使用显式配置的环境变量，
+	// 否则重启或请求落到其他节点后已签发的链接将全部失效
+	MediaSignSecret = os.Getenv("MEDIA_SIGN_SECRET")
+	if MediaSignSecret == "" {
+		MediaSignSecret = os.Getenv("CRYPTO_SECRET")
+	}
+	if MediaSignSecret == "" {
+		MediaSignSecret = os.Getenv("SESSION_SECRET")
+	}
 }
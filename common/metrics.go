@@ -0,0 +1,201 @@
+package common
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "one_api"
+
+var (
+	MetricsEnabled bool
+	// MetricsToken 访问 /metrics 所需的 Bearer 令牌，为空时仅管理员可访问
+	MetricsToken string
+)
+
+var (
+	relayRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_requests_total",
+		Help:      "Total relay requests by model, channel, group and status code.",
+	}, []string{"model", "channel", "group", "status_code"})
+	relayRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_request_duration_seconds",
+		Help:      "Relay request latency by model, channel and group.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120, 300},
+	}, []string{"model", "channel", "group"})
+	relayFirstTokenDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_first_token_seconds",
+		Help:      "Time to first token of streaming relay requests by model, channel and group.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 3, 5, 10, 20, 30, 60},
+	}, []string{"model", "channel", "group"})
+	relayRetriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_retries_total",
+		Help:      "Total relay retries on another channel by model and group.",
+	}, []string{"model", "group"})
+	upstreamErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "upstream_errors_total",
+		Help:      "Total upstream errors by channel and error class.",
+	}, []string{"channel", "class"})
+	tokensTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "tokens_total",
+		Help:      "Total prompt and completion tokens by model, channel and group.",
+	}, []string{"model", "channel", "group", "type"})
+	quotaConsumedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "quota_consumed_total",
+		Help:      "Total quota consumed by model, channel and group.",
+	}, []string{"model", "channel", "group"})
+	cacheLookupsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "cache_lookups_total",
+		Help:      "Total cache lookups by cache and result (hit or miss).",
+	}, []string{"cache", "result"})
+	channelStatusGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "channel_status",
+		Help:      "Channel status (1 enabled, 2 manually disabled, 3 auto disabled).",
+	}, []string{"channel", "name", "type"})
+	channelEnabledGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "channel_enabled",
+		Help:      "Whether the channel is enabled (1) or disabled (0).",
+	}, []string{"channel", "name", "type"})
+	taskQueueDepthGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "task_queue_depth",
+		Help:      "Unfinished async tasks by platform and status.",
+	}, []string{"platform", "status"})
+	logBufferWritesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "log_buffer_writes_total",
+		Help:      "Total logs flushed from async log buffers by buffer and result (written, spooled or dropped).",
+	}, []string{"buffer", "result"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		relayRequestsTotal,
+		relayRequestDuration,
+		relayFirstTokenDuration,
+		relayRetriesTotal,
+		upstreamErrorsTotal,
+		tokensTotal,
+		quotaConsumedTotal,
+		cacheLookupsTotal,
+		channelStatusGauge,
+		channelEnabledGauge,
+		taskQueueDepthGauge,
+		logBufferWritesTotal,
+	)
+}
+
+// MetricsHandler 返回 Prometheus 指标的 HTTP 处理器
+func MetricsHandler() http.Handler {
+	return promhttp.Handler()
+}
+
+// RegisterDBStatsMetrics 注册数据库连接池指标
+func RegisterDBStatsMetrics(db *sql.DB, name string) {
+	if err := prometheus.Register(collectors.NewDBStatsCollector(db, name)); err != nil {
+		SysError("failed to register db stats metrics: " + err.Error())
+	}
+}
+
+// RegisterLogBufferMetrics 注册异步日志缓冲的队列深度指标
+func RegisterLogBufferMetrics(buffer string, depth func() int) {
+	gauge := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   metricsNamespace,
+		Name:        "log_buffer_depth",
+		Help:        "Logs waiting in async log buffers.",
+		ConstLabels: prometheus.Labels{"buffer": buffer},
+	}, func() float64 {
+		return float64(depth())
+	})
+	if err := prometheus.Register(gauge); err != nil {
+		SysError("failed to register log buffer metrics: " + err.Error())
+	}
+}
+
+func RecordLogBufferWrite(buffer string, result string, count int) {
+	logBufferWritesTotal.WithLabelValues(buffer, result).Add(float64(count))
+}
+
+func RecordRelayRequest(modelName string, channelId int, group string, statusCode int, duration time.Duration) {
+	channel := strconv.Itoa(channelId)
+	relayRequestsTotal.WithLabelValues(modelName, channel, group, strconv.Itoa(statusCode)).Inc()
+	relayRequestDuration.WithLabelValues(modelName, channel, group).Observe(duration.Seconds())
+}
+
+func RecordRelayFirstToken(modelName string, channelId int, group string, duration time.Duration) {
+	relayFirstTokenDuration.WithLabelValues(modelName, strconv.Itoa(channelId), group).Observe(duration.Seconds())
+}
+
+func RecordRelayRetry(modelName string, group string) {
+	relayRetriesTotal.WithLabelValues(modelName, group).Inc()
+}
+
+func RecordUpstreamError(channelId int, class string) {
+	upstreamErrorsTotal.WithLabelValues(strconv.Itoa(channelId), class).Inc()
+}
+
+func RecordTokenUsage(modelName string, channelId int, group string, promptTokens int, completionTokens int) {
+	channel := strconv.Itoa(channelId)
+	if promptTokens > 0 {
+		tokensTotal.WithLabelValues(modelName, channel, group, "prompt").Add(float64(promptTokens))
+	}
+	if completionTokens > 0 {
+		tokensTotal.WithLabelValues(modelName, channel, group, "completion").Add(float64(completionTokens))
+	}
+}
+
+func RecordQuotaConsumed(modelName string, channelId int, group string, quota int) {
+	if quota > 0 {
+		quotaConsumedTotal.WithLabelValues(modelName, strconv.Itoa(channelId), group).Add(float64(quota))
+	}
+}
+
+func RecordCacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheLookupsTotal.WithLabelValues(cache, result).Inc()
+}
+
+// ResetChannelMetrics 清空渠道状态指标，用于按当前渠道列表重新设置，避免已删除渠道残留
+func ResetChannelMetrics() {
+	channelStatusGauge.Reset()
+	channelEnabledGauge.Reset()
+}
+
+func SetChannelStatusMetric(channelId int, name string, channelType int, status int) {
+	channel := strconv.Itoa(channelId)
+	typeStr := strconv.Itoa(channelType)
+	channelStatusGauge.WithLabelValues(channel, name, typeStr).Set(float64(status))
+	enabled := 0.0
+	if status == ChannelStatusEnabled {
+		enabled = 1
+	}
+	channelEnabledGauge.WithLabelValues(channel, name, typeStr).Set(enabled)
+}
+
+// ResetTaskQueueMetrics 清空任务队列指标，用于按当前未完成任务重新设置
+func ResetTaskQueueMetrics() {
+	taskQueueDepthGauge.Reset()
+}
+
+func SetTaskQueueDepthMetric(platform string, status string, count int64) {
+	taskQueueDepthGauge.WithLabelValues(platform, status).Set(float64(count))
+}
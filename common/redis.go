@@ -74,6 +74,28 @@ func RedisGet(key string) (string, error) {
 	return val, err
 }
 
+// redisRenewLeaseScript 仅当租约仍由当前持有者持有时续期
+var redisRenewLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// RedisAcquireLease 获取或续期以 owner 标识的租约，返回当前是否持有该租约
+func RedisAcquireLease(key string, owner string, expiration time.Duration) (bool, error) {
+	ctx := context.Background()
+	ok, err := RDB.SetNX(ctx, key, owner, expiration).Result()
+	if err != nil || ok {
+		return ok, err
+	}
+	renewed, err := redisRenewLeaseScript.Run(ctx, RDB, []string{key}, owner, expiration.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return renewed == 1, nil
+}
+
 //func RedisExpire(key string, expiration time.Duration) error {
 //	ctx := context.Background()
 //	return RDB.Expire(ctx, key, expiration).Err()
@@ -0,0 +1,187 @@
+package common
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Spool 基于本地文件的暂存队列，下游不可用或队列已满时将记录按行追加到磁盘，恢复后再重放，保证记录不丢失
+type Spool struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// NewSpool 在 LOG_SPOOL_DIR 目录下创建名为 name 的暂存队列
+func NewSpool(name string) (*Spool, error) {
+	dir := GetEnvOrDefaultString("LOG_SPOOL_DIR", "./log-spool")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Spool{path: filepath.Join(dir, name+".jsonl")}, nil
+}
+
+// Append 追加记录，每条记录占一行，记录中不能包含换行符。
+// 文件保持打开，写入操作系统缓存即返回，进程异常退出不会丢失；移出重放或关闭时同步到磁盘
+func (s *Spool) Append(records ...[]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		s.file = file
+	}
+	writer := bufio.NewWriter(s.file)
+	for _, record := range records {
+		if _, err := writer.Write(record); err != nil {
+			return err
+		}
+		if err := writer.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// Close 同步并关闭追加写入的文件
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeFile()
+}
+
+func (s *Spool) closeFile() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Sync()
+	err = errors.Join(err, s.file.Close())
+	s.file = nil
+	return err
+}
+
+// Pending 是否有待重放的记录
+func (s *Spool) Pending() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, path := range []string{s.replayPath(), s.path} {
+		if info, err := os.Stat(path); err == nil && info.Size() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Spool) replayPath() string {
+	return s.path + ".replay"
+}
+
+func (s *Spool) offsetPath() string {
+	return s.path + ".replay.offset"
+}
+
+// readOffset 读取重放文件中已处理完成的位置
+func (s *Spool) readOffset() int64 {
+	data, err := os.ReadFile(s.offsetPath())
+	if err != nil {
+		return 0
+	}
+	offset, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil || offset < 0 {
+		return 0
+	}
+	return offset
+}
+
+// writeOffset 先写临时文件再重命名，保证崩溃时偏移文件不会损坏
+func (s *Spool) writeOffset(offset int64) error {
+	tmpPath := s.offsetPath() + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(strconv.FormatInt(offset, 10)), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.offsetPath())
+}
+
+// Replay 按批次重放暂存的记录，每次最多处理 maxBatches 批（不大于 0 时不限制）。
+// 逐行读取文件，每批处理成功后记录偏移，handler 返回错误时停止，未处理的记录保留到下次重放
+func (s *Spool) Replay(batchSize int, maxBatches int, handler func(records [][]byte) error) error {
+	s.mu.Lock()
+	replayPath := s.replayPath()
+	if _, err := os.Stat(replayPath); errors.Is(err, os.ErrNotExist) {
+		// 将当前文件移出，重放期间新的记录继续追加到原文件
+		if err = s.closeFile(); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		if err = os.Rename(s.path, replayPath); err != nil {
+			s.mu.Unlock()
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		_ = os.Remove(s.offsetPath())
+	}
+	s.mu.Unlock()
+
+	file, err := os.Open(replayPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	offset := s.readOffset()
+	if offset > 0 {
+		if _, err = file.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	reader := bufio.NewReader(file)
+	for batches := 0; maxBatches <= 0 || batches < maxBatches; batches++ {
+		records := make([][]byte, 0, batchSize)
+		var read int64
+		eof := false
+		for len(records) < batchSize {
+			line, readErr := reader.ReadBytes('\n')
+			read += int64(len(line))
+			if len(line) > 0 && line[len(line)-1] == '\n' {
+				line = line[:len(line)-1]
+			}
+			if len(line) > 0 {
+				records = append(records, line)
+			}
+			if readErr == io.EOF {
+				eof = true
+				break
+			}
+			if readErr != nil {
+				return readErr
+			}
+		}
+		if len(records) > 0 {
+			if err = handler(records); err != nil {
+				return err
+			}
+		}
+		offset += read
+		if eof {
+			file.Close()
+			_ = os.Remove(s.offsetPath())
+			return os.Remove(replayPath)
+		}
+		if err = s.writeOffset(offset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
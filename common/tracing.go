@@ -0,0 +1,123 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const traceContextKey = "trace_context"
+
+// TracingEnabled 是否开启 OTLP 链路追踪，导出地址等通过 OTEL_EXPORTER_OTLP_* 标准环境变量配置
+var TracingEnabled bool
+
+var tracer = otel.Tracer("one-api")
+
+// InitTracing 初始化 OTLP 链路追踪，未开启时所有 span 均为空操作
+func InitTracing() error {
+	TracingEnabled = GetEnvOrDefaultBool("TRACING_ENABLED", false)
+	if !TracingEnabled {
+		return nil
+	}
+	exporter, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		return err
+	}
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "new-api"
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+		semconv.ServiceVersion(Version),
+	))
+	if err != nil {
+		return err
+	}
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	))
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	SysLog("OTLP tracing is enabled")
+	return nil
+}
+
+// ShutdownTracing 导出剩余的 span 并关闭链路追踪
+func ShutdownTracing(ctx context.Context) {
+	if provider, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider); ok {
+		if err := provider.Shutdown(ctx); err != nil {
+			SysError("failed to shutdown tracing: " + err.Error())
+		}
+	}
+}
+
+// TraceContext 返回请求当前所处 span 的上下文
+func TraceContext(c *gin.Context) context.Context {
+	if ctx, ok := c.Get(traceContextKey); ok {
+		return ctx.(context.Context)
+	}
+	return c.Request.Context()
+}
+
+// StartRequestSpan 从请求头中提取上游传入的链路信息并开始请求的根 span
+func StartRequestSpan(c *gin.Context, name string, attrs ...attribute.KeyValue) trace.Span {
+	ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+	ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+	c.Set(traceContextKey, ctx)
+	return span
+}
+
+// StartSpan 在请求当前 span 下开始一个阶段 span，返回的函数结束该 span 并恢复父 span，可重复调用
+func StartSpan(c *gin.Context, name string, attrs ...attribute.KeyValue) func() {
+	if !TracingEnabled {
+		return func() {}
+	}
+	parent := TraceContext(c)
+	ctx, span := tracer.Start(parent, name, trace.WithAttributes(attrs...))
+	c.Set(traceContextKey, ctx)
+	ended := false
+	return func() {
+		if ended {
+			return
+		}
+		ended = true
+		span.End()
+		c.Set(traceContextKey, parent)
+	}
+}
+
+// SetSpanAttributes 为请求当前 span 添加属性
+func SetSpanAttributes(c *gin.Context, attrs ...attribute.KeyValue) {
+	trace.SpanFromContext(TraceContext(c)).SetAttributes(attrs...)
+}
+
+// SetSpanError 将请求当前 span 标记为失败
+func SetSpanError(c *gin.Context, message string) {
+	trace.SpanFromContext(TraceContext(c)).SetStatus(codes.Error, message)
+}
+
+// InjectTraceHeaders 将当前链路信息以 W3C trace-context 格式写入上游请求头
+func InjectTraceHeaders(c *gin.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(TraceContext(c), propagation.HeaderCarrier(header))
+}
+
+// GetTraceId 返回请求的 trace id，未开启追踪时返回空字符串
+func GetTraceId(c *gin.Context) string {
+	spanContext := trace.SpanContextFromContext(TraceContext(c))
+	if !spanContext.HasTraceID() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
@@ -1,10 +1,25 @@
 package constant
 
 const (
-	ContextKeyRequestStartTime = "request_start_time"
-	ContextKeyUserSetting      = "user_setting"
-	ContextKeyUserQuota        = "user_quota"
-	ContextKeyUserStatus       = "user_status"
-	ContextKeyUserEmail        = "user_email"
-	ContextKeyUserGroup        = "user_group"
+	ContextKeyRequestStartTime   = "request_start_time"
+	ContextKeyUserSetting        = "user_setting"
+	ContextKeyUserQuota          = "user_quota"
+	ContextKeyUserStatus         = "user_status"
+	ContextKeyUserEmail          = "user_email"
+	ContextKeyUserGroup          = "user_group"
+	ContextKeyFallbackFrom       = "fallback_from"
+	ContextKeyRelayInfo          = "relay_info"
+	ContextKeySessionAffinityKey = "session_affinity_key"
+	ContextKeyChannelKeyId       = "channel_key_id"
+	ContextKeyUpstreamContext    = "upstream_context"
+	ContextKeyHedgeInfo          = "hedge_info"
+	ContextKeyResponseCacheHit   = "response_cache_hit"
+	// ContextKeyTaskPrice 异步任务按请求参数计算出的价格，优先于模型价格
+	ContextKeyTaskPrice = "task_price"
+	// ContextKeyTaskProperties 提交异步任务时需要额外保存到任务记录中的属性
+	ContextKeyTaskProperties = "task_properties"
+	// ContextKeyTaskLogOther 提交异步任务时需要额外写入消费日志的信息
+	ContextKeyTaskLogOther = "task_log_other"
+	// ContextKeyBodyLogCapture 当前请求正在捕获请求与响应内容
+	ContextKeyBodyLogCapture = "body_log_capture"
 )
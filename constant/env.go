@@ -18,6 +18,10 @@ var NotificationLimitDurationMinute int
 var GenerateDefaultToken bool
 var ErrorLogEnabled bool
 var CustomPassHeaderKey string
+var FileExpireDays int
+var ResponseExpireDays int
+var BatchConcurrency int
+var BatchMaxFileMB int
 
 //var GeminiModelMap = map[string]string{
 //	"gemini-1.0-pro": "v1",
@@ -42,6 +46,13 @@ func InitEnv() {
 	ErrorLogEnabled = common.GetEnvOrDefaultBool("ERROR_LOG_ENABLED", false)
 	// CustomPassHeaderKey 自定义透传渠道请求头key，如果未配置则为空字符串（不添加请求头）
 	CustomPassHeaderKey = common.GetEnvOrDefaultString("CUSTOM_PASS_HEADER_KEY", "")
+	// FileExpireDays 上传文件与批处理输出文件（Files API）的保留天数，过期后自动删除，0 表示不过期
+	FileExpireDays = common.GetEnvOrDefault("FILE_EXPIRE_DAYS", 30)
+	// ResponseExpireDays 网关模拟 Responses API 时保存的响应的保留天数，过期后无法再通过 previous_response_id 续接，0 表示不过期
+	ResponseExpireDays = common.GetEnvOrDefault("RESPONSE_EXPIRE_DAYS", 30)
+	// BatchConcurrency 单个批处理任务同时转发的请求数
+	BatchConcurrency = common.GetEnvOrDefault("BATCH_CONCURRENCY", 4)
+	BatchMaxFileMB = common.GetEnvOrDefault("BATCH_MAX_FILE_MB", 100)
 
 	//modelVersionMapStr := strings.TrimSpace(os.Getenv("GEMINI_MODEL_MAP"))
 	//if modelVersionMapStr == "" {
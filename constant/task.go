@@ -8,6 +8,8 @@ const (
 	TaskPlatformKling      TaskPlatform = "kling"
 
 	TaskPlatformCustomPass TaskPlatform = "custompass"
+	// TaskPlatformDeclarative 声明式任务渠道，请求格式与结果字段由渠道配置决定
+	TaskPlatformDeclarative TaskPlatform = "declarative"
 )
 
 const (
@@ -0,0 +1,580 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/middleware"
+	"one-api/model"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const batchCompletionWindow = "24h"
+
+var batchSupportedEndpoints = map[string]bool{
+	"/v1/chat/completions": true,
+	"/v1/completions":      true,
+	"/v1/embeddings":       true,
+	"/v1/responses":        true,
+}
+
+func optionalTime(t int64) *int64 {
+	if t == 0 {
+		return nil
+	}
+	return &t
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func batch2OpenAIBatch(batch *model.Batch) dto.OpenAIBatch {
+	openAIBatch := dto.OpenAIBatch{
+		Id:               batch.Id,
+		Object:           "batch",
+		Endpoint:         batch.Endpoint,
+		InputFileId:      batch.InputFileId,
+		CompletionWindow: batch.CompletionWindow,
+		Status:           batch.Status,
+		OutputFileId:     optionalString(batch.OutputFileId),
+		ErrorFileId:      optionalString(batch.ErrorFileId),
+		CreatedAt:        batch.CreatedAt,
+		InProgressAt:     optionalTime(batch.InProgressAt),
+		ExpiresAt:        optionalTime(batch.ExpiresAt),
+		FinalizingAt:     optionalTime(batch.FinalizingAt),
+		CompletedAt:      optionalTime(batch.CompletedAt),
+		FailedAt:         optionalTime(batch.FailedAt),
+		ExpiredAt:        optionalTime(batch.ExpiredAt),
+		CancellingAt:     optionalTime(batch.CancellingAt),
+		CancelledAt:      optionalTime(batch.CancelledAt),
+		RequestCounts: dto.BatchRequestCounts{
+			Total:     batch.TotalCount,
+			Completed: batch.CompletedCount,
+			Failed:    batch.FailedCount,
+		},
+	}
+	if batch.Errors != "" {
+		var batchErrors dto.BatchErrors
+		if err := json.Unmarshal([]byte(batch.Errors), &batchErrors); err == nil {
+			openAIBatch.Errors = &batchErrors
+		}
+	}
+	if batch.Metadata != "" {
+		_ = json.Unmarshal([]byte(batch.Metadata), &openAIBatch.Metadata)
+	}
+	return openAIBatch
+}
+
+func getUserBatchOrAbort(c *gin.Context) *model.Batch {
+	batch, err := model.GetUserBatchById(c.GetInt("id"), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			openAIErrorResponse(c, http.StatusNotFound, "batch_not_found", fmt.Sprintf("No such Batch object: %s", c.Param("id")))
+		} else {
+			openAIErrorResponse(c, http.StatusInternalServerError, "get_batch_failed", err.Error())
+		}
+		return nil
+	}
+	return batch
+}
+
+func CreateBatch(c *gin.Context) {
+	var req dto.BatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if !batchSupportedEndpoints[req.Endpoint] {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_endpoint", fmt.Sprintf("endpoint %s is not supported", req.Endpoint))
+		return
+	}
+	if req.CompletionWindow != batchCompletionWindow {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_completion_window", "completion_window must be 24h")
+		return
+	}
+	userId := c.GetInt("id")
+	inputFile, err := model.GetUserFileById(userId, req.InputFileId)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_input_file", fmt.Sprintf("No such File object: %s", req.InputFileId))
+		return
+	}
+	if inputFile.Purpose != model.FilePurposeBatch {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_input_file", "input file purpose must be batch")
+		return
+	}
+	now := common.GetTimestamp()
+	batch := &model.Batch{
+		Id:               model.GenerateBatchId(),
+		UserId:           userId,
+		TokenId:          c.GetInt("token_id"),
+		ClientIp:         c.ClientIP(),
+		Endpoint:         req.Endpoint,
+		InputFileId:      req.InputFileId,
+		CompletionWindow: req.CompletionWindow,
+		Status:           model.BatchStatusValidating,
+		CreatedAt:        now,
+		ExpiresAt:        now + int64(24*time.Hour/time.Second),
+	}
+	if len(req.Metadata) > 0 {
+		metadata, _ := json.Marshal(req.Metadata)
+		batch.Metadata = string(metadata)
+	}
+	if err = batch.Insert(); err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "create_batch_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, batch2OpenAIBatch(batch))
+}
+
+func RetrieveBatch(c *gin.Context) {
+	batch := getUserBatchOrAbort(c)
+	if batch == nil {
+		return
+	}
+	c.JSON(http.StatusOK, batch2OpenAIBatch(batch))
+}
+
+func ListBatches(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	// 多查询一条用于判断是否还有下一页
+	batches, err := model.GetUserBatches(c.GetInt("id"), c.Query("after"), limit+1)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "list_batches_failed", err.Error())
+		return
+	}
+	hasMore := len(batches) > limit
+	if hasMore {
+		batches = batches[:limit]
+	}
+	resp := dto.OpenAIBatchList{
+		Object:  "list",
+		Data:    make([]dto.OpenAIBatch, 0, len(batches)),
+		HasMore: hasMore,
+	}
+	for _, batch := range batches {
+		resp.Data = append(resp.Data, batch2OpenAIBatch(batch))
+	}
+	if len(batches) > 0 {
+		resp.FirstId = &batches[0].Id
+		resp.LastId = &batches[len(batches)-1].Id
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func CancelBatch(c *gin.Context) {
+	batch := getUserBatchOrAbort(c)
+	if batch == nil {
+		return
+	}
+	if batch.IsFinished() || batch.Status == model.BatchStatusCancelling {
+		openAIErrorResponse(c, http.StatusConflict, "batch_not_cancellable", fmt.Sprintf("Cannot cancel a batch with status %s", batch.Status))
+		return
+	}
+	// 由后台处理协程在当前分片结束后完成取消并生成输出文件
+	now := common.GetTimestamp()
+	updated, err := batch.UpdateStatusFrom(map[string]any{
+		"status":        model.BatchStatusCancelling,
+		"cancelling_at": now,
+	}, model.BatchStatusValidating, model.BatchStatusInProgress)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "cancel_batch_failed", err.Error())
+		return
+	}
+	if !updated {
+		openAIErrorResponse(c, http.StatusConflict, "batch_not_cancellable", "Cannot cancel a batch that is being finalized")
+		return
+	}
+	batch.Status = model.BatchStatusCancelling
+	batch.CancellingAt = now
+	c.JSON(http.StatusOK, batch2OpenAIBatch(batch))
+}
+
+var runningBatches sync.Map
+
+// UpdateBatchBulk 轮询未完成的批处理任务，每个任务在独立协程中处理
+func UpdateBatchBulk() {
+	for {
+		time.Sleep(time.Duration(10) * time.Second)
+		batches, err := model.GetUnfinishedBatches()
+		if err != nil {
+			common.SysError("get unfinished batches failed: " + err.Error())
+			continue
+		}
+		for _, batch := range batches {
+			if _, running := runningBatches.LoadOrStore(batch.Id, true); running {
+				continue
+			}
+			b := batch
+			gopool.Go(func() {
+				defer runningBatches.Delete(b.Id)
+				processBatch(b)
+			})
+		}
+	}
+}
+
+func batchLineError(code string, message string, line int) dto.BatchError {
+	return dto.BatchError{Code: code, Message: message, Line: &line}
+}
+
+// parseBatchInput 校验输入文件，任意一行不合法则整个批处理失败
+func parseBatchInput(batch *model.Batch, content []byte) ([]dto.BatchInputLine, []dto.BatchError) {
+	lines := make([]dto.BatchInputLine, 0)
+	batchErrors := make([]dto.BatchError, 0)
+	customIds := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), len(content)+1)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		var line dto.BatchInputLine
+		if err := json.Unmarshal(raw, &line); err != nil {
+			batchErrors = append(batchErrors, batchLineError("invalid_json_line", err.Error(), lineNo))
+			continue
+		}
+		if line.CustomId == "" {
+			batchErrors = append(batchErrors, batchLineError("missing_required_parameter", "custom_id is required", lineNo))
+			continue
+		}
+		if customIds[line.CustomId] {
+			batchErrors = append(batchErrors, batchLineError("duplicate_custom_id", "custom_id must be unique", lineNo))
+			continue
+		}
+		customIds[line.CustomId] = true
+		if line.Method != http.MethodPost {
+			batchErrors = append(batchErrors, batchLineError("invalid_method", "method must be POST", lineNo))
+			continue
+		}
+		if line.Url != batch.Endpoint {
+			batchErrors = append(batchErrors, batchLineError("mismatched_url", fmt.Sprintf("url must be %s", batch.Endpoint), lineNo))
+			continue
+		}
+		var body struct {
+			Model  string `json:"model"`
+			Stream bool   `json:"stream"`
+		}
+		if err := json.Unmarshal(line.Body, &body); err != nil || body.Model == "" {
+			batchErrors = append(batchErrors, batchLineError("invalid_body", "body must be a JSON object with model", lineNo))
+			continue
+		}
+		if body.Stream {
+			batchErrors = append(batchErrors, batchLineError("invalid_body", "stream is not supported in batch requests", lineNo))
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		batchErrors = append(batchErrors, dto.BatchError{Code: "invalid_file", Message: err.Error()})
+	}
+	if len(lines) == 0 && len(batchErrors) == 0 {
+		batchErrors = append(batchErrors, dto.BatchError{Code: "empty_file", Message: "input file is empty"})
+	}
+	return lines, batchErrors
+}
+
+func failBatch(batch *model.Batch, batchErrors []dto.BatchError) {
+	errorsJson, _ := json.Marshal(dto.BatchErrors{Object: "list", Data: batchErrors})
+	now := common.GetTimestamp()
+	updated, err := batch.UpdateStatusFrom(map[string]any{
+		"status":    model.BatchStatusFailed,
+		"errors":    string(errorsJson),
+		"failed_at": now,
+	}, model.BatchStatusValidating, model.BatchStatusInProgress, model.BatchStatusCancelling)
+	if err != nil {
+		common.SysError(fmt.Sprintf("update batch %s failed: %s", batch.Id, err.Error()))
+		return
+	}
+	if updated {
+		batch.Status = model.BatchStatusFailed
+		batch.Errors = string(errorsJson)
+		batch.FailedAt = now
+		// 失败的批处理不生成输出文件，清理已写入的临时结果
+		for _, tmpId := range []string{batchOutputTmpId(batch), batchErrorTmpId(batch)} {
+			if err = model.DeleteFileContent(tmpId); err != nil {
+				common.SysError(fmt.Sprintf("delete batch %s result content failed: %s", batch.Id, err.Error()))
+			}
+		}
+	}
+}
+
+func batchOutputTmpId(batch *model.Batch) string {
+	return batch.Id + ".output"
+}
+
+func batchErrorTmpId(batch *model.Batch) string {
+	return batch.Id + ".error"
+}
+
+// finalizeBatch 生成输出文件和错误文件，并将批处理置为最终状态。
+// 状态只在仍为预期状态时更新，处理期间被取消的批处理按取消完成
+func finalizeBatch(batch *model.Batch, finalStatus string) {
+	now := common.GetTimestamp()
+	if batch.Status != model.BatchStatusFinalizing {
+		fields := map[string]any{
+			"status":        model.BatchStatusFinalizing,
+			"finalizing_at": now,
+		}
+		fromStatus := model.BatchStatusInProgress
+		if finalStatus == model.BatchStatusCancelled {
+			fromStatus = model.BatchStatusCancelling
+		}
+		updated, err := batch.UpdateStatusFrom(fields, fromStatus)
+		if err == nil && !updated && finalStatus != model.BatchStatusCancelled {
+			if updated, err = batch.UpdateStatusFrom(fields, model.BatchStatusCancelling); updated {
+				finalStatus = model.BatchStatusCancelled
+			}
+		}
+		if err != nil {
+			common.SysError(fmt.Sprintf("update batch %s failed: %s", batch.Id, err.Error()))
+			return
+		}
+		if !updated {
+			common.SysLog(fmt.Sprintf("batch %s status changed concurrently, skip finalizing", batch.Id))
+			return
+		}
+		batch.Status = model.BatchStatusFinalizing
+		batch.FinalizingAt = now
+	}
+	outputFile, err := model.CreateFileFromContent(batch.UserId, batchOutputTmpId(batch), batch.Id+"_output.jsonl", model.FilePurposeBatchOutput, fileExpiresAt())
+	if err != nil {
+		common.SysError(fmt.Sprintf("create output file for batch %s failed: %s", batch.Id, err.Error()))
+	} else if outputFile != nil {
+		batch.OutputFileId = outputFile.Id
+	}
+	errorFile, err := model.CreateFileFromContent(batch.UserId, batchErrorTmpId(batch), batch.Id+"_error.jsonl", model.FilePurposeBatchOutput, fileExpiresAt())
+	if err != nil {
+		common.SysError(fmt.Sprintf("create error file for batch %s failed: %s", batch.Id, err.Error()))
+	} else if errorFile != nil {
+		batch.ErrorFileId = errorFile.Id
+	}
+	now = common.GetTimestamp()
+	fields := map[string]any{
+		"status":          finalStatus,
+		"output_file_id":  batch.OutputFileId,
+		"error_file_id":   batch.ErrorFileId,
+		"total_count":     batch.TotalCount,
+		"completed_count": batch.CompletedCount,
+		"failed_count":    batch.FailedCount,
+	}
+	switch finalStatus {
+	case model.BatchStatusCompleted:
+		batch.CompletedAt = now
+		fields["completed_at"] = now
+	case model.BatchStatusExpired:
+		batch.ExpiredAt = now
+		fields["expired_at"] = now
+	case model.BatchStatusCancelled:
+		batch.CancelledAt = now
+		fields["cancelled_at"] = now
+	}
+	if _, err = batch.UpdateStatusFrom(fields, model.BatchStatusFinalizing); err != nil {
+		common.SysError(fmt.Sprintf("update batch %s failed: %s", batch.Id, err.Error()))
+	}
+	batch.Status = finalStatus
+	common.SysLog(fmt.Sprintf("batch %s finished with status %s, completed %d, failed %d", batch.Id, batch.Status, batch.CompletedCount, batch.FailedCount))
+}
+
+// loadBatchProcessedIds 从已写入的输出与错误临时内容中读取已处理行的 custom_id 并据此恢复计数，
+// 重启后跳过这些行，避免重复请求。每行结果在一个事务中写入，不会出现不完整的行
+func loadBatchProcessedIds(batch *model.Batch) map[string]bool {
+	processed := make(map[string]bool)
+	batch.CompletedCount = 0
+	batch.FailedCount = 0
+	for _, tmpId := range []string{batchOutputTmpId(batch), batchErrorTmpId(batch)} {
+		content, err := model.ReadFileContent(tmpId)
+		if err != nil {
+			continue
+		}
+		count := 0
+		for _, line := range bytes.Split(content, []byte{'\n'}) {
+			var result struct {
+				CustomId string `json:"custom_id"`
+			}
+			if len(line) == 0 || json.Unmarshal(line, &result) != nil {
+				continue
+			}
+			processed[result.CustomId] = true
+			count++
+		}
+		if tmpId == batchOutputTmpId(batch) {
+			batch.CompletedCount = count
+		} else {
+			batch.FailedCount = count
+		}
+	}
+	return processed
+}
+
+// recordBatchResult 每行请求结束后立即写入结果文件，结果文件同时记录已完成的行，用于断点续跑
+func recordBatchResult(batch *model.Batch, result *dto.BatchOutputLine) {
+	data, _ := json.Marshal(result)
+	data = append(data, '\n')
+	tmpId := batchErrorTmpId(batch)
+	succeeded := result.Error == nil && result.Response != nil && result.Response.StatusCode == http.StatusOK
+	if succeeded {
+		tmpId = batchOutputTmpId(batch)
+	}
+	if err := model.AppendFileContent(tmpId, data); err != nil {
+		common.SysError(fmt.Sprintf("write batch %s result failed: %s", batch.Id, err.Error()))
+	}
+	if succeeded {
+		batch.CompletedCount++
+	} else {
+		batch.FailedCount++
+	}
+}
+
+func processBatch(batch *model.Batch) {
+	if batch.Status == model.BatchStatusFinalizing {
+		finalizeBatch(batch, model.BatchStatusCompleted)
+		return
+	}
+	content, err := model.ReadFileContent(batch.InputFileId)
+	if err != nil {
+		failBatch(batch, []dto.BatchError{{Code: "invalid_input_file", Message: err.Error()}})
+		return
+	}
+	lines, batchErrors := parseBatchInput(batch, content)
+	if len(batchErrors) > 0 {
+		failBatch(batch, batchErrors)
+		return
+	}
+	batch.TotalCount = len(lines)
+	if batch.Status == model.BatchStatusValidating {
+		now := common.GetTimestamp()
+		updated, err := batch.UpdateStatusFrom(map[string]any{
+			"status":         model.BatchStatusInProgress,
+			"in_progress_at": now,
+			"total_count":    batch.TotalCount,
+		}, model.BatchStatusValidating)
+		if err != nil {
+			common.SysError(fmt.Sprintf("update batch %s failed: %s", batch.Id, err.Error()))
+			return
+		}
+		// 未更新说明已被取消，由下面的取消检查完成取消
+		if updated {
+			batch.Status = model.BatchStatusInProgress
+			batch.InProgressAt = now
+		}
+	}
+	token, err := model.GetTokenById(batch.TokenId)
+	if err != nil {
+		failBatch(batch, []dto.BatchError{{Code: "invalid_token", Message: "the token used to create this batch is no longer available"}})
+		return
+	}
+	concurrency := constant.BatchConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	processed := loadBatchProcessedIds(batch)
+	pending := make([]dto.BatchInputLine, 0, len(lines))
+	for _, line := range lines {
+		if !processed[line.CustomId] {
+			pending = append(pending, line)
+		}
+	}
+	// 按分片并发处理，每行结束后立即写入结果，每个分片结束后保存进度并检查取消与过期，重启后跳过已有结果的行
+	var resultLock sync.Mutex
+	for start := 0; start < len(pending); start += concurrency {
+		status, err := model.GetBatchStatus(batch.Id)
+		if err == nil && status == model.BatchStatusCancelling {
+			finalizeBatch(batch, model.BatchStatusCancelled)
+			return
+		}
+		if common.GetTimestamp() > batch.ExpiresAt {
+			finalizeBatch(batch, model.BatchStatusExpired)
+			return
+		}
+		end := start + concurrency
+		if end > len(pending) {
+			end = len(pending)
+		}
+		var wg sync.WaitGroup
+		for _, line := range pending[start:end] {
+			wg.Add(1)
+			gopool.Go(func() {
+				defer wg.Done()
+				result := executeBatchLine(batch, token, line)
+				resultLock.Lock()
+				recordBatchResult(batch, result)
+				resultLock.Unlock()
+			})
+		}
+		wg.Wait()
+		if err = batch.UpdateProgress(); err != nil {
+			common.SysError(fmt.Sprintf("update batch %s progress failed: %s", batch.Id, err.Error()))
+		}
+	}
+	finalizeBatch(batch, model.BatchStatusCompleted)
+}
+
+// executeBatchLine 构造一个内部请求，依次经过 TokenAuth、Distribute 和 Relay，
+// 因此与普通 API 请求一样进行渠道选择、重试和计费
+func executeBatchLine(batch *model.Batch, token *model.Token, line dto.BatchInputLine) *dto.BatchOutputLine {
+	output := &dto.BatchOutputLine{
+		Id:       "batch_req_" + common.GetRandomString(24),
+		CustomId: line.CustomId,
+	}
+	requestId := common.GetTimeString() + common.GetRandomString(8)
+	ctx := context.WithValue(context.Background(), common.RequestIdKey, requestId)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, line.Url, bytes.NewReader(line.Body))
+	if err != nil {
+		output.Error = &dto.BatchError{Code: "invalid_request", Message: err.Error()}
+		return output
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer sk-"+token.Key)
+	// 使用提交批处理时的客户端 IP，令牌的 IP 白名单与普通请求一样生效
+	req.RemoteAddr = net.JoinHostPort(batch.ClientIp, "0")
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+	c.Set(common.RequestIdKey, requestId)
+	c.Set("batch_id", batch.Id)
+
+	middleware.TokenAuth()(c)
+	if !c.IsAborted() {
+		middleware.Distribute()(c)
+	}
+	if !c.IsAborted() {
+		Relay(c)
+	}
+
+	body := w.Body.Bytes()
+	if !json.Valid(body) {
+		body, _ = json.Marshal(string(body))
+	}
+	output.Response = &dto.BatchOutputResponse{
+		StatusCode: w.Code,
+		RequestId:  requestId,
+		Body:       body,
+	}
+	return output
+}
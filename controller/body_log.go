@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"one-api/service"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// UpdateBodyLogGC 定期清理超过保留天数的请求内容记录
+func UpdateBodyLogGC() {
+	for {
+		time.Sleep(time.Hour)
+		cleaned, err := service.CleanExpiredBodyLogs()
+		if err != nil {
+			common.SysError("clean expired body logs failed: " + err.Error())
+		}
+		if cleaned > 0 {
+			common.SysLog(fmt.Sprintf("cleaned %d expired body logs", cleaned))
+		}
+	}
+}
+
+// GetBodyLog 管理员按请求 ID 查看消费日志对应的请求与响应内容
+func GetBodyLog(c *gin.Context) {
+	bodyLog, err := model.GetBodyLogByRequestId(c.Param("request_id"))
+	if err != nil {
+		message := err.Error()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			message = "请求内容记录不存在或已过期"
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": message,
+		})
+		return
+	}
+	if err = service.DecryptBodyLog(bodyLog); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    bodyLog,
+	})
+}
@@ -29,7 +29,8 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func testChannel(channel *model.Channel, testModel string) (err error, openAIErrorWithStatusCode *dto.OpenAIErrorWithStatusCode) {
+// testChannel 测试渠道，channelKey 不为 nil 时使用多密钥渠道中的指定密钥
+func testChannel(channel *model.Channel, channelKey *model.ChannelKey, testModel string) (err error, openAIErrorWithStatusCode *dto.OpenAIErrorWithStatusCode) {
 	tik := time.Now()
 	if channel.Type == common.ChannelTypeMidjourney {
 		return errors.New("midjourney channel test is not supported"), nil
@@ -45,6 +46,9 @@ func testChannel(channel *model.Channel, testModel string) (err error, openAIErr
 	}
 	if channel.Type == common.ChannelTypeCustomPass {
 		return errors.New("custom pass channel test is not supported"), nil
+	}
+	if channel.Type == common.ChannelTypeDeclarative {
+		return errors.New("declarative task channel test is not supported"), nil
 	}	
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
@@ -92,7 +96,14 @@ func testChannel(channel *model.Channel, testModel string) (err error, openAIErr
 	group, _ := model.GetUserGroup(1, false)
 	c.Set("group", group)
 
-	middleware.SetupContextForSelectedChannel(c, channel, testModel)
+	err = middleware.SetupContextForSelectedChannel(c, channel, testModel)
+	if channelKey != nil {
+		// 测试指定密钥时即使该密钥已被禁用也使用它
+		err = middleware.SetupContextForChannelKey(c, channel, channelKey)
+	}
+	if err != nil {
+		return err, nil
+	}
 
 	info := relaycommon.GenRelayInfo(c)
 
@@ -234,10 +245,29 @@ func TestChannel(c *gin.Context) {
 		return
 	}
 	testModel := c.Query("model")
+	channelKeys, err := testChannelKeys(channel)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	tik := time.Now()
-	err, _ = testChannel(channel, testModel)
+	tested := 0
+	// 多密钥渠道逐个测试每个密钥，遇到失败的密钥时返回该密钥的错误
+	for _, channelKey := range channelKeys {
+		tested++
+		err, _ = testChannel(channel, channelKey, testModel)
+		if err != nil {
+			if channelKey != nil {
+				err = fmt.Errorf("密钥 #%d 测试失败：%s", channelKey.Id, err.Error())
+			}
+			break
+		}
+	}
 	tok := time.Now()
-	milliseconds := tok.Sub(tik).Milliseconds()
+	milliseconds := tok.Sub(tik).Milliseconds() / int64(tested)
 	go channel.UpdateResponseTime(milliseconds)
 	consumedTime := float64(milliseconds) / 1000.0
 	if err != nil {
@@ -256,6 +286,21 @@ func TestChannel(c *gin.Context) {
 	return
 }
 
+// testChannelKeys 返回需要逐个测试的密钥，非多密钥渠道或没有密钥的渠道返回一个 nil，表示使用渠道本身的密钥
+func testChannelKeys(channel *model.Channel) ([]*model.ChannelKey, error) {
+	if !channel.IsMultiKey() {
+		return []*model.ChannelKey{nil}, nil
+	}
+	channelKeys, err := model.GetChannelKeys(channel.Id)
+	if err != nil {
+		return nil, err
+	}
+	if len(channelKeys) == 0 {
+		return []*model.ChannelKey{nil}, nil
+	}
+	return channelKeys, nil
+}
+
 var testAllChannelsLock sync.Mutex
 var testAllChannelsRunning bool = false
 
@@ -285,37 +330,58 @@ func testAllChannels(notify bool) error {
 		}()
 
 		for _, channel := range channels {
-			isChannelEnabled := channel.Status == common.ChannelStatusEnabled
-			tik := time.Now()
-			err, openaiWithStatusErr := testChannel(channel, "")
-			tok := time.Now()
-			milliseconds := tok.Sub(tik).Milliseconds()
-
-			shouldBanChannel := false
-
-			// request error disables the channel
-			if openaiWithStatusErr != nil {
-				oaiErr := openaiWithStatusErr.Error
-				err = errors.New(fmt.Sprintf("type %s, httpCode %d, code %v, message %s", oaiErr.Type, openaiWithStatusErr.StatusCode, oaiErr.Code, oaiErr.Message))
-				shouldBanChannel = service.ShouldDisableChannel(channel.Type, openaiWithStatusErr)
-			}
-
-			if milliseconds > disableThreshold {
-				err = errors.New(fmt.Sprintf("响应时间 %.2fs 超过阈值 %.2fs", float64(milliseconds)/1000.0, float64(disableThreshold)/1000.0))
-				shouldBanChannel = true
+			channelKeys, err := testChannelKeys(channel)
+			if err != nil {
+				common.SysError(fmt.Sprintf("failed to get keys of channel #%d: %s", channel.Id, err.Error()))
+				continue
 			}
-
-			// disable channel
-			if isChannelEnabled && shouldBanChannel && channel.GetAutoBan() {
-				service.DisableChannel(channel.Id, channel.Name, err.Error())
-			}
-
-			// enable channel
-			if !isChannelEnabled && service.ShouldEnableChannel(err, openaiWithStatusErr, channel.Status) {
-				service.EnableChannel(channel.Id, channel.Name)
+			var totalMilliseconds int64
+			for _, channelKey := range channelKeys {
+				tik := time.Now()
+				err, openaiWithStatusErr := testChannel(channel, channelKey, "")
+				tok := time.Now()
+				milliseconds := tok.Sub(tik).Milliseconds()
+				totalMilliseconds += milliseconds
+
+				shouldBanChannel := false
+
+				// request error disables the channel
+				if openaiWithStatusErr != nil {
+					oaiErr := openaiWithStatusErr.Error
+					err = errors.New(fmt.Sprintf("type %s, httpCode %d, code %v, message %s", oaiErr.Type, openaiWithStatusErr.StatusCode, oaiErr.Code, oaiErr.Message))
+					shouldBanChannel = service.ShouldDisableChannel(channel.Type, openaiWithStatusErr)
+				}
+
+				if milliseconds > disableThreshold {
+					err = errors.New(fmt.Sprintf("响应时间 %.2fs 超过阈值 %.2fs", float64(milliseconds)/1000.0, float64(disableThreshold)/1000.0))
+					shouldBanChannel = true
+				}
+
+				// 多密钥渠道按密钥禁用与启用，密钥全部禁用或重新启用时渠道随之变化
+				if channelKey != nil {
+					isKeyEnabled := channelKey.Status == common.ChannelStatusEnabled
+					if isKeyEnabled && shouldBanChannel && channel.GetAutoBan() {
+						service.DisableChannelKey(channel.Id, channelKey.Id, channel.Name, err.Error())
+					}
+					if !isKeyEnabled && service.ShouldEnableChannel(err, openaiWithStatusErr, channelKey.Status) {
+						service.EnableChannelKey(channel.Id, channelKey.Id, channel.Name)
+					}
+					continue
+				}
+
+				isChannelEnabled := channel.Status == common.ChannelStatusEnabled
+				// disable channel
+				if isChannelEnabled && shouldBanChannel && channel.GetAutoBan() {
+					service.DisableChannel(channel.Id, channel.Name, err.Error())
+				}
+
+				// enable channel
+				if !isChannelEnabled && service.ShouldEnableChannel(err, openaiWithStatusErr, channel.Status) {
+					service.EnableChannel(channel.Id, channel.Name)
+				}
 			}
 
-			channel.UpdateResponseTime(milliseconds)
+			channel.UpdateResponseTime(totalMilliseconds / int64(len(channelKeys)))
 			time.Sleep(common.RequestInterval)
 		}
 
@@ -314,6 +314,10 @@ func AddChannel(c *gin.Context) {
 		}
 		keys = []string{channel.Key}
 	}
+	if channel.IsMultiKey() {
+		addMultiKeyChannel(c, &channel, keys)
+		return
+	}
 	channels := make([]model.Channel, 0, len(keys))
 	for _, key := range keys {
 		if key == "" {
@@ -539,6 +543,14 @@ func UpdateChannel(c *gin.Context) {
 		}
 	}
 	err = channel.Update()
+	if err == nil && channel.IsMultiKey() {
+		// 单密钥渠道切换为多密钥模式时，以现有密钥初始化密钥池
+		var count int64
+		count, err = model.CountEnabledChannelKeys(channel.Id)
+		if err == nil && count == 0 {
+			_, err = model.AddChannelKeys(channel.Id, strings.Split(channel.Key, "\n"))
+		}
+	}
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -701,3 +713,12 @@ func GetTagModels(c *gin.Context) {
 	})
 	return
 }
+
+// GetChannelHealth 获取当前节点上渠道在滑动窗口内的延迟、错误率及熔断状态
+func GetChannelHealth(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    model.GetAllChannelHealth(),
+	})
+}
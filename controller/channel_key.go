@@ -0,0 +1,208 @@
+package controller
+
+import (
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"one-api/service"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type channelKeyResponse struct {
+	Id           int    `json:"id"`
+	ChannelId    int    `json:"channel_id"`
+	Key          string `json:"key"`
+	Status       int    `json:"status"`
+	StatusReason string `json:"status_reason"`
+	StatusTime   int64  `json:"status_time"`
+	UsedCount    int    `json:"used_count"`
+	UsedQuota    int64  `json:"used_quota"`
+	CreatedTime  int64  `json:"created_time"`
+}
+
+type addChannelKeysRequest struct {
+	// Keys 多个密钥以换行分隔
+	Keys string `json:"keys"`
+}
+
+// addMultiKeyChannel 创建多密钥渠道，换行分隔的密钥全部加入同一渠道的密钥池
+func addMultiKeyChannel(c *gin.Context, channel *model.Channel, keys []string) {
+	if channel.MultiKeyMode != model.ChannelMultiKeyModeRoundRobin && channel.MultiKeyMode != model.ChannelMultiKeyModeRandom {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "不支持的多密钥模式: " + channel.MultiKeyMode,
+		})
+		return
+	}
+	validKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if key = strings.TrimSpace(key); key != "" {
+			validKeys = append(validKeys, key)
+		}
+	}
+	if len(validKeys) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "密钥不能为空",
+		})
+		return
+	}
+	// 渠道本身的 Key 保存第一个密钥，供余额查询等仅支持单密钥的功能使用
+	channel.Key = validKeys[0]
+	err := channel.Insert()
+	if err == nil {
+		_, err = model.AddChannelKeys(channel.Id, validKeys)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func getMultiKeyChannel(c *gin.Context) *model.Channel {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return nil
+	}
+	channel, err := model.GetChannelById(id, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return nil
+	}
+	if !channel.IsMultiKey() {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "该渠道不是多密钥渠道",
+		})
+		return nil
+	}
+	return channel
+}
+
+func GetChannelKeys(c *gin.Context) {
+	channel := getMultiKeyChannel(c)
+	if channel == nil {
+		return
+	}
+	keys, err := model.GetChannelKeys(channel.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	data := make([]channelKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		data = append(data, channelKeyResponse{
+			Id:           key.Id,
+			ChannelId:    key.ChannelId,
+			Key:          key.MaskedKey(),
+			Status:       key.Status,
+			StatusReason: key.StatusReason,
+			StatusTime:   key.StatusTime,
+			UsedCount:    key.UsedCount,
+			UsedQuota:    key.UsedQuota,
+			CreatedTime:  key.CreatedTime,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    data,
+	})
+}
+
+func AddChannelKeys(c *gin.Context) {
+	channel := getMultiKeyChannel(c)
+	if channel == nil {
+		return
+	}
+	req := addChannelKeysRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	count, err := model.AddChannelKeys(channel.Id, strings.Split(req.Keys, "\n"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	// 渠道因密钥全部失效被自动禁用时，添加新密钥后重新启用
+	if count > 0 && channel.Status == common.ChannelStatusAutoDisabled {
+		service.EnableChannel(channel.Id, channel.Name)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    count,
+	})
+}
+
+func DeleteChannelKey(c *gin.Context) {
+	channel := getMultiKeyChannel(c)
+	if channel == nil {
+		return
+	}
+	keyId, _ := strconv.Atoi(c.Param("key_id"))
+	if err := model.DeleteChannelKey(channel.Id, keyId); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func EnableChannelKey(c *gin.Context) {
+	channel := getMultiKeyChannel(c)
+	if channel == nil {
+		return
+	}
+	keyId, _ := strconv.Atoi(c.Param("key_id"))
+	service.EnableChannelKey(channel.Id, keyId, channel.Name)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func DisableChannelKey(c *gin.Context) {
+	channel := getMultiKeyChannel(c)
+	if channel == nil {
+		return
+	}
+	keyId, _ := strconv.Atoi(c.Param("key_id"))
+	service.ManuallyDisableChannelKey(channel.Id, keyId, channel.Name)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/model"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func openAIErrorResponse(c *gin.Context, statusCode int, code string, message string) {
+	c.JSON(statusCode, gin.H{
+		"error": dto.OpenAIError{
+			Message: common.MessageWithRequestId(message, c.GetString(common.RequestIdKey)),
+			Type:    "invalid_request_error",
+			Code:    code,
+		},
+	})
+}
+
+func file2OpenAIFile(file *model.File) dto.OpenAIFile {
+	return dto.OpenAIFile{
+		Id:        file.Id,
+		Object:    "file",
+		Bytes:     file.Bytes,
+		CreatedAt: file.CreatedAt,
+		ExpiresAt: optionalTime(file.ExpiresAt),
+		Filename:  file.Filename,
+		Purpose:   file.Purpose,
+		Status:    "processed",
+	}
+}
+
+// fileExpiresAt 新文件的过期时间，未配置保留天数时不过期
+func fileExpiresAt() int64 {
+	if constant.FileExpireDays <= 0 {
+		return 0
+	}
+	return common.GetTimestamp() + int64(constant.FileExpireDays)*24*3600
+}
+
+// UpdateFileGC 定期删除已过期的上传文件与批处理输出文件
+func UpdateFileGC() {
+	for {
+		time.Sleep(time.Hour)
+		for {
+			deleted, err := model.DeleteExpiredFiles(common.GetTimestamp(), 100)
+			if err != nil {
+				common.SysError("delete expired files failed: " + err.Error())
+			}
+			if deleted > 0 {
+				common.SysLog(fmt.Sprintf("deleted %d expired files", deleted))
+			}
+			if err != nil || deleted < 100 {
+				break
+			}
+		}
+	}
+}
+
+func getUserFileOrAbort(c *gin.Context) *model.File {
+	file, err := model.GetUserFileById(c.GetInt("id"), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			openAIErrorResponse(c, http.StatusNotFound, "file_not_found", fmt.Sprintf("No such File object: %s", c.Param("id")))
+		} else {
+			openAIErrorResponse(c, http.StatusInternalServerError, "get_file_failed", err.Error())
+		}
+		return nil
+	}
+	return file
+}
+
+func UploadFile(c *gin.Context) {
+	purpose := c.PostForm("purpose")
+	if purpose != model.FilePurposeBatch {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_purpose", "only purpose 'batch' is supported")
+		return
+	}
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_file", "field file is required")
+		return
+	}
+	maxBytes := int64(constant.BatchMaxFileMB) << 20
+	if fileHeader.Size > maxBytes {
+		openAIErrorResponse(c, http.StatusBadRequest, "file_too_large", fmt.Sprintf("file size exceeds %d MB", constant.BatchMaxFileMB))
+		return
+	}
+	f, err := fileHeader.Open()
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_file", err.Error())
+		return
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxBytes))
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_file", err.Error())
+		return
+	}
+	file := &model.File{
+		Id:        model.GenerateFileId(),
+		UserId:    c.GetInt("id"),
+		Bytes:     int64(len(data)),
+		Filename:  fileHeader.Filename,
+		Purpose:   purpose,
+		CreatedAt: common.GetTimestamp(),
+		ExpiresAt: fileExpiresAt(),
+	}
+	if err = file.Insert(data); err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "save_file_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, file2OpenAIFile(file))
+}
+
+func ListFiles(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 10000 {
+		limit = 10000
+	}
+	files, err := model.GetUserFiles(c.GetInt("id"), c.Query("purpose"), limit)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "list_files_failed", err.Error())
+		return
+	}
+	data := make([]dto.OpenAIFile, 0, len(files))
+	for _, file := range files {
+		data = append(data, file2OpenAIFile(file))
+	}
+	c.JSON(http.StatusOK, dto.OpenAIFileList{
+		Object: "list",
+		Data:   data,
+	})
+}
+
+func RetrieveFile(c *gin.Context) {
+	file := getUserFileOrAbort(c)
+	if file == nil {
+		return
+	}
+	c.JSON(http.StatusOK, file2OpenAIFile(file))
+}
+
+func RetrieveFileContent(c *gin.Context) {
+	file := getUserFileOrAbort(c)
+	if file == nil {
+		return
+	}
+	data, err := model.ReadFileContent(file.Id)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "read_file_failed", err.Error())
+		return
+	}
+	c.Data(http.StatusOK, "application/jsonl", data)
+}
+
+func DeleteFile(c *gin.Context) {
+	file := getUserFileOrAbort(c)
+	if file == nil {
+		return
+	}
+	if err := file.Delete(); err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "delete_file_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, dto.OpenAIFileDeleted{
+		Id:      file.Id,
+		Object:  "file",
+		Deleted: true,
+	})
+}
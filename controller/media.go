@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/service"
+	"one-api/setting/operation_setting"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UpdateMediaStoreGC 定期清理超过保留时间的媒体文件
+func UpdateMediaStoreGC() {
+	for {
+		interval := operation_setting.GetMediaStoreSetting().GCIntervalSeconds
+		if interval <= 0 {
+			interval = 600
+		}
+		time.Sleep(time.Duration(interval) * time.Second)
+		cleaned, err := service.CleanExpiredMedia(context.Background())
+		if err != nil {
+			common.SysError("clean expired media failed: " + err.Error())
+		}
+		if cleaned > 0 {
+			common.SysLog(fmt.Sprintf("cleaned %d expired media objects", cleaned))
+		}
+	}
+}
+
+// GetMediaObject 提供媒体存储中的文件下载，链接需携带有效的签名
+func GetMediaObject(c *gin.Context) {
+	key := c.Param("key")
+	if !service.VerifyMediaSignature(key, c.Query("expires"), c.Query("signature")) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "invalid_media_signature",
+		})
+		return
+	}
+	object, reader, err := service.OpenMediaObject(c.Request.Context(), key)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "media_not_found",
+		})
+		return
+	}
+	defer reader.Close()
+	c.Header("Content-Type", object.ContentType)
+	c.Header("Content-Length", strconv.FormatInt(object.Size, 10))
+	c.Header("Cache-Control", "private, max-age=3600")
+	c.Status(http.StatusOK)
+	if _, err = io.Copy(c.Writer, reader); err != nil {
+		common.LogError(c, fmt.Sprintf("copy media %s failed: %s", key, err.Error()))
+	}
+}
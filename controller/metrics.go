@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMetrics 输出 Prometheus 指标，渠道状态和任务队列深度在每次抓取时从数据库刷新。
+// 配置了 METRICS_TOKEN 时校验 Bearer 令牌，否则由路由上的 AdminAuth 校验管理员身份
+func GetMetrics(c *gin.Context) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if common.MetricsToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(common.MetricsToken)) != 1 {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	refreshMetricGauges()
+	common.MetricsHandler().ServeHTTP(c.Writer, c.Request)
+}
+
+func refreshMetricGauges() {
+	if channels, err := model.GetAllChannelStatuses(); err != nil {
+		common.SysError("failed to get channel statuses for metrics: " + err.Error())
+	} else {
+		common.ResetChannelMetrics()
+		for _, channel := range channels {
+			common.SetChannelStatusMetric(channel.Id, channel.Name, channel.Type, channel.Status)
+		}
+	}
+	if depths, err := model.CountUnfinishedTasks(); err != nil {
+		common.SysError("failed to count unfinished tasks for metrics: " + err.Error())
+	} else {
+		common.ResetTaskQueueMetrics()
+		for _, depth := range depths {
+			common.SetTaskQueueDepthMetric(depth.Platform, depth.Status, depth.Count)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"io"
@@ -17,158 +18,125 @@ import (
 	"time"
 )
 
-func UpdateMidjourneyTaskBulk() {
-	//imageModel := "midjourney"
-	ctx := context.TODO()
-	for {
-		time.Sleep(time.Duration(15) * time.Second)
+func UpdateMidjourneyTaskAll(ctx context.Context, taskChannelM map[int][]string, taskM map[string]*model.Task) error {
+	for channelId, taskIds := range taskChannelM {
+		err := updateMidjourneyTaskAll(ctx, channelId, taskIds, taskM)
+		if err != nil {
+			common.LogError(ctx, fmt.Sprintf("渠道 #%d 更新 Midjourney 任务失败: %s", channelId, err.Error()))
+		}
+	}
+	return nil
+}
 
-		tasks := model.GetAllUnFinishTasks()
-		if len(tasks) == 0 {
-			continue
+func updateMidjourneyTaskAll(ctx context.Context, channelId int, taskIds []string, taskM map[string]*model.Task) error {
+	common.LogInfo(ctx, fmt.Sprintf("渠道 #%d 未完成的任务有: %d", channelId, len(taskIds)))
+	if len(taskIds) == 0 {
+		return nil
+	}
+	midjourneyChannel, err := model.CacheGetChannel(channelId)
+	if err != nil {
+		common.LogError(ctx, fmt.Sprintf("CacheGetChannel: %v", err))
+		failReason := fmt.Sprintf("获取渠道信息失败，请联系管理员，渠道ID：%d", channelId)
+		err = model.TaskBulkUpdate(taskIds, map[string]any{
+			"fail_reason": failReason,
+			"status":      "FAILURE",
+			"progress":    "100%",
+		})
+		if err != nil {
+			common.LogInfo(ctx, fmt.Sprintf("UpdateMidjourneyTask error: %v", err))
+		} else {
+			finishFailedTasks(ctx, taskIds, taskM, failReason)
 		}
+		return err
+	}
+	requestUrl := fmt.Sprintf("%s/mj/task/list-by-condition", *midjourneyChannel.BaseURL)
 
-		common.LogInfo(ctx, fmt.Sprintf("检测到未完成的任务数有: %v", len(tasks)))
-		taskChannelM := make(map[int][]string)
-		taskM := make(map[string]*model.Midjourney)
-		nullTaskIds := make([]int, 0)
-		for _, task := range tasks {
-			if task.MjId == "" {
-				// 统计失败的未完成任务
-				nullTaskIds = append(nullTaskIds, task.Id)
-				continue
-			}
-			taskM[task.MjId] = task
-			taskChannelM[task.ChannelId] = append(taskChannelM[task.ChannelId], task.MjId)
+	body, _ := json.Marshal(map[string]any{
+		"ids": taskIds,
+	})
+	// 设置超时时间
+	timeout := time.Second * 15
+	reqCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	// 使用带有超时的 context 创建新的请求
+	req, err := http.NewRequestWithContext(reqCtx, "POST", requestUrl, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// 同一批次的任务由 updateChannelTasks 按密钥分组，使用第一个任务的密钥即可
+	req.Header.Set("mj-api-secret", taskChannelKey(midjourneyChannel, taskM[taskIds[0]]))
+	resp, err := service.GetHttpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("get task status code: %d", resp.StatusCode)
+	}
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var responseItems []dto.MidjourneyDto
+	err = json.Unmarshal(responseBody, &responseItems)
+	if err != nil {
+		common.LogError(ctx, fmt.Sprintf("Get Task parse body error2: %v, body: %s", err, string(responseBody)))
+		return err
+	}
+
+	for _, responseItem := range responseItems {
+		task, ok := taskM[responseItem.MjId]
+		if !ok {
+			continue
 		}
-		if len(nullTaskIds) > 0 {
-			err := model.MjBulkUpdateByTaskIds(nullTaskIds, map[string]any{
-				"status":   "FAILURE",
-				"progress": "100%",
-			})
-			if err != nil {
-				common.LogError(ctx, fmt.Sprintf("Fix null mj_id task error: %v", err))
-			} else {
-				common.LogInfo(ctx, fmt.Sprintf("Fix null mj_id task success: %v", nullTaskIds))
-			}
+		midjourney := model.MidjourneyFromTask(task)
+
+		useTime := (time.Now().UnixNano() / int64(time.Millisecond)) - midjourney.SubmitTime
+		// 如果时间超过一小时，且进度不是100%，则认为任务失败
+		if useTime > 3600000 && midjourney.Progress != "100%" {
+			responseItem.FailReason = "上游任务超时（超过1小时）"
+			responseItem.Status = "FAILURE"
 		}
-		if len(taskChannelM) == 0 {
+		if !checkMjTaskNeedUpdate(midjourney, responseItem) {
 			continue
 		}
-
-		for channelId, taskIds := range taskChannelM {
-			common.LogInfo(ctx, fmt.Sprintf("渠道 #%d 未完成的任务有: %d", channelId, len(taskIds)))
-			if len(taskIds) == 0 {
-				continue
-			}
-			midjourneyChannel, err := model.CacheGetChannel(channelId)
-			if err != nil {
-				common.LogError(ctx, fmt.Sprintf("CacheGetChannel: %v", err))
-				err := model.MjBulkUpdate(taskIds, map[string]any{
-					"fail_reason": fmt.Sprintf("获取渠道信息失败，请联系管理员，渠道ID：%d", channelId),
-					"status":      "FAILURE",
-					"progress":    "100%",
-				})
-				if err != nil {
-					common.LogInfo(ctx, fmt.Sprintf("UpdateMidjourneyTask error: %v", err))
-				}
-				continue
-			}
-			requestUrl := fmt.Sprintf("%s/mj/task/list-by-condition", *midjourneyChannel.BaseURL)
-
-			body, _ := json.Marshal(map[string]any{
-				"ids": taskIds,
-			})
-			req, err := http.NewRequest("POST", requestUrl, bytes.NewBuffer(body))
-			if err != nil {
-				common.LogError(ctx, fmt.Sprintf("Get Task error: %v", err))
-				continue
-			}
-			// 设置超时时间
-			timeout := time.Second * 15
-			ctx, cancel := context.WithTimeout(context.Background(), timeout)
-			// 使用带有超时的 context 创建新的请求
-			req = req.WithContext(ctx)
-			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("mj-api-secret", midjourneyChannel.Key)
-			resp, err := service.GetHttpClient().Do(req)
-			if err != nil {
-				common.LogError(ctx, fmt.Sprintf("Get Task Do req error: %v", err))
-				continue
-			}
-			if resp.StatusCode != http.StatusOK {
-				common.LogError(ctx, fmt.Sprintf("Get Task status code: %d", resp.StatusCode))
-				continue
-			}
-			responseBody, err := io.ReadAll(resp.Body)
-			if err != nil {
-				common.LogError(ctx, fmt.Sprintf("Get Task parse body error: %v", err))
-				continue
-			}
-			var responseItems []dto.MidjourneyDto
-			err = json.Unmarshal(responseBody, &responseItems)
-			if err != nil {
-				common.LogError(ctx, fmt.Sprintf("Get Task parse body error2: %v, body: %s", err, string(responseBody)))
-				continue
-			}
-			resp.Body.Close()
-			req.Body.Close()
-			cancel()
-
-			for _, responseItem := range responseItems {
-				task := taskM[responseItem.MjId]
-
-				useTime := (time.Now().UnixNano() / int64(time.Millisecond)) - task.SubmitTime
-				// 如果时间超过一小时，且进度不是100%，则认为任务失败
-				if useTime > 3600000 && task.Progress != "100%" {
-					responseItem.FailReason = "上游任务超时（超过1小时）"
-					responseItem.Status = "FAILURE"
-				}
-				if !checkMjTaskNeedUpdate(task, responseItem) {
-					continue
-				}
-				task.Code = 1
-				task.Progress = responseItem.Progress
-				task.PromptEn = responseItem.PromptEn
-				task.State = responseItem.State
-				task.SubmitTime = responseItem.SubmitTime
-				task.StartTime = responseItem.StartTime
-				task.FinishTime = responseItem.FinishTime
-				task.ImageUrl = responseItem.ImageUrl
-				task.Status = responseItem.Status
-				task.FailReason = responseItem.FailReason
-				if responseItem.Properties != nil {
-					propertiesStr, _ := json.Marshal(responseItem.Properties)
-					task.Properties = string(propertiesStr)
-				}
-				if responseItem.Buttons != nil {
-					buttonStr, _ := json.Marshal(responseItem.Buttons)
-					task.Buttons = string(buttonStr)
-				}
-				shouldReturnQuota := false
-				if (task.Progress != "100%" && responseItem.FailReason != "") || (task.Progress == "100%" && task.Status == "FAILURE") {
-					common.LogInfo(ctx, task.MjId+" 构建失败，"+task.FailReason)
-					task.Progress = "100%"
-					if task.Quota != 0 {
-						shouldReturnQuota = true
-					}
-				}
-				err = task.Update()
-				if err != nil {
-					common.LogError(ctx, "UpdateMidjourneyTask task error: "+err.Error())
-				} else {
-					if shouldReturnQuota {
-						err = model.IncreaseUserQuota(task.UserId, task.Quota, false)
-						if err != nil {
-							common.LogError(ctx, "fail to increase user quota: "+err.Error())
-						}
-						logContent := fmt.Sprintf("构图失败 %s，补偿 %s", task.MjId, common.LogQuota(task.Quota))
-						model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
-					}
-				}
+		midjourney.Code = 1
+		midjourney.Progress = responseItem.Progress
+		midjourney.PromptEn = responseItem.PromptEn
+		midjourney.State = responseItem.State
+		midjourney.SubmitTime = responseItem.SubmitTime
+		midjourney.StartTime = responseItem.StartTime
+		midjourney.FinishTime = responseItem.FinishTime
+		midjourney.ImageUrl = responseItem.ImageUrl
+		midjourney.Status = responseItem.Status
+		midjourney.FailReason = responseItem.FailReason
+		if responseItem.Properties != nil {
+			propertiesStr, _ := json.Marshal(responseItem.Properties)
+			midjourney.Properties = string(propertiesStr)
+		}
+		if responseItem.Buttons != nil {
+			buttonStr, _ := json.Marshal(responseItem.Buttons)
+			midjourney.Buttons = string(buttonStr)
+		}
+		failed := false
+		if (midjourney.Progress != "100%" && responseItem.FailReason != "") || (midjourney.Progress == "100%" && midjourney.Status == "FAILURE") {
+			common.LogInfo(ctx, midjourney.MjId+" 构建失败，"+midjourney.FailReason)
+			midjourney.Progress = "100%"
+			midjourney.Status = "FAILURE"
+			failed = true
+		}
+		midjourney.ApplyToTask(task)
+		err = service.UpdateFinishedTask(ctx, task)
+		if err != nil {
+			if !errors.Is(err, service.ErrTaskAlreadyFinished) {
+				common.LogError(ctx, "UpdateMidjourneyTask task error: "+err.Error())
 			}
+		} else if failed {
+			service.RefundTaskQuota(ctx, task)
 		}
 	}
+	return nil
 }
 
 func checkMjTaskNeedUpdate(oldTask *model.Midjourney, newTask dto.MidjourneyDto) bool {
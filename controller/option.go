@@ -7,6 +7,7 @@ import (
 	"one-api/model"
 	"one-api/setting"
 	"one-api/setting/console_setting"
+	"one-api/setting/operation_setting"
 	"one-api/setting/ratio_setting"
 	"one-api/setting/system_setting"
 	"strings"
@@ -18,7 +19,7 @@ func GetOptions(c *gin.Context) {
 	var options []*model.Option
 	common.OptionMapRWMutex.Lock()
 	for k, v := range common.OptionMap {
-		if strings.HasSuffix(k, "Token") || strings.HasSuffix(k, "Secret") || strings.HasSuffix(k, "Key") {
+		if isSensitiveOptionKey(k) {
 			continue
 		}
 		options = append(options, &model.Option{
@@ -35,6 +36,12 @@ func GetOptions(c *gin.Context) {
 	return
 }
 
+// isSensitiveOptionKey 判断是否为令牌、密钥等敏感配置，不区分大小写，同时匹配 SMTPToken 与 xxx_setting.s3_secret_key 两种命名
+func isSensitiveOptionKey(key string) bool {
+	key = strings.ToLower(key)
+	return strings.HasSuffix(key, "token") || strings.HasSuffix(key, "secret") || strings.HasSuffix(key, "key")
+}
+
 func UpdateOption(c *gin.Context) {
 	var option model.Option
 	err := json.NewDecoder(c.Request.Body).Decode(&option)
@@ -62,6 +69,23 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "body_log_setting.enabled", "body_log_setting.encrypt":
+		encrypt := operation_setting.GetBodyLogSetting().Encrypt || option.Key == "body_log_setting.encrypt"
+		if option.Value == "true" && encrypt && common.BodyLogSecret == "" {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无法启用加密的请求内容记录，请先设置 BODY_LOG_SECRET（或 CRYPTO_SECRET、SESSION_SECRET）环境变量，否则重启后已有记录将无法解密！",
+			})
+			return
+		}
+	case "media_store_setting.enabled":
+		if option.Value == "true" && common.MediaSignSecret == "" {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无法启用媒体存储，请先设置 MEDIA_SIGN_SECRET（或 CRYPTO_SECRET、SESSION_SECRET）环境变量，否则重启后已签发的链接将全部失效！",
+			})
+			return
+		}
 	case "LinuxDOOAuthEnabled":
 		if option.Value == "true" && common.LinuxDOClientId == "" {
 			c.JSON(http.StatusOK, gin.H{
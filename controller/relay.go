@@ -13,14 +13,18 @@ import (
 	"one-api/middleware"
 	"one-api/model"
 	"one-api/relay"
+	relaycommon "one-api/relay/common"
 	"one-api/relay/constant"
 	relayconstant "one-api/relay/constant"
 	"one-api/relay/helper"
 	"one-api/service"
+	"one-api/setting/model_setting"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func relayHandler(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
@@ -82,24 +86,50 @@ func Relay(c *gin.Context) {
 	originalModel := c.GetString("original_model")
 	var openaiErr *dto.OpenAIErrorWithStatusCode
 
-	for i := 0; i <= common.RetryTimes; i++ {
-		channel, err := getChannel(c, group, originalModel, i)
-		if err != nil {
-			common.LogError(c, err.Error())
-			openaiErr = service.OpenAIErrorWrapperLocal(err, "get_channel_failed", http.StatusInternalServerError)
-			break
+	fallbackModels := model_setting.GetFallbackModels(originalModel)
+	// failedModel 产生当前错误的模型，切换模型失败时跳过的模型不会覆盖它
+	failedModel := ""
+	for idx, modelName := range fallbackModels {
+		if idx > 0 {
+			if !shouldFallback(c, openaiErr, failedModel) {
+				break
+			}
+			if err := switchFallbackModel(c, group, originalModel, modelName); err != nil {
+				common.LogError(c, err.Error())
+				continue
+			}
 		}
-
-		openaiErr = relayRequest(c, relayMode, channel)
-
-		if openaiErr == nil {
-			return // 成功处理请求，直接返回
-		}
-
-		go processChannelError(c, channel.Id, channel.Type, channel.Name, channel.GetAutoBan(), openaiErr)
-
-		if !shouldRetry(c, openaiErr, common.RetryTimes-i) {
-			break
+		failedModel = modelName
+		retryTimes := model_setting.GetFallbackRetryTimes(modelName, common.RetryTimes)
+		for i := 0; i <= retryTimes; i++ {
+			channel, err := getChannel(c, group, modelName, i)
+			if err != nil {
+				common.LogError(c, err.Error())
+				openaiErr = service.OpenAIErrorWrapperLocal(err, "get_channel_failed", http.StatusInternalServerError)
+				break
+			}
+
+			endSpan := common.StartSpan(c, "relay_attempt", relayAttemptAttributes(channel, modelName, i)...)
+			openaiErr = relayRequest(c, relayMode, channel)
+			if openaiErr != nil {
+				common.SetSpanError(c, openaiErr.Error.Message)
+			}
+			endSpan()
+			channel = servedChannel(c, channel)
+
+			if openaiErr == nil {
+				updateSessionAffinity(c, channel.Id)
+				recordChannelKeyUsed(c)
+				return // 成功处理请求，直接返回
+			}
+
+			go processChannelError(c, channel.Id, c.GetInt(constant2.ContextKeyChannelKeyId), channel.Type, channel.Name, channel.GetAutoBan(), openaiErr)
+			common.RecordUpstreamError(channel.Id, upstreamErrorClass(openaiErr.StatusCode, openaiErr.LocalError))
+
+			if !shouldRetry(c, openaiErr, retryTimes-i) {
+				break
+			}
+			common.RecordRelayRetry(modelName, group)
 		}
 	}
 	useChannel := c.GetStringSlice("use_channel")
@@ -157,14 +187,17 @@ func WssRelay(c *gin.Context) {
 		openaiErr = wssRequest(c, ws, relayMode, channel)
 
 		if openaiErr == nil {
+			recordChannelKeyUsed(c)
 			return // 成功处理请求，直接返回
 		}
 
-		go processChannelError(c, channel.Id, channel.Type, channel.Name, channel.GetAutoBan(), openaiErr)
+		go processChannelError(c, channel.Id, c.GetInt(constant2.ContextKeyChannelKeyId), channel.Type, channel.Name, channel.GetAutoBan(), openaiErr)
+		common.RecordUpstreamError(channel.Id, upstreamErrorClass(openaiErr.StatusCode, openaiErr.LocalError))
 
 		if !shouldRetry(c, openaiErr, common.RetryTimes-i) {
 			break
 		}
+		common.RecordRelayRetry(originalModel, group)
 	}
 	useChannel := c.GetStringSlice("use_channel")
 	if len(useChannel) > 1 {
@@ -187,27 +220,60 @@ func RelayClaude(c *gin.Context) {
 	group := c.GetString("group")
 	originalModel := c.GetString("original_model")
 	var claudeErr *dto.ClaudeErrorWithStatusCode
-
-	for i := 0; i <= common.RetryTimes; i++ {
-		channel, err := getChannel(c, group, originalModel, i)
-		if err != nil {
-			common.LogError(c, err.Error())
-			claudeErr = service.ClaudeErrorWrapperLocal(err, "get_channel_failed", http.StatusInternalServerError)
-			break
-		}
-
-		claudeErr = claudeRequest(c, channel)
-
-		if claudeErr == nil {
-			return // 成功处理请求，直接返回
+	// fallbackErr 保留错误码与是否本地错误，用于判断是否降级
+	var fallbackErr *dto.OpenAIErrorWithStatusCode
+
+	fallbackModels := model_setting.GetFallbackModels(originalModel)
+	// failedModel 产生当前错误的模型，切换模型失败时跳过的模型不会覆盖它
+	failedModel := ""
+	for idx, modelName := range fallbackModels {
+		if idx > 0 {
+			if !shouldFallback(c, fallbackErr, failedModel) {
+				break
+			}
+			if err := switchFallbackModel(c, group, originalModel, modelName); err != nil {
+				common.LogError(c, err.Error())
+				continue
+			}
 		}
-
-		openaiErr := service.ClaudeErrorToOpenAIError(claudeErr)
-
-		go processChannelError(c, channel.Id, channel.Type, channel.Name, channel.GetAutoBan(), openaiErr)
-
-		if !shouldRetry(c, openaiErr, common.RetryTimes-i) {
-			break
+		failedModel = modelName
+		retryTimes := model_setting.GetFallbackRetryTimes(modelName, common.RetryTimes)
+		for i := 0; i <= retryTimes; i++ {
+			channel, err := getChannel(c, group, modelName, i)
+			if err != nil {
+				common.LogError(c, err.Error())
+				claudeErr = service.ClaudeErrorWrapperLocal(err, "get_channel_failed", http.StatusInternalServerError)
+				fallbackErr = service.OpenAIErrorWrapperLocal(err, "get_channel_failed", http.StatusInternalServerError)
+				break
+			}
+
+			endSpan := common.StartSpan(c, "relay_attempt", relayAttemptAttributes(channel, modelName, i)...)
+			claudeErr = claudeRequest(c, channel)
+			if claudeErr != nil {
+				common.SetSpanError(c, claudeErr.Error.Message)
+			}
+			endSpan()
+
+			if claudeErr == nil {
+				updateSessionAffinity(c, channel.Id)
+				recordChannelKeyUsed(c)
+				return // 成功处理请求，直接返回
+			}
+
+			openaiErr := service.ClaudeErrorToOpenAIError(claudeErr)
+			fallbackErr = &dto.OpenAIErrorWithStatusCode{
+				Error:      openaiErr.Error,
+				StatusCode: openaiErr.StatusCode,
+				LocalError: claudeErr.LocalError,
+			}
+
+			go processChannelError(c, channel.Id, c.GetInt(constant2.ContextKeyChannelKeyId), channel.Type, channel.Name, channel.GetAutoBan(), openaiErr)
+			common.RecordUpstreamError(channel.Id, upstreamErrorClass(fallbackErr.StatusCode, fallbackErr.LocalError))
+
+			if !shouldRetry(c, openaiErr, retryTimes-i) {
+				break
+			}
+			common.RecordRelayRetry(modelName, group)
 		}
 	}
 	useChannel := c.GetStringSlice("use_channel")
@@ -225,11 +291,35 @@ func RelayClaude(c *gin.Context) {
 	}
 }
 
+func relayAttemptAttributes(channel *model.Channel, modelName string, attempt int) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Int("relay.attempt", attempt),
+		attribute.Int("channel.id", channel.Id),
+		attribute.String("model", modelName),
+	}
+}
+
 func relayRequest(c *gin.Context, relayMode int, channel *model.Channel) *dto.OpenAIErrorWithStatusCode {
 	addUsedChannel(c, channel.Id)
 	requestBody, _ := common.GetRequestBody(c)
 	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
-	return relayHandler(c, relayMode)
+	startTime := time.Now()
+	openaiErr := relayHandler(c, relayMode)
+	recordChannelResult(c, servedChannel(c, channel).Id, startTime, openaiErr)
+	return openaiErr
+}
+
+// servedChannel 对冲请求胜出时上下文中已切换为对冲渠道，返回实际服务请求的渠道，用于统计、错误处理与会话绑定
+func servedChannel(c *gin.Context, channel *model.Channel) *model.Channel {
+	channelId := c.GetInt("channel_id")
+	if channelId == 0 || channelId == channel.Id {
+		return channel
+	}
+	served, err := model.CacheGetChannel(channelId)
+	if err != nil {
+		return channel
+	}
+	return served
 }
 
 func wssRequest(c *gin.Context, ws *websocket.Conn, relayMode int, channel *model.Channel) *dto.OpenAIErrorWithStatusCode {
@@ -243,7 +333,57 @@ func claudeRequest(c *gin.Context, channel *model.Channel) *dto.ClaudeErrorWithS
 	addUsedChannel(c, channel.Id)
 	requestBody, _ := common.GetRequestBody(c)
 	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
-	return relay.ClaudeHelper(c)
+	startTime := time.Now()
+	claudeErr := relay.ClaudeHelper(c)
+	if claudeErr != nil {
+		openaiErr := service.ClaudeErrorToOpenAIError(claudeErr)
+		openaiErr.LocalError = claudeErr.LocalError
+		recordChannelResult(c, channel.Id, startTime, openaiErr)
+	} else {
+		recordChannelResult(c, channel.Id, startTime, nil)
+	}
+	return claudeErr
+}
+
+// recordChannelResult 记录渠道请求结果供自适应负载均衡使用，本地错误与请求本身的错误不计入渠道错误
+func recordChannelResult(c *gin.Context, channelId int, startTime time.Time, openaiErr *dto.OpenAIErrorWithStatusCode) {
+	if openaiErr != nil {
+		if openaiErr.LocalError {
+			return
+		}
+		switch {
+		case openaiErr.StatusCode >= 500, openaiErr.StatusCode == http.StatusTooManyRequests,
+			openaiErr.StatusCode == http.StatusUnauthorized, openaiErr.StatusCode == http.StatusForbidden:
+			model.RecordChannelResult(channelId, false, time.Since(startTime), 0)
+		}
+		return
+	}
+	// 命中响应缓存的请求未访问渠道，不计入渠道统计
+	if _, ok := c.Get(constant2.ContextKeyResponseCacheHit); ok {
+		return
+	}
+	var ttft time.Duration
+	if info, ok := c.Get(constant2.ContextKeyRelayInfo); ok {
+		if relayInfo, ok := info.(*relaycommon.RelayInfo); ok && relayInfo.IsStream && relayInfo.HasSendResponse() {
+			ttft = relayInfo.FirstResponseTime.Sub(startTime)
+		}
+	}
+	model.RecordChannelResult(channelId, true, time.Since(startTime), ttft)
+}
+
+// updateSessionAffinity 请求成功后将会话绑定到实际服务的渠道并续期，重试或降级后会话会跟随新的渠道
+func updateSessionAffinity(c *gin.Context, channelId int) {
+	if key := c.GetString(constant2.ContextKeySessionAffinityKey); key != "" {
+		model.SetSessionAffinity(key, channelId)
+	}
+}
+
+// recordChannelKeyUsed 请求成功后累计实际服务的密钥使用次数，失败、重试、对冲落选的尝试以及命中响应缓存的请求均不计入
+func recordChannelKeyUsed(c *gin.Context) {
+	if _, ok := c.Get(constant2.ContextKeyResponseCacheHit); ok {
+		return
+	}
+	model.UpdateChannelKeyUsedCount(c.GetInt(constant2.ContextKeyChannelKeyId), 1)
 }
 
 func addUsedChannel(c *gin.Context, channelId int) {
@@ -270,10 +410,57 @@ func getChannel(c *gin.Context, group, originalModel string, retryCount int) (*m
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("获取重试渠道失败: %s", err.Error()))
 	}
-	middleware.SetupContextForSelectedChannel(c, channel, originalModel)
+	if err = middleware.SetupContextForSelectedChannel(c, channel, originalModel); err != nil {
+		return nil, err
+	}
 	return channel, nil
 }
 
+// switchFallbackModel 切换到降级链中的下一个模型：重新选择渠道，计费与日志均按实际服务的模型处理
+func switchFallbackModel(c *gin.Context, group, originalModel, modelName string) error {
+	if !middleware.IsTokenModelAllowed(c, modelName) {
+		return errors.New(fmt.Sprintf("降级模型 %s 不在令牌可用模型范围内", modelName))
+	}
+	channel, _, err := model.CacheGetRandomSatisfiedChannel(c, group, modelName, 0)
+	if err != nil {
+		return errors.New(fmt.Sprintf("获取降级模型 %s 的渠道失败: %s", modelName, err.Error()))
+	}
+	if channel == nil {
+		return errors.New(fmt.Sprintf("降级模型 %s 无可用渠道", modelName))
+	}
+	common.LogInfo(c, fmt.Sprintf("model %s failed, fallback to %s (channel #%d)", c.GetString("original_model"), modelName, channel.Id))
+	if err = middleware.SetupContextForSelectedChannel(c, channel, modelName); err != nil {
+		return errors.New(fmt.Sprintf("降级模型 %s 的渠道 #%d 不可用: %s", modelName, channel.Id, err.Error()))
+	}
+	c.Set(constant2.ContextKeyFallbackFrom, originalModel)
+	c.Writer.Header().Set("X-New-Api-Served-Model", modelName)
+	return nil
+}
+
+// shouldFallback 判断当前模型的所有渠道失败后是否降级到下一个模型
+func shouldFallback(c *gin.Context, openaiErr *dto.OpenAIErrorWithStatusCode, modelName string) bool {
+	if openaiErr == nil {
+		return false
+	}
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return false
+	}
+	// 本地错误（如额度不足、请求无效）不降级，但当前模型已无可用渠道时需要降级
+	if openaiErr.LocalError {
+		return openaiErr.Error.Code == "get_channel_failed"
+	}
+	statusCodes := model_setting.GetFallbackStatusCodes(modelName)
+	if len(statusCodes) > 0 {
+		for _, code := range statusCodes {
+			if code == openaiErr.StatusCode {
+				return true
+			}
+		}
+		return false
+	}
+	return shouldRetry(c, openaiErr, 1)
+}
+
 func shouldRetry(c *gin.Context, openaiErr *dto.OpenAIErrorWithStatusCode, retryTimes int) bool {
 	if openaiErr == nil {
 		return false
@@ -317,12 +504,37 @@ func shouldRetry(c *gin.Context, openaiErr *dto.OpenAIErrorWithStatusCode, retry
 	return true
 }
 
-func processChannelError(c *gin.Context, channelId int, channelType int, channelName string, autoBan bool, err *dto.OpenAIErrorWithStatusCode) {
+// upstreamErrorClass 将转发错误按来源和状态码归类，用于上游错误指标
+func upstreamErrorClass(statusCode int, localError bool) string {
+	switch {
+	case localError:
+		return "local"
+	case statusCode == http.StatusTooManyRequests:
+		return "rate_limit"
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return "auth"
+	case statusCode == http.StatusRequestTimeout || statusCode == http.StatusGatewayTimeout:
+		return "timeout"
+	case statusCode >= 500:
+		return "server_error"
+	case statusCode >= 400:
+		return "client_error"
+	default:
+		return "other"
+	}
+}
+
+func processChannelError(c *gin.Context, channelId int, channelKeyId int, channelType int, channelName string, autoBan bool, err *dto.OpenAIErrorWithStatusCode) {
 	// 不要使用context获取渠道信息，异步处理时可能会出现渠道信息不一致的情况
 	// do not use context to get channel info, there may be inconsistent channel info when processing asynchronously
 	common.LogError(c, fmt.Sprintf("relay error (channel #%d, status code: %d): %s", channelId, err.StatusCode, err.Error.Message))
 	if service.ShouldDisableChannel(channelType, err) && autoBan {
-		service.DisableChannel(channelId, channelName, err.Error.Message)
+		// 多密钥渠道只禁用出错的密钥
+		if channelKeyId != 0 {
+			service.DisableChannelKey(channelId, channelKeyId, channelName, err.Error.Message)
+		} else {
+			service.DisableChannel(channelId, channelName, err.Error.Message)
+		}
 	}
 }
 
@@ -356,7 +568,9 @@ func RelayMidjourney(c *gin.Context) {
 		})
 		channelId := c.GetInt("channel_id")
 		common.LogError(c, fmt.Sprintf("relay error (channel #%d, status code %d): %s", channelId, statusCode, fmt.Sprintf("%s %s", err.Description, err.Result)))
+		return
 	}
+	recordChannelKeyUsed(c)
 }
 
 func RelayNotImplemented(c *gin.Context) {
@@ -395,6 +609,8 @@ func RelayTask(c *gin.Context) {
 		retryTimes = 0
 	}
 	for i := 0; shouldRetryTaskRelay(c, channelId, taskErr, retryTimes) && i < retryTimes; i++ {
+		common.RecordUpstreamError(channelId, upstreamErrorClass(taskErr.StatusCode, taskErr.LocalError))
+		common.RecordRelayRetry(originalModel, group)
 		channel, _, err := model.CacheGetRandomSatisfiedChannel(c, group, originalModel, i)
 		if err != nil {
 			common.LogError(c, fmt.Sprintf("CacheGetRandomSatisfiedChannel failed: %s", err.Error()))
@@ -405,7 +621,10 @@ func RelayTask(c *gin.Context) {
 		useChannel = append(useChannel, fmt.Sprintf("%d", channelId))
 		c.Set("use_channel", useChannel)
 		common.LogInfo(c, fmt.Sprintf("using channel #%d to retry (remain times %d)", channel.Id, i))
-		middleware.SetupContextForSelectedChannel(c, channel, originalModel)
+		if err = middleware.SetupContextForSelectedChannel(c, channel, originalModel); err != nil {
+			common.LogError(c, err.Error())
+			break
+		}
 
 		requestBody, err := common.GetRequestBody(c)
 		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
@@ -421,14 +640,22 @@ func RelayTask(c *gin.Context) {
 			taskErr.Message = "当前分组上游负载已饱和，请稍后再试"
 		}
 		c.JSON(taskErr.StatusCode, taskErr)
+		return
 	}
+	recordChannelKeyUsed(c)
 }
 
 func taskRelayHandler(c *gin.Context, relayMode int) *dto.TaskError {
 	var err *dto.TaskError
 	switch relayMode {
-	case relayconstant.RelayModeSunoFetch, relayconstant.RelayModeSunoFetchByID, relayconstant.RelayModeKlingFetchByID:
+	case relayconstant.RelayModeSunoFetch, relayconstant.RelayModeSunoFetchByID, relayconstant.RelayModeKlingFetchByID, relayconstant.RelayModeTaskFetchByID:
 		err = relay.RelayTaskFetch(c, relayMode)
+	case relayconstant.RelayModeTaskCancel:
+		err = relay.RelayTaskCancel(c, relayMode)
+	case relayconstant.RelayModeVideoSubmit:
+		err = relay.RelayVideoSubmit(c, relayMode)
+	case relayconstant.RelayModeVideoFetchByID, relayconstant.RelayModeVideoList, relayconstant.RelayModeVideoContent, relayconstant.RelayModeVideoCancel:
+		err = relay.RelayVideoFetch(c, relayMode)
 	default:
 		err = relay.RelayTaskSubmit(c, relayMode)
 	}
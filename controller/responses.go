@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/model"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 仅能查询和删除网关模拟 Responses API 时保存的响应，原生渠道生成的响应保存在上游
+
+// UpdateResponseGC 定期清理超过保留天数的已保存响应
+func UpdateResponseGC() {
+	for {
+		time.Sleep(time.Hour)
+		if constant.ResponseExpireDays <= 0 {
+			continue
+		}
+		deleted, err := model.DeleteResponsesBefore(common.GetTimestamp()-int64(constant.ResponseExpireDays)*86400, 1000)
+		if err != nil {
+			common.SysError("delete expired responses failed: " + err.Error())
+		}
+		if deleted > 0 {
+			common.SysLog(fmt.Sprintf("deleted %d expired responses", deleted))
+		}
+	}
+}
+
+func getUserResponseOrAbort(c *gin.Context) *model.Response {
+	response, err := model.GetUserResponseById(c.GetInt("id"), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			openAIErrorResponse(c, http.StatusNotFound, "response_not_found", fmt.Sprintf("Response with id '%s' not found.", c.Param("id")))
+		} else {
+			openAIErrorResponse(c, http.StatusInternalServerError, "get_response_failed", err.Error())
+		}
+		return nil
+	}
+	return response
+}
+
+func RetrieveResponse(c *gin.Context) {
+	response := getUserResponseOrAbort(c)
+	if response == nil {
+		return
+	}
+	c.Data(http.StatusOK, "application/json", []byte(response.Body))
+}
+
+func DeleteResponse(c *gin.Context) {
+	response := getUserResponseOrAbort(c)
+	if response == nil {
+		return
+	}
+	if _, err := model.DeleteUserResponseById(response.UserId, response.Id); err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "delete_response_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      response.Id,
+		"object":  "response",
+		"deleted": true,
+	})
+}
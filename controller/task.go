@@ -14,70 +14,200 @@ import (
 	"one-api/dto"
 	"one-api/model"
 	"one-api/relay"
+	"one-api/service"
+	"one-api/setting/operation_setting"
 	"sort"
 	"strconv"
+	"sync"
 	"time"
+
+	"github.com/bytedance/gopkg/util/gopool"
 )
 
+// taskNextPollAt 各未完成任务的下一次轮询时间，仅由轮询主节点的调度循环读写
+var taskNextPollAt = make(map[int64]time.Time)
+
+// taskScanCursor 上一轮扫描到的最大任务 id，未完成任务超过 ScanLimit 时从该位置继续扫描，扫描到末尾后从头开始
+var taskScanCursor int64
+
 func UpdateTaskBulk() {
-	//revocer
-	//imageModel := "midjourney"
 	for {
-		time.Sleep(time.Duration(15) * time.Second)
-		common.SysLog("任务进度轮询开始")
-		ctx := context.TODO()
-		allTasks := model.GetAllUnFinishSyncTasks(500)
-		platformTask := make(map[constant.TaskPlatform][]*model.Task)
-		for _, t := range allTasks {
-			platformTask[t.Platform] = append(platformTask[t.Platform], t)
-		}
-		for platform, tasks := range platformTask {
-			if len(tasks) == 0 {
-				continue
-			}
-			taskChannelM := make(map[int][]string)
-			taskM := make(map[string]*model.Task)
-			nullTaskIds := make([]int64, 0)
-			for _, task := range tasks {
-				if task.TaskID == "" {
-					// 统计失败的未完成任务
-					nullTaskIds = append(nullTaskIds, task.ID)
-					continue
+		pollSetting := operation_setting.GetTaskPollSetting()
+		time.Sleep(time.Duration(max(pollSetting.TickSeconds, 1)) * time.Second)
+		if !service.IsTaskPollLeader() {
+			// 非主节点不轮询，重新成为主节点后立即轮询全部任务
+			taskNextPollAt = make(map[int64]time.Time)
+			continue
+		}
+		// 轮询期间持续续期租约，单轮耗时超过租约时长也不会被其他实例接管
+		lease := service.StartTaskPollLease()
+		updateTaskBulk(context.TODO(), pollSetting, lease)
+		lease.Stop()
+		if !lease.Held() {
+			taskNextPollAt = make(map[int64]time.Time)
+		}
+	}
+}
+
+// scanUnfinishedTasks 从游标处继续扫描最多 limit 个未完成任务，到达末尾时从头补足，保证任务数超过上限时所有任务都能被轮询到
+func scanUnfinishedTasks(limit int) []*model.Task {
+	limit = max(limit, 1)
+	tasks := model.GetAllUnFinishSyncTasks(taskScanCursor, limit)
+	if len(tasks) < limit {
+		if taskScanCursor > 0 {
+			for _, t := range model.GetAllUnFinishSyncTasks(0, limit-len(tasks)) {
+				if t.ID > taskScanCursor {
+					break
 				}
-				taskM[task.TaskID] = task
-				taskChannelM[task.ChannelId] = append(taskChannelM[task.ChannelId], task.TaskID)
+				tasks = append(tasks, t)
 			}
-			if len(nullTaskIds) > 0 {
-				err := model.TaskBulkUpdateByID(nullTaskIds, map[string]any{
-					"status":   "FAILURE",
-					"progress": "100%",
-				})
-				if err != nil {
-					common.LogError(ctx, fmt.Sprintf("Fix null task_id task error: %v", err))
-				} else {
-					common.LogInfo(ctx, fmt.Sprintf("Fix null task_id task success: %v", nullTaskIds))
+		}
+		taskScanCursor = 0
+	}
+	if len(tasks) == limit {
+		taskScanCursor = tasks[len(tasks)-1].ID
+	}
+	return tasks
+}
+
+func updateTaskBulk(ctx context.Context, pollSetting *operation_setting.TaskPollSetting, lease *service.TaskPollLease) {
+	now := time.Now()
+	// 已到期的记录无论任务是否仍未完成都可以删除，未完成的任务下次被扫描到时会立即轮询
+	for id, at := range taskNextPollAt {
+		if !now.Before(at) {
+			delete(taskNextPollAt, id)
+		}
+	}
+	allTasks := scanUnfinishedTasks(pollSetting.ScanLimit)
+	platformTask := make(map[constant.TaskPlatform][]*model.Task)
+	dueCount := 0
+	for _, t := range allTasks {
+		if at, ok := taskNextPollAt[t.ID]; ok && now.Before(at) {
+			continue
+		}
+		taskNextPollAt[t.ID] = now.Add(service.GetTaskPollInterval(t, now.Unix()))
+		platformTask[t.Platform] = append(platformTask[t.Platform], t)
+		dueCount++
+	}
+	if dueCount == 0 {
+		return
+	}
+	common.SysLog(fmt.Sprintf("任务进度轮询开始，本轮待轮询任务数: %d", dueCount))
+	var wg sync.WaitGroup
+	for platform, tasks := range platformTask {
+		taskChannelM := make(map[int][]string)
+		taskM := make(map[string]*model.Task)
+		nullTaskIds := make([]int64, 0)
+		nullTasks := make([]*model.Task, 0)
+		if !lease.Held() {
+			break
+		}
+		for _, task := range tasks {
+			if service.IsTaskExpired(task) {
+				// 超过最长存活时间仍未完成，标记失败并退还额度
+				if err := service.FailTask(ctx, task, "任务超时未完成"); err != nil && !errors.Is(err, service.ErrTaskAlreadyFinished) {
+					common.LogError(ctx, fmt.Sprintf("Fail expired task %s error: %v", task.TaskID, err))
 				}
+				continue
 			}
-			if len(taskChannelM) == 0 {
+			if task.TaskID == "" {
+				// 统计失败的未完成任务
+				nullTaskIds = append(nullTaskIds, task.ID)
+				nullTasks = append(nullTasks, task)
 				continue
 			}
+			taskM[task.TaskID] = task
+			taskChannelM[task.ChannelId] = append(taskChannelM[task.ChannelId], task.TaskID)
+		}
+		if len(nullTaskIds) > 0 {
+			err := model.TaskBulkUpdateByID(nullTaskIds, map[string]any{
+				"status":   "FAILURE",
+				"progress": "100%",
+			})
+			if err != nil {
+				common.LogError(ctx, fmt.Sprintf("Fix null task_id task error: %v", err))
+			} else {
+				common.LogInfo(ctx, fmt.Sprintf("Fix null task_id task success: %v", nullTaskIds))
+				for _, task := range nullTasks {
+					task.Status = model.TaskStatusFailure
+					task.Progress = "100%"
+					service.RefundTaskQuota(ctx, task)
+				}
+			}
+		}
+		for channelId, taskIds := range taskChannelM {
+			wg.Add(1)
+			gopool.Go(func() {
+				defer wg.Done()
+				updateChannelTasks(platform, channelId, taskIds, taskM, pollSetting, lease)
+			})
+		}
+	}
+	wg.Wait()
+	common.SysLog("任务进度轮询完成")
+}
 
-			UpdateTaskByPlatform(platform, taskChannelM, taskM)
+// updateChannelTasks 将渠道的待轮询任务按提交时使用的密钥分组后再按批次拆分，同一批次的任务使用同一个密钥查询，
+// 并以渠道并发上限发起轮询请求，失去主节点租约后不再发起新的批次
+func updateChannelTasks(platform constant.TaskPlatform, channelId int, taskIds []string, taskM map[string]*model.Task, pollSetting *operation_setting.TaskPollSetting, lease *service.TaskPollLease) {
+	var keyIds []int
+	keyTaskIds := make(map[int][]string)
+	for _, taskId := range taskIds {
+		keyId := 0
+		if task := taskM[taskId]; task != nil {
+			keyId = task.ChannelKeyId
+		}
+		if _, ok := keyTaskIds[keyId]; !ok {
+			keyIds = append(keyIds, keyId)
 		}
-		common.SysLog("任务进度轮询完成")
+		keyTaskIds[keyId] = append(keyTaskIds[keyId], taskId)
+	}
+	batchSize := max(pollSetting.ChannelBatchSize, 1)
+	sem := make(chan struct{}, max(pollSetting.ChannelConcurrency, 1))
+	var wg sync.WaitGroup
+	for _, keyId := range keyIds {
+		keyTasks := keyTaskIds[keyId]
+		for start := 0; start < len(keyTasks); start += batchSize {
+			batch := keyTasks[start:min(start+batchSize, len(keyTasks))]
+			sem <- struct{}{}
+			if !lease.Held() {
+				<-sem
+				wg.Wait()
+				return
+			}
+			wg.Add(1)
+			gopool.Go(func() {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				UpdateTaskByPlatform(platform, map[int][]string{channelId: batch}, taskM)
+			})
+		}
+	}
+	wg.Wait()
+}
+
+// taskChannelKey 返回查询任务使用的渠道密钥，多密钥渠道沿用提交任务时的密钥
+func taskChannelKey(channel *model.Channel, task *model.Task) string {
+	if task == nil {
+		return channel.GetKeyByKeyId(0)
 	}
+	return channel.GetKeyByKeyId(task.ChannelKeyId)
 }
 
 func UpdateTaskByPlatform(platform constant.TaskPlatform, taskChannelM map[int][]string, taskM map[string]*model.Task) {
 	switch platform {
 	case constant.TaskPlatformMidjourney:
-		//_ = UpdateMidjourneyTaskAll(context.Background(), tasks)
+		_ = UpdateMidjourneyTaskAll(context.Background(), taskChannelM, taskM)
 	case constant.TaskPlatformSuno:
 		_ = UpdateSunoTaskAll(context.Background(), taskChannelM, taskM)
 	case constant.TaskPlatformKling:
 		_ = UpdateVideoTaskAll(context.Background(), taskChannelM, taskM)
 	case constant.TaskPlatformCustomPass:
 		_ = UpdateCustomPassTaskAll(context.Background(), taskChannelM, taskM)
+	case constant.TaskPlatformDeclarative:
+		_ = UpdateDeclarativeTaskAll(context.Background(), taskChannelM, taskM)
 	default:
 		common.SysLog("未知平台")
 	}
@@ -101,13 +231,16 @@ func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, tas
 	channel, err := model.CacheGetChannel(channelId)
 	if err != nil {
 		common.SysLog(fmt.Sprintf("CacheGetChannel: %v", err))
+		failReason := fmt.Sprintf("获取渠道信息失败，请联系管理员，渠道ID：%d", channelId)
 		err = model.TaskBulkUpdate(taskIds, map[string]any{
-			"fail_reason": fmt.Sprintf("获取渠道信息失败，请联系管理员，渠道ID：%d", channelId),
+			"fail_reason": failReason,
 			"status":      "FAILURE",
 			"progress":    "100%",
 		})
 		if err != nil {
 			common.SysError(fmt.Sprintf("UpdateMidjourneyTask error2: %v", err))
+		} else {
+			finishFailedTasks(ctx, taskIds, taskM, failReason)
 		}
 		return err
 	}
@@ -115,7 +248,8 @@ func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, tas
 	if adaptor == nil {
 		return errors.New("adaptor not found")
 	}
-	resp, err := adaptor.FetchTask(*channel.BaseURL, channel.Key, map[string]any{
+	// 同一批次的任务由 updateChannelTasks 按密钥分组，使用第一个任务的密钥即可
+	resp, err := adaptor.FetchTask(*channel.BaseURL, taskChannelKey(channel, taskM[taskIds[0]]), map[string]any{
 		"ids": taskIds,
 	})
 	if err != nil {
@@ -154,37 +288,44 @@ func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, tas
 		task.SubmitTime = lo.If(responseItem.SubmitTime != 0, responseItem.SubmitTime).Else(task.SubmitTime)
 		task.StartTime = lo.If(responseItem.StartTime != 0, responseItem.StartTime).Else(task.StartTime)
 		task.FinishTime = lo.If(responseItem.FinishTime != 0, responseItem.FinishTime).Else(task.FinishTime)
-		if responseItem.FailReason != "" || task.Status == model.TaskStatusFailure {
+		failed := responseItem.FailReason != "" || task.Status == model.TaskStatusFailure
+		if failed {
 			common.LogInfo(ctx, task.TaskID+" 构建失败，"+task.FailReason)
 			task.Progress = "100%"
-			//err = model.CacheUpdateUserQuota(task.UserId) ?
-			if err != nil {
-				common.LogError(ctx, "error update user quota cache: "+err.Error())
-			} else {
-				quota := task.Quota
-				if quota != 0 {
-					err = model.IncreaseUserQuota(task.UserId, quota, false)
-					if err != nil {
-						common.LogError(ctx, "fail to increase user quota: "+err.Error())
-					}
-					logContent := fmt.Sprintf("异步任务执行失败 %s，补偿 %s", task.TaskID, common.LogQuota(quota))
-					model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
-				}
-			}
 		}
 		if responseItem.Status == model.TaskStatusSuccess {
 			task.Progress = "100%"
 		}
 		task.Data = responseItem.Data
 
-		err = task.Update()
+		// 条件写入，任务已被取消等路径写入终态时不覆盖，也不再退款
+		err = service.UpdateFinishedTask(ctx, task)
 		if err != nil {
-			common.SysError("UpdateMidjourneyTask task error: " + err.Error())
+			if !errors.Is(err, service.ErrTaskAlreadyFinished) {
+				common.SysError("UpdateMidjourneyTask task error: " + err.Error())
+			}
+		} else if failed {
+			service.RefundTaskQuota(ctx, task)
 		}
 	}
 	return nil
 }
 
+// finishFailedTasks 为批量标记为失败的任务退还额度并创建回调
+func finishFailedTasks(ctx context.Context, taskIds []string, taskM map[string]*model.Task, failReason string) {
+	for _, taskId := range taskIds {
+		task := taskM[taskId]
+		if task == nil {
+			continue
+		}
+		task.Status = model.TaskStatusFailure
+		task.Progress = "100%"
+		task.FailReason = failReason
+		service.RefundTaskQuota(ctx, task)
+		service.EnqueueTaskWebhook(task)
+	}
+}
+
 func checkTaskNeedUpdate(oldTask *model.Task, newTask dto.SunoDataResponse) bool {
 
 	if oldTask.SubmitTime != newTask.SubmitTime {
@@ -323,13 +464,16 @@ func updateCustomPassTaskAll(ctx context.Context, channelId int, taskIds []strin
 	channel, err := model.CacheGetChannel(channelId)
 	if err != nil {
 		common.SysLog(fmt.Sprintf("CacheGetChannel: %v", err))
+		failReason := fmt.Sprintf("获取渠道信息失败，请联系管理员，渠道ID：%d", channelId)
 		err = model.TaskBulkUpdate(taskIds, map[string]any{
-			"fail_reason": fmt.Sprintf("获取渠道信息失败，请联系管理员，渠道ID：%d", channelId),
+			"fail_reason": failReason,
 			"status":      "FAILURE",
 			"progress":    "100%",
 		})
 		if err != nil {
 			common.SysError(fmt.Sprintf("UpdateCustomPassTask error: %v", err))
+		} else {
+			finishFailedTasks(ctx, taskIds, taskM, failReason)
 		}
 		return err
 	}
@@ -370,7 +514,7 @@ func updateCustomPassTaskAll(ctx context.Context, channelId int, taskIds []strin
 			requestBody["client_token"] = clientToken
 		}
 
-		resp, err := adaptor.FetchTask(*channel.BaseURL, channel.Key, requestBody)
+		resp, err := adaptor.FetchTask(*channel.BaseURL, taskChannelKey(channel, taskM[modelTaskIdList[0]]), requestBody)
 		if err != nil {
 			common.SysError(fmt.Sprintf("Get CustomPass Task Do req error: %v", err))
 			continue
@@ -473,23 +617,10 @@ func updateCustomPassTaskAll(ctx context.Context, channelId int, taskIds []strin
 				task.FinishTime = currentTime
 			}
 
-			// 如果任务失败，退回扣费
+			// 如果任务失败，在写入成功后退回扣费
 			if task.Status == model.TaskStatusFailure {
 				// 确保失败任务的进度设置为100%，避免重复处理
 				task.Progress = "100%"
-				quota := task.Quota
-				if quota != 0 {
-					err = model.IncreaseUserQuota(task.UserId, quota, false)
-					if err != nil {
-						common.LogError(ctx, "fail to increase user quota: "+err.Error())
-					}
-					modelName := task.Properties.Model
-					if modelName == "" {
-						modelName = "自定义透传"
-					}
-					logContent := fmt.Sprintf("%s任务执行失败 %s，补偿 %s", modelName, task.TaskID, common.LogQuota(quota))
-					model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
-				}
 			}
 
 			if task.Status == model.TaskStatusSuccess {
@@ -507,12 +638,18 @@ func updateCustomPassTaskAll(ctx context.Context, channelId int, taskIds []strin
 			// 更新数据库前记录日志
 			common.LogInfo(ctx, fmt.Sprintf("CustomPass任务准备更新数据库 - TaskID: %s, ID: %d", task.TaskID, task.ID))
 
-			err = task.Update()
+			err = service.UpdateFinishedTask(ctx, task)
+			if errors.Is(err, service.ErrTaskAlreadyFinished) {
+				continue
+			}
 			if err != nil {
 				common.SysError("UpdateCustomPassTask task error: " + err.Error())
 				common.LogError(ctx, fmt.Sprintf("CustomPass任务数据库更新失败 - TaskID: %s, 错误: %s", task.TaskID, err.Error()))
 			} else {
 				common.LogInfo(ctx, fmt.Sprintf("CustomPass任务数据库更新成功 - TaskID: %s, 最终状态: %s, 最终进度: %s", task.TaskID, task.Status, task.Progress))
+				if task.Status == model.TaskStatusFailure {
+					service.RefundTaskQuota(ctx, task)
+				}
 			}
 		}
 	}
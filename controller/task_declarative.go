@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/model"
+	"one-api/relay"
+	"one-api/relay/channel"
+	"one-api/relay/channel/task/declarative"
+	"one-api/service"
+	"time"
+)
+
+func UpdateDeclarativeTaskAll(ctx context.Context, taskChannelM map[int][]string, taskM map[string]*model.Task) error {
+	for channelId, taskIds := range taskChannelM {
+		if err := updateDeclarativeTaskAll(ctx, channelId, taskIds, taskM); err != nil {
+			common.LogError(ctx, fmt.Sprintf("Channel #%d failed to update declarative tasks: %s", channelId, err.Error()))
+		}
+	}
+	return nil
+}
+
+func updateDeclarativeTaskAll(ctx context.Context, channelId int, taskIds []string, taskM map[string]*model.Task) error {
+	common.LogInfo(ctx, fmt.Sprintf("Channel #%d pending declarative tasks: %d", channelId, len(taskIds)))
+	if len(taskIds) == 0 {
+		return nil
+	}
+	cacheGetChannel, err := model.CacheGetChannel(channelId)
+	if err != nil {
+		failReason := fmt.Sprintf("Failed to get channel info, channel ID: %d", channelId)
+		errUpdate := model.TaskBulkUpdate(taskIds, map[string]any{
+			"fail_reason": failReason,
+			"status":      "FAILURE",
+			"progress":    "100%",
+		})
+		if errUpdate != nil {
+			common.SysError(fmt.Sprintf("UpdateDeclarativeTask error: %v", errUpdate))
+		} else {
+			finishFailedTasks(ctx, taskIds, taskM, failReason)
+		}
+		return fmt.Errorf("CacheGetChannel failed: %w", err)
+	}
+	config, err := declarative.ParseTaskConfig(cacheGetChannel.GetSetting())
+	if err != nil {
+		// 配置错误由管理员修复后继续轮询，超时任务由生命周期检查统一处理
+		return fmt.Errorf("invalid task config: %w", err)
+	}
+	adaptor := relay.GetTaskAdaptor(constant.TaskPlatformDeclarative)
+	if adaptor == nil {
+		return fmt.Errorf("declarative adaptor not found")
+	}
+	for _, taskId := range taskIds {
+		if err := updateDeclarativeSingleTask(ctx, adaptor, cacheGetChannel, config, taskId, taskM); err != nil {
+			common.LogError(ctx, fmt.Sprintf("Failed to update declarative task %s: %s", taskId, err.Error()))
+		}
+	}
+	return nil
+}
+
+func updateDeclarativeSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, channel *model.Channel, config *declarative.TaskConfig, taskId string, taskM map[string]*model.Task) error {
+	task := taskM[taskId]
+	if task == nil {
+		return fmt.Errorf("task %s not found", taskId)
+	}
+	baseURL := common.ChannelBaseURLs[channel.Type]
+	if channel.GetBaseURL() != "" {
+		baseURL = channel.GetBaseURL()
+	}
+	resp, err := adaptor.FetchTask(baseURL, taskChannelKey(channel, task), map[string]any{
+		"task_id":         taskId,
+		"model":           task.Properties.Model,
+		"action":          task.Action,
+		"channel_setting": channel.GetSetting(),
+	})
+	if err != nil {
+		return fmt.Errorf("FetchTask failed for task %s: %w", taskId, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Get declarative task status code: %d", resp.StatusCode)
+	}
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("ReadAll failed for task %s: %w", taskId, err)
+	}
+	result, err := config.ParseTaskResult(responseBody)
+	if err != nil {
+		common.LogError(ctx, fmt.Sprintf("Failed to parse declarative task response body: %v, body: %s", err, string(responseBody)))
+		return fmt.Errorf("ParseTaskResult failed for task %s: %w", taskId, err)
+	}
+
+	task.Status = model.TaskStatus(result.Status)
+	if result.Progress != "" {
+		task.Progress = result.Progress
+	}
+	if result.ResultUrl != "" {
+		task.ResultUrl = result.ResultUrl
+	}
+	now := time.Now().Unix()
+	if task.StartTime == 0 && task.Status != model.TaskStatusNotStart && task.Status != model.TaskStatusSubmitted && task.Status != model.TaskStatusQueued {
+		task.StartTime = now
+	}
+	switch task.Status {
+	case model.TaskStatusSuccess:
+		task.Progress = "100%"
+		task.FinishTime = now
+	case model.TaskStatusFailure:
+		task.Progress = "100%"
+		task.FinishTime = now
+		task.FailReason = result.FailReason
+		common.LogInfo(ctx, fmt.Sprintf("Task %s failed: %s", task.TaskID, task.FailReason))
+	default:
+		// 进度为 100% 的任务不再轮询，未完成的任务进度最多为 99%
+		if task.Progress == "100%" {
+			task.Progress = "99%"
+		}
+	}
+
+	task.Data = responseBody
+	if err := service.UpdateFinishedTask(ctx, task); err != nil {
+		if !errors.Is(err, service.ErrTaskAlreadyFinished) {
+			common.SysError("UpdateDeclarativeTask task error: " + err.Error())
+		}
+		return nil
+	}
+	if task.Status == model.TaskStatusFailure {
+		service.RefundTaskQuota(ctx, task)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package controller
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,6 +12,7 @@ import (
 	"one-api/model"
 	"one-api/relay"
 	"one-api/relay/channel"
+	"one-api/service"
 )
 
 func UpdateVideoTaskAll(ctx context.Context, taskChannelM map[int][]string, taskM map[string]*model.Task) error {
@@ -29,13 +31,16 @@ func updateVideoTaskAll(ctx context.Context, channelId int, taskIds []string, ta
 	}
 	cacheGetChannel, err := model.CacheGetChannel(channelId)
 	if err != nil {
+		failReason := fmt.Sprintf("Failed to get channel info, channel ID: %d", channelId)
 		errUpdate := model.TaskBulkUpdate(taskIds, map[string]any{
-			"fail_reason": fmt.Sprintf("Failed to get channel info, channel ID: %d", channelId),
+			"fail_reason": failReason,
 			"status":      "FAILURE",
 			"progress":    "100%",
 		})
 		if errUpdate != nil {
 			common.SysError(fmt.Sprintf("UpdateVideoTask error: %v", errUpdate))
+		} else {
+			finishFailedTasks(ctx, taskIds, taskM, failReason)
 		}
 		return fmt.Errorf("CacheGetChannel failed: %w", err)
 	}
@@ -56,8 +61,14 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 	if channel.GetBaseURL() != "" {
 		baseURL = channel.GetBaseURL()
 	}
-	resp, err := adaptor.FetchTask(baseURL, channel.Key, map[string]any{
+	task := taskM[taskId]
+	if task == nil {
+		common.LogError(ctx, fmt.Sprintf("Task %s not found in taskM", taskId))
+		return fmt.Errorf("task %s not found", taskId)
+	}
+	resp, err := adaptor.FetchTask(baseURL, taskChannelKey(channel, task), map[string]any{
 		"task_id": taskId,
+		"action":  task.Action,
 	})
 	if err != nil {
 		return fmt.Errorf("FetchTask failed for task %s: %w", taskId, err)
@@ -89,12 +100,6 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 		return fmt.Errorf("video task data format error for task %s", taskId)
 	}
 
-	task := taskM[taskId]
-	if task == nil {
-		common.LogError(ctx, fmt.Sprintf("Task %s not found in taskM", taskId))
-		return fmt.Errorf("task %s not found", taskId)
-	}
-
 	if status, ok := data["task_status"].(string); ok {
 		switch status {
 		case "submitted", "queued":
@@ -106,6 +111,7 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 			task.Progress = "100%"
 			if url, err := adaptor.ParseResultUrl(responseItem); err == nil {
 				task.FailReason = url
+				task.ResultUrl = url
 			} else {
 				common.LogWarn(ctx, fmt.Sprintf("Failed to get url from body for task %s: %s", task.TaskID, err.Error()))
 			}
@@ -118,22 +124,17 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 		}
 	}
 
+	task.Data = responseBody
+	if err := service.UpdateFinishedTask(ctx, task); err != nil {
+		if !errors.Is(err, service.ErrTaskAlreadyFinished) {
+			common.SysError("UpdateVideoTask task error: " + err.Error())
+		}
+		return nil
+	}
 	// If task failed, refund quota
 	if task.Status == model.TaskStatusFailure {
 		common.LogInfo(ctx, fmt.Sprintf("Task %s failed: %s", task.TaskID, task.FailReason))
-		quota := task.Quota
-		if quota != 0 {
-			if err := model.IncreaseUserQuota(task.UserId, quota, false); err != nil {
-				common.LogError(ctx, "Failed to increase user quota: "+err.Error())
-			}
-			logContent := fmt.Sprintf("Video async task failed %s, refund %s", task.TaskID, common.LogQuota(quota))
-			model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
-		}
-	}
-
-	task.Data = responseBody
-	if err := task.Update(); err != nil {
-		common.SysError("UpdateVideoTask task error: " + err.Error())
+		service.RefundTaskQuota(ctx, task)
 	}
 
 	return nil
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"one-api/service"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// runningTaskWebhooks 正在投递的回调，避免同一回调被并发投递
+var runningTaskWebhooks sync.Map
+
+// UpdateTaskWebhookBulk 定期投递到达重试时间的异步任务回调
+func UpdateTaskWebhookBulk() {
+	for {
+		time.Sleep(time.Duration(5) * time.Second)
+		webhooks, err := model.GetDueTaskWebhooks(100)
+		if err != nil {
+			common.SysError("get due task webhooks failed: " + err.Error())
+			continue
+		}
+		for _, webhook := range webhooks {
+			if _, running := runningTaskWebhooks.LoadOrStore(webhook.Id, true); running {
+				continue
+			}
+			w := webhook
+			gopool.Go(func() {
+				defer runningTaskWebhooks.Delete(w.Id)
+				service.DeliverTaskWebhook(w)
+			})
+		}
+	}
+}
+
+func getTaskWebhooks(c *gin.Context, userId int) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 1 {
+		p = 1
+	}
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if pageSize <= 0 {
+		pageSize = common.ItemsPerPage
+	}
+	items, total, err := model.GetTaskWebhooks(userId, c.Query("task_id"), c.Query("status"), (p-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"items":     items,
+			"total":     total,
+			"page":      p,
+			"page_size": pageSize,
+		},
+	})
+}
+
+func GetUserTaskWebhooks(c *gin.Context) {
+	getTaskWebhooks(c, c.GetInt("id"))
+}
+
+func GetAllTaskWebhooks(c *gin.Context) {
+	getTaskWebhooks(c, 0)
+}
+
+// RetryTaskWebhook 将回调重新加入投递队列，重新计算投递次数
+func RetryTaskWebhook(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	webhook, err := model.GetTaskWebhookById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	webhook.Status = model.TaskWebhookStatusPending
+	webhook.Attempts = 0
+	webhook.NextAttemptAt = common.GetTimestamp()
+	if err = webhook.Update(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    webhook,
+	})
+}
@@ -153,6 +153,9 @@ func AddToken(c *gin.Context) {
 		ModelLimits:        token.ModelLimits,
 		AllowIps:           token.AllowIps,
 		Group:              token.Group,
+		ResponseCache:      token.ResponseCache,
+		SemanticCache:      token.SemanticCache,
+		BodyLog:            token.BodyLog,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -242,6 +245,9 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.ModelLimits = token.ModelLimits
 		cleanToken.AllowIps = token.AllowIps
 		cleanToken.Group = token.Group
+		cleanToken.ResponseCache = token.ResponseCache
+		cleanToken.SemanticCache = token.SemanticCache
+		cleanToken.BodyLog = token.BodyLog
 	}
 	err = cleanToken.Update()
 	if err != nil {
@@ -220,15 +220,21 @@ type OpenAIResponsesResponse struct {
 }
 
 type IncompleteDetails struct {
-	Reasoning string `json:"reasoning"`
+	Reasoning string `json:"reason"`
 }
 
 type ResponsesOutput struct {
 	Type    string                   `json:"type"`
 	ID      string                   `json:"id"`
-	Status  string                   `json:"status"`
-	Role    string                   `json:"role"`
-	Content []ResponsesOutputContent `json:"content"`
+	Status  string                   `json:"status,omitempty"`
+	Role    string                   `json:"role,omitempty"`
+	Content []ResponsesOutputContent `json:"content,omitempty"`
+	// function_call
+	CallId    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	// reasoning
+	Summary []ResponsesOutputContent `json:"summary,omitempty"`
 }
 
 type ResponsesOutputContent struct {
@@ -253,8 +259,16 @@ const (
 
 // ResponsesStreamResponse 用于处理 /v1/responses 流式响应
 type ResponsesStreamResponse struct {
-	Type     string                   `json:"type"`
-	Response *OpenAIResponsesResponse `json:"response,omitempty"`
-	Delta    string                   `json:"delta,omitempty"`
-	Item     *ResponsesOutput         `json:"item,omitempty"`
+	Type           string                   `json:"type"`
+	SequenceNumber int                      `json:"sequence_number"`
+	Response       *OpenAIResponsesResponse `json:"response,omitempty"`
+	Delta          string                   `json:"delta,omitempty"`
+	Item           *ResponsesOutput         `json:"item,omitempty"`
+	ItemId         string                   `json:"item_id,omitempty"`
+	OutputIndex    *int                     `json:"output_index,omitempty"`
+	ContentIndex   *int                     `json:"content_index,omitempty"`
+	SummaryIndex   *int                     `json:"summary_index,omitempty"`
+	Part           *ResponsesOutputContent  `json:"part,omitempty"`
+	Text           *string                  `json:"text,omitempty"`
+	Arguments      *string                  `json:"arguments,omitempty"`
 }
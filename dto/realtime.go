@@ -6,6 +6,9 @@ const (
 	RealtimeEventTypeConversationCreate = "conversation.item.create"
 	RealtimeEventTypeResponseCreate     = "response.create"
 	RealtimeEventInputAudioBufferAppend = "input_audio_buffer.append"
+	RealtimeEventInputAudioBufferCommit = "input_audio_buffer.commit"
+	RealtimeEventInputAudioBufferClear  = "input_audio_buffer.clear"
+	RealtimeEventTypeResponseCancel     = "response.cancel"
 )
 
 const (
@@ -17,6 +20,17 @@ const (
 	RealtimeEventResponseFunctionCallArgumentsDelta = "response.function_call_arguments.delta"
 	RealtimeEventResponseFunctionCallArgumentsDone  = "response.function_call_arguments.done"
 	RealtimeEventConversationItemCreated            = "conversation.item.created"
+	RealtimeEventInputAudioBufferCommitted          = "input_audio_buffer.committed"
+	RealtimeEventInputAudioBufferCleared            = "input_audio_buffer.cleared"
+	RealtimeEventInputAudioTranscriptionCompleted   = "conversation.item.input_audio_transcription.completed"
+	RealtimeEventInputAudioTranscriptionFailed      = "conversation.item.input_audio_transcription.failed"
+	RealtimeEventTypeResponseCreated                = "response.created"
+	RealtimeEventResponseOutputItemAdded            = "response.output_item.added"
+	RealtimeEventResponseOutputItemDone             = "response.output_item.done"
+	RealtimeEventResponseTextDelta                  = "response.text.delta"
+	RealtimeEventResponseTextDone                   = "response.text.done"
+	RealtimeEventResponseAudioDone                  = "response.audio.done"
+	RealtimeEventResponseAudioTranscriptionDone     = "response.audio_transcript.done"
 )
 
 type RealtimeEvent struct {
@@ -29,10 +43,27 @@ type RealtimeEvent struct {
 	Response *RealtimeResponse `json:"response,omitempty"`
 	Delta    string            `json:"delta,omitempty"`
 	Audio    string            `json:"audio,omitempty"`
+	// 以下字段用于网关桥接时输出的服务端事件
+	PreviousItemId *string `json:"previous_item_id,omitempty"`
+	ItemId         string  `json:"item_id,omitempty"`
+	ResponseId     string  `json:"response_id,omitempty"`
+	OutputIndex    *int    `json:"output_index,omitempty"`
+	ContentIndex   *int    `json:"content_index,omitempty"`
+	Text           string  `json:"text,omitempty"`
+	Transcript     string  `json:"transcript,omitempty"`
+	CallId         string  `json:"call_id,omitempty"`
+	Name           string  `json:"name,omitempty"`
+	Arguments      string  `json:"arguments,omitempty"`
 }
 
 type RealtimeResponse struct {
-	Usage *RealtimeUsage `json:"usage"`
+	Id           string          `json:"id,omitempty"`
+	Object       string          `json:"object,omitempty"`
+	Status       string          `json:"status,omitempty"`
+	Output       []*RealtimeItem `json:"output,omitempty"`
+	Modalities   []string        `json:"modalities,omitempty"`
+	Instructions string          `json:"instructions,omitempty"`
+	Usage        *RealtimeUsage  `json:"usage"`
 }
 
 type RealtimeUsage struct {
@@ -44,6 +75,8 @@ type RealtimeUsage struct {
 }
 
 type RealtimeSession struct {
+	Id                      string                  `json:"id,omitempty"`
+	Model                   string                  `json:"model,omitempty"`
 	Modalities              []string                `json:"modalities"`
 	Instructions            string                  `json:"instructions"`
 	Voice                   string                  `json:"voice"`
@@ -77,6 +110,8 @@ type RealtimeItem struct {
 	Name      *string           `json:"name,omitempty"`
 	ToolCalls any               `json:"tool_calls,omitempty"`
 	CallId    string            `json:"call_id,omitempty"`
+	Arguments string            `json:"arguments,omitempty"`
+	Output    string            `json:"output,omitempty"`
 }
 type RealtimeContent struct {
 	Type       string `json:"type"`
@@ -87,6 +87,7 @@ type TaskDto struct {
 	StartTime  int64           `json:"start_time"`
 	FinishTime int64           `json:"finish_time"`
 	Progress   string          `json:"progress"`
+	ResultUrl  string          `json:"result_url,omitempty"`
 	Data       json.RawMessage `json:"data"`
 }
 
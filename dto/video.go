@@ -1,5 +1,11 @@
 package dto
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 type VideoRequest struct {
 	Model          string         `json:"model,omitempty" example:"kling-v1"`                                                                                                                                    // Model/style ID
 	Prompt         string         `json:"prompt,omitempty" example:"宇航员站起身走了"`                                                                                                                                   // Text prompt
@@ -13,6 +19,41 @@ type VideoRequest struct {
 	ResponseFormat string         `json:"response_format,omitempty" example:"url"`                                                                                                                               // Response format
 	User           string         `json:"user,omitempty" example:"user-1234"`                                                                                                                                    // User identifier
 	Metadata       map[string]any `json:"metadata,omitempty"`                                                                                                                                                    // Vendor-specific/custom params (e.g. negative_prompt, style, quality_level, etc.)
+	Seconds        any            `json:"seconds,omitempty" example:"5"`                                                                                                                                         // OpenAI-style duration in seconds, string or number
+	Size           string         `json:"size,omitempty" example:"1280x720"`                                                                                                                                     // OpenAI-style resolution, WIDTHxHEIGHT
+	InputReference string         `json:"input_reference,omitempty"`                                                                                                                                             // OpenAI-style reference image (URL/Base64)
+}
+
+// GetSeconds 视频时长，优先使用 seconds，其次 duration
+func (r *VideoRequest) GetSeconds() int {
+	switch v := r.Seconds.(type) {
+	case float64:
+		return int(v)
+	case string:
+		if seconds, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return int(seconds)
+		}
+	}
+	return int(r.Duration)
+}
+
+// GetSize 视频分辨率，优先使用 size，其次 width 与 height
+func (r *VideoRequest) GetSize() string {
+	if r.Size != "" {
+		return r.Size
+	}
+	if r.Width > 0 && r.Height > 0 {
+		return fmt.Sprintf("%dx%d", r.Width, r.Height)
+	}
+	return ""
+}
+
+// GetImage 参考图片，优先使用 image，其次 input_reference
+func (r *VideoRequest) GetImage() string {
+	if r.Image != "" {
+		return r.Image
+	}
+	return r.InputReference
 }
 
 // VideoResponse 视频生成提交任务后的响应
@@ -45,3 +86,38 @@ type VideoTaskError struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
 }
+
+const (
+	VideoStatusQueued     = "queued"
+	VideoStatusInProgress = "in_progress"
+	VideoStatusCompleted  = "completed"
+	VideoStatusFailed     = "failed"
+	VideoStatusCancelled  = "cancelled"
+)
+
+// VideoObject 与 OpenAI 视频接口兼容的视频任务对象，各供应商的任务统一转换为该格式
+type VideoObject struct {
+	Id          string            `json:"id"`
+	Object      string            `json:"object"`
+	Model       string            `json:"model"`
+	Status      string            `json:"status"`
+	Progress    int               `json:"progress"`
+	CreatedAt   int64             `json:"created_at"`
+	CompletedAt int64             `json:"completed_at,omitempty"`
+	Seconds     string            `json:"seconds,omitempty"`
+	Size        string            `json:"size,omitempty"`
+	Error       *VideoObjectError `json:"error,omitempty"`
+}
+
+type VideoObjectError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type VideoListResponse struct {
+	Object  string        `json:"object"`
+	Data    []VideoObject `json:"data"`
+	FirstId string        `json:"first_id,omitempty"`
+	LastId  string        `json:"last_id,omitempty"`
+	HasMore bool          `json:"has_more"`
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -12,9 +14,13 @@ import (
 	"one-api/model"
 	"one-api/router"
 	"one-api/service"
+	"one-api/setting/operation_setting"
 	"one-api/setting/ratio_setting"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/gin-contrib/sessions"
@@ -47,6 +53,11 @@ func main() {
 	if common.DebugEnabled {
 		common.SysLog("running in debug mode")
 	}
+	// Initialize tracing
+	if err := common.InitTracing(); err != nil {
+		common.SysError("failed to initialize tracing: " + err.Error())
+	}
+	defer common.ShutdownTracing(context.Background())
 	// Initialize SQL Database
 	err = model.InitDB()
 	if err != nil {
@@ -67,6 +78,16 @@ func main() {
 		}
 	}()
 
+	// Initialize log sinks
+	if err = service.InitLogSinks(); err != nil {
+		common.FatalLog("failed to initialize log sinks: " + err.Error())
+	}
+	if common.LogBatchWriteEnabled {
+		if err = model.InitLogBatchWriter(); err != nil {
+			common.FatalLog("failed to initialize log batch writer: " + err.Error())
+		}
+	}
+
 	// Initialize Redis
 	err = common.InitRedisClient()
 	if err != nil {
@@ -80,6 +101,26 @@ func main() {
 	// Initialize options
 	model.InitOptionMap()
 
+	// 迁移旧版 Midjourney 任务，需在任务轮询启动前完成
+	if *common.MigrateMidjourney || common.IsMasterNode {
+		var staleBefore int64
+		if maxAge := operation_setting.GetTaskLifecycleSetting().MaxTaskAgeSeconds; maxAge > 0 {
+			staleBefore = time.Now().Unix() - int64(maxAge)
+		}
+		migrated, err := model.MigrateMidjourneyTasks(staleBefore)
+		if err != nil {
+			if *common.MigrateMidjourney {
+				common.FatalLog("failed to migrate midjourney tasks: " + err.Error())
+			}
+			common.SysError("failed to migrate midjourney tasks: " + err.Error())
+		} else if migrated > 0 || *common.MigrateMidjourney {
+			common.SysLog(fmt.Sprintf("migrated %d midjourney tasks", migrated))
+		}
+		if *common.MigrateMidjourney {
+			return
+		}
+	}
+
 	service.InitTokenEncoders()
 
 	if common.RedisEnabled {
@@ -130,10 +171,27 @@ func main() {
 	}
 	if common.IsMasterNode && constant.UpdateTask {
 		gopool.Go(func() {
-			controller.UpdateMidjourneyTaskBulk()
+			controller.UpdateTaskBulk()
 		})
+	}
+	if common.IsMasterNode {
 		gopool.Go(func() {
-			controller.UpdateTaskBulk()
+			controller.UpdateBatchBulk()
+		})
+		gopool.Go(func() {
+			controller.UpdateTaskWebhookBulk()
+		})
+		gopool.Go(func() {
+			controller.UpdateMediaStoreGC()
+		})
+		gopool.Go(func() {
+			controller.UpdateBodyLogGC()
+		})
+		gopool.Go(func() {
+			controller.UpdateFileGC()
+		})
+		gopool.Go(func() {
+			controller.UpdateResponseGC()
 		})
 	}
 	if os.Getenv("BATCH_UPDATE_ENABLED") == "true" {
@@ -181,8 +239,26 @@ func main() {
 	if port == "" {
 		port = strconv.Itoa(*common.Port)
 	}
-	err = server.Run(":" + port)
-	if err != nil {
-		common.FatalLog("failed to start HTTP server: " + err.Error())
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: server.Handler(),
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			common.FatalLog("failed to start HTTP server: " + err.Error())
+		}
+	}()
+
+	// 收到退出信号后等待处理中的请求完成，再发送剩余的日志
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	common.SysLog("shutting down server...")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		common.SysError("server shutdown failed: " + err.Error())
 	}
+	service.CloseLogSinks()
+	model.CloseLogBatchWriter()
 }
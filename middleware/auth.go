@@ -160,6 +160,8 @@ func WssAuth(c *gin.Context) {
 
 func TokenAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		endSpan := common.StartSpan(c, "token_auth")
+		defer endSpan()
 		// 先检测是否为ws
 		if c.Request.Header.Get("Sec-WebSocket-Protocol") != "" {
 			// Sec-WebSocket-Protocol: realtime, openai-insecure-api-key.sk-xxx, openai-beta.realtime-v1
@@ -249,6 +251,9 @@ func TokenAuth() func(c *gin.Context) {
 		}
 		c.Set("allow_ips", token.GetIpLimitsMap())
 		c.Set("token_group", token.Group)
+		c.Set("token_response_cache", token.ResponseCache)
+		c.Set("token_semantic_cache", token.SemanticCache)
+		c.Set("token_body_log", token.BodyLog)
 		if len(parts) > 1 {
 			if model.IsAdmin(token.UserId) {
 				c.Set("specific_channel_id", parts[1])
@@ -257,6 +262,7 @@ func TokenAuth() func(c *gin.Context) {
 				return
 			}
 		}
+		endSpan()
 		c.Next()
 	}
 }
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"bytes"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/service"
+	"one-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+type bodyLogWriter struct {
+	gin.ResponseWriter
+	body  bytes.Buffer
+	limit int
+	size  int
+}
+
+func (w *bodyLogWriter) record(data []byte) {
+	w.size += len(data)
+	if w.limit <= 0 {
+		w.body.Write(data)
+	} else if remain := w.limit - w.body.Len(); remain > 0 {
+		w.body.Write(data[:min(remain, len(data))])
+	}
+}
+
+func (w *bodyLogWriter) Write(data []byte) (int, error) {
+	w.record(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *bodyLogWriter) WriteString(s string) (int, error) {
+	w.record([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// BodyLog 为开启了内容记录的令牌、用户或分组保存请求与响应内容，通过请求 ID 与消费日志关联
+func BodyLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		setting := operation_setting.GetBodyLogSetting()
+		if !setting.Enabled {
+			c.Next()
+			return
+		}
+		// 多捕获一个字节，以便保存时判断是否需要截断
+		limit := setting.MaxBodyBytes
+		if limit > 0 {
+			limit++
+		}
+		writer := &bodyLogWriter{
+			ResponseWriter: c.Writer,
+			limit:          limit,
+		}
+		c.Writer = writer
+		c.Set(constant.ContextKeyBodyLogCapture, true)
+		c.Next()
+		c.Writer = writer.ResponseWriter
+		// 仅记录令牌鉴权的转发请求
+		tokenId := c.GetInt("token_id")
+		if tokenId == 0 || !operation_setting.IsBodyLogEnabledFor(c.GetInt("id"), c.GetString("group"), c.GetBool("token_body_log")) {
+			return
+		}
+		requestBody, _ := common.GetRequestBody(c)
+		service.SaveBodyLog(&service.BodyLogCapture{
+			RequestId:           c.GetString(common.RequestIdKey),
+			UserId:              c.GetInt("id"),
+			TokenId:             tokenId,
+			Group:               c.GetString("group"),
+			ModelName:           c.GetString("original_model"),
+			Path:                c.Request.URL.Path,
+			StatusCode:          writer.Status(),
+			RequestContentType:  c.Request.Header.Get("Content-Type"),
+			RequestBody:         requestBody,
+			RequestSize:         len(requestBody),
+			ResponseContentType: writer.Header().Get("Content-Type"),
+			ResponseBody:        writer.body.Bytes(),
+			ResponseSize:        writer.size,
+		})
+	}
+}
@@ -25,6 +25,8 @@ type ModelRequest struct {
 
 func Distribute() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		endSpan := common.StartSpan(c, "distribute")
+		defer endSpan()
 		allowIpsMap := c.GetStringMap("allow_ips")
 		if len(allowIpsMap) != 0 {
 			clientIp := c.ClientIP()
@@ -98,6 +100,13 @@ func Distribute() func(c *gin.Context) {
 			}
 
 			if shouldSelectChannel {
+				affinityKey := getSessionAffinityKey(c, userGroup, modelRequest.Model)
+				if affinityKey != "" {
+					c.Set(constant.ContextKeySessionAffinityKey, affinityKey)
+					channel = model.GetSessionAffinityChannel(affinityKey, userGroup, modelRequest.Model)
+				}
+			}
+			if shouldSelectChannel && channel == nil {
 				var selectGroup string
 				channel, selectGroup, err = model.CacheGetRandomSatisfiedChannel(c, userGroup, modelRequest.Model, 0)
 				if err != nil {
@@ -122,7 +131,11 @@ func Distribute() func(c *gin.Context) {
 			}
 		}
 		c.Set(constant.ContextKeyRequestStartTime, time.Now())
-		SetupContextForSelectedChannel(c, channel, modelRequest.Model)
+		if err := SetupContextForSelectedChannel(c, channel, modelRequest.Model); err != nil {
+			abortWithOpenAiMessage(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		endSpan()
 		c.Next()
 	}
 }
@@ -162,7 +175,8 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 	} else if strings.Contains(c.Request.URL.Path, "/suno/") {
 		relayMode := relayconstant.Path2RelaySuno(c.Request.Method, c.Request.URL.Path)
 		if relayMode == relayconstant.RelayModeSunoFetch ||
-			relayMode == relayconstant.RelayModeSunoFetchByID {
+			relayMode == relayconstant.RelayModeSunoFetchByID ||
+			relayMode == relayconstant.RelayModeTaskCancel {
 			shouldSelectChannel = false
 		} else {
 			modelName := service.CoverTaskActionToModelName(constant.TaskPlatformSuno, c.Param("action"))
@@ -172,13 +186,31 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 		c.Set("relay_mode", relayMode)
 	} else if strings.Contains(c.Request.URL.Path, "/v1/video/generations") {
 		relayMode := relayconstant.Path2RelayKling(c.Request.Method, c.Request.URL.Path)
-		if relayMode == relayconstant.RelayModeKlingFetchByID {
+		if relayMode == relayconstant.RelayModeKlingFetchByID || relayMode == relayconstant.RelayModeTaskCancel {
 				shouldSelectChannel = false
 		} else {
 			err = common.UnmarshalBodyReusable(c, &modelRequest)
 		}
 		c.Set("platform", string(constant.TaskPlatformKling))
 		c.Set("relay_mode", relayMode)
+	} else if strings.HasPrefix(c.Request.URL.Path, "/v1/videos") {
+		// 平台由选中渠道的类型决定，见 relay.RelayVideoSubmit
+		relayMode := relayconstant.Path2RelayVideo(c.Request.Method, c.Request.URL.Path)
+		if relayMode == relayconstant.RelayModeVideoSubmit {
+			err = common.UnmarshalBodyReusable(c, &modelRequest)
+		} else {
+			shouldSelectChannel = false
+		}
+		c.Set("relay_mode", relayMode)
+	} else if strings.HasPrefix(c.Request.URL.Path, "/v1/tasks/") {
+		relayMode := relayconstant.Path2RelayTask(c.Request.Method, c.Request.URL.Path)
+		if relayMode == relayconstant.RelayModeTaskFetchByID || relayMode == relayconstant.RelayModeTaskCancel {
+			shouldSelectChannel = false
+		} else {
+			err = common.UnmarshalBodyReusable(c, &modelRequest)
+		}
+		c.Set("platform", string(constant.TaskPlatformDeclarative))
+		c.Set("relay_mode", relayMode)
 	} else if strings.HasPrefix(c.Request.URL.Path, "/v1beta/models/") {
 		// Gemini API 路径处理: /v1beta/models/gemini-2.0-flash:generateContent
 		relayMode := relayconstant.RelayModeGemini
@@ -249,10 +281,10 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 	return &modelRequest, shouldSelectChannel, nil
 }
 
-func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, modelName string) {
+func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, modelName string) error {
 	c.Set("original_model", modelName) // for retry
 	if channel == nil {
-		return
+		return nil
 	}
 	c.Set("channel_id", channel.Id)
 	c.Set("channel_name", channel.Name)
@@ -266,7 +298,13 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	c.Set("auto_ban", channel.GetAutoBan())
 	c.Set("model_mapping", channel.GetModelMapping())
 	c.Set("status_code_mapping", channel.GetStatusCodeMapping())
-	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
+	var channelKey *model.ChannelKey
+	if channel.IsMultiKey() {
+		channelKey = model.SelectChannelKey(channel)
+	}
+	if err := SetupContextForChannelKey(c, channel, channelKey); err != nil {
+		return err
+	}
 	c.Set("base_url", channel.GetBaseURL())
 	// TODO: api_version统一
 	switch channel.Type {
@@ -287,6 +325,22 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	case common.ChannelTypeCoze:
 		c.Set("bot_id", channel.Other)
 	}
+	return nil
+}
+
+// SetupContextForChannelKey 设置请求使用的渠道密钥，channelKey 为 nil 时使用渠道本身的密钥；
+// 多密钥渠道没有可用密钥时返回错误，不回退到渠道本身的密钥
+func SetupContextForChannelKey(c *gin.Context, channel *model.Channel, channelKey *model.ChannelKey) error {
+	key := channel.Key
+	c.Set(constant.ContextKeyChannelKeyId, 0)
+	if channelKey != nil {
+		key = channelKey.Key
+		c.Set(constant.ContextKeyChannelKeyId, channelKey.Id)
+	} else if channel.IsMultiKey() {
+		return fmt.Errorf("渠道 #%d 没有已启用的密钥", channel.Id)
+	}
+	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", key))
+	return nil
 }
 
 // extractModelNameFromGeminiPath 从 Gemini API URL 路径中提取模型名
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"one-api/common"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RelayMetrics 记录转发请求的数量与耗时指标
+func RelayMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		modelName := c.GetString("original_model")
+		if modelName == "" {
+			// 未进入模型分发的请求（如鉴权失败、模型列表）不计入
+			return
+		}
+		common.RecordRelayRequest(modelName, c.GetInt("channel_id"), c.GetString("group"), c.Writer.Status(), time.Since(start))
+	}
+}
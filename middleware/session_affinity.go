@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"encoding/json"
+	"one-api/common"
+	"one-api/model"
+	"one-api/setting/operation_setting"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type sessionAffinityRequest struct {
+	User     string            `json:"user"`
+	System   json.RawMessage   `json:"system"`
+	Messages []json.RawMessage `json:"messages"`
+	Metadata struct {
+		UserId string `json:"user_id"`
+	} `json:"metadata"`
+}
+
+var sessionAffinityPaths = []string{
+	"/v1/chat/completions",
+	"/v1/completions",
+	"/v1/messages",
+	"/v1/responses",
+}
+
+// getSessionAffinityKey 依次使用请求头中的会话 id、请求体中的 user（Claude 为 metadata.user_id）、
+// 消息列表前缀计算会话标识，无法识别会话时返回空字符串
+func getSessionAffinityKey(c *gin.Context, group string, modelName string) string {
+	setting := operation_setting.GetSessionAffinitySetting()
+	if !setting.Enabled || group == "auto" {
+		return ""
+	}
+	path := strings.TrimPrefix(c.Request.URL.Path, "/pg")
+	if !common.StringsContains(sessionAffinityPaths, path) {
+		return ""
+	}
+	sessionId := ""
+	if setting.SessionHeader != "" {
+		sessionId = c.Request.Header.Get(setting.SessionHeader)
+	}
+	if sessionId == "" {
+		var request sessionAffinityRequest
+		if err := common.UnmarshalBodyReusable(c, &request); err != nil {
+			return ""
+		}
+		switch {
+		case request.User != "":
+			sessionId = "user:" + request.User
+		case request.Metadata.UserId != "":
+			sessionId = "user:" + request.Metadata.UserId
+		case setting.PrefixMessages > 0 && len(request.Messages) > 0:
+			n := setting.PrefixMessages
+			if n > len(request.Messages) {
+				n = len(request.Messages)
+			}
+			prefix, _ := json.Marshal(request.Messages[:n])
+			sessionId = "prefix:" + string(request.System) + string(prefix)
+		}
+	}
+	if sessionId == "" {
+		return ""
+	}
+	return model.GenerateSessionAffinityKey(c.GetInt("id"), group, modelName, common.GenerateHMAC(sessionId))
+}
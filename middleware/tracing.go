@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+	"one-api/common"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Tracing 为转发请求创建链路追踪的根 span
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !common.TracingEnabled {
+			c.Next()
+			return
+		}
+		span := common.StartRequestSpan(c, c.Request.Method+" "+c.FullPath(),
+			attribute.String("http.request.method", c.Request.Method),
+			attribute.String("url.path", c.Request.URL.Path),
+			attribute.String("request_id", c.GetString(common.RequestIdKey)),
+		)
+		defer span.End()
+		c.Next()
+		status := c.Writer.Status()
+		span.SetAttributes(
+			attribute.Int("http.response.status_code", status),
+			attribute.String("model", c.GetString("original_model")),
+			attribute.Int("channel.id", c.GetInt("channel_id")),
+			attribute.String("group", c.GetString("group")),
+			attribute.Int("user.id", c.GetInt("id")),
+		)
+		if status >= http.StatusInternalServerError {
+			common.SetSpanError(c, http.StatusText(status))
+		}
+	}
+}
@@ -27,3 +27,13 @@ func abortWithMidjourneyMessage(c *gin.Context, statusCode int, code int, descri
 	c.Abort()
 	common.LogError(c.Request.Context(), description)
 }
+
+// IsTokenModelAllowed 判断令牌的模型限制是否允许访问 modelName，供请求内部发起的其他模型调用（降级、向量计算等）复用
+func IsTokenModelAllowed(c *gin.Context, modelName string) bool {
+	if !c.GetBool("token_model_limit_enabled") {
+		return true
+	}
+	tokenModelLimit, _ := c.Get("token_model_limit")
+	limit, ok := tokenModelLimit.(map[string]bool)
+	return ok && limit[modelName]
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"one-api/common"
+	"one-api/setting/operation_setting"
 	"strings"
 
 	"github.com/samber/lo"
@@ -99,6 +100,9 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 	if err != nil {
 		return nil, err
 	}
+	if len(abilities) > 0 && operation_setting.IsAdaptiveLoadBalanceEnabled() {
+		return getAdaptiveSatisfiedChannel(abilities)
+	}
 	channel := Channel{}
 	if len(abilities) > 0 {
 		// Randomly choose one
@@ -123,6 +127,22 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 	return &channel, err
 }
 
+// getAdaptiveSatisfiedChannel 未开启内存缓存时的自适应选择，与内存缓存路径一样过滤熔断中的渠道并按自适应权重选择
+func getAdaptiveSatisfiedChannel(abilities []Ability) (*Channel, error) {
+	channelIds := make([]int, 0, len(abilities))
+	for _, ability := range abilities {
+		channelIds = append(channelIds, ability.ChannelId)
+	}
+	var channels []*Channel
+	if err := DB.Where("id in (?)", channelIds).Find(&channels).Error; err != nil {
+		return nil, err
+	}
+	if len(channels) == 0 {
+		return nil, errors.New("channel not found")
+	}
+	return pickAdaptiveChannel(filterEjectedChannels(channels), 10), nil
+}
+
 func (channel *Channel) AddAbilities() error {
 	models_ := strings.Split(channel.Models, ",")
 	groups_ := strings.Split(channel.Group, ",")
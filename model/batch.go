@@ -0,0 +1,114 @@
+package model
+
+import (
+	"errors"
+	"one-api/common"
+)
+
+const (
+	BatchStatusValidating = "validating"
+	BatchStatusFailed     = "failed"
+	BatchStatusInProgress = "in_progress"
+	BatchStatusFinalizing = "finalizing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusExpired    = "expired"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+)
+
+// Batch OpenAI Batch API 任务，输入文件中的每一行都会作为独立请求经过正常的转发流程
+type Batch struct {
+	Id               string `json:"id" gorm:"type:varchar(64);primaryKey"`
+	UserId           int    `json:"user_id" gorm:"index"`
+	TokenId          int    `json:"token_id" gorm:"index"`
+	ClientIp         string `json:"client_ip" gorm:"type:varchar(64)"`
+	Endpoint         string `json:"endpoint" gorm:"type:varchar(64)"`
+	InputFileId      string `json:"input_file_id" gorm:"type:varchar(64)"`
+	CompletionWindow string `json:"completion_window" gorm:"type:varchar(16)"`
+	Status           string `json:"status" gorm:"type:varchar(20);index"`
+	OutputFileId     string `json:"output_file_id" gorm:"type:varchar(64)"`
+	ErrorFileId      string `json:"error_file_id" gorm:"type:varchar(64)"`
+	Errors           string `json:"errors" gorm:"type:text"`
+	Metadata         string `json:"metadata" gorm:"type:text"`
+	TotalCount       int    `json:"total_count"`
+	CompletedCount   int    `json:"completed_count"`
+	FailedCount      int    `json:"failed_count"`
+	CreatedAt        int64  `json:"created_at" gorm:"bigint;index"`
+	InProgressAt     int64  `json:"in_progress_at" gorm:"bigint"`
+	ExpiresAt        int64  `json:"expires_at" gorm:"bigint"`
+	FinalizingAt     int64  `json:"finalizing_at" gorm:"bigint"`
+	CompletedAt      int64  `json:"completed_at" gorm:"bigint"`
+	FailedAt         int64  `json:"failed_at" gorm:"bigint"`
+	ExpiredAt        int64  `json:"expired_at" gorm:"bigint"`
+	CancellingAt     int64  `json:"cancelling_at" gorm:"bigint"`
+	CancelledAt      int64  `json:"cancelled_at" gorm:"bigint"`
+}
+
+func GenerateBatchId() string {
+	return "batch_" + common.GetRandomString(24)
+}
+
+func (batch *Batch) IsFinished() bool {
+	switch batch.Status {
+	case BatchStatusCompleted, BatchStatusFailed, BatchStatusExpired, BatchStatusCancelled:
+		return true
+	}
+	return false
+}
+
+func (batch *Batch) Insert() error {
+	return DB.Create(batch).Error
+}
+
+// UpdateStatusFrom 仅当数据库中的状态仍为 fromStatuses 之一时写入 fields，返回是否更新，
+// 避免处理协程与取消请求互相覆盖状态
+func (batch *Batch) UpdateStatusFrom(fields map[string]any, fromStatuses ...string) (bool, error) {
+	result := DB.Model(&Batch{}).Where("id = ? and status in (?)", batch.Id, fromStatuses).Updates(fields)
+	return result.RowsAffected > 0, result.Error
+}
+
+// UpdateProgress 仅更新计数，避免覆盖并发写入的状态（如取消）
+func (batch *Batch) UpdateProgress() error {
+	return DB.Model(&Batch{}).Where("id = ?", batch.Id).Updates(map[string]any{
+		"total_count":     batch.TotalCount,
+		"completed_count": batch.CompletedCount,
+		"failed_count":    batch.FailedCount,
+	}).Error
+}
+
+// GetBatchStatus 从数据库读取最新状态，供处理中的批任务检查是否被取消
+func GetBatchStatus(id string) (string, error) {
+	var status string
+	err := DB.Model(&Batch{}).Where("id = ?", id).Select("status").Scan(&status).Error
+	return status, err
+}
+
+func GetUserBatchById(userId int, id string) (*Batch, error) {
+	if id == "" {
+		return nil, errors.New("id 为空！")
+	}
+	batch := Batch{}
+	err := DB.Where("id = ? and user_id = ?", id, userId).First(&batch).Error
+	return &batch, err
+}
+
+// GetUserBatches 按创建时间倒序分页，after 为上一页最后一个 batch id
+func GetUserBatches(userId int, after string, limit int) ([]*Batch, error) {
+	var batches []*Batch
+	query := DB.Where("user_id = ?", userId)
+	if after != "" {
+		var afterBatch Batch
+		if err := DB.Where("id = ? and user_id = ?", after, userId).First(&afterBatch).Error; err == nil {
+			query = query.Where("created_at < ? or (created_at = ? and id < ?)", afterBatch.CreatedAt, afterBatch.CreatedAt, afterBatch.Id)
+		}
+	}
+	err := query.Order("created_at desc, id desc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+func GetUnfinishedBatches() ([]*Batch, error) {
+	var batches []*Batch
+	err := DB.Where("status in (?)", []string{BatchStatusValidating, BatchStatusInProgress, BatchStatusFinalizing, BatchStatusCancelling}).
+		Order("created_at").Find(&batches).Error
+	return batches, err
+}
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"one-api/common"
+)
+
+// BodyLog 请求与响应内容记录，通过 RequestId 与消费日志关联，Encrypted 为 true 时内容为加密后的密文
+type BodyLog struct {
+	Id                int64  `json:"id"`
+	RequestId         string `json:"request_id" gorm:"type:varchar(64);index"`
+	UserId            int    `json:"user_id" gorm:"index"`
+	TokenId           int    `json:"token_id" gorm:"index"`
+	Group             string `json:"group" gorm:"type:varchar(64)"`
+	ModelName         string `json:"model_name" gorm:"type:varchar(128)"`
+	Path              string `json:"path" gorm:"type:varchar(255)"`
+	StatusCode        int    `json:"status_code"`
+	RequestBody       string `json:"request_body" gorm:"type:text"`
+	ResponseBody      string `json:"response_body" gorm:"type:text"`
+	RequestTruncated  bool   `json:"request_truncated"`
+	ResponseTruncated bool   `json:"response_truncated"`
+	Encrypted         bool   `json:"encrypted"`
+	CreatedAt         int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+func (bodyLog *BodyLog) Insert() error {
+	bodyLog.CreatedAt = common.GetTimestamp()
+	return LOG_DB.Create(bodyLog).Error
+}
+
+func GetBodyLogByRequestId(requestId string) (*BodyLog, error) {
+	bodyLog := BodyLog{}
+	err := LOG_DB.Where("request_id = ?", requestId).First(&bodyLog).Error
+	return &bodyLog, err
+}
+
+// DeleteBodyLogsBefore 分批删除创建时间早于 timestamp 的内容记录，返回删除的数量
+func DeleteBodyLogsBefore(timestamp int64, limit int) (int64, error) {
+	var total int64
+	for {
+		var ids []int64
+		if err := LOG_DB.Model(&BodyLog{}).Where("created_at < ?", timestamp).Limit(limit).Pluck("id", &ids).Error; err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			return total, nil
+		}
+		result := LOG_DB.Where("id IN ?", ids).Delete(&BodyLog{})
+		if result.Error != nil {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+	}
+}
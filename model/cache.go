@@ -6,6 +6,7 @@ import (
 	"math/rand"
 	"one-api/common"
 	"one-api/setting"
+	"one-api/setting/operation_setting"
 	"sort"
 	"strings"
 	"sync"
@@ -67,6 +68,7 @@ func InitChannelCache() {
 	group2model2channels = newGroup2model2channels
 	channelsIDM = newChannelsIDM
 	channelSyncLock.Unlock()
+	initChannelKeyCache(newChannelsIDM)
 	common.SysLog("channels synced from database")
 }
 
@@ -135,6 +137,11 @@ func getRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 		return nil, errors.New("channel not found")
 	}
 
+	adaptive := operation_setting.IsAdaptiveLoadBalanceEnabled()
+	if adaptive {
+		channels = filterEjectedChannels(channels)
+	}
+
 	uniquePriorities := make(map[int]bool)
 	for _, channel := range channels {
 		uniquePriorities[int(channel.GetPriority())] = true
@@ -160,6 +167,9 @@ func getRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 
 	// 平滑系数
 	smoothingFactor := 10
+	if adaptive {
+		return pickAdaptiveChannel(targetChannels, smoothingFactor), nil
+	}
 	// Calculate the total weight of all channels up to endIdx
 	totalWeight := 0
 	for _, channel := range targetChannels {
@@ -187,6 +197,7 @@ func CacheGetChannel(id int) (*Channel, error) {
 	defer channelSyncLock.RUnlock()
 
 	c, ok := channelsIDM[id]
+	common.RecordCacheLookup("channel", ok)
 	if !ok {
 		return nil, errors.New(fmt.Sprintf("当前渠道# %d，已不存在", id))
 	}
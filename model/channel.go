@@ -37,6 +37,8 @@ type Channel struct {
 	Tag               *string `json:"tag" gorm:"index"`
 	Setting           *string `json:"setting" gorm:"type:text"`
 	ParamOverride     *string `json:"param_override" gorm:"type:text"`
+	// MultiKeyMode 多密钥模式（round_robin / random），为空表示单密钥渠道，密钥保存在 ChannelKey 中
+	MultiKeyMode string `json:"multi_key_mode" gorm:"type:varchar(16);default:''"`
 }
 
 func (channel *Channel) GetModels() []string {
@@ -114,6 +116,13 @@ func GetAllChannels(startIdx int, num int, selectAll bool, idSort bool) ([]*Chan
 	return channels, err
 }
 
+// GetAllChannelStatuses 获取所有渠道的 ID、名称、类型和状态，用于监控指标
+func GetAllChannelStatuses() ([]*Channel, error) {
+	var channels []*Channel
+	err := DB.Select("id", "name", "type", "status").Find(&channels).Error
+	return channels, err
+}
+
 func GetChannelsByTag(tag string, idSort bool) ([]*Channel, error) {
 	var channels []*Channel
 	order := "priority desc"
@@ -214,6 +223,12 @@ func BatchDeleteChannels(ids []int) error {
 		tx.Rollback()
 		return err
 	}
+	err = deleteChannelKeysByChannelIds(tx, ids)
+	if err != nil {
+		// 回滚事务
+		tx.Rollback()
+		return err
+	}
 	// 提交事务
 	tx.Commit()
 	return err
@@ -302,6 +317,10 @@ func (channel *Channel) Delete() error {
 		return err
 	}
 	err = channel.DeleteAbilities()
+	if err != nil {
+		return err
+	}
+	err = deleteChannelKeysByChannelIds(DB, []int{channel.Id})
 	return err
 }
 
@@ -0,0 +1,276 @@
+package model
+
+import (
+	"errors"
+	"math/rand"
+	"one-api/common"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ChannelMultiKeyModeRoundRobin = "round_robin"
+	ChannelMultiKeyModeRandom     = "random"
+)
+
+// ChannelKey 多密钥渠道中的单个密钥，状态取值与渠道状态一致
+type ChannelKey struct {
+	Id           int    `json:"id"`
+	ChannelId    int    `json:"channel_id" gorm:"index"`
+	Key          string `json:"key" gorm:"type:text;not null"`
+	Status       int    `json:"status" gorm:"default:1;index"`
+	StatusReason string `json:"status_reason" gorm:"type:text"`
+	StatusTime   int64  `json:"status_time" gorm:"bigint"`
+	UsedCount    int    `json:"used_count" gorm:"default:0"`
+	UsedQuota    int64  `json:"used_quota" gorm:"bigint;default:0"`
+	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
+}
+
+var channelKeysCache = make(map[int][]*ChannelKey)
+var channelKeyIndex sync.Map // channelId -> *uint64，轮询计数
+
+func (channel *Channel) IsMultiKey() bool {
+	return channel.MultiKeyMode != ""
+}
+
+// MaskedKey 返回脱敏后的密钥，仅保留首尾各 4 位
+func (channelKey *ChannelKey) MaskedKey() string {
+	if len(channelKey.Key) <= 8 {
+		return strings.Repeat("*", len(channelKey.Key))
+	}
+	return channelKey.Key[:4] + strings.Repeat("*", 8) + channelKey.Key[len(channelKey.Key)-4:]
+}
+
+// initChannelKeyCache 加载所有启用的密钥，由 InitChannelCache 调用
+func initChannelKeyCache(channelIds map[int]*Channel) {
+	var keys []*ChannelKey
+	DB.Where("status = ?", common.ChannelStatusEnabled).Order("id").Find(&keys)
+	newChannelKeysCache := make(map[int][]*ChannelKey)
+	for _, key := range keys {
+		if _, ok := channelIds[key.ChannelId]; !ok {
+			continue
+		}
+		newChannelKeysCache[key.ChannelId] = append(newChannelKeysCache[key.ChannelId], key)
+	}
+	channelSyncLock.Lock()
+	channelKeysCache = newChannelKeysCache
+	channelSyncLock.Unlock()
+}
+
+func getEnabledChannelKeys(channelId int) []*ChannelKey {
+	if common.MemoryCacheEnabled {
+		channelSyncLock.RLock()
+		defer channelSyncLock.RUnlock()
+		return channelKeysCache[channelId]
+	}
+	var keys []*ChannelKey
+	DB.Where("channel_id = ? and status = ?", channelId, common.ChannelStatusEnabled).Order("id").Find(&keys)
+	return keys
+}
+
+// SelectChannelKey 按渠道的多密钥模式从启用的密钥中选择一个，没有可用密钥时返回 nil
+func SelectChannelKey(channel *Channel) *ChannelKey {
+	keys := getEnabledChannelKeys(channel.Id)
+	if len(keys) == 0 {
+		return nil
+	}
+	var channelKey *ChannelKey
+	if channel.MultiKeyMode == ChannelMultiKeyModeRandom {
+		channelKey = keys[rand.Intn(len(keys))]
+	} else {
+		v, _ := channelKeyIndex.LoadOrStore(channel.Id, new(uint64))
+		idx := atomic.AddUint64(v.(*uint64), 1) - 1
+		channelKey = keys[idx%uint64(len(keys))]
+	}
+	return channelKey
+}
+
+// GetChannelKeyByKeyId 返回渠道中指定 id 的密钥（包括已禁用的），用于轮询、取消等需要沿用提交时密钥的场景。
+// 密钥不存在时退回到第一个启用的密钥，非多密钥渠道返回 nil
+func (channel *Channel) GetChannelKeyByKeyId(channelKeyId int) *ChannelKey {
+	if !channel.IsMultiKey() {
+		return nil
+	}
+	keys := getEnabledChannelKeys(channel.Id)
+	if channelKeyId != 0 {
+		for _, key := range keys {
+			if key.Id == channelKeyId {
+				return key
+			}
+		}
+		if channelKey, err := GetChannelKeyById(channel.Id, channelKeyId); err == nil {
+			return channelKey
+		}
+	}
+	if len(keys) > 0 {
+		return keys[0]
+	}
+	return nil
+}
+
+// GetKeyByKeyId 返回渠道中指定 id 的密钥内容，找不到时返回渠道本身的密钥
+func (channel *Channel) GetKeyByKeyId(channelKeyId int) string {
+	if channelKey := channel.GetChannelKeyByKeyId(channelKeyId); channelKey != nil {
+		return channelKey.Key
+	}
+	return channel.Key
+}
+
+func GetChannelKeys(channelId int) ([]*ChannelKey, error) {
+	var keys []*ChannelKey
+	err := DB.Where("channel_id = ?", channelId).Order("id").Find(&keys).Error
+	return keys, err
+}
+
+func GetChannelKeyById(channelId int, id int) (*ChannelKey, error) {
+	channelKey := ChannelKey{}
+	err := DB.Where("id = ? and channel_id = ?", id, channelId).First(&channelKey).Error
+	return &channelKey, err
+}
+
+func CountEnabledChannelKeys(channelId int) (int64, error) {
+	var count int64
+	err := DB.Model(&ChannelKey{}).Where("channel_id = ? and status = ?", channelId, common.ChannelStatusEnabled).Count(&count).Error
+	return count, err
+}
+
+// AddChannelKeys 向渠道添加密钥，忽略空行以及渠道中已存在的密钥，返回实际添加的数量
+func AddChannelKeys(channelId int, keys []string) (int, error) {
+	existing, err := GetChannelKeys(channelId)
+	if err != nil {
+		return 0, err
+	}
+	seen := make(map[string]bool, len(existing))
+	for _, key := range existing {
+		seen[key.Key] = true
+	}
+	now := common.GetTimestamp()
+	channelKeys := make([]ChannelKey, 0, len(keys))
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		channelKeys = append(channelKeys, ChannelKey{
+			ChannelId:   channelId,
+			Key:         key,
+			Status:      common.ChannelStatusEnabled,
+			CreatedTime: now,
+		})
+	}
+	if len(channelKeys) == 0 {
+		return 0, nil
+	}
+	if err = DB.Create(&channelKeys).Error; err != nil {
+		return 0, err
+	}
+	if common.MemoryCacheEnabled {
+		channelSyncLock.Lock()
+		for i := range channelKeys {
+			channelKeysCache[channelId] = append(channelKeysCache[channelId], &channelKeys[i])
+		}
+		channelSyncLock.Unlock()
+	}
+	return len(channelKeys), nil
+}
+
+func DeleteChannelKey(channelId int, id int) error {
+	result := DB.Where("id = ? and channel_id = ?", id, channelId).Delete(&ChannelKey{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("密钥不存在")
+	}
+	cacheRemoveChannelKey(channelId, id)
+	return nil
+}
+
+func deleteChannelKeysByChannelIds(tx *gorm.DB, channelIds []int) error {
+	return tx.Where("channel_id in (?)", channelIds).Delete(&ChannelKey{}).Error
+}
+
+func cacheRemoveChannelKey(channelId int, id int) {
+	if !common.MemoryCacheEnabled {
+		return
+	}
+	channelSyncLock.Lock()
+	defer channelSyncLock.Unlock()
+	keys := channelKeysCache[channelId]
+	for i, key := range keys {
+		if key.Id == id {
+			channelKeysCache[channelId] = append(keys[:i:i], keys[i+1:]...)
+			return
+		}
+	}
+}
+
+// UpdateChannelKeyStatusById 与 UpdateChannelStatusById 语义一致，但作用于单个密钥，状态未变化时返回 false
+func UpdateChannelKeyStatusById(channelId int, id int, status int, reason string) bool {
+	channelStatusLock.Lock()
+	defer channelStatusLock.Unlock()
+	channelKey, err := GetChannelKeyById(channelId, id)
+	if err != nil || channelKey.Status == status {
+		return false
+	}
+	channelKey.Status = status
+	channelKey.StatusReason = reason
+	channelKey.StatusTime = common.GetTimestamp()
+	err = DB.Model(channelKey).Select("status", "status_reason", "status_time").Updates(channelKey).Error
+	if err != nil {
+		common.SysError("failed to update channel key status: " + err.Error())
+		return false
+	}
+	if common.MemoryCacheEnabled {
+		if status == common.ChannelStatusEnabled {
+			channelSyncLock.Lock()
+			channelKeysCache[channelId] = append(channelKeysCache[channelId], channelKey)
+			channelSyncLock.Unlock()
+		} else {
+			cacheRemoveChannelKey(channelId, id)
+		}
+	}
+	return true
+}
+
+// UpdateChannelKeyUsedCount 累计密钥使用次数，id 为 0（非多密钥渠道）时忽略
+func UpdateChannelKeyUsedCount(id int, count int) {
+	if id == 0 {
+		return
+	}
+	if common.BatchUpdateEnabled {
+		addNewRecord(BatchUpdateTypeChannelKeyUsedCount, id, count)
+		return
+	}
+	updateChannelKeyUsedCount(id, count)
+}
+
+func updateChannelKeyUsedCount(id int, count int) {
+	err := DB.Model(&ChannelKey{}).Where("id = ?", id).Update("used_count", gorm.Expr("used_count + ?", count)).Error
+	if err != nil {
+		common.SysError("failed to update channel key used count: " + err.Error())
+	}
+}
+
+// UpdateChannelKeyUsedQuota 累计密钥消耗额度，id 为 0（非多密钥渠道）时忽略
+func UpdateChannelKeyUsedQuota(id int, quota int) {
+	if id == 0 {
+		return
+	}
+	if common.BatchUpdateEnabled {
+		addNewRecord(BatchUpdateTypeChannelKeyUsedQuota, id, quota)
+		return
+	}
+	updateChannelKeyUsedQuota(id, quota)
+}
+
+func updateChannelKeyUsedQuota(id int, quota int) {
+	err := DB.Model(&ChannelKey{}).Where("id = ?", id).Update("used_quota", gorm.Expr("used_quota + ?", quota)).Error
+	if err != nil {
+		common.SysError("failed to update channel key used quota: " + err.Error())
+	}
+}
@@ -0,0 +1,304 @@
+package model
+
+import (
+	"math/rand"
+	"one-api/setting/operation_setting"
+	"sync"
+	"time"
+)
+
+// channelStatBucket 每秒一个统计桶
+type channelStatBucket struct {
+	second    int64
+	requests  int
+	errors    int
+	latencyMs int64
+	ttftMs    int64
+	ttftCount int
+}
+
+// channelStat 单个渠道在滑动窗口内的统计以及熔断状态，仅保存在当前节点内存中。
+// 熔断到期后进入半开状态，只放行一个试探请求，probeStartedAt 为试探请求的放行时间
+type channelStat struct {
+	mu             sync.Mutex
+	buckets        []channelStatBucket
+	ejectedUntil   int64
+	halfOpen       bool
+	probeStartedAt int64
+}
+
+// ChannelHealth 渠道在滑动窗口内的健康状况
+type ChannelHealth struct {
+	ChannelId    int     `json:"channel_id"`
+	Requests     int     `json:"requests"`
+	Errors       int     `json:"errors"`
+	ErrorRate    float64 `json:"error_rate"`
+	AvgLatencyMs int64   `json:"avg_latency_ms"`
+	AvgTTFTMs    int64   `json:"avg_ttft_ms"`
+	EjectedUntil int64   `json:"ejected_until"`
+	HalfOpen     bool    `json:"half_open"`
+}
+
+var channelStats sync.Map // channelId -> *channelStat
+
+func getChannelStat(channelId int) *channelStat {
+	if v, ok := channelStats.Load(channelId); ok {
+		return v.(*channelStat)
+	}
+	v, _ := channelStats.LoadOrStore(channelId, &channelStat{})
+	return v.(*channelStat)
+}
+
+func (s *channelStat) bucket(now int64, window int) *channelStatBucket {
+	if len(s.buckets) != window {
+		s.buckets = make([]channelStatBucket, window)
+	}
+	b := &s.buckets[now%int64(window)]
+	if b.second != now {
+		*b = channelStatBucket{second: now}
+	}
+	return b
+}
+
+// health 汇总窗口内的统计，调用方需持有锁
+func (s *channelStat) health(now int64, window int) ChannelHealth {
+	var h ChannelHealth
+	var latencyMs, ttftMs int64
+	var ttftCount int
+	for _, b := range s.buckets {
+		if b.second <= now-int64(window) || b.second > now {
+			continue
+		}
+		h.Requests += b.requests
+		h.Errors += b.errors
+		latencyMs += b.latencyMs
+		ttftMs += b.ttftMs
+		ttftCount += b.ttftCount
+	}
+	if h.Requests > 0 {
+		h.ErrorRate = float64(h.Errors) / float64(h.Requests)
+	}
+	if success := h.Requests - h.Errors; success > 0 {
+		h.AvgLatencyMs = latencyMs / int64(success)
+	}
+	if ttftCount > 0 {
+		h.AvgTTFTMs = ttftMs / int64(ttftCount)
+	}
+	h.EjectedUntil = s.ejectedUntil
+	h.HalfOpen = s.halfOpen
+	return h
+}
+
+// RecordChannelResult 记录一次渠道请求结果，ttft 为 0 表示非流式请求或未返回内容
+func RecordChannelResult(channelId int, success bool, latency time.Duration, ttft time.Duration) {
+	if channelId == 0 {
+		return
+	}
+	setting := operation_setting.GetLoadBalanceSetting()
+	window := setting.WindowSeconds
+	if window <= 0 {
+		window = 60
+	}
+	s := getChannelStat(channelId)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().Unix()
+	b := s.bucket(now, window)
+	b.requests++
+	if success {
+		b.latencyMs += latency.Milliseconds()
+		if ttft > 0 {
+			b.ttftMs += ttft.Milliseconds()
+			b.ttftCount++
+		}
+	} else {
+		b.errors++
+	}
+
+	// 熔断期内仍在进行的旧请求不影响熔断状态，熔断到期后的试探请求决定恢复还是继续熔断
+	if s.ejectedUntil != 0 {
+		if now < s.ejectedUntil {
+			return
+		}
+		if success {
+			s.ejectedUntil = 0
+			s.halfOpen = false
+			s.buckets = nil
+		} else {
+			s.ejectedUntil = now + int64(setting.EjectSeconds)
+			s.halfOpen = true
+		}
+		s.probeStartedAt = 0
+		return
+	}
+	if success || setting.ErrorRateThreshold <= 0 {
+		return
+	}
+	h := s.health(now, window)
+	if h.Requests >= setting.MinRequests && h.ErrorRate >= setting.ErrorRateThreshold {
+		s.ejectedUntil = now + int64(setting.EjectSeconds)
+	}
+}
+
+// probing 半开状态下是否已有试探请求在进行，试探请求超过熔断时长仍未返回结果时允许重新试探，调用方需持有锁
+func (s *channelStat) probing(now int64) bool {
+	timeout := int64(operation_setting.GetLoadBalanceSetting().EjectSeconds)
+	if timeout <= 0 {
+		timeout = 30
+	}
+	return s.probeStartedAt != 0 && now-s.probeStartedAt < timeout
+}
+
+// IsChannelEjected 渠道是否处于熔断期内，半开状态下已有试探请求在进行时同样视为熔断
+func IsChannelEjected(channelId int) bool {
+	v, ok := channelStats.Load(channelId)
+	if !ok {
+		return false
+	}
+	s := v.(*channelStat)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().Unix()
+	if s.ejectedUntil == 0 {
+		return false
+	}
+	return now < s.ejectedUntil || s.probing(now)
+}
+
+// acquireChannelProbe 选中渠道后调用：渠道处于半开状态时抢占唯一的试探名额，抢占失败返回 false；
+// 渠道未熔断时直接返回 true
+func acquireChannelProbe(channelId int) bool {
+	v, ok := channelStats.Load(channelId)
+	if !ok {
+		return true
+	}
+	s := v.(*channelStat)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().Unix()
+	if s.ejectedUntil == 0 {
+		return true
+	}
+	if now < s.ejectedUntil || s.probing(now) {
+		return false
+	}
+	s.probeStartedAt = now
+	return true
+}
+
+func GetChannelHealth(channelId int) ChannelHealth {
+	window := operation_setting.GetLoadBalanceSetting().WindowSeconds
+	if window <= 0 {
+		window = 60
+	}
+	s := getChannelStat(channelId)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := s.health(time.Now().Unix(), window)
+	h.ChannelId = channelId
+	return h
+}
+
+// GetAllChannelHealth 返回所有有统计数据的渠道健康状况
+func GetAllChannelHealth() []ChannelHealth {
+	var result []ChannelHealth
+	channelStats.Range(func(key, value any) bool {
+		result = append(result, GetChannelHealth(key.(int)))
+		return true
+	})
+	return result
+}
+
+// filterEjectedChannels 过滤熔断中的渠道，全部熔断时返回原列表，避免无渠道可用
+func filterEjectedChannels(channels []*Channel) []*Channel {
+	available := make([]*Channel, 0, len(channels))
+	for _, channel := range channels {
+		if !IsChannelEjected(channel.Id) {
+			available = append(available, channel)
+		}
+	}
+	if len(available) == 0 {
+		return channels
+	}
+	return available
+}
+
+// pickAdaptiveChannel 按自适应权重随机选择渠道，选中半开状态且试探名额已被占用的渠道时将其移出候选后重新选择
+func pickAdaptiveChannel(channels []*Channel, smoothingFactor int) *Channel {
+	candidates := channels
+	for len(candidates) > 0 {
+		weights := adaptiveWeights(candidates, smoothingFactor)
+		totalWeight := 0.0
+		for _, weight := range weights {
+			totalWeight += weight
+		}
+		randomWeight := rand.Float64() * totalWeight
+		selected := len(candidates) - 1
+		for i := range candidates {
+			randomWeight -= weights[i]
+			if randomWeight < 0 {
+				selected = i
+				break
+			}
+		}
+		if acquireChannelProbe(candidates[selected].Id) {
+			return candidates[selected]
+		}
+		candidates = append(candidates[:selected:selected], candidates[selected+1:]...)
+	}
+	// 所有渠道均在熔断中，与 filterEjectedChannels 一样不拒绝请求
+	return channels[rand.Intn(len(channels))]
+}
+
+// adaptiveWeights 在静态权重的基础上按错误率和延迟调整。同优先级的渠道使用同一种延迟指标比较：
+// 所有有延迟数据的渠道都有首字时间时比较首字时间，否则比较整体耗时；无统计数据的渠道保持原权重以便获得探测流量
+func adaptiveWeights(channels []*Channel, smoothingFactor int) []float64 {
+	healths := make([]ChannelHealth, len(channels))
+	useTTFT := true
+	for i, channel := range channels {
+		healths[i] = GetChannelHealth(channel.Id)
+		if healths[i].AvgLatencyMs > 0 && healths[i].AvgTTFTMs == 0 {
+			useTTFT = false
+		}
+	}
+	healthLatency := func(h ChannelHealth) int64 {
+		if useTTFT {
+			return h.AvgTTFTMs
+		}
+		return h.AvgLatencyMs
+	}
+	var latencySum int64
+	var latencyCount int
+	for _, h := range healths {
+		if l := healthLatency(h); l > 0 {
+			latencySum += l
+			latencyCount++
+		}
+	}
+	weights := make([]float64, len(channels))
+	for i, channel := range channels {
+		weight := float64(channel.GetWeight() + smoothingFactor)
+		h := healths[i]
+		if h.Requests > 0 {
+			// 拉普拉斯平滑，避免少量样本导致权重剧烈波动
+			successRate := float64(h.Requests-h.Errors+1) / float64(h.Requests+2)
+			weight *= successRate * successRate
+		}
+		if l := healthLatency(h); l > 0 && latencyCount > 1 {
+			factor := float64(latencySum) / float64(latencyCount) / float64(l)
+			if factor < 0.2 {
+				factor = 0.2
+			} else if factor > 5 {
+				factor = 5
+			}
+			weight *= factor
+		}
+		// 保留极小权重，避免渠道完全没有流量而无法恢复
+		if weight < 0.01 {
+			weight = 0.01
+		}
+		weights[i] = weight
+	}
+	return weights
+}
@@ -0,0 +1,183 @@
+package model
+
+import (
+	"encoding/base64"
+	"errors"
+	"one-api/common"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	FilePurposeBatch       = "batch"
+	FilePurposeBatchOutput = "batch_output"
+)
+
+// fileChunkSize 单个内容分片的原始字节数，base64 编码后约 32KB，可以放入各数据库的 text 列
+const fileChunkSize = 24 * 1024
+
+// File 用户上传的文件（如 batch 输入文件），内容按分片保存在数据库的 FileChunk 中，各节点均可读取
+type File struct {
+	Id        string `json:"id" gorm:"type:varchar(64);primaryKey"`
+	UserId    int    `json:"user_id" gorm:"index"`
+	Bytes     int64  `json:"bytes"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose" gorm:"type:varchar(32);index"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;index"`
+	ExpiresAt int64  `json:"expires_at" gorm:"bigint;index"`
+}
+
+// FileChunk 文件内容分片，按 Id 顺序拼接得到完整内容。批处理输出在处理过程中以临时 FileId 逐行追加，
+// 完成后改为正式文件的 Id
+type FileChunk struct {
+	Id     int64  `json:"id"`
+	FileId string `json:"file_id" gorm:"type:varchar(64);index"`
+	Bytes  int    `json:"bytes"`
+	Data   string `json:"data" gorm:"type:text"`
+}
+
+func GenerateFileId() string {
+	return "file-" + common.GetRandomString(24)
+}
+
+func newFileChunks(id string, data []byte) []*FileChunk {
+	chunks := make([]*FileChunk, 0, len(data)/fileChunkSize+1)
+	for start := 0; start < len(data); start += fileChunkSize {
+		end := start + fileChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunks = append(chunks, &FileChunk{
+			FileId: id,
+			Bytes:  end - start,
+			Data:   base64.StdEncoding.EncodeToString(data[start:end]),
+		})
+	}
+	return chunks
+}
+
+// AppendFileContent 在一个事务中追加文件内容，用于批处理逐行写入输出，不会留下写了一半的内容
+func AppendFileContent(id string, data []byte) error {
+	chunks := newFileChunks(id, data)
+	if len(chunks) == 0 {
+		return nil
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return tx.Create(&chunks).Error
+	})
+}
+
+// ReadFileContent 读取文件内容，内容不存在时返回 gorm.ErrRecordNotFound
+func ReadFileContent(id string) ([]byte, error) {
+	var chunks []*FileChunk
+	if err := DB.Where("file_id = ?", id).Order("id asc").Find(&chunks).Error; err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var content strings.Builder
+	for _, chunk := range chunks {
+		data, err := base64.StdEncoding.DecodeString(chunk.Data)
+		if err != nil {
+			return nil, err
+		}
+		content.Write(data)
+	}
+	return []byte(content.String()), nil
+}
+
+// DeleteFileContent 删除文件内容，用于清理未登记为文件的临时内容
+func DeleteFileContent(id string) error {
+	return DB.Where("file_id = ?", id).Delete(&FileChunk{}).Error
+}
+
+// Insert 保存文件记录与内容
+func (file *File) Insert(data []byte) error {
+	chunks := newFileChunks(file.Id, data)
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if len(chunks) > 0 {
+			if err := tx.Create(&chunks).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(file).Error
+	})
+}
+
+// Delete 删除文件记录以及内容
+func (file *File) Delete() error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("file_id = ?", file.Id).Delete(&FileChunk{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(file).Error
+	})
+}
+
+func GetUserFileById(userId int, id string) (*File, error) {
+	if id == "" {
+		return nil, errors.New("id 为空！")
+	}
+	file := File{}
+	err := DB.Where("id = ? and user_id = ?", id, userId).First(&file).Error
+	return &file, err
+}
+
+func GetUserFiles(userId int, purpose string, limit int) ([]*File, error) {
+	var files []*File
+	query := DB.Where("user_id = ?", userId)
+	if purpose != "" {
+		query = query.Where("purpose = ?", purpose)
+	}
+	err := query.Order("created_at desc").Limit(limit).Find(&files).Error
+	return files, err
+}
+
+// CreateFileFromContent 将已写入的临时内容登记为用户文件，临时内容不存在时返回 nil
+func CreateFileFromContent(userId int, tmpId string, filename string, purpose string, expiresAt int64) (*File, error) {
+	var size int64
+	if err := DB.Model(&FileChunk{}).Where("file_id = ?", tmpId).Select("coalesce(sum(bytes), 0)").Scan(&size).Error; err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	file := &File{
+		Id:        GenerateFileId(),
+		UserId:    userId,
+		Bytes:     size,
+		Filename:  filename,
+		Purpose:   purpose,
+		CreatedAt: common.GetTimestamp(),
+		ExpiresAt: expiresAt,
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&FileChunk{}).Where("file_id = ?", tmpId).Update("file_id", file.Id).Error; err != nil {
+			return err
+		}
+		return tx.Create(file).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// DeleteExpiredFiles 删除已过期的文件及其内容，每次最多处理 limit 个，返回删除的数量
+func DeleteExpiredFiles(now int64, limit int) (int, error) {
+	var files []*File
+	err := DB.Where("expires_at > 0 and expires_at < ?", now).Order("expires_at asc").Limit(limit).Find(&files).Error
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, file := range files {
+		if err = file.Delete(); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
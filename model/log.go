@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"one-api/common"
 	"one-api/constant"
+	"one-api/setting/operation_setting"
 	"os"
 	"strings"
 	"time"
@@ -44,6 +45,7 @@ const (
 	LogTypeManage
 	LogTypeSystem
 	LogTypeError
+	LogTypeRefund
 )
 
 func formatUserLogs(logs []*Log) {
@@ -92,11 +94,80 @@ func RecordLog(userId int, logType int, content string) {
 	}
 }
 
+// RecordRefundLog 记录异步任务失败后退还额度的日志，Quota 为退还的额度
+func RecordRefundLog(userId int, tokenId int, channelId int, modelName string, quota int, content string, other map[string]interface{}) {
+	username, _ := GetUsernameById(userId, false)
+	var tokenName string
+	if tokenId != 0 {
+		if token, err := GetTokenById(tokenId); err == nil {
+			tokenName = token.Name
+		}
+	}
+	log := &Log{
+		UserId:    userId,
+		Username:  username,
+		CreatedAt: common.GetTimestamp(),
+		Type:      LogTypeRefund,
+		Content:   content,
+		TokenName: tokenName,
+		ModelName: modelName,
+		Quota:     quota,
+		ChannelId: channelId,
+		TokenId:   tokenId,
+		Other:     common.MapToJsonStr(other),
+	}
+	err := LOG_DB.Create(log).Error
+	if err != nil {
+		common.SysError("failed to record refund log: " + err.Error())
+	}
+}
+
+// logExporter 将消费与错误日志导出到外部存储，返回 true 时表示仅导出、不再写入数据库
+var logExporter func(log *Log) bool
+
+// SetLogExporter 设置消费与错误日志的导出器
+func SetLogExporter(exporter func(log *Log) bool) {
+	logExporter = exporter
+}
+
+func insertLog(c *gin.Context, log *Log) {
+	if logExporter != nil && logExporter(log) {
+		return
+	}
+	if logWriter != nil {
+		logWriter.enqueue(log)
+		return
+	}
+	if err := LOG_DB.Create(log).Error; err != nil {
+		common.LogError(c, "failed to record log: "+err.Error())
+	}
+}
+
+// withRequestLinks 将当前请求的 trace id 以及内容记录对应的请求 ID 写入 other，便于从日志跳转到对应链路和请求内容
+func withRequestLinks(c *gin.Context, userId int, other map[string]interface{}) map[string]interface{} {
+	traceId := common.GetTraceId(c)
+	bodyLogged := c.GetBool(constant.ContextKeyBodyLogCapture) &&
+		operation_setting.IsBodyLogEnabledFor(userId, c.GetString("group"), c.GetBool("token_body_log"))
+	if traceId == "" && !bodyLogged {
+		return other
+	}
+	if other == nil {
+		other = make(map[string]interface{})
+	}
+	if traceId != "" {
+		other["trace_id"] = traceId
+	}
+	if bodyLogged {
+		other["body_log_id"] = c.GetString(common.RequestIdKey)
+	}
+	return other
+}
+
 func RecordErrorLog(c *gin.Context, userId int, channelId int, modelName string, tokenName string, content string, tokenId int, useTimeSeconds int,
 	isStream bool, group string, other map[string]interface{}) {
 	common.LogInfo(c, fmt.Sprintf("record error log: userId=%d, channelId=%d, modelName=%s, tokenName=%s, content=%s", userId, channelId, modelName, tokenName, content))
 	username := c.GetString("username")
-	otherStr := common.MapToJsonStr(other)
+	otherStr := common.MapToJsonStr(withRequestLinks(c, userId, other))
 	// 判断是否需要记录 IP
 	needRecordIp := false
 	if settingMap, err := GetUserSetting(userId, false); err == nil {
@@ -130,21 +201,23 @@ func RecordErrorLog(c *gin.Context, userId int, channelId int, modelName string,
 		}(),
 		Other: otherStr,
 	}
-	err := LOG_DB.Create(log).Error
-	if err != nil {
-		common.LogError(c, "failed to record log: "+err.Error())
-	}
+	insertLog(c, log)
 }
 
 func RecordConsumeLog(c *gin.Context, userId int, channelId int, promptTokens int, completionTokens int,
 	modelName string, tokenName string, quota int, content string, tokenId int, userQuota int, useTimeSeconds int,
 	isStream bool, group string, other map[string]interface{}) {
 	common.LogInfo(c, fmt.Sprintf("record consume log: userId=%d, 用户调用前余额=%d, channelId=%d, promptTokens=%d, completionTokens=%d, modelName=%s, tokenName=%s, quota=%d, content=%s", userId, userQuota, channelId, promptTokens, completionTokens, modelName, tokenName, quota, content))
+	common.RecordTokenUsage(modelName, channelId, group, promptTokens, completionTokens)
+	common.RecordQuotaConsumed(modelName, channelId, group, quota)
+	if frt, ok := other["frt"].(float64); ok && isStream && frt > 0 {
+		common.RecordRelayFirstToken(modelName, channelId, group, time.Duration(frt)*time.Millisecond)
+	}
 	if !common.LogConsumeEnabled {
 		return
 	}
 	username := c.GetString("username")
-	otherStr := common.MapToJsonStr(other)
+	otherStr := common.MapToJsonStr(withRequestLinks(c, userId, other))
 	// 判断是否需要记录 IP
 	needRecordIp := false
 	if settingMap, err := GetUserSetting(userId, false); err == nil {
@@ -178,10 +251,7 @@ func RecordConsumeLog(c *gin.Context, userId int, channelId int, promptTokens in
 		}(),
 		Other: otherStr,
 	}
-	err := LOG_DB.Create(log).Error
-	if err != nil {
-		common.LogError(c, "failed to record log: "+err.Error())
-	}
+	insertLog(c, log)
 	if common.DataExportEnabled {
 		gopool.Go(func() {
 			LogQuotaData(userId, username, modelName, quota, common.GetTimestamp(), promptTokens+completionTokens)
@@ -0,0 +1,251 @@
+package model
+
+import (
+	"fmt"
+	"one-api/common"
+	"sync"
+	"time"
+)
+
+// logBatchWriter 日志异步批量写入，按数量或时间阈值批量插入数据库以降低写入压力。
+// 写入失败或队列已满时日志暂存到磁盘，数据库恢复后重放；数据库拒绝的日志隔离到单独的文件；关闭时写入缓冲中剩余的日志
+type logBatchWriter struct {
+	queue      chan *Log
+	spool      *common.Spool
+	quarantine *common.Spool
+	batchSize  int
+	interval   time.Duration
+	stop       chan struct{}
+	done       chan struct{}
+	// mu 保护 closed，保证关闭后不再有日志进入队列
+	mu     sync.RWMutex
+	closed bool
+}
+
+// logWriterReplayBatches 每次重放的最大批数，避免重放期间队列积压
+const logWriterReplayBatches = 10
+
+var logWriter *logBatchWriter
+
+// InitLogBatchWriter 开启日志异步批量写入
+func InitLogBatchWriter() error {
+	spool, err := common.NewSpool("log-db")
+	if err != nil {
+		return err
+	}
+	quarantine, err := common.NewSpool("log-db-dead")
+	if err != nil {
+		return err
+	}
+	writer := &logBatchWriter{
+		queue:      make(chan *Log, common.LogBatchWriteQueueSize),
+		spool:      spool,
+		quarantine: quarantine,
+		batchSize:  max(common.LogBatchWriteSize, 1),
+		interval:   time.Duration(max(common.LogBatchWriteInterval, 1)) * time.Second,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	common.RegisterLogBufferMetrics("db", func() int {
+		return len(writer.queue)
+	})
+	go writer.run()
+	logWriter = writer
+	common.SysLog(fmt.Sprintf("log batch write enabled with size %d and interval %s", writer.batchSize, writer.interval))
+	return nil
+}
+
+// CloseLogBatchWriter 停止异步写入，并将缓冲中剩余的日志写入数据库
+func CloseLogBatchWriter() {
+	if logWriter == nil {
+		return
+	}
+	logWriter.mu.Lock()
+	logWriter.closed = true
+	logWriter.mu.Unlock()
+	close(logWriter.stop)
+	<-logWriter.done
+	for _, spool := range []*common.Spool{logWriter.spool, logWriter.quarantine} {
+		if err := spool.Close(); err != nil {
+			common.SysError("failed to close log spool: " + err.Error())
+		}
+	}
+}
+
+func (w *logBatchWriter) enqueue(log *Log) {
+	// 队列已满或已关闭时直接暂存到磁盘，避免阻塞请求
+	if !w.tryEnqueue(log) {
+		w.spill([]*Log{log})
+	}
+}
+
+func (w *logBatchWriter) tryEnqueue(log *Log) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return false
+	}
+	select {
+	case w.queue <- log:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *logBatchWriter) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	batch := make([]*Log, 0, w.batchSize)
+	for {
+		select {
+		case log := <-w.queue:
+			batch = append(batch, log)
+			if len(batch) < w.batchSize {
+				continue
+			}
+		case <-ticker.C:
+		case <-w.stop:
+			for {
+				select {
+				case log := <-w.queue:
+					batch = append(batch, log)
+					continue
+				default:
+				}
+				break
+			}
+			w.flush(batch)
+			return
+		}
+		// 写入成功后重放暂存的日志，持续有流量时也能补写
+		if w.flush(batch) {
+			w.replaySpool()
+		}
+		batch = make([]*Log, 0, w.batchSize)
+	}
+}
+
+// flush 写入一批日志，失败时暂存到磁盘，返回数据库是否可用
+func (w *logBatchWriter) flush(batch []*Log) bool {
+	if len(batch) == 0 {
+		return true
+	}
+	remaining, err := w.insert(batch)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to write %d logs, spooling: %s", len(remaining), err.Error()))
+		w.spill(remaining)
+		return false
+	}
+	return true
+}
+
+// insert 批量写入日志。数据库可用但整批写入失败时逐条写入，仍被拒绝的日志隔离到单独的文件，
+// 避免单条异常日志阻塞其他日志；返回错误时同时返回需要重试的日志
+func (w *logBatchWriter) insert(logs []*Log) ([]*Log, error) {
+	err := LOG_DB.CreateInBatches(logs, w.batchSize).Error
+	if err == nil {
+		common.RecordLogBufferWrite("db", "written", len(logs))
+		return nil, nil
+	}
+	if !logDBReachable() {
+		return logs, err
+	}
+	var rejected []*Log
+	written := 0
+	for i, log := range logs {
+		log.Id = 0
+		rowErr := LOG_DB.Create(log).Error
+		if rowErr == nil {
+			written++
+			continue
+		}
+		if !logDBReachable() {
+			common.RecordLogBufferWrite("db", "written", written)
+			return append(rejected, logs[i:]...), rowErr
+		}
+		err = rowErr
+		rejected = append(rejected, log)
+	}
+	common.RecordLogBufferWrite("db", "written", written)
+	// 所有日志都写入失败时更可能是表结构等整体问题，保留重试
+	if written == 0 && len(logs) > 1 {
+		return logs, err
+	}
+	if len(rejected) > 0 {
+		w.reject(rejected, err)
+	}
+	return nil, nil
+}
+
+// logDBReachable 日志数据库连接是否可用，用于区分连接故障与数据被拒绝
+func logDBReachable() bool {
+	sqlDB, err := LOG_DB.DB()
+	if err != nil {
+		return false
+	}
+	return sqlDB.Ping() == nil
+}
+
+func encodeSpoolLogs(logs []*Log) [][]byte {
+	records := make([][]byte, 0, len(logs))
+	for _, log := range logs {
+		record, err := common.EncodeJson(log)
+		if err != nil {
+			common.SysError("failed to encode log for spool: " + err.Error())
+			common.RecordLogBufferWrite("db", "dropped", 1)
+			continue
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func (w *logBatchWriter) spill(logs []*Log) {
+	records := encodeSpoolLogs(logs)
+	if err := w.spool.Append(records...); err != nil {
+		common.SysError(fmt.Sprintf("failed to spool %d logs, dropped: %s", len(records), err.Error()))
+		common.RecordLogBufferWrite("db", "dropped", len(records))
+		return
+	}
+	common.RecordLogBufferWrite("db", "spooled", len(records))
+}
+
+func (w *logBatchWriter) reject(logs []*Log, reason error) {
+	records := encodeSpoolLogs(logs)
+	common.SysError(fmt.Sprintf("database rejected %d logs, moved to quarantine: %s", len(records), reason.Error()))
+	if err := w.quarantine.Append(records...); err != nil {
+		common.SysError(fmt.Sprintf("failed to quarantine %d logs, dropped: %s", len(records), err.Error()))
+		common.RecordLogBufferWrite("db", "dropped", len(records))
+		return
+	}
+	common.RecordLogBufferWrite("db", "dead_letter", len(records))
+}
+
+// replaySpool 将暂存到磁盘的日志重新写入数据库
+func (w *logBatchWriter) replaySpool() {
+	if !w.spool.Pending() {
+		return
+	}
+	err := w.spool.Replay(w.batchSize, logWriterReplayBatches, func(records [][]byte) error {
+		logs := make([]*Log, 0, len(records))
+		for _, record := range records {
+			log := &Log{}
+			if err := common.DecodeJson(record, log); err != nil {
+				common.SysError("failed to decode spooled log, skipped: " + err.Error())
+				continue
+			}
+			log.Id = 0
+			logs = append(logs, log)
+		}
+		if len(logs) == 0 {
+			return nil
+		}
+		_, err := w.insert(logs)
+		return err
+	})
+	if err != nil {
+		common.SysError("failed to replay spooled logs: " + err.Error())
+	}
+}
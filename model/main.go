@@ -187,6 +187,7 @@ func InitDB() (err error) {
 		sqlDB.SetMaxIdleConns(common.GetEnvOrDefault("SQL_MAX_IDLE_CONNS", 100))
 		sqlDB.SetMaxOpenConns(common.GetEnvOrDefault("SQL_MAX_OPEN_CONNS", 1000))
 		sqlDB.SetConnMaxLifetime(time.Second * time.Duration(common.GetEnvOrDefault("SQL_MAX_LIFETIME", 60)))
+		common.RegisterDBStatsMetrics(sqlDB, "main")
 
 		if !common.IsMasterNode {
 			return nil
@@ -221,6 +222,7 @@ func InitLogDB() (err error) {
 		sqlDB.SetMaxIdleConns(common.GetEnvOrDefault("SQL_MAX_IDLE_CONNS", 100))
 		sqlDB.SetMaxOpenConns(common.GetEnvOrDefault("SQL_MAX_OPEN_CONNS", 1000))
 		sqlDB.SetConnMaxLifetime(time.Second * time.Duration(common.GetEnvOrDefault("SQL_MAX_LIFETIME", 60)))
+		common.RegisterDBStatsMetrics(sqlDB, "log")
 
 		if !common.IsMasterNode {
 			return nil
@@ -252,11 +254,18 @@ func migrateDB() error {
 		&Redemption{},
 		&Ability{},
 		&Log{},
-		&Midjourney{},
 		&TopUp{},
 		&QuotaData{},
 		&Task{},
 		&Setup{},
+		&File{},
+		&FileChunk{},
+		&Batch{},
+		&ChannelKey{},
+		&Response{},
+		&TaskWebhook{},
+		&MediaObject{},
+		&BodyLog{},
 	)
 	if err != nil {
 		return err
@@ -266,7 +275,7 @@ func migrateDB() error {
 
 func migrateDBFast() error {
 	var wg sync.WaitGroup
-	errChan := make(chan error, 12) // Buffer size matches number of migrations
+	errChan := make(chan error, 19) // Buffer size matches number of migrations
 
 	migrations := []struct {
 		model interface{}
@@ -279,11 +288,18 @@ func migrateDBFast() error {
 		{&Redemption{}, "Redemption"},
 		{&Ability{}, "Ability"},
 		{&Log{}, "Log"},
-		{&Midjourney{}, "Midjourney"},
 		{&TopUp{}, "TopUp"},
 		{&QuotaData{}, "QuotaData"},
 		{&Task{}, "Task"},
 		{&Setup{}, "Setup"},
+		{&File{}, "File"},
+		{&FileChunk{}, "FileChunk"},
+		{&Batch{}, "Batch"},
+		{&ChannelKey{}, "ChannelKey"},
+		{&Response{}, "Response"},
+		{&TaskWebhook{}, "TaskWebhook"},
+		{&MediaObject{}, "MediaObject"},
+		{&BodyLog{}, "BodyLog"},
 	}
 
 	for _, m := range migrations {
@@ -312,7 +328,7 @@ func migrateDBFast() error {
 
 func migrateLOGDB() error {
 	var err error
-	if err = LOG_DB.AutoMigrate(&Log{}); err != nil {
+	if err = LOG_DB.AutoMigrate(&Log{}, &BodyLog{}); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,49 @@
+package model
+
+import (
+	"one-api/common"
+)
+
+// MediaObject 持久化到媒体存储中的生成结果，Key 为存储中的对象名，到达 ExpiresAt 后由后台清理
+type MediaObject struct {
+	Id          int64  `json:"id"`
+	Key         string `json:"key" gorm:"type:varchar(128);uniqueIndex"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	TaskId      string `json:"task_id" gorm:"type:varchar(50);index"`
+	Backend     string `json:"backend" gorm:"type:varchar(16)"`
+	SourceUrl   string `json:"source_url" gorm:"type:text"`
+	ContentType string `json:"content_type" gorm:"type:varchar(128)"`
+	Size        int64  `json:"size"`
+	ExpiresAt   int64  `json:"expires_at" gorm:"bigint;index"`
+	CreatedAt   int64  `json:"created_at" gorm:"bigint"`
+}
+
+func (object *MediaObject) Insert() error {
+	object.CreatedAt = common.GetTimestamp()
+	return DB.Create(object).Error
+}
+
+func (object *MediaObject) Delete() error {
+	return DB.Delete(object).Error
+}
+
+func GetMediaObjectByKey(key string) (*MediaObject, error) {
+	object := MediaObject{}
+	err := DB.Where(commonKeyCol+" = ?", key).First(&object).Error
+	return &object, err
+}
+
+// GetUserMediaUsage 用户未过期媒体文件占用的存储空间（字节）
+func GetUserMediaUsage(userId int) (int64, error) {
+	var usage int64
+	err := DB.Model(&MediaObject{}).Where("user_id = ? and expires_at > ?", userId, common.GetTimestamp()).
+		Select("coalesce(sum(size), 0)").Scan(&usage).Error
+	return usage, err
+}
+
+// GetExpiredMediaObjects 按 ID 分页获取已过期待清理的媒体文件
+func GetExpiredMediaObjects(afterId int64, limit int) ([]*MediaObject, error) {
+	var objects []*MediaObject
+	err := DB.Where("expires_at <= ? and id > ?", common.GetTimestamp(), afterId).Order("id").Limit(limit).Find(&objects).Error
+	return objects, err
+}
@@ -1,205 +1,289 @@
 package model
 
+import (
+	"encoding/json"
+	"fmt"
+	"one-api/constant"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Midjourney 为 Midjourney 任务的接口视图，数据统一存储在 tasks 表中（platform 为 mj），
+// 同时也是旧版 midjourneys 表的结构，用于迁移历史数据。时间字段沿用 Midjourney 的毫秒单位
 type Midjourney struct {
-	Id          int    `json:"id"`
+	Id           int    `json:"id"`
+	Code         int    `json:"code"`
+	UserId       int    `json:"user_id" gorm:"index"`
+	Action       string `json:"action" gorm:"type:varchar(40);index"`
+	MjId         string `json:"mj_id" gorm:"index"`
+	Prompt       string `json:"prompt"`
+	PromptEn     string `json:"prompt_en"`
+	Description  string `json:"description"`
+	State        string `json:"state"`
+	SubmitTime   int64  `json:"submit_time" gorm:"index"`
+	StartTime    int64  `json:"start_time" gorm:"index"`
+	FinishTime   int64  `json:"finish_time" gorm:"index"`
+	ImageUrl     string `json:"image_url"`
+	Status       string `json:"status" gorm:"type:varchar(20);index"`
+	Progress     string `json:"progress" gorm:"type:varchar(30);index"`
+	FailReason   string `json:"fail_reason"`
+	ChannelId    int    `json:"channel_id"`
+	ChannelKeyId int    `json:"-" gorm:"-"` // 多密钥渠道提交任务时使用的密钥 id
+	Quota        int    `json:"quota"`
+	Buttons      string `json:"buttons"`
+	Properties   string `json:"properties"`
+	TokenId      int    `json:"-" gorm:"-"` // 提交任务时使用的token ID，用于失败退款
+	TokenKey     string `json:"-" gorm:"-"`
+}
+
+// midjourneyTaskData 为 Midjourney 特有字段，保存在 Task.Data 中
+type midjourneyTaskData struct {
 	Code        int    `json:"code"`
-	UserId      int    `json:"user_id" gorm:"index"`
-	Action      string `json:"action" gorm:"type:varchar(40);index"`
-	MjId        string `json:"mj_id" gorm:"index"`
 	Prompt      string `json:"prompt"`
 	PromptEn    string `json:"prompt_en"`
 	Description string `json:"description"`
 	State       string `json:"state"`
-	SubmitTime  int64  `json:"submit_time" gorm:"index"`
-	StartTime   int64  `json:"start_time" gorm:"index"`
-	FinishTime  int64  `json:"finish_time" gorm:"index"`
-	ImageUrl    string `json:"image_url"`
-	Status      string `json:"status" gorm:"type:varchar(20);index"`
-	Progress    string `json:"progress" gorm:"type:varchar(30);index"`
-	FailReason  string `json:"fail_reason"`
-	ChannelId   int    `json:"channel_id"`
-	Quota       int    `json:"quota"`
-	Buttons     string `json:"buttons"`
-	Properties  string `json:"properties"`
+	Buttons     string `json:"buttons,omitempty"`
+	Properties  string `json:"properties,omitempty"`
 }
 
 // TaskQueryParams 用于包含所有搜索条件的结构体，可以根据需求添加更多字段
 type TaskQueryParams struct {
 	ChannelID      string
 	MjID           string
-	StartTimestamp string
-	EndTimestamp   string
+	StartTimestamp string // 毫秒时间戳
+	EndTimestamp   string // 毫秒时间戳
 }
 
-func GetAllUserTask(userId int, startIdx int, num int, queryParams TaskQueryParams) []*Midjourney {
-	var tasks []*Midjourney
-	var err error
-
-	// 初始化查询构建器
-	query := DB.Where("user_id = ?", userId)
-
-	if queryParams.MjID != "" {
-		query = query.Where("mj_id = ?", queryParams.MjID)
+// MidjourneyFromTask 将 tasks 表中的 Midjourney 任务转换为接口视图
+func MidjourneyFromTask(task *Task) *Midjourney {
+	var data midjourneyTaskData
+	if len(task.Data) > 0 {
+		_ = json.Unmarshal(task.Data, &data)
 	}
-	if queryParams.StartTimestamp != "" {
-		// 假设您已将前端传来的时间戳转换为数据库所需的时间格式，并处理了时间戳的验证和解析
-		query = query.Where("submit_time >= ?", queryParams.StartTimestamp)
+	prompt := data.Prompt
+	if prompt == "" {
+		prompt = task.Properties.Input
 	}
-	if queryParams.EndTimestamp != "" {
-		query = query.Where("submit_time <= ?", queryParams.EndTimestamp)
+	return &Midjourney{
+		Id:           int(task.ID),
+		Code:         data.Code,
+		UserId:       task.UserId,
+		Action:       task.Action,
+		MjId:         task.TaskID,
+		Prompt:       prompt,
+		PromptEn:     data.PromptEn,
+		Description:  data.Description,
+		State:        data.State,
+		SubmitTime:   task.SubmitTime * 1000,
+		StartTime:    task.StartTime * 1000,
+		FinishTime:   task.FinishTime * 1000,
+		ImageUrl:     task.ResultUrl,
+		Status:       string(task.Status),
+		Progress:     task.Progress,
+		FailReason:   task.FailReason,
+		ChannelId:    task.ChannelId,
+		ChannelKeyId: task.ChannelKeyId,
+		Quota:        task.Quota,
+		Buttons:      data.Buttons,
+		Properties:   data.Properties,
+		TokenId:      task.TokenId,
+		TokenKey:     task.TokenKey,
 	}
+}
 
-	// 获取数据
-	err = query.Order("id desc").Limit(num).Offset(startIdx).Find(&tasks).Error
-	if err != nil {
-		return nil
+// ApplyToTask 将接口视图中的字段写回任务，保留退款标记等 tasks 表独有的字段
+func (midjourney *Midjourney) ApplyToTask(task *Task) {
+	task.ID = int64(midjourney.Id)
+	task.Platform = constant.TaskPlatformMidjourney
+	task.TaskID = midjourney.MjId
+	task.UserId = midjourney.UserId
+	task.ChannelId = midjourney.ChannelId
+	if midjourney.ChannelKeyId != 0 {
+		task.ChannelKeyId = midjourney.ChannelKeyId
 	}
-
-	return tasks
+	task.Quota = midjourney.Quota
+	task.Action = midjourney.Action
+	task.Status = TaskStatus(midjourney.Status)
+	if task.Status == "" {
+		task.Status = TaskStatusNotStart
+	}
+	task.FailReason = midjourney.FailReason
+	task.SubmitTime = midjourney.SubmitTime / 1000
+	task.StartTime = midjourney.StartTime / 1000
+	task.FinishTime = midjourney.FinishTime / 1000
+	task.Progress = midjourney.Progress
+	task.ResultUrl = midjourney.ImageUrl
+	task.Properties.Input = midjourney.Prompt
+	if midjourney.TokenId != 0 {
+		task.TokenId = midjourney.TokenId
+		task.TokenKey = midjourney.TokenKey
+	}
+	task.SetData(midjourneyTaskData{
+		Code:        midjourney.Code,
+		Prompt:      midjourney.Prompt,
+		PromptEn:    midjourney.PromptEn,
+		Description: midjourney.Description,
+		State:       midjourney.State,
+		Buttons:     midjourney.Buttons,
+		Properties:  midjourney.Properties,
+	})
 }
 
-func GetAllTasks(startIdx int, num int, queryParams TaskQueryParams) []*Midjourney {
-	var tasks []*Midjourney
-	var err error
-
-	// 初始化查询构建器
-	query := DB
-
-	// 添加过滤条件
+func midjourneyQuery(queryParams TaskQueryParams) *gorm.DB {
+	query := DB.Model(&Task{}).Where("platform = ?", constant.TaskPlatformMidjourney)
 	if queryParams.ChannelID != "" {
 		query = query.Where("channel_id = ?", queryParams.ChannelID)
 	}
 	if queryParams.MjID != "" {
-		query = query.Where("mj_id = ?", queryParams.MjID)
+		query = query.Where("task_id = ?", queryParams.MjID)
 	}
-	if queryParams.StartTimestamp != "" {
-		query = query.Where("submit_time >= ?", queryParams.StartTimestamp)
+	// 前端传入毫秒时间戳，tasks 表中以秒存储
+	if start, err := strconv.ParseInt(queryParams.StartTimestamp, 10, 64); err == nil {
+		query = query.Where("submit_time >= ?", start/1000)
 	}
-	if queryParams.EndTimestamp != "" {
-		query = query.Where("submit_time <= ?", queryParams.EndTimestamp)
+	if end, err := strconv.ParseInt(queryParams.EndTimestamp, 10, 64); err == nil {
+		query = query.Where("submit_time <= ?", end/1000)
 	}
+	return query
+}
 
-	// 获取数据
-	err = query.Order("id desc").Limit(num).Offset(startIdx).Find(&tasks).Error
-	if err != nil {
+func findMidjourneyTasks(query *gorm.DB) []*Midjourney {
+	var tasks []*Task
+	if err := query.Find(&tasks).Error; err != nil {
 		return nil
 	}
+	mjs := make([]*Midjourney, 0, len(tasks))
+	for _, task := range tasks {
+		mjs = append(mjs, MidjourneyFromTask(task))
+	}
+	return mjs
+}
 
-	return tasks
+func GetAllUserTask(userId int, startIdx int, num int, queryParams TaskQueryParams) []*Midjourney {
+	queryParams.ChannelID = ""
+	query := midjourneyQuery(queryParams).Where("user_id = ?", userId)
+	return findMidjourneyTasks(query.Order("id desc").Limit(num).Offset(startIdx))
 }
 
-func GetAllUnFinishTasks() []*Midjourney {
-	var tasks []*Midjourney
-	var err error
-	// get all tasks progress is not 100%
-	err = DB.Where("progress != ?", "100%").Find(&tasks).Error
-	if err != nil {
-		return nil
-	}
-	return tasks
+func GetAllTasks(startIdx int, num int, queryParams TaskQueryParams) []*Midjourney {
+	return findMidjourneyTasks(midjourneyQuery(queryParams).Order("id desc").Limit(num).Offset(startIdx))
 }
 
 func GetByOnlyMJId(mjId string) *Midjourney {
-	var mj *Midjourney
-	var err error
-	err = DB.Where("mj_id = ?", mjId).First(&mj).Error
-	if err != nil {
+	mjs := findMidjourneyTasks(midjourneyQuery(TaskQueryParams{MjID: mjId}).Limit(1))
+	if len(mjs) == 0 {
 		return nil
 	}
-	return mj
+	return mjs[0]
 }
 
 func GetByMJId(userId int, mjId string) *Midjourney {
-	var mj *Midjourney
-	var err error
-	err = DB.Where("user_id = ? and mj_id = ?", userId, mjId).First(&mj).Error
-	if err != nil {
+	mjs := findMidjourneyTasks(midjourneyQuery(TaskQueryParams{MjID: mjId}).Where("user_id = ?", userId).Limit(1))
+	if len(mjs) == 0 {
 		return nil
 	}
-	return mj
+	return mjs[0]
 }
 
 func GetByMJIds(userId int, mjIds []string) []*Midjourney {
-	var mj []*Midjourney
-	var err error
-	err = DB.Where("user_id = ? and mj_id in (?)", userId, mjIds).Find(&mj).Error
-	if err != nil {
-		return nil
-	}
-	return mj
-}
-
-func GetMjByuId(id int) *Midjourney {
-	var mj *Midjourney
-	var err error
-	err = DB.Where("id = ?", id).First(&mj).Error
-	if err != nil {
-		return nil
-	}
-	return mj
-}
-
-func UpdateProgress(id int, progress string) error {
-	return DB.Model(&Midjourney{}).Where("id = ?", id).Update("progress", progress).Error
+	return findMidjourneyTasks(midjourneyQuery(TaskQueryParams{}).Where("user_id = ? and task_id in (?)", userId, mjIds))
 }
 
 func (midjourney *Midjourney) Insert() error {
-	var err error
-	err = DB.Create(midjourney).Error
-	return err
+	task := &Task{}
+	midjourney.ApplyToTask(task)
+	if err := task.Insert(); err != nil {
+		return err
+	}
+	midjourney.Id = int(task.ID)
+	return nil
 }
 
 func (midjourney *Midjourney) Update() error {
-	var err error
-	err = DB.Save(midjourney).Error
-	return err
-}
-
-func MjBulkUpdate(mjIds []string, params map[string]any) error {
-	return DB.Model(&Midjourney{}).
-		Where("mj_id in (?)", mjIds).
-		Updates(params).Error
-}
-
-func MjBulkUpdateByTaskIds(taskIDs []int, params map[string]any) error {
-	return DB.Model(&Midjourney{}).
-		Where("id in (?)", taskIDs).
-		Updates(params).Error
+	task := &Task{}
+	if err := DB.Where("id = ? and platform = ?", midjourney.Id, constant.TaskPlatformMidjourney).First(task).Error; err != nil {
+		return err
+	}
+	midjourney.ApplyToTask(task)
+	return task.Update()
 }
 
 // CountAllTasks returns total midjourney tasks for admin query
 func CountAllTasks(queryParams TaskQueryParams) int64 {
 	var total int64
-	query := DB.Model(&Midjourney{})
-	if queryParams.ChannelID != "" {
-		query = query.Where("channel_id = ?", queryParams.ChannelID)
-	}
-	if queryParams.MjID != "" {
-		query = query.Where("mj_id = ?", queryParams.MjID)
-	}
-	if queryParams.StartTimestamp != "" {
-		query = query.Where("submit_time >= ?", queryParams.StartTimestamp)
-	}
-	if queryParams.EndTimestamp != "" {
-		query = query.Where("submit_time <= ?", queryParams.EndTimestamp)
-	}
-	_ = query.Count(&total).Error
+	_ = midjourneyQuery(queryParams).Count(&total).Error
 	return total
 }
 
 // CountAllUserTask returns total midjourney tasks for user
 func CountAllUserTask(userId int, queryParams TaskQueryParams) int64 {
 	var total int64
-	query := DB.Model(&Midjourney{}).Where("user_id = ?", userId)
-	if queryParams.MjID != "" {
-		query = query.Where("mj_id = ?", queryParams.MjID)
-	}
-	if queryParams.StartTimestamp != "" {
-		query = query.Where("submit_time >= ?", queryParams.StartTimestamp)
+	queryParams.ChannelID = ""
+	_ = midjourneyQuery(queryParams).Where("user_id = ?", userId).Count(&total).Error
+	return total
+}
+
+// MigrateMidjourneyTasks 将旧版 midjourneys 表中的任务迁移到 tasks 表，已迁移的任务会被跳过，可重复执行。
+// 提交时间早于 staleBefore（秒）仍未完成的任务直接标记为失败且不退款，避免迁移后被轮询按超时批量退款
+func MigrateMidjourneyTasks(staleBefore int64) (int, error) {
+	if !DB.Migrator().HasTable(&Midjourney{}) {
+		return 0, nil
 	}
-	if queryParams.EndTimestamp != "" {
-		query = query.Where("submit_time <= ?", queryParams.EndTimestamp)
+	migrated := 0
+	lastId := 0
+	for {
+		var legacyTasks []*Midjourney
+		err := DB.Where("id > ?", lastId).Order("id").Limit(500).Find(&legacyTasks).Error
+		if err != nil {
+			return migrated, err
+		}
+		if len(legacyTasks) == 0 {
+			return migrated, nil
+		}
+		mjIds := make([]string, 0, len(legacyTasks))
+		for _, legacy := range legacyTasks {
+			mjIds = append(mjIds, legacy.MjId)
+		}
+		var existing []*Task
+		err = DB.Select("task_id", "user_id", "submit_time").
+			Where("platform = ? and task_id in (?)", constant.TaskPlatformMidjourney, mjIds).Find(&existing).Error
+		if err != nil {
+			return migrated, err
+		}
+		existed := make(map[string]bool, len(existing))
+		for _, task := range existing {
+			existed[fmt.Sprintf("%s:%d:%d", task.TaskID, task.UserId, task.SubmitTime)] = true
+		}
+		for _, legacy := range legacyTasks {
+			lastId = legacy.Id
+			if existed[fmt.Sprintf("%s:%d:%d", legacy.MjId, legacy.UserId, legacy.SubmitTime/1000)] {
+				continue
+			}
+			task := &Task{}
+			legacy.Id = 0
+			legacy.ApplyToTask(task)
+			task.CreatedAt = legacy.SubmitTime / 1000
+			if task.IsFinished() {
+				// 旧版轮询在任务失败时已退还额度
+				task.Refunded = task.Status == TaskStatusFailure
+			} else if legacy.Code != 1 && legacy.Code != 21 && legacy.Code != 22 {
+				// 提交失败的任务未扣费，避免被轮询标记失败时重复退款
+				task.Quota = 0
+			} else if staleBefore > 0 && task.SubmitTime > 0 && task.SubmitTime < staleBefore {
+				// 长期未完成的历史任务无法确认上游结果，标记失败但不退款
+				task.Status = TaskStatusFailure
+				task.Progress = "100%"
+				task.FailReason = "legacy task expired before migration"
+				task.FinishTime = time.Now().Unix()
+				task.Refunded = true
+			}
+			if err = task.Insert(); err != nil {
+				return migrated, err
+			}
+			migrated++
+		}
 	}
-	_ = query.Count(&total).Error
-	return total
 }
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"errors"
+)
+
+// Response 网关模拟 Responses API 时保存的响应。Input 与 Output 分别为本轮新增的输入消息与助手消息（JSON），
+// 续接 previous_response_id 时沿 PreviousResponseId 逐级向前拼接完整对话；Body 为返回给客户端的响应对象
+type Response struct {
+	Id                 string `json:"id" gorm:"type:varchar(64);primaryKey"`
+	UserId             int    `json:"user_id" gorm:"index"`
+	TokenId            int    `json:"token_id" gorm:"index"`
+	Model              string `json:"model" gorm:"type:varchar(255)"`
+	PreviousResponseId string `json:"previous_response_id" gorm:"type:varchar(64)"`
+	Input              string `json:"input" gorm:"type:text"`
+	Output             string `json:"output" gorm:"type:text"`
+	Body               string `json:"body" gorm:"type:text"`
+	CreatedAt          int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+// maxResponseChainDepth 续接对话时最多向前查找的响应数量，避免异常数据导致无限循环
+const maxResponseChainDepth = 100
+
+func (response *Response) Insert() error {
+	return DB.Create(response).Error
+}
+
+func GetUserResponseById(userId int, id string) (*Response, error) {
+	if id == "" {
+		return nil, errors.New("id 为空！")
+	}
+	response := Response{}
+	err := DB.Where("id = ? and user_id = ?", id, userId).First(&response).Error
+	return &response, err
+}
+
+func DeleteUserResponseById(userId int, id string) (int64, error) {
+	result := DB.Where("id = ? and user_id = ?", id, userId).Delete(&Response{})
+	return result.RowsAffected, result.Error
+}
+
+// DeleteResponsesBefore 分批删除创建时间早于 timestamp 的响应，返回删除的数量
+func DeleteResponsesBefore(timestamp int64, limit int) (int64, error) {
+	var total int64
+	for {
+		var ids []string
+		if err := DB.Model(&Response{}).Where("created_at < ?", timestamp).Limit(limit).Pluck("id", &ids).Error; err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			return total, nil
+		}
+		result := DB.Where("id IN ?", ids).Delete(&Response{})
+		if result.Error != nil {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+	}
+}
+
+// GetUserResponseChain 返回以 id 结尾的响应链，按时间正序排列
+func GetUserResponseChain(userId int, id string) ([]*Response, error) {
+	var chain []*Response
+	for id != "" {
+		if len(chain) >= maxResponseChainDepth {
+			return nil, errors.New("previous_response_id 链过长")
+		}
+		response, err := GetUserResponseById(userId, id)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, response)
+		id = response.PreviousResponseId
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain, nil
+}
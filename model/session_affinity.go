@@ -0,0 +1,119 @@
+package model
+
+import (
+	"fmt"
+	"one-api/common"
+	"one-api/setting/operation_setting"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type sessionAffinityEntry struct {
+	channelId int
+	expiresAt int64
+}
+
+var (
+	sessionAffinityMap         = make(map[string]sessionAffinityEntry)
+	sessionAffinityLock        sync.Mutex
+	sessionAffinityLastCleanup int64
+)
+
+func sessionAffinityRedisKey(key string) string {
+	return "session_affinity:" + key
+}
+
+func sessionAffinityTTL() time.Duration {
+	ttl := operation_setting.GetSessionAffinitySetting().TTLSeconds
+	if ttl <= 0 {
+		ttl = 300
+	}
+	return time.Duration(ttl) * time.Second
+}
+
+// SetSessionAffinity 绑定会话与渠道，启用 Redis 时多节点共享
+func SetSessionAffinity(key string, channelId int) {
+	if key == "" || channelId == 0 {
+		return
+	}
+	ttl := sessionAffinityTTL()
+	if common.RedisEnabled {
+		if err := common.RedisSet(sessionAffinityRedisKey(key), strconv.Itoa(channelId), ttl); err != nil {
+			common.SysError("failed to set session affinity: " + err.Error())
+		}
+		return
+	}
+	now := time.Now().Unix()
+	sessionAffinityLock.Lock()
+	defer sessionAffinityLock.Unlock()
+	sessionAffinityMap[key] = sessionAffinityEntry{channelId: channelId, expiresAt: now + int64(ttl.Seconds())}
+	// 定期清理过期条目
+	if now-sessionAffinityLastCleanup >= int64(ttl.Seconds()) {
+		for k, entry := range sessionAffinityMap {
+			if entry.expiresAt <= now {
+				delete(sessionAffinityMap, k)
+			}
+		}
+		sessionAffinityLastCleanup = now
+	}
+}
+
+func getSessionAffinityChannelId(key string) int {
+	if common.RedisEnabled {
+		value, err := common.RedisGet(sessionAffinityRedisKey(key))
+		if err != nil {
+			return 0
+		}
+		channelId, _ := strconv.Atoi(value)
+		return channelId
+	}
+	sessionAffinityLock.Lock()
+	defer sessionAffinityLock.Unlock()
+	entry, ok := sessionAffinityMap[key]
+	if !ok {
+		return 0
+	}
+	if entry.expiresAt <= time.Now().Unix() {
+		delete(sessionAffinityMap, key)
+		return 0
+	}
+	return entry.channelId
+}
+
+// GetSessionAffinityChannel 获取会话绑定的渠道，渠道已禁用、不再支持该分组模型或处于熔断期时返回 nil
+func GetSessionAffinityChannel(key string, group string, model string) *Channel {
+	channelId := getSessionAffinityChannelId(key)
+	if channelId == 0 {
+		return nil
+	}
+	channel, err := CacheGetChannel(channelId)
+	if err != nil || channel.Status != common.ChannelStatusEnabled {
+		return nil
+	}
+	if !channelSatisfies(channel, group, model) || !acquireChannelProbe(channel.Id) {
+		return nil
+	}
+	return channel
+}
+
+func channelSatisfies(channel *Channel, group string, model string) bool {
+	if common.MemoryCacheEnabled {
+		channelSyncLock.RLock()
+		defer channelSyncLock.RUnlock()
+		for _, c := range group2model2channels[group][model] {
+			if c.Id == channel.Id {
+				return true
+			}
+		}
+		return false
+	}
+	return common.StringsContains(strings.Split(channel.Group, ","), group) &&
+		common.StringsContains(strings.Split(channel.Models, ","), model)
+}
+
+// GenerateSessionAffinityKey 会话 id 仅在同一用户、分组和模型内有效
+func GenerateSessionAffinityKey(userId int, group string, model string, sessionHash string) string {
+	return fmt.Sprintf("%d:%s:%s:%s", userId, group, model, sessionHash)
+}
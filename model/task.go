@@ -21,28 +21,36 @@ const (
 )
 
 type Task struct {
-	ID         int64                 `json:"id" gorm:"primary_key;AUTO_INCREMENT"`
-	CreatedAt  int64                 `json:"created_at" gorm:"index"`
-	UpdatedAt  int64                 `json:"updated_at"`
-	TaskID     string                `json:"task_id" gorm:"type:varchar(50);index"`  // 第三方id，不一定有/ song id\ Task id
-	Platform   constant.TaskPlatform `json:"platform" gorm:"type:varchar(30);index"` // 平台
-	UserId     int                   `json:"user_id" gorm:"index"`
-	ChannelId  int                   `json:"channel_id" gorm:"index"`
-	TokenId    int                   `json:"token_id" gorm:"index"`                   // 提交任务时使用的token ID
-	TokenKey   string                `json:"token_key" gorm:"type:varchar(48)"`       // 提交任务时使用的token key
-	Quota      int                   `json:"quota"`
-	Action     string                `json:"action" gorm:"type:varchar(40);index"` // 任务类型, song, lyrics, description-mode
-	Status     TaskStatus            `json:"status" gorm:"type:varchar(20);index"` // 任务状态
-	FailReason string                `json:"fail_reason"`
-	SubmitTime int64                 `json:"submit_time" gorm:"index"`
-	StartTime  int64                 `json:"start_time" gorm:"index"`
-	FinishTime int64                 `json:"finish_time" gorm:"index"`
-	Progress   string                `json:"progress" gorm:"type:varchar(20);index"`
-	Properties Properties            `json:"properties" gorm:"type:json"`
+	ID           int64                 `json:"id" gorm:"primary_key;AUTO_INCREMENT"`
+	CreatedAt    int64                 `json:"created_at" gorm:"index"`
+	UpdatedAt    int64                 `json:"updated_at"`
+	TaskID       string                `json:"task_id" gorm:"type:varchar(50);index"`  // 第三方id，不一定有/ song id\ Task id
+	Platform     constant.TaskPlatform `json:"platform" gorm:"type:varchar(30);index"` // 平台
+	UserId       int                   `json:"user_id" gorm:"index"`
+	ChannelId    int                   `json:"channel_id" gorm:"index"`
+	ChannelKeyId int                   `json:"channel_key_id" gorm:"default:0"`   // 多密钥渠道提交任务时使用的密钥 id，轮询与取消沿用该密钥
+	TokenId      int                   `json:"token_id" gorm:"index"`             // 提交任务时使用的token ID
+	TokenKey     string                `json:"token_key" gorm:"type:varchar(48)"` // 提交任务时使用的token key
+	Quota        int                   `json:"quota"`
+	Action       string                `json:"action" gorm:"type:varchar(40);index"` // 任务类型, song, lyrics, description-mode
+	Status       TaskStatus            `json:"status" gorm:"type:varchar(20);index"` // 任务状态
+	FailReason   string                `json:"fail_reason"`
+	SubmitTime   int64                 `json:"submit_time" gorm:"index"`
+	StartTime    int64                 `json:"start_time" gorm:"index"`
+	FinishTime   int64                 `json:"finish_time" gorm:"index"`
+	Progress     string                `json:"progress" gorm:"type:varchar(20);index"`
+	Properties   Properties            `json:"properties" gorm:"type:json"`
+	Refunded     bool                  `json:"refunded" gorm:"default:false"` // 失败任务的额度是否已退还
+	ResultUrl    string                `json:"result_url" gorm:"type:text"`   // 任务结果地址
 
 	Data json.RawMessage `json:"data" gorm:"type:json"`
 }
 
+// IsFinished 任务是否已经处于成功或失败的终态
+func (t *Task) IsFinished() bool {
+	return t.Status == TaskStatusSuccess || t.Status == TaskStatusFailure
+}
+
 func (t *Task) SetData(data any) {
 	b, _ := json.Marshal(data)
 	t.Data = json.RawMessage(b)
@@ -54,8 +62,11 @@ func (t *Task) GetData(v any) error {
 }
 
 type Properties struct {
-	Input string `json:"input"`
-	Model string `json:"model,omitempty"` // 添加模型名称字段
+	Input       string `json:"input"`
+	Model       string `json:"model,omitempty"`        // 添加模型名称字段
+	CallbackUrl string `json:"callback_url,omitempty"` // 任务完成或失败时回调的地址
+	Seconds     int    `json:"seconds,omitempty"`      // 视频任务时长
+	Size        string `json:"size,omitempty"`         // 视频任务分辨率
 }
 
 func (m *Properties) Scan(val interface{}) error {
@@ -82,14 +93,15 @@ type SyncTaskQueryParams struct {
 
 func InitTask(platform constant.TaskPlatform, relayInfo *commonRelay.TaskRelayInfo) *Task {
 	t := &Task{
-		UserId:     relayInfo.UserId,
-		SubmitTime: time.Now().Unix(),
-		Status:     TaskStatusNotStart,
-		Progress:   "0%",
-		ChannelId:  relayInfo.ChannelId,
-		Platform:   platform,
-		TokenId:    relayInfo.TokenId,
-		TokenKey:   relayInfo.TokenKey,
+		UserId:       relayInfo.UserId,
+		SubmitTime:   time.Now().Unix(),
+		Status:       TaskStatusNotStart,
+		Progress:     "0%",
+		ChannelId:    relayInfo.ChannelId,
+		ChannelKeyId: relayInfo.ChannelKeyId,
+		Platform:     platform,
+		TokenId:      relayInfo.TokenId,
+		TokenKey:     relayInfo.TokenKey,
 	}
 	return t
 }
@@ -175,11 +187,12 @@ func TaskGetAllTasks(startIdx int, num int, queryParams SyncTaskQueryParams) []*
 	return tasks
 }
 
-func GetAllUnFinishSyncTasks(limit int) []*Task {
+// GetAllUnFinishSyncTasks 按 id 顺序返回 id 大于 afterId 的未完成任务，调度器以此分段扫描全部任务
+func GetAllUnFinishSyncTasks(afterId int64, limit int) []*Task {
 	var tasks []*Task
 	var err error
 	// get all tasks progress is not 100%
-	err = DB.Where("progress != ?", "100%").Limit(limit).Order("id").Find(&tasks).Error
+	err = DB.Where("progress != ? and id > ?", "100%", afterId).Limit(limit).Order("id").Find(&tasks).Error
 	if err != nil {
 		return nil
 	}
@@ -229,10 +242,35 @@ func GetByTaskIds(userId int, taskIds []any) ([]*Task, error) {
 	return task, nil
 }
 
+// GetUserTasksByPlatforms 按 ID 游标分页查询用户在指定平台的任务，afterId 为 0 时从头开始
+func GetUserTasksByPlatforms(userId int, platforms []constant.TaskPlatform, afterId int64, limit int, asc bool) ([]*Task, error) {
+	var tasks []*Task
+	query := DB.Where("user_id = ? and platform in (?)", userId, platforms)
+	order := "id desc"
+	if asc {
+		order = "id"
+		if afterId > 0 {
+			query = query.Where("id > ?", afterId)
+		}
+	} else if afterId > 0 {
+		query = query.Where("id < ?", afterId)
+	}
+	err := query.Order(order).Limit(limit).Find(&tasks).Error
+	return tasks, err
+}
+
 func TaskUpdateProgress(id int64, progress string) error {
 	return DB.Model(&Task{}).Where("id = ?", id).Update("progress", progress).Error
 }
 
+// TaskUpdateResult 仅更新任务的结果地址与结果数据，用于任务完成后将结果改写为持久化后的地址
+func TaskUpdateResult(id int64, resultUrl string, data json.RawMessage) error {
+	return DB.Model(&Task{}).Where("id = ?", id).Updates(map[string]any{
+		"result_url": resultUrl,
+		"data":       data,
+	}).Error
+}
+
 func (Task *Task) Insert() error {
 	var err error
 	err = DB.Create(Task).Error
@@ -245,6 +283,21 @@ func (Task *Task) Update() error {
 	return err
 }
 
+// UpdateUnfinished 仅当数据库中的任务尚未进入终态时写入全部字段，返回是否写入。
+// 轮询与取消各自持有任务副本，条件写入保证终态只会被写入一次，不会被过期的副本覆盖；
+// 退款标记由 TaskSetRefunded 单独维护，这里不写入
+func (Task *Task) UpdateUnfinished() (bool, error) {
+	result := DB.Model(Task).Where("status not in (?)", []TaskStatus{TaskStatusSuccess, TaskStatusFailure}).
+		Select("*").Omit("refunded").Updates(Task)
+	return result.RowsAffected > 0, result.Error
+}
+
+// TaskSetRefunded 以条件更新的方式修改任务的退款标记，返回 false 表示标记已是目标值，用于保证同一任务只退款一次
+func TaskSetRefunded(id int64, refunded bool) (bool, error) {
+	result := DB.Model(&Task{}).Where("id = ? and refunded = ?", id, !refunded).Update("refunded", refunded)
+	return result.RowsAffected > 0, result.Error
+}
+
 func TaskBulkUpdate(TaskIds []string, params map[string]any) error {
 	if len(TaskIds) == 0 {
 		return nil
@@ -368,3 +421,18 @@ func TaskCountAllUserTask(userId int, queryParams SyncTaskQueryParams) int64 {
 	_ = query.Count(&total).Error
 	return total
 }
+
+// TaskQueueDepth 未完成任务按平台和状态的数量统计
+type TaskQueueDepth struct {
+	Platform string `json:"platform"`
+	Status   string `json:"status"`
+	Count    int64  `json:"count"`
+}
+
+// CountUnfinishedTasks 按平台和状态统计未完成的任务数
+func CountUnfinishedTasks() ([]TaskQueueDepth, error) {
+	var depths []TaskQueueDepth
+	err := DB.Model(&Task{}).Select("platform, status, count(*) as count").
+		Where("progress != ?", "100%").Group("platform, status").Scan(&depths).Error
+	return depths, err
+}
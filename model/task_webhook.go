@@ -0,0 +1,82 @@
+package model
+
+import (
+	"one-api/common"
+
+	"gorm.io/gorm/clause"
+)
+
+const (
+	TaskWebhookStatusPending   = "pending"
+	TaskWebhookStatusSucceeded = "succeeded"
+	TaskWebhookStatusFailed    = "failed"
+)
+
+// TaskWebhook 异步任务进入终态后的回调投递记录。Id 与任务记录的 ID 相同，保证每个任务只回调一次；
+// 投递失败时按退避时间重试，Attempts、LastStatusCode 与 LastError 记录最近一次投递的结果
+type TaskWebhook struct {
+	Id             int64  `json:"id" gorm:"primaryKey;autoIncrement:false"`
+	UserId         int    `json:"user_id" gorm:"index"`
+	TaskId         string `json:"task_id" gorm:"type:varchar(50);index"`
+	Platform       string `json:"platform" gorm:"type:varchar(30)"`
+	Url            string `json:"url" gorm:"type:varchar(1024)"`
+	Event          string `json:"event" gorm:"type:varchar(32)"`
+	Payload        string `json:"payload" gorm:"type:text"`
+	Status         string `json:"status" gorm:"type:varchar(20);index"`
+	Attempts       int    `json:"attempts"`
+	LastStatusCode int    `json:"last_status_code"`
+	LastError      string `json:"last_error" gorm:"type:text"`
+	NextAttemptAt  int64  `json:"next_attempt_at" gorm:"bigint;index"`
+	DeliveredAt    int64  `json:"delivered_at" gorm:"bigint"`
+	CreatedAt      int64  `json:"created_at" gorm:"bigint;index"`
+	UpdatedAt      int64  `json:"updated_at" gorm:"bigint"`
+}
+
+// Insert 新增回调记录，任务已有回调记录时返回 false
+func (webhook *TaskWebhook) Insert() (bool, error) {
+	result := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(webhook)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (webhook *TaskWebhook) Update() error {
+	webhook.UpdatedAt = common.GetTimestamp()
+	return DB.Save(webhook).Error
+}
+
+func GetTaskWebhookById(id int64) (*TaskWebhook, error) {
+	webhook := TaskWebhook{}
+	err := DB.Where("id = ?", id).First(&webhook).Error
+	return &webhook, err
+}
+
+// GetDueTaskWebhooks 获取到达重试时间的待投递回调
+func GetDueTaskWebhooks(limit int) ([]*TaskWebhook, error) {
+	var webhooks []*TaskWebhook
+	err := DB.Where("status = ? and next_attempt_at <= ?", TaskWebhookStatusPending, common.GetTimestamp()).
+		Order("next_attempt_at").Limit(limit).Find(&webhooks).Error
+	return webhooks, err
+}
+
+// GetTaskWebhooks 分页查询回调记录，userId 为 0 时查询所有用户
+func GetTaskWebhooks(userId int, taskId string, status string, startIdx int, num int) ([]*TaskWebhook, int64, error) {
+	var webhooks []*TaskWebhook
+	var total int64
+	query := DB.Model(&TaskWebhook{})
+	if userId != 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+	if taskId != "" {
+		query = query.Where("task_id = ?", taskId)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Order("id desc").Limit(num).Offset(startIdx).Find(&webhooks).Error
+	return webhooks, total, err
+}
@@ -26,6 +26,9 @@ type Token struct {
 	AllowIps           *string        `json:"allow_ips" gorm:"default:''"`
 	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
 	Group              string         `json:"group" gorm:"default:''"`
+	ResponseCache      bool           `json:"response_cache" gorm:"default:false"` // 是否使用响应缓存，仅在响应缓存设置为令牌自选时生效
+	SemanticCache      bool           `json:"semantic_cache" gorm:"default:false"` // 是否使用语义缓存，仅在语义缓存设置为令牌自选时生效
+	BodyLog            bool           `json:"body_log" gorm:"default:false"`       // 是否记录请求与响应内容，仅在开启内容记录时生效
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
@@ -155,6 +158,7 @@ func GetTokenByKey(key string, fromDB bool) (token *Token, err error) {
 	if !fromDB && common.RedisEnabled {
 		// Try Redis first
 		token, err := cacheGetTokenByKey(key)
+		common.RecordCacheLookup("token", err == nil)
 		if err == nil {
 			return token, nil
 		}
@@ -184,7 +188,7 @@ func (token *Token) Update() (err error) {
 		}
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "group", "response_cache", "semantic_cache", "body_log").Updates(token).Error
 	return err
 }
 
@@ -91,6 +91,9 @@ func GetUserCache(userId int) (userCache *UserBase, err error) {
 
 	// Try getting from Redis first
 	userCache, err = cacheGetUserBase(userId)
+	if common.RedisEnabled {
+		common.RecordCacheLookup("user", err == nil)
+	}
 	if err == nil {
 		return userCache, nil
 	}
@@ -16,6 +16,8 @@ const (
 	BatchUpdateTypeUsedQuota
 	BatchUpdateTypeChannelUsedQuota
 	BatchUpdateTypeRequestCount
+	BatchUpdateTypeChannelKeyUsedCount
+	BatchUpdateTypeChannelKeyUsedQuota
 	BatchUpdateTypeCount // if you add a new type, you need to add a new map and a new lock
 )
 
@@ -90,6 +92,10 @@ func batchUpdate() {
 				updateUserRequestCount(key, value)
 			case BatchUpdateTypeChannelUsedQuota:
 				updateChannelUsedQuota(key, value)
+			case BatchUpdateTypeChannelKeyUsedCount:
+				updateChannelKeyUsedCount(key, value)
+			case BatchUpdateTypeChannelKeyUsedQuota:
+				updateChannelKeyUsedQuota(key, value)
 			}
 		}
 	}
@@ -1,6 +1,7 @@
 package channel
 
 import (
+	"errors"
 	"io"
 	"net/http"
 	"one-api/dto"
@@ -9,6 +10,9 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// ErrTaskCancelUnsupported 上游没有取消接口时 CancelTask 返回该错误，不会发出请求
+var ErrTaskCancelUnsupported = errors.New("cancel unsupported")
+
 type Adaptor interface {
 	// Init IsStream bool
 	Init(info *relaycommon.RelayInfo)
@@ -44,6 +48,14 @@ type TaskAdaptor interface {
 
 	// FetchTask
 	FetchTask(baseUrl, key string, body map[string]any) (*http.Response, error)
+	// CancelTask 请求上游取消任务，body 与 FetchTask 相同，包含 task_id、model、action 与 channel_setting，
+	// 上游不支持取消时返回 ErrTaskCancelUnsupported
+	CancelTask(baseUrl, key string, body map[string]any) (*http.Response, error)
 
 	ParseResultUrl(resp map[string]any) (string, error)
 }
+
+// TaskPriceProvider 可由任务适配器实现，按任务 action 返回固定价格，优先于模型价格
+type TaskPriceProvider interface {
+	GetTaskPrice(info *relaycommon.TaskRelayInfo) (float64, bool)
+}
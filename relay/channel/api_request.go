@@ -1,12 +1,14 @@
 package channel
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	common2 "one-api/common"
+	constant2 "one-api/constant"
 	"one-api/relay/common"
 	"one-api/relay/constant"
 	"one-api/relay/helper"
@@ -18,6 +20,7 @@ import (
 	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func SetupApiRequestHeader(info *common.RelayInfo, c *gin.Context, req *http.Header) {
@@ -54,6 +57,10 @@ func DoApiRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody
 	if err != nil {
 		return nil, fmt.Errorf("new request failed: %w", err)
 	}
+	// 对冲请求需要能够取消落败一方的上游请求
+	if upstreamCtx, ok := c.Value(constant2.ContextKeyUpstreamContext).(context.Context); ok {
+		req = req.WithContext(upstreamCtx)
+	}
 	err = a.SetupRequestHeader(c, &req.Header, info)
 	if err != nil {
 		return nil, fmt.Errorf("setup request header failed: %w", err)
@@ -243,14 +250,23 @@ func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 		}
 	}
 
+	endSpan := common2.StartSpan(c, "upstream_request",
+		attribute.Int("channel.id", info.ChannelId),
+		attribute.String("upstream.model", info.UpstreamModelName),
+		attribute.String("server.address", req.URL.Host))
+	common2.InjectTraceHeaders(c, req.Header)
 	resp, err := client.Do(req)
-
 	if err != nil {
+		common2.SetSpanError(c, err.Error())
+		endSpan()
 		return nil, err
 	}
 	if resp == nil {
+		endSpan()
 		return nil, errors.New("resp is nil")
 	}
+	common2.SetSpanAttributes(c, attribute.Int("http.response.status_code", resp.StatusCode))
+	endSpan()
 
 	// 安全地关闭请求体，避免空指针解引用
 	if req.Body != nil {
@@ -295,3 +311,20 @@ func DoTaskApiRequest(a TaskAdaptor, c *gin.Context, info *common.TaskRelayInfo,
 	}
 	return resp, nil
 }
+
+// DoTaskCancelRequest 发送任务取消请求，超时上下文在返回前取消，所以先读出响应体
+func DoTaskCancelRequest(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	resp, err := service.GetHttpClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	return resp, nil
+}
@@ -169,6 +169,7 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycom
 							modelName, tokenName, finalQuota, logContent, info.TokenId, userQuota, 0, false, info.Group, other)
 						model.UpdateUserUsedQuotaAndRequestCount(info.UserId, finalQuota)
 						model.UpdateChannelUsedQuota(info.ChannelId, finalQuota)
+						model.UpdateChannelKeyUsedQuota(info.ChannelKeyId, finalQuota)
 					}
 					
 					usage = &usageInfo
@@ -224,6 +225,7 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycom
 					modelName, tokenName, finalQuota, logContent, info.TokenId, userQuota, 0, false, info.Group, other)
 				model.UpdateUserUsedQuotaAndRequestCount(info.UserId, finalQuota)
 				model.UpdateChannelUsedQuota(info.ChannelId, finalQuota)
+				model.UpdateChannelKeyUsedQuota(info.ChannelKeyId, finalQuota)
 			}
 		}
 	}
@@ -0,0 +1,476 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"sort"
+	"strings"
+)
+
+// geminiFunctionDeclaration Gemini 函数声明，parametersJsonSchema 为标准 JSON Schema 形式的参数
+type geminiFunctionDeclaration struct {
+	Name                 string `json:"name"`
+	Description          string `json:"description,omitempty"`
+	Parameters           any    `json:"parameters,omitempty"`
+	ParametersJsonSchema any    `json:"parametersJsonSchema,omitempty"`
+}
+
+// normalizeGeminiSchema 将 Gemini Schema 中的大写类型名（OBJECT、STRING 等）转换为 JSON Schema 的小写形式
+func normalizeGeminiSchema(schema any) any {
+	switch v := schema.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			if typeName, ok := value.(string); ok && key == "type" {
+				result[key] = strings.ToLower(typeName)
+			} else {
+				result[key] = normalizeGeminiSchema(value)
+			}
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, value := range v {
+			result[i] = normalizeGeminiSchema(value)
+		}
+		return result
+	}
+	return schema
+}
+
+func geminiInlineData2OpenAI(data *GeminiInlineData) dto.MediaContent {
+	mimeType := strings.ToLower(data.MimeType)
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return dto.MediaContent{
+			Type:     dto.ContentTypeImageURL,
+			ImageUrl: &dto.MessageImageUrl{Url: fmt.Sprintf("data:%s;base64,%s", data.MimeType, data.Data)},
+		}
+	case strings.HasPrefix(mimeType, "audio/"):
+		format := strings.TrimPrefix(mimeType, "audio/")
+		if format == "mpeg" {
+			format = "mp3"
+		}
+		return dto.MediaContent{
+			Type:       dto.ContentTypeInputAudio,
+			InputAudio: &dto.MessageInputAudio{Data: data.Data, Format: format},
+		}
+	}
+	return dto.MediaContent{
+		Type: dto.ContentTypeFile,
+		File: &dto.MessageFile{FileData: fmt.Sprintf("data:%s;base64,%s", data.MimeType, data.Data)},
+	}
+}
+
+func geminiToolConfig2OpenAI(toolConfig *GeminiToolConfig) any {
+	if toolConfig == nil || toolConfig.FunctionCallingConfig == nil {
+		return nil
+	}
+	config := toolConfig.FunctionCallingConfig
+	switch strings.ToUpper(config.Mode) {
+	case "ANY":
+		if len(config.AllowedFunctionNames) == 1 {
+			return map[string]interface{}{
+				"type": "function",
+				"function": map[string]interface{}{
+					"name": config.AllowedFunctionNames[0],
+				},
+			}
+		}
+		return "required"
+	case "NONE":
+		return "none"
+	case "AUTO":
+		return "auto"
+	}
+	return nil
+}
+
+// GeminiRequest2OpenAI 将 Gemini generateContent 请求转换为 OpenAI 对话补全请求。
+// Gemini 通过函数名关联 functionCall 与 functionResponse，转换时按函数名依次配对生成 tool_call_id
+func GeminiRequest2OpenAI(request *GeminiChatRequest, model string, stream bool) (*dto.GeneralOpenAIRequest, error) {
+	config := request.GenerationConfig
+	openAIRequest := &dto.GeneralOpenAIRequest{
+		Model:       model,
+		Stream:      stream,
+		Temperature: config.Temperature,
+		TopP:        config.TopP,
+		MaxTokens:   config.MaxOutputTokens,
+		N:           config.CandidateCount,
+		Seed:        float64(config.Seed),
+	}
+	if len(config.StopSequences) > 0 {
+		openAIRequest.Stop = config.StopSequences
+	}
+	if config.ResponseMimeType == "application/json" {
+		if config.ResponseSchema != nil {
+			openAIRequest.ResponseFormat = &dto.ResponseFormat{
+				Type: "json_schema",
+				JsonSchema: &dto.FormatJsonSchema{
+					Name:   "response",
+					Schema: normalizeGeminiSchema(config.ResponseSchema),
+				},
+			}
+		} else {
+			openAIRequest.ResponseFormat = &dto.ResponseFormat{Type: "json_object"}
+		}
+	}
+
+	// 仅转换函数声明，googleSearch、codeExecution 等 Gemini 内置工具无法在其他渠道使用
+	for _, tool := range request.Tools {
+		if tool.FunctionDeclarations == nil {
+			continue
+		}
+		declarations, err := common.Any2Type[[]geminiFunctionDeclaration](tool.FunctionDeclarations)
+		if err != nil {
+			return nil, fmt.Errorf("invalid functionDeclarations: %w", err)
+		}
+		for _, declaration := range declarations {
+			parameters := declaration.ParametersJsonSchema
+			if parameters == nil {
+				parameters = normalizeGeminiSchema(declaration.Parameters)
+			}
+			openAIRequest.Tools = append(openAIRequest.Tools, dto.ToolCallRequest{
+				Type: "function",
+				Function: dto.FunctionRequest{
+					Name:        declaration.Name,
+					Description: declaration.Description,
+					Parameters:  parameters,
+				},
+			})
+		}
+	}
+	if len(openAIRequest.Tools) > 0 {
+		openAIRequest.ToolChoice = geminiToolConfig2OpenAI(request.ToolConfig)
+	}
+
+	messages := make([]dto.Message, 0, len(request.Contents)+1)
+	if request.SystemInstructions != nil {
+		var texts []string
+		for _, part := range request.SystemInstructions.Parts {
+			if part.Text != "" {
+				texts = append(texts, part.Text)
+			}
+		}
+		if len(texts) > 0 {
+			message := dto.Message{Role: "system"}
+			message.SetStringContent(strings.Join(texts, "\n"))
+			messages = append(messages, message)
+		}
+	}
+
+	pendingCallIds := make(map[string][]string)
+	for _, content := range request.Contents {
+		role := "user"
+		if content.Role == "model" {
+			role = "assistant"
+		}
+		var mediaContents []dto.MediaContent
+		var toolCalls []dto.ToolCallRequest
+		for _, part := range content.Parts {
+			switch {
+			case part.Thought:
+				// 历史中的思考内容不回传给上游
+			case part.FunctionCall != nil:
+				callId := fmt.Sprintf("call_%s", common.GetUUID())
+				pendingCallIds[part.FunctionCall.FunctionName] = append(pendingCallIds[part.FunctionCall.FunctionName], callId)
+				arguments := "{}"
+				if part.FunctionCall.Arguments != nil {
+					argumentsBytes, err := json.Marshal(part.FunctionCall.Arguments)
+					if err != nil {
+						return nil, err
+					}
+					arguments = string(argumentsBytes)
+				}
+				toolCalls = append(toolCalls, dto.ToolCallRequest{
+					ID:   callId,
+					Type: "function",
+					Function: dto.FunctionRequest{
+						Name:      part.FunctionCall.FunctionName,
+						Arguments: arguments,
+					},
+				})
+			case part.FunctionResponse != nil:
+				name := part.FunctionResponse.Name
+				callId := fmt.Sprintf("call_%s", common.GetUUID())
+				if ids := pendingCallIds[name]; len(ids) > 0 {
+					callId = ids[0]
+					pendingCallIds[name] = ids[1:]
+				}
+				responseBytes, err := json.Marshal(part.FunctionResponse.Response)
+				if err != nil {
+					return nil, err
+				}
+				toolMessage := dto.Message{
+					Role:       "tool",
+					Name:       common.GetPointer(name),
+					ToolCallId: callId,
+				}
+				toolMessage.SetStringContent(string(responseBytes))
+				messages = append(messages, toolMessage)
+			case part.InlineData != nil:
+				mediaContents = append(mediaContents, geminiInlineData2OpenAI(part.InlineData))
+			case part.FileData != nil:
+				if part.FileData.MimeType != "" && !strings.HasPrefix(part.FileData.MimeType, "image/") {
+					return nil, fmt.Errorf("unsupported fileData mime type: %s", part.FileData.MimeType)
+				}
+				mediaContents = append(mediaContents, dto.MediaContent{
+					Type:     dto.ContentTypeImageURL,
+					ImageUrl: &dto.MessageImageUrl{Url: part.FileData.FileUri},
+				})
+			case part.ExecutableCode != nil:
+				mediaContents = append(mediaContents, dto.MediaContent{
+					Type: dto.ContentTypeText,
+					Text: "```" + part.ExecutableCode.Language + "\n" + part.ExecutableCode.Code + "\n```",
+				})
+			case part.CodeExecutionResult != nil:
+				mediaContents = append(mediaContents, dto.MediaContent{
+					Type: dto.ContentTypeText,
+					Text: "```output\n" + part.CodeExecutionResult.Output + "\n```",
+				})
+			case part.Text != "":
+				mediaContents = append(mediaContents, dto.MediaContent{Type: dto.ContentTypeText, Text: part.Text})
+			}
+		}
+		if len(mediaContents) == 0 && len(toolCalls) == 0 {
+			continue
+		}
+		message := dto.Message{Role: role}
+		onlyText := true
+		var texts []string
+		for _, mediaContent := range mediaContents {
+			if mediaContent.Type != dto.ContentTypeText {
+				onlyText = false
+				break
+			}
+			texts = append(texts, mediaContent.Text)
+		}
+		if onlyText {
+			message.SetStringContent(strings.Join(texts, ""))
+		} else {
+			message.SetMediaContent(mediaContents)
+		}
+		if len(toolCalls) > 0 {
+			message.SetToolCalls(toolCalls)
+		}
+		messages = append(messages, message)
+	}
+	openAIRequest.Messages = messages
+	return openAIRequest, nil
+}
+
+// openAIFinishReason2Gemini 转换结束原因，工具调用在 Gemini 中同样以 STOP 结束
+func openAIFinishReason2Gemini(reason string) string {
+	switch reason {
+	case constant.FinishReasonLength:
+		return "MAX_TOKENS"
+	case constant.FinishReasonContentFilter:
+		return "SAFETY"
+	case "":
+		return ""
+	}
+	return "STOP"
+}
+
+func openAIToolCall2GeminiPart(toolCall dto.ToolCallResponse) GeminiPart {
+	var args any
+	if toolCall.Function.Arguments != "" {
+		if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args); err != nil {
+			args = map[string]interface{}{}
+		}
+	}
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	return GeminiPart{
+		FunctionCall: &FunctionCall{
+			FunctionName: toolCall.Function.Name,
+			Arguments:    args,
+		},
+	}
+}
+
+func openAIUsage2Gemini(usage *dto.Usage) GeminiUsageMetadata {
+	if usage == nil {
+		return GeminiUsageMetadata{}
+	}
+	reasoningTokens := usage.CompletionTokenDetails.ReasoningTokens
+	return GeminiUsageMetadata{
+		PromptTokenCount:     usage.PromptTokens,
+		CandidatesTokenCount: usage.CompletionTokens - reasoningTokens,
+		ThoughtsTokenCount:   reasoningTokens,
+		TotalTokenCount:      usage.TotalTokens,
+	}
+}
+
+// ResponseOpenAI2Gemini 将 OpenAI 对话补全响应转换为 Gemini generateContent 响应
+func ResponseOpenAI2Gemini(response *dto.OpenAITextResponse) *GeminiChatResponse {
+	geminiResponse := &GeminiChatResponse{
+		Candidates:    make([]GeminiChatCandidate, 0, len(response.Choices)),
+		UsageMetadata: openAIUsage2Gemini(&response.Usage),
+	}
+	for _, choice := range response.Choices {
+		parts := make([]GeminiPart, 0)
+		reasoning := choice.Message.ReasoningContent
+		if reasoning == "" {
+			reasoning = choice.Message.Reasoning
+		}
+		if reasoning != "" {
+			parts = append(parts, GeminiPart{Text: reasoning, Thought: true})
+		}
+		if text := choice.Message.StringContent(); text != "" {
+			parts = append(parts, GeminiPart{Text: text})
+		}
+		var toolCalls []dto.ToolCallResponse
+		if len(choice.Message.ToolCalls) > 0 {
+			_ = json.Unmarshal(choice.Message.ToolCalls, &toolCalls)
+		}
+		for _, toolCall := range toolCalls {
+			parts = append(parts, openAIToolCall2GeminiPart(toolCall))
+		}
+		geminiResponse.Candidates = append(geminiResponse.Candidates, GeminiChatCandidate{
+			Content:      GeminiChatContent{Role: "model", Parts: parts},
+			FinishReason: common.GetPointer(openAIFinishReason2Gemini(choice.FinishReason)),
+			Index:        int64(choice.Index),
+		})
+	}
+	return geminiResponse
+}
+
+// OpenAI2GeminiStreamConverter 将 OpenAI 流式分片转换为 Gemini 流式响应。
+// 工具调用参数分片累积后在结束时整体输出；结束原因与用量在上游用量分片之后才能确定，统一在 Finish 中输出
+type OpenAI2GeminiStreamConverter struct {
+	toolCalls     map[int][]*dto.ToolCallResponse
+	finishReasons map[int]string
+	usage         *dto.Usage
+}
+
+func NewOpenAI2GeminiStreamConverter() *OpenAI2GeminiStreamConverter {
+	return &OpenAI2GeminiStreamConverter{
+		toolCalls:     make(map[int][]*dto.ToolCallResponse),
+		finishReasons: make(map[int]string),
+	}
+}
+
+// Convert 转换一个 OpenAI 流式分片，没有需要立即输出的内容时返回 nil
+func (s *OpenAI2GeminiStreamConverter) Convert(response *dto.ChatCompletionsStreamResponse) *GeminiChatResponse {
+	if response.Usage != nil && (response.Usage.PromptTokens != 0 || response.Usage.CompletionTokens != 0) {
+		s.usage = response.Usage
+	}
+	candidates := make([]GeminiChatCandidate, 0, len(response.Choices))
+	for _, choice := range response.Choices {
+		for _, toolCall := range choice.Delta.ToolCalls {
+			s.appendToolCall(choice.Index, toolCall)
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			s.finishReasons[choice.Index] = *choice.FinishReason
+		}
+		parts := make([]GeminiPart, 0)
+		if reasoning := choice.Delta.GetReasoningContent(); reasoning != "" {
+			parts = append(parts, GeminiPart{Text: reasoning, Thought: true})
+		}
+		if text := choice.Delta.GetContentString(); text != "" {
+			parts = append(parts, GeminiPart{Text: text})
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		candidates = append(candidates, GeminiChatCandidate{
+			Content: GeminiChatContent{Role: "model", Parts: parts},
+			Index:   int64(choice.Index),
+		})
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	return &GeminiChatResponse{Candidates: candidates}
+}
+
+func (s *OpenAI2GeminiStreamConverter) appendToolCall(choiceIndex int, delta dto.ToolCallResponse) {
+	calls := s.toolCalls[choiceIndex]
+	var current *dto.ToolCallResponse
+	if len(calls) > 0 {
+		last := calls[len(calls)-1]
+		sameIndex := delta.Index == nil || last.Index == nil || *delta.Index == *last.Index
+		if sameIndex && (delta.ID == "" || delta.ID == last.ID) {
+			current = last
+		}
+	}
+	if current == nil {
+		current = &dto.ToolCallResponse{ID: delta.ID, Index: delta.Index, Type: "function"}
+		s.toolCalls[choiceIndex] = append(calls, current)
+	}
+	if delta.Function.Name != "" {
+		current.Function.Name = delta.Function.Name
+	}
+	current.Function.Arguments += delta.Function.Arguments
+}
+
+// Finish 输出累积的工具调用、结束原因与用量，usage 为适配器统计的最终用量，为空时使用上游返回的用量
+func (s *OpenAI2GeminiStreamConverter) Finish(usage *dto.Usage) *GeminiChatResponse {
+	if usage == nil {
+		usage = s.usage
+	}
+	indexes := make([]int, 0, len(s.finishReasons)+len(s.toolCalls))
+	seen := make(map[int]bool)
+	for index := range s.finishReasons {
+		seen[index] = true
+		indexes = append(indexes, index)
+	}
+	for index := range s.toolCalls {
+		if !seen[index] {
+			indexes = append(indexes, index)
+		}
+	}
+	if len(indexes) == 0 {
+		indexes = append(indexes, 0)
+	}
+	sort.Ints(indexes)
+	candidates := make([]GeminiChatCandidate, 0, len(indexes))
+	for _, index := range indexes {
+		parts := make([]GeminiPart, 0)
+		for _, toolCall := range s.toolCalls[index] {
+			parts = append(parts, openAIToolCall2GeminiPart(*toolCall))
+		}
+		finishReason := openAIFinishReason2Gemini(s.finishReasons[index])
+		if finishReason == "" {
+			finishReason = "STOP"
+		}
+		candidates = append(candidates, GeminiChatCandidate{
+			Content:      GeminiChatContent{Role: "model", Parts: parts},
+			FinishReason: common.GetPointer(finishReason),
+			Index:        int64(index),
+		})
+	}
+	return &GeminiChatResponse{
+		Candidates:    candidates,
+		UsageMetadata: openAIUsage2Gemini(usage),
+	}
+}
+
+// EmbeddingRequestGemini2OpenAI 将 Gemini embedContent 请求转换为 OpenAI embedding 请求，多个文本片段合并为一条输入
+func EmbeddingRequestGemini2OpenAI(request *GeminiEmbeddingRequest, model string) *dto.EmbeddingRequest {
+	var texts []string
+	for _, part := range request.Content.Parts {
+		if part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return &dto.EmbeddingRequest{
+		Model:      model,
+		Input:      strings.Join(texts, "\n"),
+		Dimensions: request.OutputDimensionality,
+	}
+}
+
+// EmbeddingResponseOpenAI2Gemini 将 OpenAI embedding 响应转换为 Gemini embedContent 响应
+func EmbeddingResponseOpenAI2Gemini(response *dto.OpenAIEmbeddingResponse) *GeminiEmbeddingResponse {
+	geminiResponse := &GeminiEmbeddingResponse{}
+	if len(response.Data) > 0 {
+		geminiResponse.Embedding.Values = response.Data[0].Embedding
+	}
+	return geminiResponse
+}
@@ -170,7 +170,8 @@ func OaiStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 		}
 	}
 
-	if shouldSendLastResp {
+	// Claude 格式的最后一个分片由 handleFinalResponse 转换
+	if shouldSendLastResp && info.RelayFormat == relaycommon.RelayFormatOpenAI {
 		sendStreamData(c, info, lastStreamData, forceFormat, thinkToContent)
 		//err = handleStreamFormat(c, info, lastStreamData, forceFormat, thinkToContent)
 	}
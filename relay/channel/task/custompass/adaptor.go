@@ -343,6 +343,53 @@ func (a *TaskAdaptor) FetchTask(baseUrl, key string, body map[string]any) (*http
 	return service.GetHttpClient().Do(req)
 }
 
+// CancelTask 取消任务，请求地址由渠道额外设置 cancel_endpoint 配置，默认为 /{model}/task/cancel，
+// 支持 {model} 与 {task_id} 占位符，以 http 开头时作为完整地址使用
+func (a *TaskAdaptor) CancelTask(baseUrl, key string, body map[string]any) (*http.Response, error) {
+	taskID, ok := body["task_id"].(string)
+	if !ok || taskID == "" {
+		return nil, fmt.Errorf("task_id is required")
+	}
+	modelName, _ := body["model"].(string)
+	modelName = strings.TrimSuffix(modelName, "/submit")
+	if modelName == "" {
+		return nil, fmt.Errorf("model is required")
+	}
+
+	endpoint := CancelEndpointDefault
+	if setting, ok := body["channel_setting"].(map[string]interface{}); ok {
+		if value, ok := setting[CancelEndpointSettingKey].(string); ok && value != "" {
+			endpoint = value
+		}
+	}
+	endpoint = strings.NewReplacer("{model}", modelName, "{task_id}", taskID).Replace(endpoint)
+	requestUrl := endpoint
+	if !strings.HasPrefix(endpoint, "http") {
+		if baseUrl == "" {
+			return nil, fmt.Errorf("base_url is required for CustomPass channel")
+		}
+		requestUrl = strings.TrimSuffix(baseUrl, "/") + "/" + strings.TrimPrefix(endpoint, "/")
+	}
+	common.SysLog(fmt.Sprintf("CustomPass CancelTask 请求URL: %s, 任务ID: %s", requestUrl, taskID))
+
+	byteBody, err := json.Marshal(map[string]string{"task_id": taskID})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, requestUrl, bytes.NewBuffer(byteBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+key)
+	if constant.CustomPassHeaderKey != "" {
+		if clientToken, exists := body["client_token"].(string); exists && clientToken != "" {
+			req.Header.Set(constant.CustomPassHeaderKey, clientToken)
+		}
+	}
+	return channel.DoTaskCancelRequest(req)
+}
+
 func (a *TaskAdaptor) GetModelList() []string {
 	// 自定义透传渠道支持任意模型名称
 	return []string{}
@@ -4,3 +4,9 @@ package custompass
 var ModelList = []string{}
 
 var ChannelName = "custompass"
+
+// CancelEndpointSettingKey 取消任务地址在渠道额外设置中的键名
+const CancelEndpointSettingKey = "cancel_endpoint"
+
+// CancelEndpointDefault 默认的取消任务地址
+const CancelEndpointDefault = "/{model}/task/cancel"
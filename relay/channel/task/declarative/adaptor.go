@@ -0,0 +1,286 @@
+package declarative
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"one-api/common"
+	"one-api/dto"
+	"one-api/relay/channel"
+	relaycommon "one-api/relay/common"
+	"one-api/service"
+)
+
+// TaskAdaptor 声明式任务适配器，提交与查询的请求格式、结果字段和状态映射均来自渠道的 task_config 配置，
+// 新增视频、音乐等异步任务供应商时无需编写代码
+type TaskAdaptor struct {
+	ChannelType int
+	baseURL     string
+	apiKey      string
+	config      *TaskConfig
+	configErr   error
+}
+
+func (a *TaskAdaptor) Init(info *relaycommon.TaskRelayInfo) {
+	a.ChannelType = info.ChannelType
+	a.baseURL = info.BaseUrl
+	a.apiKey = info.ApiKey
+	a.config, a.configErr = ParseTaskConfig(info.ChannelSetting)
+}
+
+// ValidateRequestAndSetAction 请求体必须为 JSON 对象，action 取自路径参数，默认为 generate
+func (a *TaskAdaptor) ValidateRequestAndSetAction(c *gin.Context, info *relaycommon.TaskRelayInfo) (taskErr *dto.TaskError) {
+	if a.configErr != nil {
+		return service.TaskErrorWrapperLocal(a.configErr, "invalid_channel_config", http.StatusInternalServerError)
+	}
+	action := strings.ToLower(strings.TrimSpace(c.Param("action")))
+	if action == "" {
+		action = "generate"
+	}
+	info.Action = action
+
+	var request map[string]any
+	if err := common.UnmarshalBodyReusable(c, &request); err != nil {
+		return service.TaskErrorWrapperLocal(err, "invalid_request", http.StatusBadRequest)
+	}
+	c.Set("declarative_request", request)
+	return nil
+}
+
+func (a *TaskAdaptor) templateVars(info *relaycommon.TaskRelayInfo) map[string]string {
+	return map[string]string{
+		"base_url": a.baseURL,
+		"key":      a.apiKey,
+		"model":    info.UpstreamModelName,
+		"action":   info.Action,
+	}
+}
+
+func (a *TaskAdaptor) templateContext(c *gin.Context, info *relaycommon.TaskRelayInfo) *templateContext {
+	request, _ := c.Get("declarative_request")
+	return &templateContext{vars: a.templateVars(info), request: request}
+}
+
+func (a *TaskAdaptor) BuildRequestURL(info *relaycommon.TaskRelayInfo) (string, error) {
+	tpl := &templateContext{vars: a.templateVars(info)}
+	return tpl.renderUrl(a.config.Submit.Url), nil
+}
+
+func (a *TaskAdaptor) BuildRequestHeader(c *gin.Context, req *http.Request, info *relaycommon.TaskRelayInfo) error {
+	setTemplateHeaders(req, a.config.Submit.Headers, a.templateContext(c, info), a.apiKey)
+	return nil
+}
+
+// BuildRequestBody 未配置请求体模板时原样透传客户端请求体
+func (a *TaskAdaptor) BuildRequestBody(c *gin.Context, info *relaycommon.TaskRelayInfo) (io.Reader, error) {
+	if len(a.config.Submit.Body) == 0 {
+		body, err := common.GetRequestBody(c)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(body), nil
+	}
+	body, err := a.templateContext(c, info).renderBody(a.config.Submit.Body)
+	if err != nil {
+		return nil, fmt.Errorf("render submit body failed: %w", err)
+	}
+	return bytes.NewReader(body), nil
+}
+
+func (a *TaskAdaptor) DoRequest(c *gin.Context, info *relaycommon.TaskRelayInfo, requestBody io.Reader) (*http.Response, error) {
+	return channel.DoTaskApiRequest(a, c, info, requestBody)
+}
+
+// DoResponse 按 task_id_path 提取上游任务 ID
+func (a *TaskAdaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.TaskRelayInfo) (taskID string, taskData []byte, taskErr *dto.TaskError) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		taskErr = service.TaskErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+		return
+	}
+	var response any
+	if err = json.Unmarshal(responseBody, &response); err != nil {
+		taskErr = service.TaskErrorWrapper(fmt.Errorf("%w, body: %s", err, responseBody), "unmarshal_response_body_failed", http.StatusInternalServerError)
+		return
+	}
+	taskID = jsonPathString(response, a.config.TaskIdPath)
+	if taskID == "" {
+		taskErr = service.TaskErrorWrapper(fmt.Errorf("task id not found at %s, body: %s", a.config.TaskIdPath, responseBody), "task_id_not_found", http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"task_id": taskID})
+	return taskID, responseBody, nil
+}
+
+// FetchTask 查询任务状态，body 需包含 task_id 与渠道额外设置 channel_setting，可选 model 与 action
+func (a *TaskAdaptor) FetchTask(baseUrl, key string, body map[string]any) (*http.Response, error) {
+	config, tpl, err := parseTaskRequestBody(baseUrl, key, body)
+	if err != nil {
+		return nil, err
+	}
+	return doTemplateRequest(config.Fetch, tpl, key, http.MethodGet)
+}
+
+// CancelTask 按 cancel 模板取消任务，参数与 FetchTask 相同
+func (a *TaskAdaptor) CancelTask(baseUrl, key string, body map[string]any) (*http.Response, error) {
+	config, tpl, err := parseTaskRequestBody(baseUrl, key, body)
+	if err != nil {
+		return nil, err
+	}
+	if config.Cancel == nil || config.Cancel.Url == "" {
+		return nil, fmt.Errorf("task_config cancel is not configured: %w", channel.ErrTaskCancelUnsupported)
+	}
+	return doTemplateRequest(*config.Cancel, tpl, key, http.MethodPost)
+}
+
+func parseTaskRequestBody(baseUrl, key string, body map[string]any) (*TaskConfig, *templateContext, error) {
+	taskID, ok := body["task_id"].(string)
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid task_id")
+	}
+	setting, _ := body["channel_setting"].(map[string]interface{})
+	config, err := ParseTaskConfig(setting)
+	if err != nil {
+		return nil, nil, err
+	}
+	modelName, _ := body["model"].(string)
+	action, _ := body["action"].(string)
+	tpl := &templateContext{vars: map[string]string{
+		"base_url": baseUrl,
+		"key":      key,
+		"model":    modelName,
+		"action":   action,
+		"task_id":  taskID,
+	}}
+	return config, tpl, nil
+}
+
+// doTemplateRequest 渲染并发送查询或取消请求，method 为模板未配置请求方法时的默认值
+func doTemplateRequest(template RequestTemplate, tpl *templateContext, key string, method string) (*http.Response, error) {
+	if template.Method != "" {
+		method = strings.ToUpper(template.Method)
+	}
+	var requestBody io.Reader
+	if len(template.Body) > 0 {
+		data, err := tpl.renderBody(template.Body)
+		if err != nil {
+			return nil, fmt.Errorf("render request body failed: %w", err)
+		}
+		requestBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, tpl.renderUrl(template.Url), requestBody)
+	if err != nil {
+		return nil, err
+	}
+	setTemplateHeaders(req, template.Headers, tpl, key)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	req = req.WithContext(ctx)
+	resp, err := service.GetHttpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	// 超时上下文在返回前取消，先读出响应体
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	return resp, nil
+}
+
+func (a *TaskAdaptor) GetModelList() []string {
+	return ModelList
+}
+
+func (a *TaskAdaptor) GetChannelName() string {
+	return ChannelName
+}
+
+// ParseResultUrl 按 result_url_path 提取任务结果地址
+func (a *TaskAdaptor) ParseResultUrl(resp map[string]any) (string, error) {
+	if a.config == nil || a.config.ResultUrlPath == "" {
+		return "", errors.New("result_url_path is not configured")
+	}
+	url := jsonPathString(resp, a.config.ResultUrlPath)
+	if url == "" {
+		return "", fmt.Errorf("result url not found at %s", a.config.ResultUrlPath)
+	}
+	return url, nil
+}
+
+// GetTaskPrice 返回当前 action 配置的固定价格
+func (a *TaskAdaptor) GetTaskPrice(info *relaycommon.TaskRelayInfo) (float64, bool) {
+	if a.config == nil {
+		return 0, false
+	}
+	price, ok := a.config.ActionPrices[info.Action]
+	return price, ok
+}
+
+// ParseTaskResult 从上游查询响应中提取任务状态、进度、结果地址与失败原因，
+// 未在 status_mapping 中配置的状态值视为 UNKNOWN
+func (config *TaskConfig) ParseTaskResult(responseBody []byte) (*TaskResult, error) {
+	var response any
+	if err := json.Unmarshal(responseBody, &response); err != nil {
+		return nil, err
+	}
+	result := &TaskResult{
+		ResultUrl:  jsonPathString(response, config.ResultUrlPath),
+		FailReason: jsonPathString(response, config.FailReasonPath),
+		Progress:   normalizeProgress(jsonPathString(response, config.ProgressPath)),
+	}
+	upstreamStatus := jsonPathString(response, config.StatusPath)
+	if upstreamStatus == "" {
+		return nil, fmt.Errorf("status not found at %s", config.StatusPath)
+	}
+	if status, ok := config.StatusMapping[upstreamStatus]; ok {
+		result.Status = status
+	} else if taskStatuses[strings.ToUpper(upstreamStatus)] {
+		result.Status = strings.ToUpper(upstreamStatus)
+	} else {
+		result.Status = "UNKNOWN"
+	}
+	return result, nil
+}
+
+// normalizeProgress 将 0-1 或 0-100 的数值进度转换为百分比字符串
+func normalizeProgress(progress string) string {
+	progress = strings.TrimSpace(progress)
+	if progress == "" || strings.HasSuffix(progress, "%") {
+		return progress
+	}
+	value, err := strconv.ParseFloat(progress, 64)
+	if err != nil {
+		return ""
+	}
+	if value > 0 && value <= 1 && strings.Contains(progress, ".") {
+		value *= 100
+	}
+	return fmt.Sprintf("%d%%", int(value))
+}
+
+// setTemplateHeaders 设置模板请求头，未配置请求头时默认使用 Bearer 鉴权
+func setTemplateHeaders(req *http.Request, headers map[string]string, tpl *templateContext, key string) {
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if len(headers) == 0 {
+		req.Header.Set("Authorization", "Bearer "+key)
+		return
+	}
+	for name, value := range headers {
+		req.Header.Set(name, tpl.renderString(value))
+	}
+}
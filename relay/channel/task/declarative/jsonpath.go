@@ -0,0 +1,95 @@
+package declarative
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPathGet 按 JSONPath 从 JSON 解码后的数据中取值，支持 $.a.b、$.a[0].b 与 $['a'] 形式，$ 前缀可省略
+func jsonPathGet(data any, path string) (any, bool) {
+	path = strings.TrimSpace(path)
+	path = strings.TrimPrefix(path, "$")
+	current := data
+	for path != "" {
+		var key string
+		var index = -1
+		switch {
+		case strings.HasPrefix(path, "."):
+			path = path[1:]
+			end := strings.IndexAny(path, ".[")
+			if end < 0 {
+				end = len(path)
+			}
+			key, path = path[:end], path[end:]
+		case strings.HasPrefix(path, "["):
+			end := strings.Index(path, "]")
+			if end < 0 {
+				return nil, false
+			}
+			segment := strings.TrimSpace(path[1:end])
+			path = path[end+1:]
+			if unquoted := strings.Trim(segment, `'"`); unquoted != segment {
+				key = unquoted
+			} else {
+				i, err := strconv.Atoi(segment)
+				if err != nil {
+					return nil, false
+				}
+				index = i
+			}
+		default:
+			end := strings.IndexAny(path, ".[")
+			if end < 0 {
+				end = len(path)
+			}
+			key, path = path[:end], path[end:]
+		}
+		if index >= 0 {
+			items, ok := current.([]any)
+			if !ok || index >= len(items) {
+				return nil, false
+			}
+			current = items[index]
+			continue
+		}
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// jsonPathString 按 JSONPath 取值并转为字符串，非字符串的值按 JSON 序列化
+func jsonPathString(data any, path string) string {
+	if path == "" {
+		return ""
+	}
+	value, ok := jsonPathGet(data, path)
+	if !ok || value == nil {
+		return ""
+	}
+	return stringify(value)
+}
+
+func stringify(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(b)
+	}
+}
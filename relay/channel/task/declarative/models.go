@@ -0,0 +1,90 @@
+package declarative
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// 声明式任务渠道支持任意模型名称，所以这里返回空列表
+var ModelList = []string{}
+
+var ChannelName = "declarative"
+
+// TaskConfigKey 声明式任务配置在渠道额外设置中的键名
+const TaskConfigKey = "task_config"
+
+// taskStatuses 状态映射允许使用的任务状态，与 model.TaskStatus 保持一致
+var taskStatuses = map[string]bool{
+	"NOT_START":   true,
+	"SUBMITTED":   true,
+	"QUEUED":      true,
+	"IN_PROGRESS": true,
+	"FAILURE":     true,
+	"SUCCESS":     true,
+	"UNKNOWN":     true,
+}
+
+// RequestTemplate 上游请求模板，Url、Headers 与 Body 中的 {{变量}} 会在发送前替换，Url 中除 base_url 外的变量会按位置转义，
+// 可用变量：base_url、key、model、action、task_id，以及引用客户端请求体字段的 request.<路径>
+type RequestTemplate struct {
+	Method  string            `json:"method,omitempty"`
+	Url     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// TaskConfig 声明式任务渠道配置，各 Path 字段为 JSONPath，如 $.data.task_id、$.data.videos[0].url
+type TaskConfig struct {
+	Submit RequestTemplate `json:"submit"`
+	Fetch  RequestTemplate `json:"fetch"`
+	// Cancel 可选的取消任务请求，未配置时不支持取消
+	Cancel *RequestTemplate `json:"cancel,omitempty"`
+
+	TaskIdPath     string `json:"task_id_path"`
+	StatusPath     string `json:"status_path"`
+	ProgressPath   string `json:"progress_path,omitempty"`
+	ResultUrlPath  string `json:"result_url_path,omitempty"`
+	FailReasonPath string `json:"fail_reason_path,omitempty"`
+
+	// StatusMapping 上游状态值到任务状态（SUBMITTED、QUEUED、IN_PROGRESS、SUCCESS、FAILURE 等）的映射
+	StatusMapping map[string]string `json:"status_mapping"`
+	// ActionPrices 按 action 计费的固定价格（美元），未配置的 action 使用模型价格
+	ActionPrices map[string]float64 `json:"action_prices,omitempty"`
+}
+
+// TaskResult 从上游查询结果中提取的任务状态
+type TaskResult struct {
+	Status     string
+	Progress   string
+	ResultUrl  string
+	FailReason string
+}
+
+// ParseTaskConfig 从渠道额外设置中读取并校验声明式任务配置
+func ParseTaskConfig(setting map[string]interface{}) (*TaskConfig, error) {
+	raw, ok := setting[TaskConfigKey]
+	if !ok {
+		return nil, errors.New("channel setting task_config is required")
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var config TaskConfig
+	if err = json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid task_config: %w", err)
+	}
+	if config.Submit.Url == "" || config.Fetch.Url == "" {
+		return nil, errors.New("task_config submit.url and fetch.url are required")
+	}
+	if config.TaskIdPath == "" || config.StatusPath == "" {
+		return nil, errors.New("task_config task_id_path and status_path are required")
+	}
+	for value, status := range config.StatusMapping {
+		if !taskStatuses[status] {
+			return nil, fmt.Errorf("task_config status_mapping %s has invalid status %s", value, status)
+		}
+	}
+	return &config, nil
+}
@@ -0,0 +1,109 @@
+package declarative
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var templateVarRegex = regexp.MustCompile(`{{\s*([^{}\s]+)\s*}}`)
+
+// templateContext 渲染请求模板时可用的变量，request.<路径> 从客户端请求体中按 JSONPath 取值
+type templateContext struct {
+	vars    map[string]string
+	request any
+}
+
+func (t *templateContext) lookup(name string) (any, bool) {
+	if strings.HasPrefix(name, "request.") {
+		if t.request == nil {
+			return nil, false
+		}
+		return jsonPathGet(t.request, "$."+strings.TrimPrefix(name, "request."))
+	}
+	value, ok := t.vars[name]
+	return value, ok
+}
+
+// renderString 替换字符串中的变量，未知变量替换为空字符串
+func (t *templateContext) renderString(s string) string {
+	return templateVarRegex.ReplaceAllStringFunc(s, func(match string) string {
+		name := templateVarRegex.FindStringSubmatch(match)[1]
+		value, ok := t.lookup(name)
+		if !ok || value == nil {
+			return ""
+		}
+		return stringify(value)
+	})
+}
+
+// renderUrl 替换地址模板中的变量，除 base_url 外的变量按所在位置转义：查询参数中使用 QueryEscape，
+// 路径中使用 PathEscape，避免客户端请求字段或上游任务 ID 中的 /、?、& 等字符改变请求地址
+func (t *templateContext) renderUrl(s string) string {
+	var builder strings.Builder
+	last := 0
+	inQuery := false
+	for _, loc := range templateVarRegex.FindAllStringSubmatchIndex(s, -1) {
+		literal := s[last:loc[0]]
+		builder.WriteString(literal)
+		inQuery = inQuery || strings.Contains(literal, "?")
+		last = loc[1]
+		name := s[loc[2]:loc[3]]
+		value, ok := t.lookup(name)
+		if !ok || value == nil {
+			continue
+		}
+		rendered := stringify(value)
+		switch {
+		case name == "base_url":
+		case inQuery:
+			rendered = url.QueryEscape(rendered)
+		case rendered == "." || rendered == "..":
+			// 单独的 . 与 .. 会被当作路径中的相对段
+			rendered = strings.ReplaceAll(rendered, ".", "%2E")
+		default:
+			rendered = url.PathEscape(rendered)
+		}
+		builder.WriteString(rendered)
+	}
+	builder.WriteString(s[last:])
+	return builder.String()
+}
+
+// renderValue 递归替换 JSON 值中的变量；整个字符串只包含一个变量时保留变量原始的 JSON 类型
+func (t *templateContext) renderValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		rendered := make(map[string]any, len(v))
+		for key, item := range v {
+			rendered[key] = t.renderValue(item)
+		}
+		return rendered
+	case []any:
+		rendered := make([]any, len(v))
+		for i, item := range v {
+			rendered[i] = t.renderValue(item)
+		}
+		return rendered
+	case string:
+		if match := templateVarRegex.FindStringSubmatch(v); match != nil && match[0] == strings.TrimSpace(v) {
+			if raw, ok := t.lookup(match[1]); ok {
+				return raw
+			}
+			return nil
+		}
+		return t.renderString(v)
+	default:
+		return v
+	}
+}
+
+// renderBody 渲染 JSON 请求体模板
+func (t *templateContext) renderBody(body json.RawMessage) ([]byte, error) {
+	var tpl any
+	if err := json.Unmarshal(body, &tpl); err != nil {
+		return nil, err
+	}
+	return json.Marshal(t.renderValue(tpl))
+}
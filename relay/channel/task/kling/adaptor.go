@@ -58,6 +58,21 @@ type responsePayload struct {
 // Adaptor implementation
 // ============================
 
+// Kling exposes image-to-video and text-to-video as separate endpoints; the
+// task action records which one a task was submitted to.
+const (
+	actionGenerate     = "generate"
+	actionTextGenerate = "textGenerate"
+)
+
+// videoPath returns the endpoint path of the given action.
+func videoPath(action string) string {
+	if action == actionTextGenerate {
+		return "/v1/videos/text2video"
+	}
+	return "/v1/videos/image2video"
+}
+
 type TaskAdaptor struct {
 	ChannelType int
 	accessKey   string
@@ -79,10 +94,7 @@ func (a *TaskAdaptor) Init(info *relaycommon.TaskRelayInfo) {
 
 // ValidateRequestAndSetAction parses body, validates fields and sets default action.
 func (a *TaskAdaptor) ValidateRequestAndSetAction(c *gin.Context, info *relaycommon.TaskRelayInfo) (taskErr *dto.TaskError) {
-	// Accept only POST /v1/video/generations as "generate" action.
-	action := "generate"
-	info.Action = action
-
+	// Accept only POST /v1/video/generations; requests without an image are text-to-video.
 	var req SubmitReq
 	if err := common.UnmarshalBodyReusable(c, &req); err != nil {
 		taskErr = service.TaskErrorWrapperLocal(err, "invalid_request", http.StatusBadRequest)
@@ -92,6 +104,10 @@ func (a *TaskAdaptor) ValidateRequestAndSetAction(c *gin.Context, info *relaycom
 		taskErr = service.TaskErrorWrapperLocal(fmt.Errorf("prompt is required"), "invalid_request", http.StatusBadRequest)
 		return
 	}
+	info.Action = actionGenerate
+	if strings.TrimSpace(req.Image) == "" {
+		info.Action = actionTextGenerate
+	}
 
 	// Store into context for later usage
 	c.Set("kling_request", req)
@@ -100,7 +116,7 @@ func (a *TaskAdaptor) ValidateRequestAndSetAction(c *gin.Context, info *relaycom
 
 // BuildRequestURL constructs the upstream URL.
 func (a *TaskAdaptor) BuildRequestURL(info *relaycommon.TaskRelayInfo) (string, error) {
-	return fmt.Sprintf("%s/v1/videos/image2video", a.baseURL), nil
+	return fmt.Sprintf("%s%s", a.baseURL, videoPath(info.Action)), nil
 }
 
 // BuildRequestHeader sets required headers.
@@ -175,7 +191,8 @@ func (a *TaskAdaptor) FetchTask(baseUrl, key string, body map[string]any) (*http
 	if !ok {
 		return nil, fmt.Errorf("invalid task_id")
 	}
-	url := fmt.Sprintf("%s/v1/videos/image2video/%s", baseUrl, taskID)
+	action, _ := body["action"].(string)
+	url := fmt.Sprintf("%s%s/%s", baseUrl, videoPath(action), taskID)
 
 	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
@@ -198,6 +215,31 @@ func (a *TaskAdaptor) FetchTask(baseUrl, key string, body map[string]any) (*http
 	return service.GetHttpClient().Do(req)
 }
 
+// CancelTask cancel a pending task
+func (a *TaskAdaptor) CancelTask(baseUrl, key string, body map[string]any) (*http.Response, error) {
+	taskID, ok := body["task_id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid task_id")
+	}
+	action, _ := body["action"].(string)
+	url := fmt.Sprintf("%s%s/%s/cancel", baseUrl, videoPath(action), taskID)
+
+	req, err := http.NewRequest(http.MethodPost, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := a.createJWTTokenWithKey(key)
+	if err != nil {
+		token = key
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("User-Agent", "kling-sdk/1.0")
+
+	return channel.DoTaskCancelRequest(req)
+}
+
 func (a *TaskAdaptor) GetModelList() []string {
 	return []string{"kling-v1", "kling-v1-6", "kling-v2-master"}
 }
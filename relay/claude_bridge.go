@@ -0,0 +1,129 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/relay/channel"
+	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
+	"one-api/service"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// supportsClaudeFormat 适配器是否能直接处理 Claude 格式的请求与响应，
+// 其余渠道通过 Claude→OpenAI→Claude 桥接处理
+func supportsClaudeFormat(info *relaycommon.RelayInfo) bool {
+	switch info.ApiType {
+	case relayconstant.APITypeAnthropic, relayconstant.APITypeAws, relayconstant.APITypeOpenAI:
+		return true
+	case relayconstant.APITypeVertexAi:
+		return strings.HasPrefix(info.UpstreamModelName, "claude")
+	}
+	return false
+}
+
+func convertClaudeBridgeRequest(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, request *dto.ClaudeRequest) (any, error) {
+	openAIRequest, err := service.ClaudeToOpenAIRequest(*request, info)
+	if err != nil {
+		return nil, err
+	}
+	if info.SupportStreamOptions && openAIRequest.Stream {
+		openAIRequest.StreamOptions = &dto.StreamOptions{
+			IncludeUsage: true,
+		}
+	}
+	return adaptor.ConvertOpenAIRequest(c, info, openAIRequest)
+}
+
+// claudeBridgeWriter 将适配器输出的 OpenAI 格式响应转换为 Claude 格式：
+// 流式响应逐行转换为 Claude 事件，非流式响应缓存后整体转换
+type claudeBridgeWriter struct {
+	*openAIBridgeWriter
+	// convertInfo 独立的转换状态，适配器在处理响应时会修改原 RelayInfo 的计数
+	convertInfo *relaycommon.RelayInfo
+}
+
+func startClaudeBridge(c *gin.Context, info *relaycommon.RelayInfo) *claudeBridgeWriter {
+	writer := &claudeBridgeWriter{
+		openAIBridgeWriter: newOpenAIBridgeWriter(c, info.IsStream),
+		convertInfo: &relaycommon.RelayInfo{
+			PromptTokens: info.PromptTokens,
+			ClaudeConvertInfo: &relaycommon.ClaudeConvertInfo{
+				LastMessagesType: relaycommon.LastMessageTypeNone,
+			},
+		},
+	}
+	// 保活注释转换为 Claude 的 ping 事件
+	writer.onKeepAlive = func() {
+		writer.writeEvent(&dto.ClaudeResponse{Type: "ping"})
+	}
+	writer.onStreamData = writer.handleStreamData
+	return writer
+}
+
+func (w *claudeBridgeWriter) handleStreamData(data string) {
+	var streamResponse dto.ChatCompletionsStreamResponse
+	if err := json.Unmarshal(common.StringToByteSlice(data), &streamResponse); err != nil {
+		common.SysError("error unmarshalling bridged stream response: " + err.Error())
+		return
+	}
+	if service.ValidUsage(streamResponse.Usage) {
+		w.convertInfo.ClaudeConvertInfo.Usage = streamResponse.Usage
+	}
+	w.convertInfo.SendResponseCount++
+	for _, resp := range service.StreamResponseOpenAI2Claude(&streamResponse, w.convertInfo) {
+		w.writeEvent(resp)
+	}
+}
+
+func (w *claudeBridgeWriter) writeEvent(resp *dto.ClaudeResponse) {
+	jsonData, err := json.Marshal(resp)
+	if err != nil {
+		common.SysError("error marshalling claude stream response: " + err.Error())
+		return
+	}
+	_, _ = fmt.Fprintf(w.ResponseWriter, "event: %s\ndata: %s\n\n", resp.Type, jsonData)
+	w.ResponseWriter.Flush()
+}
+
+// finish 恢复原始的 ResponseWriter 并输出剩余的 Claude 响应，usage 为适配器统计的最终用量
+func (w *claudeBridgeWriter) finish(c *gin.Context, usage any, openaiErr *dto.OpenAIErrorWithStatusCode) {
+	w.restore(c)
+	if openaiErr != nil {
+		// 错误由调用方以 Claude 格式返回
+		return
+	}
+	finalUsage, _ := usage.(*dto.Usage)
+	if w.stream {
+		if finalUsage != nil {
+			w.convertInfo.ClaudeConvertInfo.Usage = finalUsage
+		}
+		w.convertInfo.Done = true
+		w.convertInfo.SendResponseCount++
+		for _, resp := range service.StreamResponseOpenAI2Claude(&dto.ChatCompletionsStreamResponse{}, w.convertInfo) {
+			w.writeEvent(resp)
+		}
+		return
+	}
+
+	body := w.buffer.Bytes()
+	contentType := ""
+	var openAIResponse dto.OpenAITextResponse
+	if w.status == http.StatusOK {
+		if err := json.Unmarshal(body, &openAIResponse); err == nil {
+			if finalUsage != nil {
+				openAIResponse.Usage = *finalUsage
+			}
+			if claudeBody, err := json.Marshal(service.ResponseOpenAI2Claude(&openAIResponse, w.convertInfo)); err == nil {
+				body = claudeBody
+				contentType = "application/json"
+			}
+		}
+	}
+	w.writeBody(contentType, body)
+}
@@ -78,6 +78,10 @@ func ClaudeHelper(c *gin.Context) (claudeError *dto.ClaudeErrorWithStatusCode) {
 	if adaptor == nil {
 		return service.ClaudeErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
 	}
+	bridge := !supportsClaudeFormat(relayInfo)
+	if bridge {
+		prepareOpenAIChatBridge(relayInfo)
+	}
 	adaptor.Init(relayInfo)
 	var requestBody io.Reader
 
@@ -107,7 +111,12 @@ func ClaudeHelper(c *gin.Context) (claudeError *dto.ClaudeErrorWithStatusCode) {
 		relayInfo.UpstreamModelName = textRequest.Model
 	}
 
-	convertedRequest, err := adaptor.ConvertClaudeRequest(c, relayInfo, textRequest)
+	var convertedRequest any
+	if bridge {
+		convertedRequest, err = convertClaudeBridgeRequest(c, relayInfo, adaptor, textRequest)
+	} else {
+		convertedRequest, err = adaptor.ConvertClaudeRequest(c, relayInfo, textRequest)
+	}
 	if err != nil {
 		return service.ClaudeErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
 	}
@@ -138,7 +147,14 @@ func ClaudeHelper(c *gin.Context) (claudeError *dto.ClaudeErrorWithStatusCode) {
 		}
 	}
 
+	var bridgeWriter *claudeBridgeWriter
+	if bridge {
+		bridgeWriter = startClaudeBridge(c, relayInfo)
+	}
 	usage, openaiErr := adaptor.DoResponse(c, httpResp, relayInfo)
+	if bridgeWriter != nil {
+		bridgeWriter.finish(c, usage, openaiErr)
+	}
 	//log.Printf("usage: %v", usage)
 	if openaiErr != nil {
 		// reset status code 重置状态码
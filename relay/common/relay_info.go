@@ -31,6 +31,7 @@ type ClaudeConvertInfo struct {
 	Usage            *dto.Usage
 	FinishReason     string
 	Done             bool
+	LastToolCallId   string
 }
 
 const (
@@ -62,6 +63,7 @@ type ResponsesUsageInfo struct {
 type RelayInfo struct {
 	ChannelType       int
 	ChannelId         int
+	ChannelKeyId      int // 多密钥渠道中实际使用的密钥 id，单密钥渠道为 0
 	TokenId           int
 	TokenKey          string
 	UserId            int
@@ -236,6 +238,7 @@ func GenRelayInfo(c *gin.Context) *RelayInfo {
 		RequestURLPath:    c.Request.URL.String(),
 		ChannelType:       channelType,
 		ChannelId:         channelId,
+		ChannelKeyId:      c.GetInt(constant.ContextKeyChannelKeyId),
 		TokenId:           tokenId,
 		TokenKey:          tokenKey,
 		UserId:            userId,
@@ -284,9 +287,15 @@ func GenRelayInfo(c *gin.Context) *RelayInfo {
 	if streamSupportedChannels[info.ChannelType] {
 		info.SupportStreamOptions = true
 	}
+	c.Set(constant.ContextKeyRelayInfo, info)
 	return info
 }
 
+// IsStreamOptionsSupported 渠道是否支持 stream_options
+func IsStreamOptionsSupported(channelType int) bool {
+	return streamSupportedChannels[channelType]
+}
+
 func (info *RelayInfo) SetPromptTokens(promptTokens int) {
 	info.PromptTokens = promptTokens
 }
@@ -51,6 +51,17 @@ const (
 	RelayModeRealtime
 
 	RelayModeGemini
+
+	RelayModeTaskFetchByID // 声明式任务查询
+	RelayModeTaskSubmit    // 声明式任务提交
+
+	RelayModeVideoSubmit
+	RelayModeVideoFetchByID
+	RelayModeVideoList
+	RelayModeVideoContent
+	RelayModeVideoCancel
+
+	RelayModeTaskCancel // 取消异步任务
 )
 
 func Path2RelayMode(path string) int {
@@ -134,6 +145,8 @@ func Path2RelaySuno(method, path string) int {
 		relayMode = RelayModeSunoFetch
 	} else if method == http.MethodGet && strings.Contains(path, "/fetch/") {
 		relayMode = RelayModeSunoFetchByID
+	} else if method == http.MethodPost && strings.Contains(path, "/cancel/") {
+		relayMode = RelayModeTaskCancel
 	} else if strings.Contains(path, "/submit/") {
 		relayMode = RelayModeSunoSubmit
 	}
@@ -146,6 +159,39 @@ func Path2RelayKling(method, path string) int {
 		relayMode = RelayModeKlingSubmit
 	} else if method == http.MethodGet && strings.Contains(path, "/video/generations/") {
 		relayMode = RelayModeKlingFetchByID
+	} else if method == http.MethodPost && strings.HasSuffix(path, "/cancel") {
+		relayMode = RelayModeTaskCancel
+	}
+	return relayMode
+}
+
+func Path2RelayTask(method, path string) int {
+	relayMode := RelayModeUnknown
+	if method == http.MethodPost && strings.HasPrefix(path, "/v1/tasks/submit/") {
+		relayMode = RelayModeTaskSubmit
+	} else if method == http.MethodGet && strings.HasPrefix(path, "/v1/tasks/fetch/") {
+		relayMode = RelayModeTaskFetchByID
+	} else if method == http.MethodPost && strings.HasPrefix(path, "/v1/tasks/cancel/") {
+		relayMode = RelayModeTaskCancel
+	}
+	return relayMode
+}
+
+// Path2RelayVideo 与供应商无关的视频接口 /v1/videos
+func Path2RelayVideo(method, path string) int {
+	relayMode := RelayModeUnknown
+	path = strings.TrimSuffix(strings.TrimPrefix(path, "/v1/videos"), "/")
+	switch {
+	case path == "" && method == http.MethodPost:
+		relayMode = RelayModeVideoSubmit
+	case path == "" && method == http.MethodGet:
+		relayMode = RelayModeVideoList
+	case strings.HasSuffix(path, "/content") && method == http.MethodGet:
+		relayMode = RelayModeVideoContent
+	case strings.HasSuffix(path, "/cancel") && method == http.MethodPost:
+		relayMode = RelayModeVideoCancel
+	case method == http.MethodGet:
+		relayMode = RelayModeVideoFetchByID
 	}
 	return relayMode
 }
@@ -70,6 +70,12 @@ func EmbeddingHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode)
 		}
 	}()
 
+	cacheKey := getResponseCacheKey(c, relayInfo)
+	if usage := tryServeResponseCache(c, relayInfo, cacheKey); usage != nil {
+		postConsumeQuota(c, relayInfo, usage, preConsumedQuota, userQuota, priceData, "")
+		return nil
+	}
+
 	adaptor := GetAdaptor(relayInfo.ApiType)
 	if adaptor == nil {
 		return service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
@@ -103,7 +109,16 @@ func EmbeddingHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode)
 		}
 	}
 
+	var cacheWriter *responseCacheWriter
+	if cacheKey != "" {
+		cacheWriter = startResponseCapture(c)
+	}
 	usage, openaiErr := adaptor.DoResponse(c, httpResp, relayInfo)
+	if cacheWriter != nil {
+		if entry := finishResponseCapture(c, cacheWriter, relayInfo, usage, openaiErr); entry != nil {
+			service.SetResponseCache(cacheKey, entry)
+		}
+	}
 	if openaiErr != nil {
 		// reset status code 重置状态码
 		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
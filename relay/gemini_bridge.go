@@ -0,0 +1,249 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/relay/channel"
+	"one-api/relay/channel/gemini"
+	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
+	"one-api/relay/helper"
+	"one-api/service"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	geminiActionStreamGenerateContent = "streamGenerateContent"
+	geminiActionCountTokens           = "countTokens"
+	geminiActionEmbedContent          = "embedContent"
+)
+
+// getGeminiAction 获取请求路径中的方法名，如 /v1beta/models/gemini-2.0-flash:generateContent 中的 generateContent
+func getGeminiAction(c *gin.Context) string {
+	path := c.Request.URL.Path
+	if i := strings.LastIndex(path, ":"); i != -1 {
+		return path[i+1:]
+	}
+	return ""
+}
+
+// supportsGeminiFormat 适配器是否能直接处理 Gemini 格式的请求与响应，
+// 其余渠道通过 Gemini→OpenAI→Gemini 桥接处理
+func supportsGeminiFormat(info *relaycommon.RelayInfo) bool {
+	switch info.ApiType {
+	case relayconstant.APITypeGemini:
+		return true
+	case relayconstant.APITypeVertexAi:
+		return strings.HasPrefix(info.UpstreamModelName, "gemini")
+	}
+	return false
+}
+
+func convertGeminiBridgeRequest(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, request *gemini.GeminiChatRequest) (any, error) {
+	openAIRequest, err := gemini.GeminiRequest2OpenAI(request, info.UpstreamModelName, info.IsStream)
+	if err != nil {
+		return nil, err
+	}
+	if info.SupportStreamOptions && openAIRequest.Stream {
+		openAIRequest.StreamOptions = &dto.StreamOptions{
+			IncludeUsage: true,
+		}
+	}
+	return adaptor.ConvertOpenAIRequest(c, info, openAIRequest)
+}
+
+// geminiBridgeWriter 将适配器输出的 OpenAI 格式响应转换为 Gemini 格式，流式响应以 alt=sse 的形式输出
+type geminiBridgeWriter struct {
+	*openAIBridgeWriter
+	converter *gemini.OpenAI2GeminiStreamConverter
+}
+
+func startGeminiBridge(c *gin.Context, info *relaycommon.RelayInfo) *geminiBridgeWriter {
+	writer := &geminiBridgeWriter{
+		openAIBridgeWriter: newOpenAIBridgeWriter(c, info.IsStream),
+		converter:          gemini.NewOpenAI2GeminiStreamConverter(),
+	}
+	writer.onStreamData = writer.handleStreamData
+	return writer
+}
+
+func (w *geminiBridgeWriter) handleStreamData(data string) {
+	var streamResponse dto.ChatCompletionsStreamResponse
+	if err := json.Unmarshal(common.StringToByteSlice(data), &streamResponse); err != nil {
+		common.SysError("error unmarshalling bridged stream response: " + err.Error())
+		return
+	}
+	if resp := w.converter.Convert(&streamResponse); resp != nil {
+		w.writeChunk(resp)
+	}
+}
+
+func (w *geminiBridgeWriter) writeChunk(resp *gemini.GeminiChatResponse) {
+	jsonData, err := json.Marshal(resp)
+	if err != nil {
+		common.SysError("error marshalling gemini stream response: " + err.Error())
+		return
+	}
+	_, _ = fmt.Fprintf(w.ResponseWriter, "data: %s\r\n\r\n", jsonData)
+	w.ResponseWriter.Flush()
+}
+
+// finish 恢复原始的 ResponseWriter 并输出剩余的 Gemini 响应，usage 为适配器统计的最终用量
+func (w *geminiBridgeWriter) finish(c *gin.Context, usage any, openaiErr *dto.OpenAIErrorWithStatusCode) {
+	w.restore(c)
+	if openaiErr != nil {
+		return
+	}
+	finalUsage, _ := usage.(*dto.Usage)
+	if w.stream {
+		w.writeChunk(w.converter.Finish(finalUsage))
+		return
+	}
+
+	body := w.buffer.Bytes()
+	contentType := ""
+	var openAIResponse dto.OpenAITextResponse
+	if w.status == http.StatusOK {
+		if err := json.Unmarshal(body, &openAIResponse); err == nil {
+			if finalUsage != nil {
+				openAIResponse.Usage = *finalUsage
+			}
+			if geminiBody, err := json.Marshal(gemini.ResponseOpenAI2Gemini(&openAIResponse)); err == nil {
+				body = geminiBody
+				contentType = "application/json"
+			}
+		}
+	}
+	w.writeBody(contentType, body)
+}
+
+// geminiCountTokens 处理 countTokens 请求，在本地估算输入 token 数，不请求上游也不计费。
+// 请求体可以直接包含 contents，也可以包含完整的 generateContentRequest
+func geminiCountTokens(c *gin.Context, info *relaycommon.RelayInfo) *dto.OpenAIErrorWithStatusCode {
+	var request struct {
+		gemini.GeminiChatRequest
+		GenerateContentRequest *gemini.GeminiChatRequest `json:"generateContentRequest,omitempty"`
+	}
+	if err := common.UnmarshalBodyReusable(c, &request); err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "invalid_gemini_request", http.StatusBadRequest)
+	}
+	countRequest := &request.GeminiChatRequest
+	if request.GenerateContentRequest != nil {
+		countRequest = request.GenerateContentRequest
+	}
+	if err := helper.ModelMappedHelper(c, info, nil); err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "model_mapped_error", http.StatusBadRequest)
+	}
+	totalTokens := getGeminiInputTokens(countRequest, info)
+	if countRequest.SystemInstructions != nil {
+		var systemTexts []string
+		for _, part := range countRequest.SystemInstructions.Parts {
+			if part.Text != "" {
+				systemTexts = append(systemTexts, part.Text)
+			}
+		}
+		if len(systemTexts) > 0 {
+			totalTokens += service.CountTokenInput(strings.Join(systemTexts, "\n"), info.UpstreamModelName)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"totalTokens": totalTokens,
+	})
+	return nil
+}
+
+// geminiEmbedContentHelper 将 embedContent 请求转换为 OpenAI embedding 请求，由非 Gemini 渠道处理
+func geminiEmbedContentHelper(c *gin.Context, relayInfo *relaycommon.RelayInfo) (openaiErr *dto.OpenAIErrorWithStatusCode) {
+	var request gemini.GeminiEmbeddingRequest
+	if err := common.UnmarshalBodyReusable(c, &request); err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "invalid_gemini_request", http.StatusBadRequest)
+	}
+	if err := helper.ModelMappedHelper(c, relayInfo, nil); err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "model_mapped_error", http.StatusBadRequest)
+	}
+	embeddingRequest := gemini.EmbeddingRequestGemini2OpenAI(&request, relayInfo.UpstreamModelName)
+	if embeddingRequest.Input == "" {
+		return service.OpenAIErrorWrapperLocal(fmt.Errorf("content is empty"), "invalid_gemini_request", http.StatusBadRequest)
+	}
+	relayInfo.RelayFormat = relaycommon.RelayFormatEmbedding
+	relayInfo.RelayMode = relayconstant.RelayModeEmbeddings
+	relayInfo.RequestURLPath = "/v1/embeddings"
+	relayInfo.IsStream = false
+
+	promptToken := getEmbeddingPromptToken(*embeddingRequest)
+	relayInfo.PromptTokens = promptToken
+
+	priceData, err := helper.ModelPriceHelper(c, relayInfo, promptToken, 0)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "model_price_error", http.StatusInternalServerError)
+	}
+	preConsumedQuota, userQuota, openaiErr := preConsumeQuota(c, priceData.ShouldPreConsumedQuota, relayInfo)
+	if openaiErr != nil {
+		return openaiErr
+	}
+	defer func() {
+		if openaiErr != nil {
+			returnPreConsumedQuota(c, relayInfo, userQuota, preConsumedQuota)
+		}
+	}()
+
+	adaptor := GetAdaptor(relayInfo.ApiType)
+	if adaptor == nil {
+		return service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptor.Init(relayInfo)
+
+	convertedRequest, err := adaptor.ConvertEmbeddingRequest(c, relayInfo, *embeddingRequest)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
+	}
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
+	}
+	statusCodeMappingStr := c.GetString("status_code_mapping")
+	resp, err := adaptor.DoRequest(c, relayInfo, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+
+	var httpResp *http.Response
+	if resp != nil {
+		httpResp = resp.(*http.Response)
+		if httpResp.StatusCode != http.StatusOK {
+			openaiErr = service.RelayErrorHandler(httpResp, false)
+			// reset status code 重置状态码
+			service.ResetStatusCode(openaiErr, statusCodeMappingStr)
+			return openaiErr
+		}
+	}
+
+	writer := newOpenAIBridgeWriter(c, false)
+	usage, openaiErr := adaptor.DoResponse(c, httpResp, relayInfo)
+	writer.restore(c)
+	if openaiErr != nil {
+		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
+		return openaiErr
+	}
+	body := writer.buffer.Bytes()
+	contentType := ""
+	var embeddingResponse dto.OpenAIEmbeddingResponse
+	if writer.status == http.StatusOK {
+		if err = json.Unmarshal(body, &embeddingResponse); err == nil {
+			if geminiBody, err := json.Marshal(gemini.EmbeddingResponseOpenAI2Gemini(&embeddingResponse)); err == nil {
+				body = geminiBody
+				contentType = "application/json"
+			}
+		}
+	}
+	writer.writeBody(contentType, body)
+
+	postConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "")
+	return nil
+}
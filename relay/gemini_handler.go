@@ -77,14 +77,22 @@ func getGeminiInputTokens(req *gemini.GeminiChatRequest, info *relaycommon.Relay
 }
 
 func GeminiHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
+	relayInfo := relaycommon.GenRelayInfoGemini(c)
+
+	action := getGeminiAction(c)
+	switch {
+	case action == geminiActionCountTokens:
+		return geminiCountTokens(c, relayInfo)
+	case action == geminiActionEmbedContent && !supportsGeminiFormat(relayInfo):
+		return geminiEmbedContentHelper(c, relayInfo)
+	}
+
 	req, err := getAndValidateGeminiRequest(c)
 	if err != nil {
 		common.LogError(c, fmt.Sprintf("getAndValidateGeminiRequest error: %s", err.Error()))
 		return service.OpenAIErrorWrapperLocal(err, "invalid_gemini_request", http.StatusBadRequest)
 	}
 
-	relayInfo := relaycommon.GenRelayInfoGemini(c)
-
 	// 检查 Gemini 流式模式
 	checkGeminiStreamMode(c, relayInfo)
 
@@ -134,6 +142,12 @@ func GeminiHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 		return service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
 	}
 
+	bridge := !supportsGeminiFormat(relayInfo)
+	if bridge {
+		// 桥接时以请求的方法名区分流式，统一以 alt=sse 的形式输出
+		relayInfo.IsStream = relayInfo.IsStream || action == geminiActionStreamGenerateContent
+		prepareOpenAIChatBridge(relayInfo)
+	}
 	adaptor.Init(relayInfo)
 
 	// Clean up empty system instruction
@@ -150,7 +164,14 @@ func GeminiHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 		}
 	}
 
-	requestBody, err := json.Marshal(req)
+	var convertedRequest any = req
+	if bridge {
+		convertedRequest, err = convertGeminiBridgeRequest(c, relayInfo, adaptor, req)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
+		}
+	}
+	requestBody, err := json.Marshal(convertedRequest)
 	if err != nil {
 		return service.OpenAIErrorWrapperLocal(err, "marshal_text_request_failed", http.StatusInternalServerError)
 	}
@@ -179,7 +200,14 @@ func GeminiHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 		}
 	}
 
+	var bridgeWriter *geminiBridgeWriter
+	if bridge {
+		bridgeWriter = startGeminiBridge(c, relayInfo)
+	}
 	usage, openaiErr := adaptor.DoResponse(c, resp.(*http.Response), relayInfo)
+	if bridgeWriter != nil {
+		bridgeWriter.finish(c, usage, openaiErr)
+	}
 	if openaiErr != nil {
 		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
 		return openaiErr
@@ -0,0 +1,263 @@
+package relay
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/middleware"
+	"one-api/model"
+	"one-api/relay/channel"
+	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
+	"one-api/relay/helper"
+	"one-api/setting/operation_setting"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type hedgeResult struct {
+	resp  *http.Response
+	err   error
+	hedge bool
+}
+
+func (r hedgeResult) ok() bool {
+	return r.err == nil && r.resp != nil && r.resp.StatusCode == http.StatusOK
+}
+
+// response 转换为 any 时避免产生非 nil 的空指针
+func (r hedgeResult) response() any {
+	if r.resp == nil {
+		return nil
+	}
+	return r.resp
+}
+
+func (r hedgeResult) close() {
+	if r.resp != nil && r.resp.Body != nil {
+		_ = r.resp.Body.Close()
+	}
+}
+
+// hedgeAttempt 对冲请求使用独立的 gin.Context，胜出后再将其上下文合并回原请求
+type hedgeAttempt struct {
+	c           *gin.Context
+	info        *relaycommon.RelayInfo
+	adaptor     channel.Adaptor
+	requestBody io.Reader
+	channelId   int
+	cancel      context.CancelFunc
+}
+
+type peekedBody struct {
+	*bufio.Reader
+	io.Closer
+}
+
+func shouldHedgeRequest(c *gin.Context, info *relaycommon.RelayInfo) bool {
+	if !info.IsStream || info.RelayMode != relayconstant.RelayModeChatCompletions {
+		return false
+	}
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return false
+	}
+	return operation_setting.IsHedgeEnabledForModel(info.OriginModelName)
+}
+
+// waitFirstByte 等待上游返回首字节，用于判断哪一方先开始响应
+func waitFirstByte(resp *http.Response, err error, hedge bool) hedgeResult {
+	result := hedgeResult{resp: resp, err: err, hedge: hedge}
+	if !result.ok() {
+		return result
+	}
+	reader := bufio.NewReader(resp.Body)
+	if _, err = reader.Peek(1); err != nil && err != io.EOF {
+		result.close()
+		return hedgeResult{err: err, hedge: hedge}
+	}
+	resp.Body = peekedBody{Reader: reader, Closer: resp.Body}
+	return result
+}
+
+func newHedgeContext(c *gin.Context) *gin.Context {
+	hc, _ := gin.CreateTestContext(httptest.NewRecorder())
+	hc.Keys = c.Copy().Keys
+	hc.Request = c.Request.Clone(c.Request.Context())
+	return hc
+}
+
+// prepareHedgeAttempt 为对冲请求选择另一个渠道（多密钥渠道可以是同一渠道的其他密钥）并构造请求
+func prepareHedgeAttempt(c *gin.Context, info *relaycommon.RelayInfo) *hedgeAttempt {
+	hc := newHedgeContext(c)
+	var selected *model.Channel
+	for i := 0; i < 3; i++ {
+		candidate, _, err := model.CacheGetRandomSatisfiedChannel(hc, c.GetString("group"), info.OriginModelName, 0)
+		if err != nil {
+			return nil
+		}
+		if candidate.Id != info.ChannelId || candidate.IsMultiKey() {
+			selected = candidate
+			break
+		}
+	}
+	if selected == nil {
+		return nil
+	}
+	if err := middleware.SetupContextForSelectedChannel(hc, selected, info.OriginModelName); err != nil {
+		return nil
+	}
+	hedgeInfo := relaycommon.GenRelayInfo(hc)
+	textRequest, err := getAndValidateTextRequest(hc, hedgeInfo)
+	if err != nil {
+		return nil
+	}
+	if err = helper.ModelMappedHelper(hc, hedgeInfo, textRequest); err != nil {
+		return nil
+	}
+	hedgeInfo.SetPromptTokens(info.PromptTokens)
+	hedgeInfo.UserQuota = info.UserQuota
+	adaptor, requestBody, openaiErr := buildTextRequest(hc, hedgeInfo, textRequest)
+	if openaiErr != nil {
+		return nil
+	}
+	return &hedgeAttempt{
+		c:           hc,
+		info:        hedgeInfo,
+		adaptor:     adaptor,
+		requestBody: requestBody,
+		channelId:   selected.Id,
+	}
+}
+
+// doRequestWithHedge 发送主请求，若超过对冲延迟仍未收到首字节，则向另一渠道发送相同请求，
+// 返回先收到首字节一方的 RelayInfo、适配器与响应，落败的一方会被取消；返回的 cleanup 需在响应处理完毕后调用
+func doRequestWithHedge(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, requestBody io.Reader) (*relaycommon.RelayInfo, channel.Adaptor, any, func(), error) {
+	delay := time.Duration(operation_setting.GetHedgeSetting().DelayMilliseconds) * time.Millisecond
+	results := make(chan hedgeResult, 2)
+
+	primaryCtx, cancelPrimaryCtx := context.WithCancel(context.Background())
+	c.Set(constant.ContextKeyUpstreamContext, primaryCtx)
+	// 清理时移除上下文，避免取消后的 context 影响后续重试
+	cancelPrimary := func() {
+		cancelPrimaryCtx()
+		c.Set(constant.ContextKeyUpstreamContext, nil)
+	}
+	go func() {
+		resp, err := adaptor.DoRequest(c, info, requestBody)
+		httpResp, _ := resp.(*http.Response)
+		results <- waitFirstByte(httpResp, err, false)
+	}()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var hedge *hedgeAttempt
+	cancelHedge := func() {
+		if hedge != nil && hedge.cancel != nil {
+			hedge.cancel()
+		}
+	}
+	pending := 1
+	var primaryFailure *hedgeResult
+	var lastFailure hedgeResult
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			hedge = prepareHedgeAttempt(c, info)
+			if hedge == nil {
+				common.LogWarn(c, "hedge request skipped: no other channel available")
+				continue
+			}
+			var hedgeCtx context.Context
+			hedgeCtx, hedge.cancel = context.WithCancel(context.Background())
+			hedge.c.Set(constant.ContextKeyUpstreamContext, hedgeCtx)
+			pending++
+			common.LogInfo(c, fmt.Sprintf("no first byte from channel #%d after %dms, hedging to channel #%d", info.ChannelId, delay.Milliseconds(), hedge.channelId))
+			go func(attempt *hedgeAttempt) {
+				resp, err := attempt.adaptor.DoRequest(attempt.c, attempt.info, attempt.requestBody)
+				httpResp, _ := resp.(*http.Response)
+				results <- waitFirstByte(httpResp, err, true)
+			}(hedge)
+		case r := <-results:
+			pending--
+			if !r.hedge && (r.ok() || hedge == nil) {
+				// 主请求胜出，或在对冲触发前已返回（包括出错，交给正常的错误处理与重试）
+				cancelHedge()
+				lastFailure.close()
+				drainHedgeResults(results, pending)
+				if hedge != nil {
+					c.Set(constant.ContextKeyHedgeInfo, map[string]interface{}{
+						"winner":          "primary",
+						"primary_channel": info.ChannelId,
+						"hedge_channel":   hedge.channelId,
+					})
+				}
+				return info, adaptor, r.response(), cancelPrimary, r.err
+			}
+			if r.hedge && r.ok() {
+				// 对冲请求胜出，取消主请求并等待其退出，避免主请求的保活 ping 与对冲响应同时写入客户端
+				cancelPrimary()
+				if pending > 0 {
+					select {
+					case loser := <-results:
+						loser.close()
+					case <-time.After(time.Second):
+						drainHedgeResults(results, pending)
+					}
+				}
+				if primaryFailure != nil {
+					primaryFailure.close()
+				}
+				for key, value := range hedge.c.Keys {
+					c.Set(key, value)
+				}
+				useChannel := c.GetStringSlice("use_channel")
+				c.Set("use_channel", append(useChannel, fmt.Sprintf("%d", hedge.channelId)))
+				c.Set(constant.ContextKeyHedgeInfo, map[string]interface{}{
+					"winner":          "hedge",
+					"primary_channel": info.ChannelId,
+					"hedge_channel":   hedge.channelId,
+				})
+				helper.SetEventStreamHeaders(c)
+				cleanup := func() {
+					cancelHedge()
+					c.Set(constant.ContextKeyUpstreamContext, nil)
+				}
+				return hedge.info, hedge.adaptor, r.response(), cleanup, nil
+			}
+			if !r.hedge {
+				common.LogWarn(c, fmt.Sprintf("primary request on channel #%d failed while hedging", info.ChannelId))
+				failure := r
+				primaryFailure = &failure
+			} else {
+				common.LogWarn(c, fmt.Sprintf("hedge request on channel #%d failed", hedge.channelId))
+				lastFailure = r
+			}
+		}
+	}
+	// 双方均失败，优先返回主请求的错误
+	if primaryFailure != nil {
+		lastFailure.close()
+		return info, adaptor, primaryFailure.response(), cancelPrimary, primaryFailure.err
+	}
+	return info, adaptor, lastFailure.response(), cancelPrimary, lastFailure.err
+}
+
+// drainHedgeResults 异步回收落败请求的结果并关闭响应体
+func drainHedgeResults(results chan hedgeResult, pending int) {
+	if pending <= 0 {
+		return
+	}
+	go func() {
+		for i := 0; i < pending; i++ {
+			r := <-results
+			r.close()
+		}
+	}()
+}
@@ -15,6 +15,7 @@ import (
 	"one-api/relay/helper"
 	"one-api/service"
 	"one-api/setting"
+	"strconv"
 	"strings"
 
 	"one-api/relay/constant"
@@ -221,6 +222,19 @@ func ImageHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 		}
 	}
 
+	if httpResp != nil && !relayInfo.IsStream && service.IsMediaStoreEnabled() {
+		// 上游图片地址通常数小时后失效，持久化后改写为网关签名链接
+		responseBody, err := io.ReadAll(httpResp.Body)
+		httpResp.Body.Close()
+		if err != nil {
+			return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+		}
+		responseBody = service.PersistImageResponse(c, relayInfo.UserId, responseBody)
+		httpResp.Body = io.NopCloser(bytes.NewReader(responseBody))
+		httpResp.ContentLength = int64(len(responseBody))
+		httpResp.Header.Set("Content-Length", strconv.Itoa(len(responseBody)))
+	}
+
 	usage, openaiErr := adaptor.DoResponse(c, httpResp, relayInfo)
 	if openaiErr != nil {
 		// reset status code 重置状态码
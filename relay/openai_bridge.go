@@ -0,0 +1,113 @@
+package relay
+
+import (
+	"bytes"
+	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// prepareOpenAIChatBridge 桥接期间按 OpenAI 对话补全处理请求与响应，需在适配器 Init 之前调用
+func prepareOpenAIChatBridge(info *relaycommon.RelayInfo) {
+	info.RelayFormat = relaycommon.RelayFormatOpenAI
+	info.RelayMode = relayconstant.RelayModeChatCompletions
+	info.RequestURLPath = "/v1/chat/completions"
+	// 要求适配器输出用量，用于生成最终的用量信息
+	info.ShouldIncludeUsage = true
+}
+
+// openAIBridgeWriter 截获适配器输出的 OpenAI 格式响应，交由各入站格式的桥接转换：
+// 流式响应按 SSE 行回调 onStreamData / onKeepAlive，非流式响应缓存到 buffer 中由调用方整体转换
+type openAIBridgeWriter struct {
+	gin.ResponseWriter
+	stream       bool
+	status       int
+	buffer       bytes.Buffer
+	onStreamData func(data string)
+	onKeepAlive  func()
+}
+
+func newOpenAIBridgeWriter(c *gin.Context, stream bool) *openAIBridgeWriter {
+	writer := &openAIBridgeWriter{
+		ResponseWriter: c.Writer,
+		stream:         stream,
+		status:         200,
+	}
+	c.Writer = writer
+	return writer
+}
+
+func (w *openAIBridgeWriter) WriteHeader(code int) {
+	if w.stream {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+func (w *openAIBridgeWriter) WriteHeaderNow() {
+	if w.stream {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *openAIBridgeWriter) Write(data []byte) (int, error) {
+	w.buffer.Write(data)
+	if w.stream {
+		for {
+			line, err := w.buffer.ReadString('\n')
+			if err != nil {
+				// 不完整的行留待下次写入
+				w.buffer.Reset()
+				w.buffer.WriteString(line)
+				break
+			}
+			w.handleStreamLine(strings.TrimRight(line, "\r\n"))
+		}
+	}
+	return len(data), nil
+}
+
+func (w *openAIBridgeWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *openAIBridgeWriter) handleStreamLine(line string) {
+	if strings.HasPrefix(line, ":") {
+		if w.onKeepAlive != nil {
+			w.onKeepAlive()
+		}
+		return
+	}
+	if !strings.HasPrefix(line, "data:") {
+		return
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+	if data == "" || data == "[DONE]" {
+		return
+	}
+	if w.onStreamData != nil {
+		w.onStreamData(data)
+	}
+}
+
+// restore 恢复原始的 ResponseWriter，流式响应中未以换行结尾的剩余数据按一行处理
+func (w *openAIBridgeWriter) restore(c *gin.Context) {
+	c.Writer = w.ResponseWriter
+	if w.stream && w.buffer.Len() > 0 {
+		w.handleStreamLine(strings.TrimRight(w.buffer.String(), "\r\n"))
+		w.buffer.Reset()
+	}
+}
+
+// writeBody 输出转换后的非流式响应
+func (w *openAIBridgeWriter) writeBody(contentType string, body []byte) {
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+	_, _ = w.ResponseWriter.Write(body)
+}
@@ -0,0 +1,793 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/middleware"
+	"one-api/model"
+	"one-api/relay/channel"
+	relaycommon "one-api/relay/common"
+	"one-api/relay/helper"
+	"one-api/service"
+	"one-api/setting/operation_setting"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// 桥接模式仅支持 24kHz 单声道 16 位 PCM 音频，与 OpenAI realtime 默认格式一致
+	realtimeBridgeAudioFormat     = "pcm16"
+	realtimeBridgeSampleRate      = 24000
+	realtimeBridgeAudioChunkBytes = 32 * 1024
+)
+
+// supportsRealtimeFormat 渠道是否原生支持 OpenAI realtime WebSocket
+func supportsRealtimeFormat(info *relaycommon.RelayInfo) bool {
+	switch info.ChannelType {
+	case common.ChannelTypeOpenAI, common.ChannelTypeAzure:
+		return true
+	}
+	return false
+}
+
+// realtimeBridgeSession 网关桥接的 realtime 会话。对话环节沿用会话所选渠道，
+// 语音识别与语音合成环节按配置的模型另外选择渠道
+type realtimeBridgeSession struct {
+	c             *gin.Context
+	info          *relaycommon.RelayInfo
+	ws            *websocket.Conn
+	session       dto.RealtimeSession
+	turnDetection bool
+	audioBuffer   bytes.Buffer
+	messages      []dto.Message
+	lastItemId    string
+	// fatalErr 计费失败等需要结束会话的错误
+	fatalErr error
+}
+
+// realtimeBridgeHelper 由网关处理 realtime 会话：缓存 input_audio_buffer 中的音频，
+// 依次调用语音识别、对话补全与语音合成，输出标准的 realtime 服务端事件
+func realtimeBridgeHelper(c *gin.Context, info *relaycommon.RelayInfo) *dto.OpenAIErrorWithStatusCode {
+	userQuota, err := model.GetUserQuota(info.UserId, false)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "get_user_quota_failed", http.StatusInternalServerError)
+	}
+	if userQuota <= 0 {
+		return service.OpenAIErrorWrapperLocal(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+	}
+
+	bridgeSetting := operation_setting.GetRealtimeBridgeSetting()
+	s := &realtimeBridgeSession{
+		c:    c,
+		info: info,
+		ws:   info.ClientWs,
+		session: dto.RealtimeSession{
+			Id:                "sess_" + common.GetRandomString(24),
+			Model:             info.OriginModelName,
+			Modalities:        []string{"text", "audio"},
+			Voice:             bridgeSetting.DefaultVoice,
+			InputAudioFormat:  realtimeBridgeAudioFormat,
+			OutputAudioFormat: realtimeBridgeAudioFormat,
+			InputAudioTranscription: dto.InputAudioTranscription{
+				Model: bridgeSetting.TranscriptionModel,
+			},
+			ToolChoice: "auto",
+		},
+	}
+	common.LogInfo(c, fmt.Sprintf("realtime bridge session started, model %s, channel %d", info.OriginModelName, info.ChannelId))
+	s.send(&dto.RealtimeEvent{Type: dto.RealtimeEventTypeSessionCreated, Session: &s.session})
+
+	for {
+		_, message, err := s.ws.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				common.LogError(c, "realtime bridge read error: "+err.Error())
+			}
+			return nil
+		}
+		s.handleEvent(message)
+		if s.fatalErr != nil {
+			common.LogError(c, "realtime bridge session closed: "+s.fatalErr.Error())
+			s.sendError("session_terminated", s.fatalErr.Error())
+			return nil
+		}
+	}
+}
+
+func (s *realtimeBridgeSession) send(event *dto.RealtimeEvent) {
+	event.EventId = "event_" + common.GetRandomString(24)
+	if err := helper.WssObject(s.c, s.ws, event); err != nil {
+		common.LogError(s.c, "realtime bridge write error: "+err.Error())
+	}
+}
+
+func (s *realtimeBridgeSession) sendError(code string, message string) {
+	s.send(&dto.RealtimeEvent{
+		Type: dto.RealtimeEventTypeError,
+		Error: &dto.OpenAIError{
+			Type:    "invalid_request_error",
+			Code:    code,
+			Message: message,
+		},
+	})
+}
+
+// appendItem 记录新加入对话的条目，返回前一个条目的 id，对话为空时返回 nil
+func (s *realtimeBridgeSession) appendItem(id string) *string {
+	var previousItemId *string
+	if s.lastItemId != "" {
+		previousItemId = common.GetPointer(s.lastItemId)
+	}
+	s.lastItemId = id
+	return previousItemId
+}
+
+func (s *realtimeBridgeSession) handleEvent(message []byte) {
+	var event dto.RealtimeEvent
+	if err := json.Unmarshal(message, &event); err != nil {
+		s.sendError("invalid_json", "invalid event: "+err.Error())
+		return
+	}
+	switch event.Type {
+	case dto.RealtimeEventTypeSessionUpdate:
+		s.updateSession(message, event.Session)
+	case dto.RealtimeEventInputAudioBufferAppend:
+		audio, err := base64.StdEncoding.DecodeString(event.Audio)
+		if err != nil {
+			s.sendError("invalid_audio", "invalid base64 audio: "+err.Error())
+			return
+		}
+		maxBytes := operation_setting.GetRealtimeBridgeSetting().MaxInputAudioSeconds * realtimeBridgeSampleRate * 2
+		if maxBytes > 0 && s.audioBuffer.Len()+len(audio) > maxBytes {
+			s.sendError("input_audio_buffer_full", "input audio buffer exceeds the maximum duration")
+			return
+		}
+		s.audioBuffer.Write(audio)
+	case dto.RealtimeEventInputAudioBufferClear:
+		s.audioBuffer.Reset()
+		s.send(&dto.RealtimeEvent{Type: dto.RealtimeEventInputAudioBufferCleared})
+	case dto.RealtimeEventInputAudioBufferCommit:
+		if s.commitAudio() && s.turnDetection {
+			s.createResponse(nil)
+		}
+	case dto.RealtimeEventTypeConversationCreate:
+		s.createItem(event.Item)
+	case dto.RealtimeEventTypeResponseCreate:
+		s.createResponse(event.Response)
+	case dto.RealtimeEventTypeResponseCancel:
+		// 响应在收到下一个事件前已经同步生成完毕，没有可以取消的响应
+	default:
+		s.sendError("unsupported_event", fmt.Sprintf("event type %s is not supported in bridge mode", event.Type))
+	}
+}
+
+// updateSession 合并客户端设置的会话参数，未设置的字段保持不变
+func (s *realtimeBridgeSession) updateSession(message []byte, session *dto.RealtimeSession) {
+	if session == nil {
+		s.sendError("invalid_session", "session is required")
+		return
+	}
+	if len(session.Modalities) > 0 {
+		s.session.Modalities = session.Modalities
+	}
+	if session.Instructions != "" {
+		s.session.Instructions = session.Instructions
+	}
+	if session.Voice != "" {
+		s.session.Voice = session.Voice
+	}
+	for _, format := range []string{session.InputAudioFormat, session.OutputAudioFormat} {
+		if format != "" && format != realtimeBridgeAudioFormat {
+			s.sendError("unsupported_audio_format", fmt.Sprintf("audio format %s is not supported in bridge mode, only %s is supported", format, realtimeBridgeAudioFormat))
+		}
+	}
+	if session.InputAudioTranscription.Model != "" {
+		s.session.InputAudioTranscription.Model = session.InputAudioTranscription.Model
+	}
+	if session.Tools != nil {
+		s.session.Tools = session.Tools
+	}
+	if session.ToolChoice != "" {
+		s.session.ToolChoice = session.ToolChoice
+	}
+	if session.Temperature > 0 {
+		s.session.Temperature = session.Temperature
+	}
+	// turn_detection 为 null 表示关闭，需要区分未设置与显式设置为 null。
+	// 网关不做语音活动检测，开启后在客户端提交音频时自动创建响应
+	var raw struct {
+		Session map[string]json.RawMessage `json:"session"`
+	}
+	if err := json.Unmarshal(message, &raw); err == nil {
+		if turnDetection, ok := raw.Session["turn_detection"]; ok {
+			s.turnDetection = string(turnDetection) != "null"
+			s.session.TurnDetection = session.TurnDetection
+		}
+	}
+	s.send(&dto.RealtimeEvent{Type: dto.RealtimeEventTypeSessionUpdated, Session: &s.session})
+}
+
+// commitAudio 提交缓存的音频并转写为用户消息，转写成功返回 true
+func (s *realtimeBridgeSession) commitAudio() bool {
+	if s.audioBuffer.Len() == 0 {
+		s.sendError("input_audio_buffer_commit_empty", "input audio buffer is empty")
+		return false
+	}
+	pcm := append([]byte(nil), s.audioBuffer.Bytes()...)
+	s.audioBuffer.Reset()
+
+	item := &dto.RealtimeItem{
+		Id:      "item_" + common.GetRandomString(24),
+		Type:    "message",
+		Status:  "completed",
+		Role:    "user",
+		Content: []dto.RealtimeContent{{Type: "input_audio"}},
+	}
+	previousItemId := s.appendItem(item.Id)
+	s.send(&dto.RealtimeEvent{Type: dto.RealtimeEventInputAudioBufferCommitted, PreviousItemId: previousItemId, ItemId: item.Id})
+	s.send(&dto.RealtimeEvent{Type: dto.RealtimeEventConversationItemCreated, PreviousItemId: previousItemId, Item: item})
+
+	contentIndex := 0
+	transcript, err := s.transcribe(pcm)
+	if err != nil {
+		common.LogError(s.c, "realtime bridge transcription failed: "+err.Error())
+		s.send(&dto.RealtimeEvent{
+			Type:         dto.RealtimeEventInputAudioTranscriptionFailed,
+			ItemId:       item.Id,
+			ContentIndex: &contentIndex,
+			Error:        &dto.OpenAIError{Type: "transcription_error", Message: err.Error()},
+		})
+		return false
+	}
+	s.send(&dto.RealtimeEvent{
+		Type:         dto.RealtimeEventInputAudioTranscriptionCompleted,
+		ItemId:       item.Id,
+		ContentIndex: &contentIndex,
+		Transcript:   transcript,
+	})
+	message := dto.Message{Role: "user"}
+	message.SetStringContent(transcript)
+	s.messages = append(s.messages, message)
+	return true
+}
+
+// createItem 处理 conversation.item.create，支持文本消息、函数调用与函数调用结果
+func (s *realtimeBridgeSession) createItem(item *dto.RealtimeItem) {
+	if item == nil {
+		s.sendError("invalid_item", "item is required")
+		return
+	}
+	if item.Id == "" {
+		item.Id = "item_" + common.GetRandomString(24)
+	}
+	item.Status = "completed"
+	message := dto.Message{Role: item.Role}
+	switch item.Type {
+	case "message", "":
+		item.Type = "message"
+		var texts []string
+		for i, content := range item.Content {
+			switch content.Type {
+			case "input_text", "text":
+				texts = append(texts, content.Text)
+			case "input_audio":
+				pcm, err := base64.StdEncoding.DecodeString(content.Audio)
+				if err != nil {
+					s.sendError("invalid_audio", "invalid base64 audio: "+err.Error())
+					return
+				}
+				transcript, err := s.transcribe(pcm)
+				if err != nil {
+					s.sendError("transcription_failed", err.Error())
+					return
+				}
+				item.Content[i].Audio = ""
+				item.Content[i].Transcript = transcript
+				texts = append(texts, transcript)
+			}
+		}
+		if message.Role == "" {
+			message.Role = "user"
+		}
+		message.SetStringContent(joinNonEmpty(texts, "\n"))
+	case "function_call":
+		name := ""
+		if item.Name != nil {
+			name = *item.Name
+		}
+		message.Role = "assistant"
+		message.SetStringContent("")
+		message.SetToolCalls([]dto.ToolCallRequest{{
+			ID:   item.CallId,
+			Type: "function",
+			Function: dto.FunctionRequest{
+				Name:      name,
+				Arguments: item.Arguments,
+			},
+		}})
+	case "function_call_output":
+		message.Role = "tool"
+		message.ToolCallId = item.CallId
+		message.SetStringContent(item.Output)
+	default:
+		s.sendError("invalid_item", fmt.Sprintf("item type %s is not supported", item.Type))
+		return
+	}
+	s.messages = append(s.messages, message)
+	s.send(&dto.RealtimeEvent{Type: dto.RealtimeEventConversationItemCreated, PreviousItemId: s.appendItem(item.Id), Item: item})
+}
+
+// createResponse 根据当前对话生成一轮回复，回复包含函数调用时不合成语音
+func (s *realtimeBridgeSession) createResponse(options *dto.RealtimeResponse) {
+	modalities := s.session.Modalities
+	instructions := s.session.Instructions
+	if options != nil {
+		if len(options.Modalities) > 0 {
+			modalities = options.Modalities
+		}
+		if options.Instructions != "" {
+			instructions = options.Instructions
+		}
+	}
+	response := &dto.RealtimeResponse{
+		Id:     "resp_" + common.GetRandomString(24),
+		Object: "realtime.response",
+		Status: "in_progress",
+		Usage:  &dto.RealtimeUsage{},
+	}
+	s.send(&dto.RealtimeEvent{Type: dto.RealtimeEventTypeResponseCreated, Response: response})
+
+	message, err := s.chat(instructions, response.Usage)
+	if err != nil {
+		common.LogError(s.c, "realtime bridge chat failed: "+err.Error())
+		if s.fatalErr == nil {
+			s.sendError("response_failed", err.Error())
+		}
+		response.Status = "failed"
+		s.send(&dto.RealtimeEvent{Type: dto.RealtimeEventTypeResponseDone, Response: response})
+		return
+	}
+
+	if toolCalls := message.ParseToolCalls(); len(toolCalls) > 0 {
+		for _, toolCall := range toolCalls {
+			name := toolCall.Function.Name
+			item := &dto.RealtimeItem{
+				Id:        "item_" + common.GetRandomString(24),
+				Type:      "function_call",
+				Status:    "completed",
+				Name:      &name,
+				CallId:    toolCall.ID,
+				Arguments: toolCall.Function.Arguments,
+			}
+			outputIndex := len(response.Output)
+			response.Output = append(response.Output, item)
+			s.appendItem(item.Id)
+			s.send(&dto.RealtimeEvent{Type: dto.RealtimeEventResponseOutputItemAdded, ResponseId: response.Id, OutputIndex: &outputIndex, Item: item})
+			s.send(&dto.RealtimeEvent{
+				Type:        dto.RealtimeEventResponseFunctionCallArgumentsDone,
+				ResponseId:  response.Id,
+				ItemId:      item.Id,
+				OutputIndex: &outputIndex,
+				CallId:      item.CallId,
+				Name:        name,
+				Arguments:   item.Arguments,
+			})
+			s.send(&dto.RealtimeEvent{Type: dto.RealtimeEventResponseOutputItemDone, ResponseId: response.Id, OutputIndex: &outputIndex, Item: item})
+		}
+		history := dto.Message{Role: "assistant", Content: message.Content}
+		history.SetToolCalls(toolCalls)
+		s.messages = append(s.messages, history)
+	} else {
+		text := message.StringContent()
+		item := &dto.RealtimeItem{
+			Id:      "item_" + common.GetRandomString(24),
+			Type:    "message",
+			Status:  "in_progress",
+			Role:    "assistant",
+			Content: []dto.RealtimeContent{},
+		}
+		outputIndex, contentIndex := 0, 0
+		previousItemId := s.appendItem(item.Id)
+		s.send(&dto.RealtimeEvent{Type: dto.RealtimeEventResponseOutputItemAdded, ResponseId: response.Id, OutputIndex: &outputIndex, Item: item})
+		s.send(&dto.RealtimeEvent{Type: dto.RealtimeEventConversationItemCreated, PreviousItemId: previousItemId, Item: item})
+		textEvent := func(eventType string) *dto.RealtimeEvent {
+			return &dto.RealtimeEvent{Type: eventType, ResponseId: response.Id, ItemId: item.Id, OutputIndex: &outputIndex, ContentIndex: &contentIndex}
+		}
+
+		if common.StringsContains(modalities, "audio") {
+			event := textEvent(dto.RealtimeEventResponseAudioTranscriptionDelta)
+			event.Delta = text
+			s.send(event)
+			if text != "" {
+				audio, err := s.speech(text, response.Usage)
+				if err != nil {
+					common.LogError(s.c, "realtime bridge speech failed: "+err.Error())
+					if s.fatalErr == nil {
+						s.sendError("speech_failed", err.Error())
+					}
+				}
+				for i := 0; i < len(audio); i += realtimeBridgeAudioChunkBytes {
+					event = textEvent(dto.RealtimeEventResponseAudioDelta)
+					event.Delta = base64.StdEncoding.EncodeToString(audio[i:min(i+realtimeBridgeAudioChunkBytes, len(audio))])
+					s.send(event)
+				}
+			}
+			s.send(textEvent(dto.RealtimeEventResponseAudioDone))
+			event = textEvent(dto.RealtimeEventResponseAudioTranscriptionDone)
+			event.Transcript = text
+			s.send(event)
+			item.Content = []dto.RealtimeContent{{Type: "audio", Transcript: text}}
+		} else {
+			event := textEvent(dto.RealtimeEventResponseTextDelta)
+			event.Delta = text
+			s.send(event)
+			event = textEvent(dto.RealtimeEventResponseTextDone)
+			event.Text = text
+			s.send(event)
+			item.Content = []dto.RealtimeContent{{Type: "text", Text: text}}
+		}
+		item.Status = "completed"
+		response.Output = append(response.Output, item)
+		s.send(&dto.RealtimeEvent{Type: dto.RealtimeEventResponseOutputItemDone, ResponseId: response.Id, OutputIndex: &outputIndex, Item: item})
+		history := dto.Message{Role: "assistant"}
+		history.SetStringContent(text)
+		s.messages = append(s.messages, history)
+	}
+	response.Status = "completed"
+	s.send(&dto.RealtimeEvent{Type: dto.RealtimeEventTypeResponseDone, Response: response})
+}
+
+// transcribe 语音识别环节，音频以 WAV 文件提交给语音识别渠道
+func (s *realtimeBridgeSession) transcribe(pcm []byte) (string, error) {
+	modelName := s.session.InputAudioTranscription.Model
+	if modelName == "" {
+		modelName = operation_setting.GetRealtimeBridgeSetting().TranscriptionModel
+	}
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	_ = writer.WriteField("model", modelName)
+	_ = writer.WriteField("response_format", "json")
+	part, err := writer.CreateFormFile("file", "audio.wav")
+	if err != nil {
+		return "", err
+	}
+	if _, err = part.Write(pcm16ToWav(pcm)); err != nil {
+		return "", err
+	}
+	if err = writer.Close(); err != nil {
+		return "", err
+	}
+
+	ec, recorder, err := s.newLegContext("/v1/audio/transcriptions", writer.FormDataContentType(), body.Bytes(), modelName)
+	if err != nil {
+		return "", err
+	}
+	if err = ec.Request.ParseMultipartForm(32 << 20); err != nil {
+		return "", err
+	}
+	info := relaycommon.GenRelayInfoOpenAIAudio(ec)
+	audioRequest := &dto.AudioRequest{Model: modelName, ResponseFormat: "json"}
+	priceData, adaptor, err := prepareRealtimeBridgeLeg(ec, info, audioRequest)
+	if err != nil {
+		return "", err
+	}
+	requestBody, err := adaptor.ConvertAudioRequest(ec, info, *audioRequest)
+	if err != nil {
+		return "", err
+	}
+	preConsumedQuota, err := s.preConsumeLeg(ec, info, priceData)
+	if err != nil {
+		return "", err
+	}
+	usage, err := doRealtimeBridgeLeg(ec, info, adaptor, requestBody)
+	if err != nil {
+		returnPreConsumedQuota(ec, info, 0, preConsumedQuota)
+		return "", err
+	}
+	if err = s.consumeLeg(ec, info, priceData, preConsumedQuota, usage, "语音识别", nil); err != nil {
+		return "", err
+	}
+	var response dto.AudioResponse
+	if err = json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		return "", err
+	}
+	return response.Text, nil
+}
+
+// chat 对话环节，使用会话所选渠道生成回复
+func (s *realtimeBridgeSession) chat(instructions string, total *dto.RealtimeUsage) (*dto.Message, error) {
+	request := &dto.GeneralOpenAIRequest{
+		Model: s.info.OriginModelName,
+	}
+	if instructions != "" {
+		system := dto.Message{Role: "system"}
+		system.SetStringContent(instructions)
+		request.Messages = append(request.Messages, system)
+	}
+	request.Messages = append(request.Messages, s.messages...)
+	if s.session.Temperature > 0 {
+		request.Temperature = common.GetPointer(s.session.Temperature)
+	}
+	for _, tool := range s.session.Tools {
+		request.Tools = append(request.Tools, dto.ToolCallRequest{
+			Type: "function",
+			Function: dto.FunctionRequest{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	if len(request.Tools) > 0 && s.session.ToolChoice != "" {
+		request.ToolChoice = s.session.ToolChoice
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	ec, recorder, err := s.newLegContext("/v1/chat/completions", "application/json", body, "")
+	if err != nil {
+		return nil, err
+	}
+	info := relaycommon.GenRelayInfo(ec)
+	info.IsStream = false
+	promptTokens, err := service.CountTokenChatRequest(info, *request)
+	if err != nil {
+		return nil, err
+	}
+	info.PromptTokens = promptTokens
+	priceData, adaptor, err := prepareRealtimeBridgeLeg(ec, info, request)
+	if err != nil {
+		return nil, err
+	}
+	convertedRequest, err := adaptor.ConvertOpenAIRequest(ec, info, request)
+	if err != nil {
+		return nil, err
+	}
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		return nil, err
+	}
+	preConsumedQuota, err := s.preConsumeLeg(ec, info, priceData)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := doRealtimeBridgeLeg(ec, info, adaptor, bytes.NewBuffer(jsonData))
+	if err != nil {
+		returnPreConsumedQuota(ec, info, 0, preConsumedQuota)
+		return nil, err
+	}
+	if err = s.consumeLeg(ec, info, priceData, preConsumedQuota, usage, "对话", total); err != nil {
+		return nil, err
+	}
+	var response dto.OpenAITextResponse
+	if err = json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		return nil, err
+	}
+	if len(response.Choices) == 0 {
+		return nil, errors.New("empty chat completion response")
+	}
+	return &response.Choices[0].Message, nil
+}
+
+// speech 语音合成环节，要求渠道以 pcm 格式返回 24kHz 单声道 16 位音频
+func (s *realtimeBridgeSession) speech(text string, total *dto.RealtimeUsage) ([]byte, error) {
+	bridgeSetting := operation_setting.GetRealtimeBridgeSetting()
+	voice := s.session.Voice
+	if voice == "" {
+		voice = bridgeSetting.DefaultVoice
+	}
+	audioRequest := &dto.AudioRequest{
+		Model:          bridgeSetting.SpeechModel,
+		Input:          text,
+		Voice:          voice,
+		ResponseFormat: "pcm",
+	}
+	body, err := json.Marshal(audioRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	ec, recorder, err := s.newLegContext("/v1/audio/speech", "application/json", body, audioRequest.Model)
+	if err != nil {
+		return nil, err
+	}
+	info := relaycommon.GenRelayInfoOpenAIAudio(ec)
+	info.PromptTokens = service.CountTTSToken(text, audioRequest.Model)
+	priceData, adaptor, err := prepareRealtimeBridgeLeg(ec, info, audioRequest)
+	if err != nil {
+		return nil, err
+	}
+	requestBody, err := adaptor.ConvertAudioRequest(ec, info, *audioRequest)
+	if err != nil {
+		return nil, err
+	}
+	preConsumedQuota, err := s.preConsumeLeg(ec, info, priceData)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := doRealtimeBridgeLeg(ec, info, adaptor, requestBody)
+	if err != nil {
+		returnPreConsumedQuota(ec, info, 0, preConsumedQuota)
+		return nil, err
+	}
+	if err = s.consumeLeg(ec, info, priceData, preConsumedQuota, usage, "语音合成", total); err != nil {
+		return nil, err
+	}
+	return recorder.Body.Bytes(), nil
+}
+
+// newLegContext 创建执行桥接环节的内部请求上下文，modelName 不为空时为该模型重新选择渠道，否则沿用会话所选渠道。
+// 重新选择渠道的模型同样受令牌的模型限制约束
+func (s *realtimeBridgeSession) newLegContext(path string, contentType string, body []byte, modelName string) (*gin.Context, *httptest.ResponseRecorder, error) {
+	if modelName != "" && !middleware.IsTokenModelAllowed(s.c, modelName) {
+		return nil, nil, fmt.Errorf("该令牌无权访问模型 %s", modelName)
+	}
+	recorder := httptest.NewRecorder()
+	ec, _ := gin.CreateTestContext(recorder)
+	request, err := http.NewRequestWithContext(s.c.Request.Context(), http.MethodPost, path, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	request.Header.Set("Content-Type", contentType)
+	ec.Request = request
+	ec.Keys = s.c.Copy().Keys
+	for _, key := range []string{"prompt_tokens", "specific_channel_id", constant.ContextKeyRelayInfo,
+		constant.ContextKeyFallbackFrom, constant.ContextKeyHedgeInfo, constant.ContextKeyUpstreamContext} {
+		delete(ec.Keys, key)
+	}
+	ec.Set(common.KeyRequestBody, body)
+	ec.Set(constant.ContextKeyRequestStartTime, time.Now())
+
+	if modelName == "" {
+		ec.Request.Header.Set("Authorization", s.c.Request.Header.Get("Authorization"))
+		return ec, recorder, nil
+	}
+	channel, _, err := model.CacheGetRandomSatisfiedChannel(ec, s.c.GetString("group"), modelName, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if channel == nil {
+		return nil, nil, fmt.Errorf("no available channel for model %s", modelName)
+	}
+	if err = middleware.SetupContextForSelectedChannel(ec, channel, modelName); err != nil {
+		return nil, nil, err
+	}
+	return ec, recorder, nil
+}
+
+func prepareRealtimeBridgeLeg(ec *gin.Context, info *relaycommon.RelayInfo, request any) (helper.PriceData, channel.Adaptor, error) {
+	if err := helper.ModelMappedHelper(ec, info, request); err != nil {
+		return helper.PriceData{}, nil, err
+	}
+	priceData, err := helper.ModelPriceHelper(ec, info, info.PromptTokens, 0)
+	if err != nil {
+		return helper.PriceData{}, nil, err
+	}
+	adaptor := GetAdaptor(info.ApiType)
+	if adaptor == nil {
+		return helper.PriceData{}, nil, fmt.Errorf("invalid api type: %d", info.ApiType)
+	}
+	adaptor.Init(info)
+	return priceData, adaptor, nil
+}
+
+// preConsumeLeg 请求上游前按环节所用模型检查额度并预扣费，与普通请求一致，额度不足时结束会话
+func (s *realtimeBridgeSession) preConsumeLeg(ec *gin.Context, info *relaycommon.RelayInfo, priceData helper.PriceData) (int, error) {
+	preConsumedQuota, _, openaiErr := preConsumeQuota(ec, priceData.ShouldPreConsumedQuota, info)
+	if openaiErr != nil {
+		s.fatalErr = errors.New(openaiErr.Error.Message)
+		return 0, s.fatalErr
+	}
+	return preConsumedQuota, nil
+}
+
+// doRealtimeBridgeLeg 请求上游并由适配器将响应写入内部请求上下文，返回适配器统计的用量
+func doRealtimeBridgeLeg(ec *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, requestBody io.Reader) (*dto.Usage, error) {
+	resp, err := adaptor.DoRequest(ec, info, requestBody)
+	if err != nil {
+		return nil, err
+	}
+	var httpResp *http.Response
+	if resp != nil {
+		httpResp = resp.(*http.Response)
+		if httpResp.StatusCode != http.StatusOK {
+			openaiErr := service.RelayErrorHandler(httpResp, false)
+			return nil, errors.New(openaiErr.Error.Message)
+		}
+	}
+	usage, openaiErr := adaptor.DoResponse(ec, httpResp, info)
+	if openaiErr != nil {
+		return nil, errors.New(openaiErr.Error.Message)
+	}
+	if textUsage, ok := usage.(*dto.Usage); ok && textUsage != nil {
+		return textUsage, nil
+	}
+	return &dto.Usage{PromptTokens: info.PromptTokens, TotalTokens: info.PromptTokens}, nil
+}
+
+// consumeLeg 退回预扣费后按环节所用模型通过 PreWssConsumeQuota 扣费、PostWssConsumeQuota 记录日志，
+// 扣费失败时结束会话。按次计费的模型直接扣除模型价格
+func (s *realtimeBridgeSession) consumeLeg(ec *gin.Context, info *relaycommon.RelayInfo, priceData helper.PriceData, preConsumedQuota int, usage *dto.Usage, leg string, total *dto.RealtimeUsage) error {
+	realtimeUsage := &dto.RealtimeUsage{
+		TotalTokens:  usage.PromptTokens + usage.CompletionTokens,
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+	}
+	realtimeUsage.InputTokenDetails.TextTokens = usage.PromptTokens
+	realtimeUsage.InputTokenDetails.CachedTokens = usage.PromptTokensDetails.CachedTokens
+	realtimeUsage.OutputTokenDetails.TextTokens = usage.CompletionTokens
+
+	var err error
+	if priceData.UsePrice {
+		err = service.PostConsumeQuota(info, priceData.ShouldPreConsumedQuota-preConsumedQuota, preConsumedQuota, false)
+	} else {
+		if preConsumedQuota != 0 {
+			err = service.PostConsumeQuota(info, -preConsumedQuota, 0, false)
+		}
+		if err == nil {
+			err = service.PreWssConsumeQuota(ec, info, realtimeUsage)
+		}
+	}
+	if err != nil {
+		s.fatalErr = err
+		return err
+	}
+	userQuota, _ := model.GetUserQuota(info.UserId, false)
+	service.PostWssConsumeQuota(ec, info, info.OriginModelName, realtimeUsage, 0, userQuota, priceData, "实时语音桥接："+leg)
+
+	if total != nil {
+		total.TotalTokens += realtimeUsage.TotalTokens
+		total.InputTokens += realtimeUsage.InputTokens
+		total.OutputTokens += realtimeUsage.OutputTokens
+		total.InputTokenDetails.TextTokens += realtimeUsage.InputTokenDetails.TextTokens
+		total.InputTokenDetails.CachedTokens += realtimeUsage.InputTokenDetails.CachedTokens
+		total.OutputTokenDetails.TextTokens += realtimeUsage.OutputTokenDetails.TextTokens
+	}
+	return nil
+}
+
+// pcm16ToWav 为 24kHz 单声道 16 位 PCM 音频添加 WAV 文件头
+func pcm16ToWav(pcm []byte) []byte {
+	var buf bytes.Buffer
+	buf.Grow(44 + len(pcm))
+	buf.WriteString("RIFF")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(36+len(pcm)))
+	buf.WriteString("WAVEfmt ")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(16))
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(1)) // PCM
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(1)) // 单声道
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(realtimeBridgeSampleRate))
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(realtimeBridgeSampleRate*2))
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(2))
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(16))
+	buf.WriteString("data")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(len(pcm)))
+	buf.Write(pcm)
+	return buf.Bytes()
+}
+
+func joinNonEmpty(texts []string, sep string) string {
+	var result []string
+	for _, text := range texts {
+		if text != "" {
+			result = append(result, text)
+		}
+	}
+	return strings.Join(result, sep)
+}
@@ -10,6 +10,7 @@ import (
 	"one-api/common"
 	"one-api/constant"
 	"one-api/dto"
+	"one-api/middleware"
 	"one-api/model"
 	relaycommon "one-api/relay/common"
 	relayconstant "one-api/relay/constant"
@@ -229,28 +230,36 @@ func RelaySwapFace(c *gin.Context) *dto.MidjourneyResponse {
 				model.UpdateUserUsedQuotaAndRequestCount(userId, quota)
 				channelId := c.GetInt("channel_id")
 				model.UpdateChannelUsedQuota(channelId, quota)
+				model.UpdateChannelKeyUsedQuota(c.GetInt(constant.ContextKeyChannelKeyId), quota)
 			}
 		}
 	}()
 	midjResponse := &mjResp.Response
 	midjourneyTask := &model.Midjourney{
-		UserId:      userId,
-		Code:        midjResponse.Code,
-		Action:      constant.MjActionSwapFace,
-		MjId:        midjResponse.Result,
-		Prompt:      "InsightFace",
-		PromptEn:    "",
-		Description: midjResponse.Description,
-		State:       "",
-		SubmitTime:  startTime,
-		StartTime:   time.Now().UnixNano() / int64(time.Millisecond),
-		FinishTime:  0,
-		ImageUrl:    "",
-		Status:      "",
-		Progress:    "0%",
-		FailReason:  "",
-		ChannelId:   c.GetInt("channel_id"),
-		Quota:       quota,
+		UserId:       userId,
+		Code:         midjResponse.Code,
+		Action:       constant.MjActionSwapFace,
+		MjId:         midjResponse.Result,
+		Prompt:       "InsightFace",
+		PromptEn:     "",
+		Description:  midjResponse.Description,
+		State:        "",
+		SubmitTime:   startTime,
+		StartTime:    time.Now().UnixNano() / int64(time.Millisecond),
+		FinishTime:   0,
+		ImageUrl:     "",
+		Status:       "",
+		Progress:     "0%",
+		FailReason:   "",
+		ChannelId:    c.GetInt("channel_id"),
+		ChannelKeyId: c.GetInt(constant.ContextKeyChannelKeyId),
+		Quota:        quota,
+		TokenId:      relayInfo.TokenId,
+		TokenKey:     relayInfo.TokenKey,
+	}
+	if mjResp.StatusCode != 200 || midjResponse.Code != 1 {
+		// 提交失败不扣费，避免任务被标记失败时退还未扣除的额度
+		midjourneyTask.Quota = 0
 	}
 	err = midjourneyTask.Insert()
 	if err != nil {
@@ -283,7 +292,9 @@ func RelayMidjourneyTaskImageSeed(c *gin.Context) *dto.MidjourneyResponse {
 		return service.MidjourneyErrorWrapper(constant.MjRequestError, "该任务所属渠道已被禁用")
 	}
 	c.Set("channel_id", originTask.ChannelId)
-	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
+	if err = middleware.SetupContextForChannelKey(c, channel, channel.GetChannelKeyByKeyId(originTask.ChannelKeyId)); err != nil {
+		return service.MidjourneyErrorWrapper(constant.MjRequestError, err.Error())
+	}
 
 	requestURL := getMjRequestPath(c.Request.URL.String())
 	fullRequestURL := fmt.Sprintf("%s%s", channel.GetBaseURL(), requestURL)
@@ -453,7 +464,9 @@ func RelayMidjourneySubmit(c *gin.Context, relayMode int) *dto.MidjourneyRespons
 			}
 			c.Set("base_url", channel.GetBaseURL())
 			c.Set("channel_id", originTask.ChannelId)
-			c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
+			if err = middleware.SetupContextForChannelKey(c, channel, channel.GetChannelKeyByKeyId(originTask.ChannelKeyId)); err != nil {
+				return service.MidjourneyErrorWrapper(constant.MjRequestError, err.Error())
+			}
 			log.Printf("检测到此操作为放大、变换、重绘，获取原channel信息: %s,%s", strconv.Itoa(originTask.ChannelId), channel.GetBaseURL())
 		}
 		midjRequest.Prompt = originTask.Prompt
@@ -531,6 +544,7 @@ func RelayMidjourneySubmit(c *gin.Context, relayMode int) *dto.MidjourneyRespons
 				model.UpdateUserUsedQuotaAndRequestCount(userId, quota)
 				channelId := c.GetInt("channel_id")
 				model.UpdateChannelUsedQuota(channelId, quota)
+				model.UpdateChannelKeyUsedQuota(c.GetInt(constant.ContextKeyChannelKeyId), quota)
 			}
 		}
 	}()
@@ -543,23 +557,26 @@ func RelayMidjourneySubmit(c *gin.Context, relayMode int) *dto.MidjourneyRespons
 	// 24-prompt包含敏感词 {"code":24,"description":"可能包含敏感词","properties":{"promptEn":"nude body","bannedWord":"nude"}}
 	// other: 提交错误，description为错误描述
 	midjourneyTask := &model.Midjourney{
-		UserId:      userId,
-		Code:        midjResponse.Code,
-		Action:      midjRequest.Action,
-		MjId:        midjResponse.Result,
-		Prompt:      midjRequest.Prompt,
-		PromptEn:    "",
-		Description: midjResponse.Description,
-		State:       "",
-		SubmitTime:  time.Now().UnixNano() / int64(time.Millisecond),
-		StartTime:   0,
-		FinishTime:  0,
-		ImageUrl:    "",
-		Status:      "",
-		Progress:    "0%",
-		FailReason:  "",
-		ChannelId:   c.GetInt("channel_id"),
-		Quota:       quota,
+		UserId:       userId,
+		Code:         midjResponse.Code,
+		Action:       midjRequest.Action,
+		MjId:         midjResponse.Result,
+		Prompt:       midjRequest.Prompt,
+		PromptEn:     "",
+		Description:  midjResponse.Description,
+		State:        "",
+		SubmitTime:   time.Now().UnixNano() / int64(time.Millisecond),
+		StartTime:    0,
+		FinishTime:   0,
+		ImageUrl:     "",
+		Status:       "",
+		Progress:     "0%",
+		FailReason:   "",
+		ChannelId:    c.GetInt("channel_id"),
+		ChannelKeyId: c.GetInt(constant.ContextKeyChannelKeyId),
+		Quota:        quota,
+		TokenId:      relayInfo.TokenId,
+		TokenKey:     relayInfo.TokenKey,
 	}
 	if midjResponse.Code == 3 {
 		//无实例账号自动禁用渠道（No available account instance）
@@ -604,6 +621,10 @@ func RelayMidjourneySubmit(c *gin.Context, relayMode int) *dto.MidjourneyRespons
 		midjourneyTask.Progress = "100%"
 		midjourneyTask.Status = "SUCCESS"
 	}
+	if !consumeQuota || midjResponseWithStatus.StatusCode != 200 {
+		// 未扣费的任务不记录额度，避免任务被标记失败时退还未扣除的额度
+		midjourneyTask.Quota = 0
+	}
 	err = midjourneyTask.Insert()
 	if err != nil {
 		return &dto.MidjourneyResponse{
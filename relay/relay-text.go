@@ -12,6 +12,7 @@ import (
 	"one-api/constant"
 	"one-api/dto"
 	"one-api/model"
+	"one-api/relay/channel"
 	relaycommon "one-api/relay/common"
 	relayconstant "one-api/relay/constant"
 	"one-api/relay/helper"
@@ -24,6 +25,7 @@ import (
 
 	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/gin-gonic/gin"
 )
@@ -119,7 +121,9 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 		promptTokens = value.(int)
 		relayInfo.PromptTokens = promptTokens
 	} else {
+		endSpan := common.StartSpan(c, "count_prompt_tokens")
 		promptTokens, err = getPromptTokens(textRequest, relayInfo)
+		endSpan()
 		// count messages token error 计算promptTokens错误
 		if err != nil {
 			return service.OpenAIErrorWrapper(err, "count_token_messages_failed", http.StatusInternalServerError)
@@ -142,6 +146,83 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 			returnPreConsumedQuota(c, relayInfo, userQuota, preConsumedQuota)
 		}
 	}()
+
+	cacheKey := getResponseCacheKey(c, relayInfo)
+	if usage := tryServeResponseCache(c, relayInfo, cacheKey); usage != nil {
+		postConsumeQuota(c, relayInfo, usage, preConsumedQuota, userQuota, priceData, "")
+		return nil
+	}
+	semanticQuery := getSemanticCacheQuery(c, relayInfo, textRequest)
+	if usage := tryServeSemanticCache(c, relayInfo, semanticQuery); usage != nil {
+		postConsumeQuota(c, relayInfo, usage, preConsumedQuota, userQuota, priceData, "")
+		return nil
+	}
+
+	adaptor, requestBody, openaiErr := buildTextRequest(c, relayInfo, textRequest)
+	if openaiErr != nil {
+		return openaiErr
+	}
+
+	var httpResp *http.Response
+	var resp any
+	if shouldHedgeRequest(c, relayInfo) {
+		var cleanup func()
+		relayInfo, adaptor, resp, cleanup, err = doRequestWithHedge(c, relayInfo, adaptor, requestBody)
+		defer cleanup()
+	} else {
+		resp, err = adaptor.DoRequest(c, relayInfo, requestBody)
+	}
+
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+
+	statusCodeMappingStr := c.GetString("status_code_mapping")
+
+	if resp != nil {
+		httpResp = resp.(*http.Response)
+		relayInfo.IsStream = relayInfo.IsStream || strings.HasPrefix(httpResp.Header.Get("Content-Type"), "text/event-stream")
+		if httpResp.StatusCode != http.StatusOK {
+			openaiErr = service.RelayErrorHandler(httpResp, false)
+			// reset status code 重置状态码
+			service.ResetStatusCode(openaiErr, statusCodeMappingStr)
+			return openaiErr
+		}
+	}
+
+	var cacheWriter *responseCacheWriter
+	if cacheKey != "" || semanticQuery != nil {
+		cacheWriter = startResponseCapture(c)
+	}
+	endResponseSpan := common.StartSpan(c, "upstream_response")
+	usage, openaiErr := adaptor.DoResponse(c, httpResp, relayInfo)
+	endResponseSpan()
+	if cacheWriter != nil {
+		if entry := finishResponseCapture(c, cacheWriter, relayInfo, usage, openaiErr); entry != nil {
+			if cacheKey != "" {
+				service.SetResponseCache(cacheKey, entry)
+			}
+			if semanticQuery != nil {
+				addSemanticCache(c, semanticQuery, entry)
+			}
+		}
+	}
+	if openaiErr != nil {
+		// reset status code 重置状态码
+		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
+		return openaiErr
+	}
+
+	if strings.HasPrefix(relayInfo.OriginModelName, "gpt-4o-audio") {
+		service.PostAudioConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "")
+	} else {
+		postConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "")
+	}
+	return nil
+}
+
+// buildTextRequest 根据当前渠道转换请求，返回适配器与请求体
+func buildTextRequest(c *gin.Context, relayInfo *relaycommon.RelayInfo, textRequest *dto.GeneralOpenAIRequest) (channel.Adaptor, io.Reader, *dto.OpenAIErrorWithStatusCode) {
 	includeUsage := false
 	// 判断用户是否需要返回使用情况
 	if textRequest.StreamOptions != nil && textRequest.StreamOptions.IncludeUsage {
@@ -166,7 +247,7 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 
 	adaptor := GetAdaptor(relayInfo.ApiType)
 	if adaptor == nil {
-		return service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
+		return nil, nil, service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
 	}
 	adaptor.Init(relayInfo)
 	var requestBody io.Reader
@@ -174,17 +255,17 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 	if model_setting.GetGlobalSettings().PassThroughRequestEnabled {
 		body, err := common.GetRequestBody(c)
 		if err != nil {
-			return service.OpenAIErrorWrapperLocal(err, "get_request_body_failed", http.StatusInternalServerError)
+			return nil, nil, service.OpenAIErrorWrapperLocal(err, "get_request_body_failed", http.StatusInternalServerError)
 		}
 		requestBody = bytes.NewBuffer(body)
 	} else {
 		convertedRequest, err := adaptor.ConvertOpenAIRequest(c, relayInfo, textRequest)
 		if err != nil {
-			return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
+			return nil, nil, service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
 		}
 		jsonData, err := json.Marshal(convertedRequest)
 		if err != nil {
-			return service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
+			return nil, nil, service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
 		}
 
 		// apply param override
@@ -192,14 +273,14 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 			reqMap := make(map[string]interface{})
 			err = json.Unmarshal(jsonData, &reqMap)
 			if err != nil {
-				return service.OpenAIErrorWrapperLocal(err, "param_override_unmarshal_failed", http.StatusInternalServerError)
+				return nil, nil, service.OpenAIErrorWrapperLocal(err, "param_override_unmarshal_failed", http.StatusInternalServerError)
 			}
 			for key, value := range relayInfo.ParamOverride {
 				reqMap[key] = value
 			}
 			jsonData, err = json.Marshal(reqMap)
 			if err != nil {
-				return service.OpenAIErrorWrapperLocal(err, "param_override_marshal_failed", http.StatusInternalServerError)
+				return nil, nil, service.OpenAIErrorWrapperLocal(err, "param_override_marshal_failed", http.StatusInternalServerError)
 			}
 		}
 
@@ -209,39 +290,7 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 		requestBody = bytes.NewBuffer(jsonData)
 	}
 
-	var httpResp *http.Response
-	resp, err := adaptor.DoRequest(c, relayInfo, requestBody)
-
-	if err != nil {
-		return service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
-	}
-
-	statusCodeMappingStr := c.GetString("status_code_mapping")
-
-	if resp != nil {
-		httpResp = resp.(*http.Response)
-		relayInfo.IsStream = relayInfo.IsStream || strings.HasPrefix(httpResp.Header.Get("Content-Type"), "text/event-stream")
-		if httpResp.StatusCode != http.StatusOK {
-			openaiErr = service.RelayErrorHandler(httpResp, false)
-			// reset status code 重置状态码
-			service.ResetStatusCode(openaiErr, statusCodeMappingStr)
-			return openaiErr
-		}
-	}
-
-	usage, openaiErr := adaptor.DoResponse(c, httpResp, relayInfo)
-	if openaiErr != nil {
-		// reset status code 重置状态码
-		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
-		return openaiErr
-	}
-
-	if strings.HasPrefix(relayInfo.OriginModelName, "gpt-4o-audio") {
-		service.PostAudioConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "")
-	} else {
-		postConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "")
-	}
-	return nil
+	return adaptor, requestBody, nil
 }
 
 func getPromptTokens(textRequest *dto.GeneralOpenAIRequest, info *relaycommon.RelayInfo) (int, error) {
@@ -282,6 +331,8 @@ func checkRequestSensitive(textRequest *dto.GeneralOpenAIRequest, info *relaycom
 
 // 预扣费并返回用户剩余配额
 func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommon.RelayInfo) (int, int, *dto.OpenAIErrorWithStatusCode) {
+	endSpan := common.StartSpan(c, "pre_consume_quota", attribute.Int("quota", preConsumedQuota))
+	defer endSpan()
 	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
 	if err != nil {
 		return 0, 0, service.OpenAIErrorWrapperLocal(err, "get_user_quota_failed", http.StatusInternalServerError)
@@ -339,6 +390,8 @@ func returnPreConsumedQuota(c *gin.Context, relayInfo *relaycommon.RelayInfo, us
 
 func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	usage *dto.Usage, preConsumedQuota int, userQuota int, priceData helper.PriceData, extraContent string) {
+	endSpan := common.StartSpan(ctx, "post_consume_quota")
+	defer endSpan()
 	if usage == nil {
 		usage = &dto.Usage{
 			PromptTokens:     relayInfo.PromptTokens,
@@ -466,6 +519,12 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	// 添加 audio input 独立计费
 	quotaCalculateDecimal = quotaCalculateDecimal.Add(audioInputQuota)
 
+	responseCacheHit := service.GetResponseCacheHit(ctx)
+	if responseCacheHit != nil {
+		// 命中响应缓存，按缓存计费倍率折算
+		quotaCalculateDecimal = quotaCalculateDecimal.Mul(decimal.NewFromFloat(responseCacheHit.BillingRatio))
+	}
+
 	quota := int(quotaCalculateDecimal.Round(0).IntPart())
 	totalTokens := promptTokens + completionTokens
 
@@ -475,6 +534,13 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	} else {
 		logContent = fmt.Sprintf("模型价格 %.2f，分组倍率 %.2f", modelPrice, groupRatio)
 	}
+	if responseCacheHit != nil {
+		if responseCacheHit.Type == service.ResponseCacheTypeSemantic {
+			logContent += fmt.Sprintf("，语义缓存命中（相似度 %.4f），缓存计费倍率 %.2f", responseCacheHit.Similarity, responseCacheHit.BillingRatio)
+		} else {
+			logContent += fmt.Sprintf("，响应缓存命中，缓存计费倍率 %.2f", responseCacheHit.BillingRatio)
+		}
+	}
 
 	// record all the consume log even if quota is 0
 	if totalTokens == 0 {
@@ -486,7 +552,10 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 			"tokenId %d, model %s， pre-consumed quota %d", relayInfo.UserId, relayInfo.ChannelId, relayInfo.TokenId, modelName, preConsumedQuota))
 	} else {
 		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
-		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		if responseCacheHit == nil {
+			model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+			model.UpdateChannelKeyUsedQuota(relayInfo.ChannelKeyId, quota)
+		}
 	}
 
 	quotaDelta := quota - preConsumedQuota
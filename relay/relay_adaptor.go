@@ -1,6 +1,7 @@
 package relay
 
 import (
+	"one-api/common"
 	commonconstant "one-api/constant"
 	"one-api/relay/channel"
 	"one-api/relay/channel/ali"
@@ -24,6 +25,7 @@ import (
 	"one-api/relay/channel/perplexity"
 	"one-api/relay/channel/siliconflow"
 	taskcustompass "one-api/relay/channel/task/custompass"
+	taskdeclarative "one-api/relay/channel/task/declarative"
 	"one-api/relay/channel/task/kling"
 	"one-api/relay/channel/task/suno"
 	"one-api/relay/channel/tencent"
@@ -100,6 +102,19 @@ func GetAdaptor(apiType int) channel.Adaptor {
 	return nil
 }
 
+// GetTaskPlatformByChannelType 由渠道类型确定任务平台，用于按模型路由的视频接口
+func GetTaskPlatformByChannelType(channelType int) (commonconstant.TaskPlatform, bool) {
+	switch channelType {
+	case common.ChannelTypeKling:
+		return commonconstant.TaskPlatformKling, true
+	case common.ChannelTypeCustomPass:
+		return commonconstant.TaskPlatformCustomPass, true
+	case common.ChannelTypeDeclarative:
+		return commonconstant.TaskPlatformDeclarative, true
+	}
+	return "", false
+}
+
 func GetTaskAdaptor(platform commonconstant.TaskPlatform) channel.TaskAdaptor {
 	switch platform {
 	//case constant.APITypeAIProxyLibrary:
@@ -110,6 +125,8 @@ func GetTaskAdaptor(platform commonconstant.TaskPlatform) channel.TaskAdaptor {
 		return &kling.TaskAdaptor{}
 	case commonconstant.TaskPlatformCustomPass:
 		return &taskcustompass.TaskAdaptor{}
+	case commonconstant.TaskPlatformDeclarative:
+		return &taskdeclarative.TaskAdaptor{}
 	}
 	return nil
 }
@@ -11,11 +11,14 @@ import (
 	"one-api/common"
 	"one-api/constant"
 	"one-api/dto"
+	"one-api/middleware"
 	"one-api/model"
+	"one-api/relay/channel"
 	relaycommon "one-api/relay/common"
 	relayconstant "one-api/relay/constant"
 	"one-api/service"
 	"one-api/setting/ratio_setting"
+	"strings"
 )
 
 /*
@@ -35,11 +38,15 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 	if taskErr != nil {
 		return
 	}
+	callbackUrl, err := service.GetTaskCallbackUrl(c)
+	if err != nil {
+		return service.TaskErrorWrapperLocal(err, "invalid_callback_url", http.StatusBadRequest)
+	}
 
 	modelName := service.CoverTaskActionToModelName(platform, relayInfo.Action)
 	if platform == constant.TaskPlatformKling {
 		modelName = relayInfo.OriginModelName
-	} else if platform == constant.TaskPlatformCustomPass {
+	} else if platform == constant.TaskPlatformCustomPass || platform == constant.TaskPlatformDeclarative {
 		// 对于自定义透传渠道，使用真实的模型名称而不是 custompass_submit
 		modelName = relayInfo.OriginModelName
 	}
@@ -52,6 +59,17 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 			modelPrice = defaultPrice
 		}
 	}
+	if priceProvider, ok := adaptor.(channel.TaskPriceProvider); ok {
+		if price, ok := priceProvider.GetTaskPrice(relayInfo); ok {
+			modelPrice = price
+		}
+	}
+	// 按请求参数计算的价格（如视频按秒计费）优先，自定义透传渠道此时不再按用量计费
+	taskPrice, hasTaskPrice := c.Get(constant.ContextKeyTaskPrice)
+	if hasTaskPrice {
+		modelPrice = taskPrice.(float64)
+	}
+	customPassDynamicQuota := platform == constant.TaskPlatformCustomPass && !hasTaskPrice
 
 	// 预扣
 	groupRatio := ratio_setting.GetGroupRatio(relayInfo.Group)
@@ -77,7 +95,8 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 			taskErr = service.TaskErrorWrapperLocal(errors.New("task_origin_not_exist"), "task_not_exist", http.StatusBadRequest)
 			return
 		}
-		if originTask.ChannelId != relayInfo.ChannelId {
+		// 基于原任务的操作需要使用原任务的渠道与密钥
+		if originTask.ChannelId != relayInfo.ChannelId || originTask.ChannelKeyId != relayInfo.ChannelKeyId {
 			channel, err := model.GetChannelById(originTask.ChannelId, true)
 			if err != nil {
 				taskErr = service.TaskErrorWrapperLocal(err, "channel_not_found", http.StatusBadRequest)
@@ -88,10 +107,15 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 			}
 			c.Set("base_url", channel.GetBaseURL())
 			c.Set("channel_id", originTask.ChannelId)
-			c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
+			if err = middleware.SetupContextForChannelKey(c, channel, channel.GetChannelKeyByKeyId(originTask.ChannelKeyId)); err != nil {
+				return service.TaskErrorWrapperLocal(err, "channel_key_not_found", http.StatusServiceUnavailable)
+			}
 
 			relayInfo.BaseUrl = channel.GetBaseURL()
 			relayInfo.ChannelId = originTask.ChannelId
+			relayInfo.ChannelKeyId = c.GetInt(constant.ContextKeyChannelKeyId)
+			relayInfo.ApiKey = strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+			adaptor.Init(relayInfo)
 		}
 	}
 
@@ -121,7 +145,7 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 			var logContent string
 			var other map[string]interface{}
 
-			if platform == constant.TaskPlatformCustomPass {
+			if customPassDynamicQuota {
 				// CustomPass使用动态费用计算
 				finalQuota = calculateCustomPassFinalQuota(c, modelName, groupRatio)
 
@@ -156,6 +180,7 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 						modelName, tokenName, finalQuota, logContent, relayInfo.TokenId, userQuota, 0, false, relayInfo.Group, other)
 					model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, finalQuota)
 					model.UpdateChannelUsedQuota(relayInfo.ChannelId, finalQuota)
+					model.UpdateChannelKeyUsedQuota(relayInfo.ChannelKeyId, finalQuota)
 				}
 			} else {
 				// 其他平台保持原有逻辑
@@ -169,10 +194,14 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 					other := make(map[string]interface{})
 					other["model_price"] = modelPrice
 					other["group_ratio"] = groupRatio
+					for key, value := range c.GetStringMap(constant.ContextKeyTaskLogOther) {
+						other[key] = value
+					}
 					model.RecordConsumeLog(c, relayInfo.UserId, relayInfo.ChannelId, 0, 0,
 						modelName, tokenName, quota, logContent, relayInfo.TokenId, userQuota, 0, false, relayInfo.Group, other)
 					model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
 					model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+					model.UpdateChannelKeyUsedQuota(relayInfo.ChannelKeyId, quota)
 				}
 			}
 		}
@@ -189,14 +218,28 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 	task.Quota = quota
 	task.Data = taskData
 	task.Action = relayInfo.Action
+	task.Properties.CallbackUrl = callbackUrl
 
+	if platform == constant.TaskPlatformDeclarative {
+		task.Properties.Model = relayInfo.OriginModelName
+	}
 	// 为自定义透传渠道保存模型名称和实际消费费用
 	if platform == constant.TaskPlatformCustomPass {
 		task.Properties.Model = relayInfo.OriginModelName
+	}
+	if customPassDynamicQuota {
 		// 计算实际消费费用并更新到任务记录中，用于失败时的正确补偿
 		finalQuota := calculateCustomPassFinalQuota(c, modelName, groupRatio)
 		task.Quota = finalQuota
 	}
+	if v, ok := c.Get(constant.ContextKeyTaskProperties); ok {
+		properties := v.(model.Properties)
+		if task.Properties.Model == "" {
+			task.Properties.Model = properties.Model
+		}
+		task.Properties.Seconds = properties.Seconds
+		task.Properties.Size = properties.Size
+	}
 
 	err = task.Insert()
 	if err != nil {
@@ -308,11 +351,11 @@ func getCustomPassOtherInfo(c *gin.Context, modelName string, groupRatio float64
 	return other
 }
 
-
 var fetchRespBuilders = map[int]func(c *gin.Context) (respBody []byte, taskResp *dto.TaskError){
 	relayconstant.RelayModeSunoFetchByID:  sunoFetchByIDRespBodyBuilder,
 	relayconstant.RelayModeSunoFetch:      sunoFetchRespBodyBuilder,
 	relayconstant.RelayModeKlingFetchByID: videoFetchByIDRespBodyBuilder,
+	relayconstant.RelayModeTaskFetchByID:  sunoFetchByIDRespBodyBuilder,
 }
 
 func RelayTaskFetch(c *gin.Context, relayMode int) (taskResp *dto.TaskError) {
@@ -408,6 +451,75 @@ func videoFetchByIDRespBodyBuilder(c *gin.Context) (respBody []byte, taskResp *d
 	return
 }
 
+// RelayTaskCancel 取消当前用户的异步任务
+func RelayTaskCancel(c *gin.Context, relayMode int) *dto.TaskError {
+	taskId := c.Param("id")
+	if taskId == "" {
+		taskId = c.Param("task_id")
+	}
+	task, exist, err := model.GetByTaskId(c.GetInt("id"), taskId)
+	if err != nil {
+		return service.TaskErrorWrapper(err, "get_task_failed", http.StatusInternalServerError)
+	}
+	if !exist {
+		return service.TaskErrorWrapperLocal(errors.New("task_not_exist"), "task_not_exist", http.StatusBadRequest)
+	}
+	if taskErr := cancelTask(c, task); taskErr != nil {
+		return taskErr
+	}
+	c.JSON(http.StatusOK, dto.TaskResponse[any]{
+		Code: "success",
+		Data: TaskModel2Dto(task),
+	})
+	return nil
+}
+
+// cancelTask 请求上游取消任务，上游确认后将任务标记为已取消并按取消时的状态退还未消耗的额度。
+// 取消与渠道绑定，失败时不重试其他渠道，所以均返回本地错误
+func cancelTask(c *gin.Context, task *model.Task) *dto.TaskError {
+	if task.IsFinished() {
+		return service.TaskErrorWrapperLocal(fmt.Errorf("task %s is already finished", task.TaskID), "task_already_finished", http.StatusBadRequest)
+	}
+	adaptor := GetTaskAdaptor(task.Platform)
+	if adaptor == nil {
+		return service.TaskErrorWrapperLocal(fmt.Errorf("invalid api platform: %s", task.Platform), "invalid_api_platform", http.StatusBadRequest)
+	}
+	cancelChannel, err := model.CacheGetChannel(task.ChannelId)
+	if err != nil {
+		return service.TaskErrorWrapperLocal(err, "channel_not_found", http.StatusBadRequest)
+	}
+	baseURL := common.ChannelBaseURLs[cancelChannel.Type]
+	if cancelChannel.GetBaseURL() != "" {
+		baseURL = cancelChannel.GetBaseURL()
+	}
+	resp, err := adaptor.CancelTask(baseURL, cancelChannel.GetKeyByKeyId(task.ChannelKeyId), map[string]any{
+		"task_id":         task.TaskID,
+		"model":           task.Properties.Model,
+		"action":          task.Action,
+		"channel_setting": cancelChannel.GetSetting(),
+		"client_token":    task.TokenKey,
+	})
+	if errors.Is(err, channel.ErrTaskCancelUnsupported) {
+		return service.TaskErrorWrapperLocal(fmt.Errorf("cancelling %s task %s is not supported", task.Platform, task.TaskID), "cancel_unsupported", http.StatusNotImplemented)
+	}
+	if err != nil {
+		return service.TaskErrorWrapperLocal(err, "cancel_task_failed", http.StatusInternalServerError)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		responseBody, _ := io.ReadAll(resp.Body)
+		return service.TaskErrorWrapperLocal(fmt.Errorf("upstream cancel failed, status code: %d, body: %s", resp.StatusCode, responseBody), "cancel_task_failed", http.StatusBadGateway)
+	}
+	if err = service.CancelTask(c, task); err != nil {
+		if errors.Is(err, service.ErrTaskAlreadyFinished) {
+			// 上游已确认取消，但轮询已先写入终态，以数据库中的最终状态为准
+			return service.TaskErrorWrapperLocal(fmt.Errorf("task %s is already finished", task.TaskID), "task_already_finished", http.StatusConflict)
+		}
+		return service.TaskErrorWrapper(err, "cancel_task_failed", http.StatusInternalServerError)
+	}
+	return nil
+}
+
 func TaskModel2Dto(task *model.Task) *dto.TaskDto {
 	return &dto.TaskDto{
 		TaskID:     task.TaskID,
@@ -418,6 +530,7 @@ func TaskModel2Dto(task *model.Task) *dto.TaskDto {
 		StartTime:  task.StartTime,
 		FinishTime: task.FinishTime,
 		Progress:   task.Progress,
+		ResultUrl:  task.ResultUrl,
 		Data:       task.Data,
 	}
 }
@@ -0,0 +1,325 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/model"
+	"one-api/relay/channel/task/kling"
+	relayconstant "one-api/relay/constant"
+	"one-api/service"
+	"one-api/setting/operation_setting"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// videoTaskPlatforms 可通过 /v1/videos 接口访问的任务平台
+var videoTaskPlatforms = []constant.TaskPlatform{
+	constant.TaskPlatformKling,
+	constant.TaskPlatformCustomPass,
+	constant.TaskPlatformDeclarative,
+}
+
+func isVideoTaskPlatform(platform constant.TaskPlatform) bool {
+	for _, p := range videoTaskPlatforms {
+		if p == platform {
+			return true
+		}
+	}
+	return false
+}
+
+// videoSubmitWriter 暂存任务适配器写出的提交响应，由视频接口统一转换为视频对象后再返回
+type videoSubmitWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *videoSubmitWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *videoSubmitWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *videoSubmitWriter) WriteHeader(int) {}
+
+func (w *videoSubmitWriter) WriteHeaderNow() {}
+
+// RelayVideoSubmit 提交视频生成任务，平台由选中渠道的类型决定，请求转换为对应任务适配器的格式后复用任务提交流程
+func RelayVideoSubmit(c *gin.Context, relayMode int) *dto.TaskError {
+	platform, ok := GetTaskPlatformByChannelType(c.GetInt("channel_type"))
+	if !ok {
+		return service.TaskErrorWrapperLocal(fmt.Errorf("channel type %d does not support video generation", c.GetInt("channel_type")), "unsupported_video_channel", http.StatusBadRequest)
+	}
+	var req dto.VideoRequest
+	if err := common.UnmarshalBodyReusable(c, &req); err != nil {
+		return service.TaskErrorWrapperLocal(err, "invalid_request", http.StatusBadRequest)
+	}
+	if strings.TrimSpace(req.Prompt) == "" {
+		return service.TaskErrorWrapperLocal(errors.New("prompt is required"), "invalid_request", http.StatusBadRequest)
+	}
+	seconds := req.GetSeconds()
+	if seconds <= 0 {
+		seconds = operation_setting.GetVideoPricingSetting().DefaultSeconds
+	}
+	size := req.GetSize()
+
+	// 重试时需要使用客户端原始的请求体与模型名称
+	originModel := c.GetString("original_model")
+	originBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return service.TaskErrorWrapperLocal(err, "read_request_body_failed", http.StatusBadRequest)
+	}
+	defer func() {
+		c.Set("original_model", originModel)
+		c.Set(common.KeyRequestBody, originBody)
+	}()
+
+	c.Set("platform", string(platform))
+	switch platform {
+	case constant.TaskPlatformKling:
+		body, err := json.Marshal(kling.SubmitReq{
+			Prompt:   req.Prompt,
+			Model:    req.Model,
+			Image:    req.GetImage(),
+			Size:     size,
+			Duration: seconds,
+			Metadata: req.Metadata,
+		})
+		if err != nil {
+			return service.TaskErrorWrapperLocal(err, "marshal_request_failed", http.StatusInternalServerError)
+		}
+		c.Set(common.KeyRequestBody, body)
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	case constant.TaskPlatformCustomPass:
+		// 自定义透传渠道的提交模型名称格式为 "model/submit"
+		if !strings.HasSuffix(originModel, "/submit") {
+			c.Set("original_model", originModel+"/submit")
+		}
+	}
+	c.Set(constant.ContextKeyTaskProperties, model.Properties{
+		Model:   req.Model,
+		Seconds: seconds,
+		Size:    size,
+	})
+	c.Set(constant.ContextKeyTaskLogOther, map[string]interface{}{
+		"video_seconds": seconds,
+		"video_size":    size,
+	})
+	if price, ok := operation_setting.GetVideoPrice(req.Model, size, seconds); ok {
+		c.Set(constant.ContextKeyTaskPrice, price)
+	}
+
+	writer := &videoSubmitWriter{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+	c.Writer = writer
+	taskErr := RelayTaskSubmit(c, relayMode)
+	c.Writer = writer.ResponseWriter
+	if taskErr != nil {
+		return taskErr
+	}
+
+	var submitResp struct {
+		TaskId string `json:"task_id"`
+	}
+	if err := json.Unmarshal(writer.body.Bytes(), &submitResp); err != nil || submitResp.TaskId == "" {
+		return service.TaskErrorWrapperLocal(fmt.Errorf("invalid submit response: %s", writer.body.String()), "invalid_submit_response", http.StatusInternalServerError)
+	}
+	task, exist, err := model.GetByTaskId(c.GetInt("id"), submitResp.TaskId)
+	if err != nil || !exist {
+		return service.TaskErrorWrapperLocal(fmt.Errorf("task %s not found after submit", submitResp.TaskId), "get_task_failed", http.StatusInternalServerError)
+	}
+	c.JSON(http.StatusOK, TaskModel2VideoObject(task))
+	return nil
+}
+
+// RelayVideoFetch 查询、列出、下载与取消视频任务，除取消外只读取本地任务记录，任务状态由后台轮询更新
+func RelayVideoFetch(c *gin.Context, relayMode int) *dto.TaskError {
+	userId := c.GetInt("id")
+	if relayMode == relayconstant.RelayModeVideoList {
+		return videoList(c, userId)
+	}
+
+	task, exist, err := model.GetByTaskId(userId, c.Param("id"))
+	if err != nil {
+		return service.TaskErrorWrapper(err, "get_task_failed", http.StatusInternalServerError)
+	}
+	if !exist || !isVideoTaskPlatform(task.Platform) {
+		return service.TaskErrorWrapperLocal(errors.New("video not found"), "video_not_found", http.StatusNotFound)
+	}
+
+	switch relayMode {
+	case relayconstant.RelayModeVideoContent:
+		return videoContent(c, task)
+	case relayconstant.RelayModeVideoCancel:
+		if task.IsFinished() {
+			return service.TaskErrorWrapperLocal(fmt.Errorf("video %s is already %s", task.TaskID, TaskModel2VideoObject(task).Status), "video_already_finished", http.StatusBadRequest)
+		}
+		if taskErr := cancelTask(c, task); taskErr != nil {
+			return taskErr
+		}
+	}
+	c.JSON(http.StatusOK, TaskModel2VideoObject(task))
+	return nil
+}
+
+// videoList 按任务 ID 游标分页，参数 limit、order（asc/desc）与 after（上一页最后一个视频 ID）
+func videoList(c *gin.Context, userId int) *dto.TaskError {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = 20
+	} else if limit > 100 {
+		limit = 100
+	}
+	asc := c.Query("order") == "asc"
+	var afterId int64
+	if after := c.Query("after"); after != "" {
+		task, exist, err := model.GetByTaskId(userId, after)
+		if err != nil {
+			return service.TaskErrorWrapper(err, "get_task_failed", http.StatusInternalServerError)
+		}
+		if !exist {
+			return service.TaskErrorWrapperLocal(errors.New("video not found"), "video_not_found", http.StatusNotFound)
+		}
+		afterId = task.ID
+	}
+	tasks, err := model.GetUserTasksByPlatforms(userId, videoTaskPlatforms, afterId, limit+1, asc)
+	if err != nil {
+		return service.TaskErrorWrapper(err, "get_tasks_failed", http.StatusInternalServerError)
+	}
+	resp := dto.VideoListResponse{
+		Object: "list",
+		Data:   make([]dto.VideoObject, 0, len(tasks)),
+	}
+	if len(tasks) > limit {
+		resp.HasMore = true
+		tasks = tasks[:limit]
+	}
+	for _, task := range tasks {
+		resp.Data = append(resp.Data, *TaskModel2VideoObject(task))
+	}
+	if len(resp.Data) > 0 {
+		resp.FirstId = resp.Data[0].Id
+		resp.LastId = resp.Data[len(resp.Data)-1].Id
+	}
+	c.JSON(http.StatusOK, resp)
+	return nil
+}
+
+// videoContent 代理下载已完成任务的视频文件
+func videoContent(c *gin.Context, task *model.Task) *dto.TaskError {
+	if task.Status != model.TaskStatusSuccess {
+		return service.TaskErrorWrapperLocal(fmt.Errorf("video %s is not completed", task.TaskID), "video_not_ready", http.StatusBadRequest)
+	}
+	url := getVideoResultUrl(task)
+	if url == "" {
+		return service.TaskErrorWrapperLocal(fmt.Errorf("video %s has no content", task.TaskID), "video_content_not_found", http.StatusNotFound)
+	}
+	if key, ok := service.ParseMediaUrl(url); ok {
+		object, reader, err := service.OpenMediaObject(c.Request.Context(), key)
+		if err != nil {
+			return service.TaskErrorWrapperLocal(err, "video_content_not_found", http.StatusNotFound)
+		}
+		defer reader.Close()
+		c.Header("Content-Type", object.ContentType)
+		c.Header("Content-Length", strconv.FormatInt(object.Size, 10))
+		c.Status(http.StatusOK)
+		if _, err = io.Copy(c.Writer, reader); err != nil {
+			common.LogError(c, fmt.Sprintf("copy video content of task %s failed: %s", task.TaskID, err.Error()))
+		}
+		return nil
+	}
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, url, nil)
+	if err != nil {
+		return service.TaskErrorWrapperLocal(err, "invalid_video_url", http.StatusInternalServerError)
+	}
+	resp, err := service.GetHttpClient().Do(req)
+	if err != nil {
+		return service.TaskErrorWrapperLocal(err, "fetch_video_content_failed", http.StatusBadGateway)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return service.TaskErrorWrapperLocal(fmt.Errorf("fetch video content status code: %d", resp.StatusCode), "fetch_video_content_failed", http.StatusBadGateway)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "video/mp4"
+	}
+	c.Header("Content-Type", contentType)
+	if contentLength := resp.Header.Get("Content-Length"); contentLength != "" {
+		c.Header("Content-Length", contentLength)
+	}
+	c.Status(http.StatusOK)
+	if _, err = io.Copy(c.Writer, resp.Body); err != nil {
+		common.LogError(c, fmt.Sprintf("copy video content of task %s failed: %s", task.TaskID, err.Error()))
+	}
+	return nil
+}
+
+// getVideoResultUrl 任务结果地址，早期的可灵任务只把地址记录在 fail_reason 中
+func getVideoResultUrl(task *model.Task) string {
+	if task.ResultUrl != "" {
+		return task.ResultUrl
+	}
+	if task.Platform == constant.TaskPlatformKling && strings.HasPrefix(task.FailReason, "http") {
+		return task.FailReason
+	}
+	var data map[string]any
+	if err := json.Unmarshal(task.Data, &data); err == nil {
+		for _, key := range []string{"video_url", "url"} {
+			if url, ok := data[key].(string); ok && strings.HasPrefix(url, "http") {
+				return url
+			}
+		}
+	}
+	return ""
+}
+
+// TaskModel2VideoObject 将任务记录转换为与 OpenAI 视频接口兼容的视频对象
+func TaskModel2VideoObject(task *model.Task) *dto.VideoObject {
+	video := &dto.VideoObject{
+		Id:        task.TaskID,
+		Object:    "video",
+		Model:     strings.TrimSuffix(task.Properties.Model, "/submit"),
+		CreatedAt: task.SubmitTime,
+		Size:      task.Properties.Size,
+	}
+	if task.Properties.Seconds > 0 {
+		video.Seconds = strconv.Itoa(task.Properties.Seconds)
+	}
+	if progress, err := strconv.Atoi(strings.TrimSuffix(task.Progress, "%")); err == nil {
+		video.Progress = progress
+	}
+	switch task.Status {
+	case model.TaskStatusSuccess:
+		video.Status = dto.VideoStatusCompleted
+		video.Progress = 100
+	case model.TaskStatusFailure:
+		if task.FailReason == service.TaskCancelledReason {
+			video.Status = dto.VideoStatusCancelled
+		} else {
+			video.Status = dto.VideoStatusFailed
+			video.Error = &dto.VideoObjectError{
+				Code:    "video_generation_failed",
+				Message: task.FailReason,
+			}
+		}
+	case model.TaskStatusInProgress, model.TaskStatusUnknown:
+		video.Status = dto.VideoStatusInProgress
+	default:
+		video.Status = dto.VideoStatusQueued
+	}
+	if task.IsFinished() {
+		video.CompletedAt = task.FinishTime
+	}
+	return video
+}
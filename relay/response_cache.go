@@ -0,0 +1,152 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
+	"one-api/relay/helper"
+	"one-api/service"
+	"one-api/setting/operation_setting"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// responseCacheWriter 在写入客户端的同时记录响应内容，超出大小限制后停止记录
+type responseCacheWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (w *responseCacheWriter) record(size int) bool {
+	if w.overflow {
+		return false
+	}
+	if w.limit > 0 && w.body.Len()+size > w.limit {
+		w.overflow = true
+		w.body.Reset()
+		return false
+	}
+	return true
+}
+
+func (w *responseCacheWriter) Write(data []byte) (int, error) {
+	if w.record(len(data)) {
+		w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseCacheWriter) WriteString(s string) (int, error) {
+	if w.record(len(s)) {
+		w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// getResponseCacheKey 判断请求是否可以使用响应缓存，可以时返回缓存键，否则返回空字符串。
+// 仅缓存 temperature 为 0 的对话/文本补全以及 embedding 请求，客户端可通过 Cache-Control: no-cache 跳过缓存
+func getResponseCacheKey(c *gin.Context, info *relaycommon.RelayInfo) string {
+	if !operation_setting.IsResponseCacheEnabledForModel(info.OriginModelName) {
+		return ""
+	}
+	if operation_setting.GetResponseCacheSetting().TokenOptIn && !c.GetBool("token_response_cache") {
+		return ""
+	}
+	cacheControl := c.Request.Header.Get("Cache-Control")
+	if strings.Contains(cacheControl, "no-cache") || strings.Contains(cacheControl, "no-store") {
+		return ""
+	}
+	if strings.HasPrefix(info.OriginModelName, "gpt-4o-audio") {
+		return ""
+	}
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return ""
+	}
+	switch info.RelayMode {
+	case relayconstant.RelayModeChatCompletions, relayconstant.RelayModeCompletions:
+		var request struct {
+			Temperature *float64 `json:"temperature"`
+		}
+		if err = json.Unmarshal(body, &request); err != nil || request.Temperature == nil || *request.Temperature != 0 {
+			return ""
+		}
+	case relayconstant.RelayModeEmbeddings:
+	default:
+		return ""
+	}
+	key, err := service.ResponseCacheKey(info.Group, info.OriginModelName, body)
+	if err != nil {
+		return ""
+	}
+	return key
+}
+
+// serveResponseCache 回放缓存的响应，返回缓存时记录的用量用于计费
+func serveResponseCache(c *gin.Context, info *relaycommon.RelayInfo, entry *service.ResponseCacheEntry, hit *service.ResponseCacheHit) *dto.Usage {
+	c.Set(constant.ContextKeyResponseCacheHit, hit)
+	c.Header("X-New-Api-Cache", "hit")
+	info.IsStream = entry.IsStream
+	info.SetFirstResponseTime()
+	if entry.IsStream {
+		helper.SetEventStreamHeaders(c)
+		c.Status(http.StatusOK)
+		_, _ = c.Writer.Write(entry.Body)
+		c.Writer.Flush()
+	} else {
+		c.Data(http.StatusOK, entry.ContentType, entry.Body)
+	}
+	usage := entry.Usage
+	return &usage
+}
+
+// tryServeResponseCache 命中缓存时直接回放响应并返回用量，未命中返回 nil
+func tryServeResponseCache(c *gin.Context, info *relaycommon.RelayInfo, cacheKey string) *dto.Usage {
+	if cacheKey == "" {
+		return nil
+	}
+	entry := service.GetResponseCache(cacheKey)
+	if entry == nil {
+		return nil
+	}
+	common.LogInfo(c, "response cache hit")
+	return serveResponseCache(c, info, entry, &service.ResponseCacheHit{
+		Type:         service.ResponseCacheTypeExact,
+		BillingRatio: operation_setting.GetResponseCacheSetting().BillingRatio,
+	})
+}
+
+func startResponseCapture(c *gin.Context) *responseCacheWriter {
+	writer := &responseCacheWriter{
+		ResponseWriter: c.Writer,
+		limit:          operation_setting.GetResponseCacheSetting().MaxBodyBytes,
+	}
+	c.Writer = writer
+	return writer
+}
+
+// finishResponseCapture 恢复原始的 ResponseWriter，响应成功且完整记录时返回可缓存的条目，否则返回 nil
+func finishResponseCapture(c *gin.Context, writer *responseCacheWriter, info *relaycommon.RelayInfo, usage any, openaiErr *dto.OpenAIErrorWithStatusCode) *service.ResponseCacheEntry {
+	c.Writer = writer.ResponseWriter
+	if openaiErr != nil || writer.overflow || writer.body.Len() == 0 {
+		return nil
+	}
+	u, ok := usage.(*dto.Usage)
+	if !ok || u == nil || u.TotalTokens == 0 && u.PromptTokens == 0 {
+		return nil
+	}
+	return &service.ResponseCacheEntry{
+		Body:        writer.body.Bytes(),
+		ContentType: c.Writer.Header().Get("Content-Type"),
+		IsStream:    info.IsStream,
+		Usage:       *u,
+	}
+}
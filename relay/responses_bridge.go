@@ -0,0 +1,223 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/model"
+	relaycommon "one-api/relay/common"
+	"one-api/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// supportsResponsesFormat 渠道是否原生支持 Responses API，其余渠道由网关基于对话补全模拟
+func supportsResponsesFormat(info *relaycommon.RelayInfo) bool {
+	switch info.ChannelType {
+	case common.ChannelTypeOpenAI, common.ChannelTypeAzure, common.ChannelTypeCustomPass:
+		return true
+	}
+	return false
+}
+
+// responsesEmulation 模拟 Responses API 时的请求状态
+type responsesEmulation struct {
+	request       *dto.OpenAIResponsesRequest
+	openAIRequest *dto.GeneralOpenAIRequest
+	// input 本次请求新增的消息，与输出一起保存用于续接对话
+	input []dto.Message
+	store bool
+}
+
+// getResponsesEmulation 判断是否需要模拟 Responses API，不需要时返回 nil。
+// previous_response_id 指向网关保存的响应时，即使渠道原生支持也需要模拟，因为上游并不知道该响应。
+// 请求本身有误时返回 400，读取已保存响应失败时返回 500
+func getResponsesEmulation(c *gin.Context, info *relaycommon.RelayInfo, request *dto.OpenAIResponsesRequest) (*responsesEmulation, *dto.OpenAIErrorWithStatusCode) {
+	var history []dto.Message
+	if request.PreviousResponseID != "" {
+		chain, err := model.GetUserResponseChain(info.UserId, request.PreviousResponseID)
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, service.OpenAIErrorWrapperLocal(err, "get_previous_response_failed", http.StatusInternalServerError)
+			}
+			if !supportsResponsesFormat(info) {
+				return nil, service.OpenAIErrorWrapperLocal(fmt.Errorf("previous response not found: %s", request.PreviousResponseID), "invalid_responses_request", http.StatusBadRequest)
+			}
+			// 由原生渠道生成的响应，交给上游处理
+			return nil, nil
+		}
+		for _, response := range chain {
+			for _, data := range []string{response.Input, response.Output} {
+				var messages []dto.Message
+				if data == "" {
+					continue
+				}
+				if err = json.Unmarshal([]byte(data), &messages); err != nil {
+					return nil, service.OpenAIErrorWrapperLocal(err, "get_previous_response_failed", http.StatusInternalServerError)
+				}
+				history = append(history, messages...)
+			}
+		}
+	} else if supportsResponsesFormat(info) {
+		return nil, nil
+	}
+
+	openAIRequest, input, err := service.ResponsesRequestToOpenAIRequest(request, history)
+	if err != nil {
+		return nil, service.OpenAIErrorWrapperLocal(err, "invalid_responses_request", http.StatusBadRequest)
+	}
+	openAIRequest.Model = info.UpstreamModelName
+	// store 默认为 true，需要区分未设置与显式设置为 false
+	var storeOption struct {
+		Store *bool `json:"store"`
+	}
+	_ = common.UnmarshalBodyReusable(c, &storeOption)
+	store := storeOption.Store == nil || *storeOption.Store
+	request.Store = store
+	return &responsesEmulation{
+		request:       request,
+		openAIRequest: openAIRequest,
+		input:         input,
+		store:         store,
+	}, nil
+}
+
+// responsesBridgeWriter 将适配器输出的对话补全响应转换为 Responses API 格式
+type responsesBridgeWriter struct {
+	*openAIBridgeWriter
+	emulation *responsesEmulation
+	converter *service.ResponsesStreamConverter
+	started   bool
+}
+
+func startResponsesBridge(c *gin.Context, info *relaycommon.RelayInfo, emulation *responsesEmulation) *responsesBridgeWriter {
+	response := service.NewResponsesResponse(service.GenerateResponsesId("resp"), emulation.request, "in_progress")
+	response.Model = info.OriginModelName
+	writer := &responsesBridgeWriter{
+		openAIBridgeWriter: newOpenAIBridgeWriter(c, info.IsStream),
+		emulation:          emulation,
+		converter:          service.NewResponsesStreamConverter(response),
+	}
+	writer.onStreamData = writer.handleStreamData
+	// 需要拦截 Write 以输出起始事件
+	c.Writer = writer
+	return writer
+}
+
+func (w *responsesBridgeWriter) handleStreamData(data string) {
+	var streamResponse dto.ChatCompletionsStreamResponse
+	if err := json.Unmarshal(common.StringToByteSlice(data), &streamResponse); err != nil {
+		common.SysError("error unmarshalling bridged stream response: " + err.Error())
+		return
+	}
+	w.writeEvents(w.converter.Convert(&streamResponse))
+}
+
+func (w *responsesBridgeWriter) writeEvents(events []dto.ResponsesStreamResponse) {
+	for _, event := range events {
+		jsonData, err := json.Marshal(event)
+		if err != nil {
+			common.SysError("error marshalling responses stream event: " + err.Error())
+			continue
+		}
+		_, _ = fmt.Fprintf(w.ResponseWriter, "event: %s\ndata: %s\n\n", event.Type, jsonData)
+	}
+	if len(events) > 0 {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// start 流式响应在第一次输出前先输出 response.created 等起始事件
+func (w *responsesBridgeWriter) start() {
+	if !w.started {
+		w.started = true
+		w.writeEvents(w.converter.Start())
+	}
+}
+
+func (w *responsesBridgeWriter) Write(data []byte) (int, error) {
+	if w.stream {
+		w.start()
+	}
+	return w.openAIBridgeWriter.Write(data)
+}
+
+func (w *responsesBridgeWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// finish 恢复原始的 ResponseWriter，输出剩余的 Responses API 响应并保存响应
+func (w *responsesBridgeWriter) finish(c *gin.Context, info *relaycommon.RelayInfo, usage any, openaiErr *dto.OpenAIErrorWithStatusCode) {
+	w.restore(c)
+	if openaiErr != nil {
+		return
+	}
+	finalUsage, _ := usage.(*dto.Usage)
+	response := w.converter.Response
+	if w.stream {
+		w.start()
+		w.writeEvents(w.converter.Finish(finalUsage))
+	} else {
+		body := w.buffer.Bytes()
+		var openAIResponse dto.OpenAITextResponse
+		if w.status != http.StatusOK || json.Unmarshal(body, &openAIResponse) != nil {
+			w.writeBody("", body)
+			return
+		}
+		if finalUsage == nil {
+			finalUsage = &openAIResponse.Usage
+		}
+		response.Status = "completed"
+		response.Output = service.ResponseOpenAI2ResponsesOutput(&openAIResponse)
+		if len(openAIResponse.Choices) > 0 && openAIResponse.Choices[0].FinishReason == "length" {
+			response.Status = "incomplete"
+			response.IncompleteDetails = &dto.IncompleteDetails{Reasoning: "max_output_tokens"}
+		}
+		service.SetResponsesUsage(response, finalUsage)
+		responseBody, err := json.Marshal(response)
+		if err != nil {
+			w.writeBody("", body)
+			return
+		}
+		w.writeBody("application/json", responseBody)
+	}
+	if w.emulation.store {
+		saveEmulatedResponse(c, info, w.emulation, response)
+	}
+}
+
+func saveEmulatedResponse(c *gin.Context, info *relaycommon.RelayInfo, emulation *responsesEmulation, response *dto.OpenAIResponsesResponse) {
+	input, err := json.Marshal(emulation.input)
+	if err != nil {
+		common.LogError(c, "marshal responses input failed: "+err.Error())
+		return
+	}
+	output, err := json.Marshal(service.ResponsesOutput2Messages(response.Output))
+	if err != nil {
+		common.LogError(c, "marshal responses output failed: "+err.Error())
+		return
+	}
+	body, err := json.Marshal(response)
+	if err != nil {
+		common.LogError(c, "marshal responses body failed: "+err.Error())
+		return
+	}
+	record := &model.Response{
+		Id:                 response.ID,
+		UserId:             info.UserId,
+		TokenId:            info.TokenId,
+		Model:              response.Model,
+		PreviousResponseId: response.PreviousResponseID,
+		Input:              string(input),
+		Output:             string(output),
+		Body:               string(body),
+		CreatedAt:          int64(response.CreatedAt),
+	}
+	if err = record.Insert(); err != nil {
+		common.LogError(c, "save emulated response failed: "+err.Error())
+	}
+}
@@ -68,9 +68,22 @@ func ResponsesHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode)
 		return service.OpenAIErrorWrapperLocal(err, "model_mapped_error", http.StatusBadRequest)
 	}
 
+	emulation, openaiErr := getResponsesEmulation(c, relayInfo, req)
+	if openaiErr != nil {
+		return openaiErr
+	}
+
 	if value, exists := c.Get("prompt_tokens"); exists {
 		promptTokens := value.(int)
 		relayInfo.SetPromptTokens(promptTokens)
+	} else if emulation != nil {
+		// 模拟时按包含历史消息在内的完整对话计算
+		promptTokens, err := service.CountTokenChatRequest(relayInfo, *emulation.openAIRequest)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "count_token_messages_failed", http.StatusInternalServerError)
+		}
+		relayInfo.PromptTokens = promptTokens
+		c.Set("prompt_tokens", promptTokens)
 	} else {
 		promptTokens := getInputTokens(req, relayInfo)
 		c.Set("prompt_tokens", promptTokens)
@@ -94,16 +107,30 @@ func ResponsesHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode)
 	if adaptor == nil {
 		return service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
 	}
+	if emulation != nil {
+		prepareOpenAIChatBridge(relayInfo)
+		relayInfo.SupportStreamOptions = relaycommon.IsStreamOptionsSupported(relayInfo.ChannelType)
+	}
 	adaptor.Init(relayInfo)
 	var requestBody io.Reader
-	if model_setting.GetGlobalSettings().PassThroughRequestEnabled {
+	if model_setting.GetGlobalSettings().PassThroughRequestEnabled && emulation == nil {
 		body, err := common.GetRequestBody(c)
 		if err != nil {
 			return service.OpenAIErrorWrapperLocal(err, "get_request_body_error", http.StatusInternalServerError)
 		}
 		requestBody = bytes.NewBuffer(body)
 	} else {
-		convertedRequest, err := adaptor.ConvertOpenAIResponsesRequest(c, relayInfo, *req)
+		var convertedRequest any
+		if emulation != nil {
+			if relayInfo.SupportStreamOptions && emulation.openAIRequest.Stream {
+				emulation.openAIRequest.StreamOptions = &dto.StreamOptions{
+					IncludeUsage: true,
+				}
+			}
+			convertedRequest, err = adaptor.ConvertOpenAIRequest(c, relayInfo, emulation.openAIRequest)
+		} else {
+			convertedRequest, err = adaptor.ConvertOpenAIResponsesRequest(c, relayInfo, *req)
+		}
 		if err != nil {
 			return service.OpenAIErrorWrapperLocal(err, "convert_request_error", http.StatusBadRequest)
 		}
@@ -152,7 +179,14 @@ func ResponsesHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode)
 		}
 	}
 
+	var bridgeWriter *responsesBridgeWriter
+	if emulation != nil {
+		bridgeWriter = startResponsesBridge(c, relayInfo, emulation)
+	}
 	usage, openaiErr := adaptor.DoResponse(c, httpResp, relayInfo)
+	if bridgeWriter != nil {
+		bridgeWriter.finish(c, relayInfo, usage, openaiErr)
+	}
 	if openaiErr != nil {
 		// reset status code 重置状态码
 		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
@@ -0,0 +1,199 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/middleware"
+	"one-api/model"
+	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
+	"one-api/service"
+	"one-api/setting/operation_setting"
+	"strings"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// semanticCacheQuery scope 为去掉最后一条用户消息后的请求生成的缓存键，只有上下文完全一致的请求才会比较向量。
+// 相同上下文没有缓存条目时不计算向量，vector 为 nil，响应写入缓存时再在后台计算
+type semanticCacheQuery struct {
+	scope  string
+	text   string
+	vector []float64
+}
+
+// getSemanticCacheQuery 判断请求是否可以使用语义缓存，不可以时返回 nil。
+// 与响应缓存一致，仅缓存显式设置 temperature 为 0 的请求；最后一条用户消息包含图片等非文本内容或携带工具定义时也不使用语义缓存
+func getSemanticCacheQuery(c *gin.Context, info *relaycommon.RelayInfo, textRequest *dto.GeneralOpenAIRequest) *semanticCacheQuery {
+	if info.RelayMode != relayconstant.RelayModeChatCompletions || !operation_setting.IsSemanticCacheEnabled(info.OriginModelName, info.Group) {
+		return nil
+	}
+	if textRequest.Temperature == nil || *textRequest.Temperature != 0 || len(textRequest.Tools) > 0 || len(textRequest.Functions) > 0 {
+		return nil
+	}
+	if operation_setting.GetSemanticCacheSetting().TokenOptIn && !c.GetBool("token_semantic_cache") {
+		return nil
+	}
+	// embedding 调用按令牌计费，令牌无权使用 embedding 模型时不使用语义缓存
+	if !middleware.IsTokenModelAllowed(c, operation_setting.GetSemanticCacheSetting().EmbeddingModel) {
+		return nil
+	}
+	cacheControl := c.Request.Header.Get("Cache-Control")
+	if strings.Contains(cacheControl, "no-cache") || strings.Contains(cacheControl, "no-store") {
+		return nil
+	}
+	lastUser := -1
+	for i := len(textRequest.Messages) - 1; i >= 0; i-- {
+		if textRequest.Messages[i].Role == "user" {
+			lastUser = i
+			break
+		}
+	}
+	if lastUser == -1 {
+		return nil
+	}
+	message := textRequest.Messages[lastUser]
+	if !message.IsStringContent() {
+		for _, content := range message.ParseContent() {
+			if content.Type != dto.ContentTypeText {
+				return nil
+			}
+		}
+	}
+	text := message.StringContent()
+	if text == "" {
+		return nil
+	}
+
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return nil
+	}
+	var request map[string]interface{}
+	if err = json.Unmarshal(body, &request); err != nil {
+		return nil
+	}
+	messages, ok := request["messages"].([]interface{})
+	if !ok || len(messages) != len(textRequest.Messages) {
+		return nil
+	}
+	request["messages"] = append(messages[:lastUser:lastUser], messages[lastUser+1:]...)
+	scopeBody, err := json.Marshal(request)
+	if err != nil {
+		return nil
+	}
+	scope, err := service.ResponseCacheKey(info.Group, info.OriginModelName, scopeBody)
+	if err != nil {
+		return nil
+	}
+
+	query := &semanticCacheQuery{scope: scope, text: text}
+	if !service.HasSemanticCache(scope) {
+		return query
+	}
+	vector, err := embedSemanticCacheText(c, text)
+	if err != nil {
+		common.LogWarn(c, "semantic cache embedding failed: "+err.Error())
+		return nil
+	}
+	query.vector = vector
+	return query
+}
+
+// embedSemanticCacheText 通过 embedding 渠道计算文本向量，请求走正常的 EmbeddingHelper 流程并按 embedding 模型计费，
+// 相同文本的向量在缓存有效期内复用
+func embedSemanticCacheText(c *gin.Context, text string) ([]float64, error) {
+	embeddingModel := operation_setting.GetSemanticCacheSetting().EmbeddingModel
+	hash := sha256.Sum256([]byte(embeddingModel + "\x00" + text))
+	embeddingKey := hex.EncodeToString(hash[:])
+	if vector := service.GetSemanticCacheEmbedding(embeddingKey); vector != nil {
+		return vector, nil
+	}
+	body, err := json.Marshal(dto.EmbeddingRequest{Model: embeddingModel, Input: text})
+	if err != nil {
+		return nil, err
+	}
+	recorder := httptest.NewRecorder()
+	ec, _ := gin.CreateTestContext(recorder)
+	ec.Request, err = http.NewRequestWithContext(c.Request.Context(), http.MethodPost, "/v1/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	ec.Request.Header.Set("Content-Type", "application/json")
+	ec.Keys = c.Copy().Keys
+	for _, key := range []string{common.KeyRequestBody, "prompt_tokens", "specific_channel_id", constant.ContextKeyRelayInfo,
+		constant.ContextKeyFallbackFrom, constant.ContextKeyHedgeInfo, constant.ContextKeyUpstreamContext} {
+		delete(ec.Keys, key)
+	}
+
+	channel, _, err := model.CacheGetRandomSatisfiedChannel(ec, c.GetString("group"), embeddingModel, 0)
+	if err != nil {
+		return nil, err
+	}
+	if channel == nil {
+		return nil, fmt.Errorf("no available channel for model %s", embeddingModel)
+	}
+	if err = middleware.SetupContextForSelectedChannel(ec, channel, embeddingModel); err != nil {
+		return nil, err
+	}
+	ec.Set("use_channel", []string{fmt.Sprintf("%d", channel.Id)})
+	if openaiErr := EmbeddingHelper(ec); openaiErr != nil {
+		return nil, errors.New(openaiErr.Error.Message)
+	}
+	var response dto.OpenAIEmbeddingResponse
+	if err = json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		return nil, err
+	}
+	if len(response.Data) == 0 || len(response.Data[0].Embedding) == 0 {
+		return nil, errors.New("empty embedding response")
+	}
+	service.SetSemanticCacheEmbedding(embeddingKey, response.Data[0].Embedding)
+	return response.Data[0].Embedding, nil
+}
+
+// addSemanticCache 将响应写入语义缓存，查找时未计算向量的请求在后台计算后写入，不增加响应延迟
+func addSemanticCache(c *gin.Context, query *semanticCacheQuery, entry *service.ResponseCacheEntry) {
+	if query.vector != nil {
+		service.AddSemanticCache(query.scope, query.vector, entry)
+		return
+	}
+	ec := c.Copy()
+	ec.Request = ec.Request.WithContext(context.WithoutCancel(c.Request.Context()))
+	gopool.Go(func() {
+		vector, err := embedSemanticCacheText(ec, query.text)
+		if err != nil {
+			common.LogWarn(ec, "semantic cache embedding failed: "+err.Error())
+			return
+		}
+		service.AddSemanticCache(query.scope, vector, entry)
+	})
+}
+
+// tryServeSemanticCache 命中语义缓存时直接回放响应并返回用量，未命中返回 nil
+func tryServeSemanticCache(c *gin.Context, info *relaycommon.RelayInfo, query *semanticCacheQuery) *dto.Usage {
+	if query == nil || query.vector == nil {
+		return nil
+	}
+	threshold := operation_setting.GetSemanticCacheThreshold(info.OriginModelName)
+	entry, similarity := service.GetSemanticCache(query.scope, query.vector, threshold)
+	if entry == nil || entry.IsStream != info.IsStream {
+		return nil
+	}
+	common.LogInfo(c, fmt.Sprintf("semantic cache hit, similarity %.4f", similarity))
+	return serveResponseCache(c, info, entry, &service.ResponseCacheHit{
+		Type:         service.ResponseCacheTypeSemantic,
+		BillingRatio: operation_setting.GetSemanticCacheSetting().BillingRatio,
+		Similarity:   similarity,
+	})
+}
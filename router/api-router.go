@@ -97,6 +97,7 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.GET("/search", controller.SearchChannels)
 			channelRoute.GET("/models", controller.ChannelListModels)
 			channelRoute.GET("/models_enabled", controller.EnabledListModels)
+			channelRoute.GET("/health", controller.GetChannelHealth)
 			channelRoute.GET("/:id", controller.GetChannel)
 			channelRoute.GET("/test", controller.TestAllChannels)
 			channelRoute.GET("/test/:id", controller.TestChannel)
@@ -115,6 +116,11 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.POST("/fetch_models", controller.FetchModels)
 			channelRoute.POST("/batch/tag", controller.BatchSetChannelTag)
 			channelRoute.GET("/tag/models", controller.GetTagModels)
+			channelRoute.GET("/:id/keys", controller.GetChannelKeys)
+			channelRoute.POST("/:id/keys", controller.AddChannelKeys)
+			channelRoute.DELETE("/:id/keys/:key_id", controller.DeleteChannelKey)
+			channelRoute.POST("/:id/keys/:key_id/enable", controller.EnableChannelKey)
+			channelRoute.POST("/:id/keys/:key_id/disable", controller.DisableChannelKey)
 		}
 		tokenRoute := apiRouter.Group("/token")
 		tokenRoute.Use(middleware.UserAuth())
@@ -145,6 +151,7 @@ func SetApiRouter(router *gin.Engine) {
 		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
+		logRoute.GET("/body/:request_id", middleware.AdminAuth(), controller.GetBodyLog)
 
 		dataRoute := apiRouter.Group("/data")
 		dataRoute.GET("/", middleware.AdminAuth(), controller.GetAllQuotaDates)
@@ -168,6 +175,9 @@ func SetApiRouter(router *gin.Engine) {
 		{
 			taskRoute.GET("/self", middleware.UserAuth(), controller.GetUserTask)
 			taskRoute.GET("/", middleware.AdminAuth(), controller.GetAllTask)
+			taskRoute.GET("/webhook/self", middleware.UserAuth(), controller.GetUserTaskWebhooks)
+			taskRoute.GET("/webhook", middleware.AdminAuth(), controller.GetAllTaskWebhooks)
+			taskRoute.POST("/webhook/:id/retry", middleware.AdminAuth(), controller.RetryTaskWebhook)
 		}
 	}
 }
@@ -6,11 +6,21 @@ import (
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"one-api/common"
+	"one-api/controller"
+	"one-api/middleware"
 	"os"
 	"strings"
 )
 
 func SetRouter(router *gin.Engine, buildFS embed.FS, indexPage []byte) {
+	if common.MetricsEnabled {
+		if common.MetricsToken != "" {
+			router.GET("/metrics", controller.GetMetrics)
+		} else {
+			// 未配置 METRICS_TOKEN 时仅管理员可访问
+			router.GET("/metrics", middleware.AdminAuth(), controller.GetMetrics)
+		}
+	}
 	SetApiRouter(router)
 	SetDashboardRouter(router)
 	SetRelayRouter(router)
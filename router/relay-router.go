@@ -12,6 +12,9 @@ func SetRelayRouter(router *gin.Engine) {
 	router.Use(middleware.CORS())
 	router.Use(middleware.DecompressRequestMiddleware())
 	router.Use(middleware.StatsMiddleware())
+	router.Use(middleware.Tracing())
+	router.Use(middleware.BodyLog())
+	router.Use(middleware.RelayMetrics())
 	// https://platform.openai.com/docs/api-reference/introduction
 	modelsRouter := router.Group("/v1/models")
 	modelsRouter.Use(middleware.TokenAuth())
@@ -19,6 +22,8 @@ func SetRelayRouter(router *gin.Engine) {
 		modelsRouter.GET("", controller.ListModels)
 		modelsRouter.GET("/:model", controller.RetrieveModel)
 	}
+	// 媒体存储中的生成结果，通过签名校验访问权限
+	router.GET("/v1/media/:key", controller.GetMediaObject)
 	playgroundRouter := router.Group("/pg")
 	playgroundRouter.Use(middleware.UserAuth())
 	{
@@ -33,6 +38,21 @@ func SetRelayRouter(router *gin.Engine) {
 		wsRouter.Use(middleware.Distribute())
 		wsRouter.GET("/realtime", controller.WssRelay)
 	}
+	{
+		// Files / Batch API 与 Responses 查询接口，不需要选择渠道，批处理中的每个请求会单独选择渠道
+		batchRouter := relayV1Router.Group("")
+		batchRouter.GET("/files", controller.ListFiles)
+		batchRouter.POST("/files", controller.UploadFile)
+		batchRouter.DELETE("/files/:id", controller.DeleteFile)
+		batchRouter.GET("/files/:id", controller.RetrieveFile)
+		batchRouter.GET("/files/:id/content", controller.RetrieveFileContent)
+		batchRouter.POST("/batches", controller.CreateBatch)
+		batchRouter.GET("/batches", controller.ListBatches)
+		batchRouter.GET("/batches/:id", controller.RetrieveBatch)
+		batchRouter.POST("/batches/:id/cancel", controller.CancelBatch)
+		batchRouter.GET("/responses/:id", controller.RetrieveResponse)
+		batchRouter.DELETE("/responses/:id", controller.DeleteResponse)
+	}
 	{
 		//http router
 		httpRouter := relayV1Router.Group("")
@@ -50,11 +70,6 @@ func SetRelayRouter(router *gin.Engine) {
 		httpRouter.POST("/audio/translations", controller.Relay)
 		httpRouter.POST("/audio/speech", controller.Relay)
 		httpRouter.POST("/responses", controller.Relay)
-		httpRouter.GET("/files", controller.RelayNotImplemented)
-		httpRouter.POST("/files", controller.RelayNotImplemented)
-		httpRouter.DELETE("/files/:id", controller.RelayNotImplemented)
-		httpRouter.GET("/files/:id", controller.RelayNotImplemented)
-		httpRouter.GET("/files/:id/content", controller.RelayNotImplemented)
 		httpRouter.POST("/fine-tunes", controller.RelayNotImplemented)
 		httpRouter.GET("/fine-tunes", controller.RelayNotImplemented)
 		httpRouter.GET("/fine-tunes/:id", controller.RelayNotImplemented)
@@ -78,6 +93,17 @@ func SetRelayRouter(router *gin.Engine) {
 		relaySunoRouter.POST("/submit/:action", controller.RelayTask)
 		relaySunoRouter.POST("/fetch", controller.RelayTask)
 		relaySunoRouter.GET("/fetch/:id", controller.RelayTask)
+		relaySunoRouter.POST("/cancel/:id", controller.RelayTask)
+	}
+
+	// 声明式任务渠道路由
+	relayTaskRouter := router.Group("/v1/tasks")
+	relayTaskRouter.Use(middleware.TokenAuth(), middleware.Distribute())
+	{
+		relayTaskRouter.POST("/submit/:action", controller.RelayTask)
+		relayTaskRouter.GET("/fetch/:id", controller.RelayTask)
+		// 取消任意平台的异步任务
+		relayTaskRouter.POST("/cancel/:id", controller.RelayTask)
 	}
 
 	relayGeminiRouter := router.Group("/v1beta")
@@ -13,5 +13,13 @@ func SetVideoRouter(router *gin.Engine) {
 	{
 		videoV1Router.POST("/video/generations", controller.RelayTask)
 		videoV1Router.GET("/video/generations/:task_id", controller.RelayTask)
+		videoV1Router.POST("/video/generations/:task_id/cancel", controller.RelayTask)
+
+		// 与供应商无关的视频接口，按模型路由到对应渠道的任务适配器
+		videoV1Router.POST("/videos", controller.RelayTask)
+		videoV1Router.GET("/videos", controller.RelayTask)
+		videoV1Router.GET("/videos/:id", controller.RelayTask)
+		videoV1Router.GET("/videos/:id/content", controller.RelayTask)
+		videoV1Router.POST("/videos/:id/cancel", controller.RelayTask)
 	}
 }
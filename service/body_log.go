@@ -0,0 +1,216 @@
+package service
+
+import (
+	"fmt"
+	"one-api/common"
+	"one-api/model"
+	"one-api/setting/operation_setting"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const bodyLogRedacted = "[REDACTED]"
+
+type bodyLogRedactor struct {
+	fingerprint string
+	fields      *regexp.Regexp
+	rules       []*regexp.Regexp
+	replaces    []string
+	luhn        []bool
+}
+
+var (
+	bodyLogRedactorLock sync.Mutex
+	bodyLogRedactorSave *bodyLogRedactor
+)
+
+// getBodyLogRedactor 返回按当前配置编译的脱敏规则，配置未变化时复用上次的编译结果
+func getBodyLogRedactor(setting *operation_setting.BodyLogSetting) *bodyLogRedactor {
+	fingerprintBytes, _ := common.EncodeJson([]any{setting.RedactFields, setting.RedactRules})
+	fingerprint := string(fingerprintBytes)
+	bodyLogRedactorLock.Lock()
+	defer bodyLogRedactorLock.Unlock()
+	if bodyLogRedactorSave != nil && bodyLogRedactorSave.fingerprint == fingerprint {
+		return bodyLogRedactorSave
+	}
+	redactor := &bodyLogRedactor{fingerprint: fingerprint}
+	if len(setting.RedactFields) > 0 {
+		fields := make([]string, 0, len(setting.RedactFields))
+		for _, field := range setting.RedactFields {
+			fields = append(fields, regexp.QuoteMeta(field))
+		}
+		redactor.fields = regexp.MustCompile(`("(?:` + strings.Join(fields, "|") + `)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	}
+	for _, rule := range setting.RedactRules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			common.SysError(fmt.Sprintf("invalid body log redact rule %s: %s", rule.Name, err.Error()))
+			continue
+		}
+		redactor.rules = append(redactor.rules, re)
+		redactor.replaces = append(redactor.replaces, rule.Replacement)
+		redactor.luhn = append(redactor.luhn, rule.Luhn)
+	}
+	bodyLogRedactorSave = redactor
+	return redactor
+}
+
+func (r *bodyLogRedactor) redact(body string) string {
+	if r.fields != nil {
+		body = r.fields.ReplaceAllString(body, `${1}"`+bodyLogRedacted+`"`)
+	}
+	for i, re := range r.rules {
+		if !r.luhn[i] {
+			body = re.ReplaceAllLiteralString(body, r.replaces[i])
+			continue
+		}
+		replacement := r.replaces[i]
+		body = re.ReplaceAllStringFunc(body, func(match string) string {
+			if luhnValid(match) {
+				return replacement
+			}
+			return match
+		})
+	}
+	return body
+}
+
+// luhnValid 对匹配内容中的数字做 Luhn 校验，忽略空格与连字符
+func luhnValid(s string) bool {
+	sum := 0
+	digits := 0
+	for i := len(s) - 1; i >= 0; i-- {
+		ch := s[i]
+		if ch < '0' || ch > '9' {
+			continue
+		}
+		d := int(ch - '0')
+		if digits%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+	return digits > 0 && sum%10 == 0
+}
+
+// isTextBody 判断内容是否为可记录的文本，音频、图片等二进制内容只记录类型和大小
+func isTextBody(contentType string, body []byte) bool {
+	if contentType == "" {
+		return utf8.Valid(body)
+	}
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	return strings.HasPrefix(mediaType, "text/") || strings.Contains(mediaType, "json")
+}
+
+// prepareBodyLogContent 截断、脱敏并按需加密待记录的内容
+func prepareBodyLogContent(setting *operation_setting.BodyLogSetting, redactor *bodyLogRedactor, contentType string, body []byte, size int) (string, bool, error) {
+	truncated := size > len(body)
+	if setting.MaxBodyBytes > 0 && len(body) > setting.MaxBodyBytes {
+		// 在字符边界处截断
+		cut := setting.MaxBodyBytes
+		for cut > 0 && !utf8.RuneStart(body[cut]) {
+			cut--
+		}
+		body = body[:cut]
+		truncated = true
+	}
+	var content string
+	if isTextBody(contentType, body) {
+		content = redactor.redact(strings.ToValidUTF8(string(body), ""))
+	} else {
+		content = fmt.Sprintf("[%s body, %d bytes]", contentType, size)
+	}
+	if !setting.Encrypt || content == "" {
+		return content, truncated, nil
+	}
+	encrypted, err := common.EncryptWithSecret(common.BodyLogSecret, []byte(content))
+	return encrypted, truncated, err
+}
+
+// BodyLogCapture 一次请求捕获到的原始内容，Size 为实际大小，可能大于已捕获的部分
+type BodyLogCapture struct {
+	RequestId           string
+	UserId              int
+	TokenId             int
+	Group               string
+	ModelName           string
+	Path                string
+	StatusCode          int
+	RequestContentType  string
+	RequestBody         []byte
+	RequestSize         int
+	ResponseContentType string
+	ResponseBody        []byte
+	ResponseSize        int
+}
+
+// SaveBodyLog 异步脱敏并保存请求与响应内容
+func SaveBodyLog(capture *BodyLogCapture) {
+	gopool.Go(func() {
+		setting := operation_setting.GetBodyLogSetting()
+		redactor := getBodyLogRedactor(setting)
+		requestBody, requestTruncated, err := prepareBodyLogContent(setting, redactor, capture.RequestContentType, capture.RequestBody, capture.RequestSize)
+		if err != nil {
+			common.SysError("failed to prepare request body log: " + err.Error())
+			return
+		}
+		responseBody, responseTruncated, err := prepareBodyLogContent(setting, redactor, capture.ResponseContentType, capture.ResponseBody, capture.ResponseSize)
+		if err != nil {
+			common.SysError("failed to prepare response body log: " + err.Error())
+			return
+		}
+		bodyLog := &model.BodyLog{
+			RequestId:         capture.RequestId,
+			UserId:            capture.UserId,
+			TokenId:           capture.TokenId,
+			Group:             capture.Group,
+			ModelName:         capture.ModelName,
+			Path:              capture.Path,
+			StatusCode:        capture.StatusCode,
+			RequestBody:       requestBody,
+			ResponseBody:      responseBody,
+			RequestTruncated:  requestTruncated,
+			ResponseTruncated: responseTruncated,
+			Encrypted:         setting.Encrypt,
+		}
+		if err = bodyLog.Insert(); err != nil {
+			common.SysError("failed to save body log: " + err.Error())
+		}
+	})
+}
+
+// DecryptBodyLog 解密内容记录，用于管理员查看
+func DecryptBodyLog(bodyLog *model.BodyLog) error {
+	if !bodyLog.Encrypted {
+		return nil
+	}
+	for _, field := range []*string{&bodyLog.RequestBody, &bodyLog.ResponseBody} {
+		if *field == "" {
+			continue
+		}
+		plaintext, err := common.DecryptWithSecret(common.BodyLogSecret, *field)
+		if err != nil {
+			return fmt.Errorf("decrypt body log failed: %w", err)
+		}
+		*field = string(plaintext)
+	}
+	bodyLog.Encrypted = false
+	return nil
+}
+
+// CleanExpiredBodyLogs 删除超过保留天数的内容记录，返回清理的数量
+func CleanExpiredBodyLogs() (int64, error) {
+	retentionDays := operation_setting.GetBodyLogSetting().RetentionDays
+	if retentionDays <= 0 {
+		return 0, nil
+	}
+	return model.DeleteBodyLogsBefore(common.GetTimestamp()-int64(retentionDays)*86400, 1000)
+}
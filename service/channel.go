@@ -33,6 +33,49 @@ func EnableChannel(channelId int, channelName string) {
 	}
 }
 
+// DisableChannelKey 禁用多密钥渠道中的单个密钥，所有密钥均被禁用时禁用整个渠道
+func DisableChannelKey(channelId int, channelKeyId int, channelName string, reason string) {
+	success := model.UpdateChannelKeyStatusById(channelId, channelKeyId, common.ChannelStatusAutoDisabled, reason)
+	if !success {
+		return
+	}
+	subject := fmt.Sprintf("通道「%s」（#%d）的密钥 #%d 已被禁用", channelName, channelId, channelKeyId)
+	content := fmt.Sprintf("通道「%s」（#%d）的密钥 #%d 已被禁用，原因：%s", channelName, channelId, channelKeyId, reason)
+	NotifyRootUser(fmt.Sprintf("%s_key_%d", formatNotifyType(channelId, common.ChannelStatusAutoDisabled), channelKeyId), subject, content)
+	disableChannelIfNoKeyEnabled(channelId, channelName, reason)
+}
+
+// ManuallyDisableChannelKey 手动禁用单个密钥，与自动禁用一样在所有密钥均被禁用时禁用整个渠道
+func ManuallyDisableChannelKey(channelId int, channelKeyId int, channelName string) bool {
+	reason := "手动禁用"
+	success := model.UpdateChannelKeyStatusById(channelId, channelKeyId, common.ChannelStatusManuallyDisabled, reason)
+	if !success {
+		return false
+	}
+	disableChannelIfNoKeyEnabled(channelId, channelName, reason)
+	return true
+}
+
+func disableChannelIfNoKeyEnabled(channelId int, channelName string, reason string) {
+	count, err := model.CountEnabledChannelKeys(channelId)
+	if err == nil && count == 0 {
+		DisableChannel(channelId, channelName, "所有密钥均已被禁用，最后一个密钥的禁用原因："+reason)
+	}
+}
+
+// EnableChannelKey 启用单个密钥，渠道因密钥全部失效被自动禁用时一并启用
+func EnableChannelKey(channelId int, channelKeyId int, channelName string) bool {
+	success := model.UpdateChannelKeyStatusById(channelId, channelKeyId, common.ChannelStatusEnabled, "")
+	if !success {
+		return false
+	}
+	channel, err := model.GetChannelById(channelId, false)
+	if err == nil && channel.Status == common.ChannelStatusAutoDisabled {
+		EnableChannel(channelId, channelName)
+	}
+	return true
+}
+
 func ShouldDisableChannel(channelType int, err *dto.OpenAIErrorWithStatusCode) bool {
 	if !common.AutomaticDisableChannelEnabled {
 		return false
@@ -62,6 +62,9 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 		openAITools = append(openAITools, openAITool)
 	}
 	openAIRequest.Tools = openAITools
+	if len(openAITools) > 0 {
+		openAIRequest.ToolChoice = claudeToolChoice2OpenAI(claudeRequest.ToolChoice)
+	}
 
 	// Convert messages
 	openAIMessages := make([]dto.Message, 0)
@@ -187,6 +190,30 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 	return &openAIRequest, nil
 }
 
+// claudeToolChoice2OpenAI 转换 tool_choice：auto、any、none 与指定工具
+func claudeToolChoice2OpenAI(toolChoice any) any {
+	choice, ok := toolChoice.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	switch choice["type"] {
+	case "auto":
+		return "auto"
+	case "any":
+		return "required"
+	case "none":
+		return "none"
+	case "tool":
+		return map[string]interface{}{
+			"type": "function",
+			"function": map[string]interface{}{
+				"name": choice["name"],
+			},
+		}
+	}
+	return nil
+}
+
 func OpenAIErrorToClaudeError(openAIError *dto.OpenAIErrorWithStatusCode) *dto.ClaudeErrorWithStatusCode {
 	claudeError := dto.ClaudeError{
 		Type:    "new_api_error",
@@ -234,146 +261,116 @@ func StreamResponseOpenAI2Claude(openAIResponse *dto.ChatCompletionsStreamRespon
 			Type:    "message_start",
 			Message: msg,
 		})
-		claudeResponses = append(claudeResponses)
-		//claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-		//	Type: "ping",
-		//})
-		if openAIResponse.IsToolCall() {
-			resp := &dto.ClaudeResponse{
-				Type: "content_block_start",
-				ContentBlock: &dto.ClaudeMediaMessage{
-					Id:   openAIResponse.GetFirstToolCall().ID,
-					Type: "tool_use",
-					Name: openAIResponse.GetFirstToolCall().Function.Name,
-				},
-			}
-			resp.SetIndex(0)
-			claudeResponses = append(claudeResponses, resp)
-		} else {
-			//resp := &dto.ClaudeResponse{
-			//	Type: "content_block_start",
-			//	ContentBlock: &dto.ClaudeMediaMessage{
-			//		Type: "text",
-			//		Text: common.GetPointer[string](""),
-			//	},
-			//}
-			//resp.SetIndex(0)
-			//claudeResponses = append(claudeResponses, resp)
-		}
-		return claudeResponses
 	}
 
-	if len(openAIResponse.Choices) == 0 {
-		// no choices
-		// TODO: handle this case
-		return claudeResponses
-	} else {
+	if len(openAIResponse.Choices) > 0 {
 		chosenChoice := openAIResponse.Choices[0]
-		if chosenChoice.FinishReason != nil && *chosenChoice.FinishReason != "" {
-			// should be done
-			info.FinishReason = *chosenChoice.FinishReason
-			return claudeResponses
-		}
-		if info.Done {
-			claudeResponses = append(claudeResponses, generateStopBlock(info.ClaudeConvertInfo.Index))
-			if info.ClaudeConvertInfo.Usage != nil {
-				claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-					Type: "message_delta",
-					Usage: &dto.ClaudeUsage{
-						InputTokens:  info.ClaudeConvertInfo.Usage.PromptTokens,
-						OutputTokens: info.ClaudeConvertInfo.Usage.CompletionTokens,
-					},
-					Delta: &dto.ClaudeMediaMessage{
-						StopReason: common.GetPointer[string](stopReasonOpenAI2Claude(info.FinishReason)),
-					},
-				})
-			}
-			claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-				Type: "message_stop",
-			})
-		} else {
-			var claudeResponse dto.ClaudeResponse
-			var isEmpty bool
-			claudeResponse.Type = "content_block_delta"
-			if len(chosenChoice.Delta.ToolCalls) > 0 {
-				if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeTools {
-					claudeResponses = append(claudeResponses, generateStopBlock(info.ClaudeConvertInfo.Index))
-					info.ClaudeConvertInfo.Index++
+		if len(chosenChoice.Delta.ToolCalls) > 0 {
+			for _, toolCall := range chosenChoice.Delta.ToolCalls {
+				// 新的工具调用 id 开始一个新的 tool_use 块，部分上游会在每个分片中重复相同的 id
+				if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeTools ||
+					(toolCall.ID != "" && toolCall.ID != info.ClaudeConvertInfo.LastToolCallId) {
+					info.ClaudeConvertInfo.LastToolCallId = toolCall.ID
+					claudeResponses = append(claudeResponses, startClaudeContentBlock(info, relaycommon.LastMessageTypeTools, &dto.ClaudeMediaMessage{
+						Id:    toolCall.ID,
+						Type:  "tool_use",
+						Name:  toolCall.Function.Name,
+						Input: map[string]interface{}{},
+					})...)
+				}
+				if toolCall.Function.Arguments != "" {
+					arguments := toolCall.Function.Arguments
 					claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-						Index: &info.ClaudeConvertInfo.Index,
-						Type:  "content_block_start",
-						ContentBlock: &dto.ClaudeMediaMessage{
-							Id:    openAIResponse.GetFirstToolCall().ID,
-							Type:  "tool_use",
-							Name:  openAIResponse.GetFirstToolCall().Function.Name,
-							Input: map[string]interface{}{},
+						Index: common.GetPointer[int](info.ClaudeConvertInfo.Index),
+						Type:  "content_block_delta",
+						Delta: &dto.ClaudeMediaMessage{
+							Type:        "input_json_delta",
+							PartialJson: &arguments,
 						},
 					})
 				}
-				info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeTools
-				// tools delta
-				claudeResponse.Delta = &dto.ClaudeMediaMessage{
-					Type:        "input_json_delta",
-					PartialJson: &chosenChoice.Delta.ToolCalls[0].Function.Arguments,
-				}
-			} else {
-				reasoning := chosenChoice.Delta.GetReasoningContent()
-				textContent := chosenChoice.Delta.GetContentString()
-				if reasoning != "" || textContent != "" {
-					if reasoning != "" {
-						if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeThinking {
-							//info.ClaudeConvertInfo.Index++
-							claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-								Index: &info.ClaudeConvertInfo.Index,
-								Type:  "content_block_start",
-								ContentBlock: &dto.ClaudeMediaMessage{
-									Type:     "thinking",
-									Thinking: "",
-								},
-							})
-						}
-						info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeThinking
-						// text delta
-						claudeResponse.Delta = &dto.ClaudeMediaMessage{
-							Type:     "thinking_delta",
-							Thinking: reasoning,
-						}
-					} else {
-						if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeText {
-							if info.LastMessagesType == relaycommon.LastMessageTypeThinking || info.LastMessagesType == relaycommon.LastMessageTypeTools {
-								claudeResponses = append(claudeResponses, generateStopBlock(info.ClaudeConvertInfo.Index))
-								info.ClaudeConvertInfo.Index++
-							}
-							claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-								Index: &info.ClaudeConvertInfo.Index,
-								Type:  "content_block_start",
-								ContentBlock: &dto.ClaudeMediaMessage{
-									Type: "text",
-									Text: common.GetPointer[string](""),
-								},
-							})
-						}
-						info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeText
-						// text delta
-						claudeResponse.Delta = &dto.ClaudeMediaMessage{
-							Type: "text_delta",
-							Text: common.GetPointer[string](textContent),
-						}
-					}
-				} else {
-					isEmpty = true
+			}
+		} else {
+			if reasoning := chosenChoice.Delta.GetReasoningContent(); reasoning != "" {
+				if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeThinking {
+					claudeResponses = append(claudeResponses, startClaudeContentBlock(info, relaycommon.LastMessageTypeThinking, &dto.ClaudeMediaMessage{
+						Type:     "thinking",
+						Thinking: "",
+					})...)
 				}
+				claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
+					Index: common.GetPointer[int](info.ClaudeConvertInfo.Index),
+					Type:  "content_block_delta",
+					Delta: &dto.ClaudeMediaMessage{
+						Type:     "thinking_delta",
+						Thinking: reasoning,
+					},
+				})
 			}
-			claudeResponse.Index = &info.ClaudeConvertInfo.Index
-			if !isEmpty {
-				claudeResponses = append(claudeResponses, &claudeResponse)
+			if textContent := chosenChoice.Delta.GetContentString(); textContent != "" {
+				if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeText {
+					claudeResponses = append(claudeResponses, startClaudeContentBlock(info, relaycommon.LastMessageTypeText, &dto.ClaudeMediaMessage{
+						Type: "text",
+						Text: common.GetPointer[string](""),
+					})...)
+				}
+				claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
+					Index: common.GetPointer[int](info.ClaudeConvertInfo.Index),
+					Type:  "content_block_delta",
+					Delta: &dto.ClaudeMediaMessage{
+						Type: "text_delta",
+						Text: common.GetPointer[string](textContent),
+					},
+				})
 			}
 		}
+		if chosenChoice.FinishReason != nil && *chosenChoice.FinishReason != "" {
+			info.FinishReason = *chosenChoice.FinishReason
+		}
+	}
+
+	if info.Done {
+		if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeNone {
+			claudeResponses = append(claudeResponses, generateStopBlock(info.ClaudeConvertInfo.Index))
+		}
+		usage := &dto.ClaudeUsage{
+			InputTokens: info.PromptTokens,
+		}
+		if info.ClaudeConvertInfo.Usage != nil {
+			usage.InputTokens = info.ClaudeConvertInfo.Usage.PromptTokens
+			usage.OutputTokens = info.ClaudeConvertInfo.Usage.CompletionTokens
+		}
+		claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
+			Type:  "message_delta",
+			Usage: usage,
+			Delta: &dto.ClaudeMediaMessage{
+				StopReason: common.GetPointer[string](stopReasonOpenAI2Claude(info.FinishReason)),
+			},
+		})
+		claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
+			Type: "message_stop",
+		})
 	}
 
 	return claudeResponses
 }
 
+// startClaudeContentBlock 结束上一个内容块（如果有）并开始新的内容块
+func startClaudeContentBlock(info *relaycommon.RelayInfo, messageType string, block *dto.ClaudeMediaMessage) []*dto.ClaudeResponse {
+	var claudeResponses []*dto.ClaudeResponse
+	if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeNone {
+		claudeResponses = append(claudeResponses, generateStopBlock(info.ClaudeConvertInfo.Index))
+		info.ClaudeConvertInfo.Index++
+	}
+	info.ClaudeConvertInfo.LastMessagesType = messageType
+	claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
+		Index:        common.GetPointer[int](info.ClaudeConvertInfo.Index),
+		Type:         "content_block_start",
+		ContentBlock: block,
+	})
+	return claudeResponses
+}
+
 func ResponseOpenAI2Claude(openAIResponse *dto.OpenAITextResponse, info *relaycommon.RelayInfo) *dto.ClaudeResponse {
 	var stopReason string
 	contents := make([]dto.ClaudeMediaMessage, 0)
@@ -385,22 +382,35 @@ func ResponseOpenAI2Claude(openAIResponse *dto.OpenAITextResponse, info *relayco
 	}
 	for _, choice := range openAIResponse.Choices {
 		stopReason = stopReasonOpenAI2Claude(choice.FinishReason)
-		claudeContent := dto.ClaudeMediaMessage{}
-		if choice.FinishReason == "tool_calls" {
-			claudeContent.Type = "tool_use"
-			claudeContent.Id = choice.Message.ToolCallId
-			claudeContent.Name = choice.Message.ParseToolCalls()[0].Function.Name
+		reasoning := choice.Message.ReasoningContent
+		if reasoning == "" {
+			reasoning = choice.Message.Reasoning
+		}
+		if reasoning != "" {
+			contents = append(contents, dto.ClaudeMediaMessage{
+				Type:     "thinking",
+				Thinking: reasoning,
+			})
+		}
+		if text := choice.Message.StringContent(); text != "" {
+			claudeContent := dto.ClaudeMediaMessage{Type: "text"}
+			claudeContent.SetText(text)
+			contents = append(contents, claudeContent)
+		}
+		for _, toolCall := range choice.Message.ParseToolCalls() {
+			claudeContent := dto.ClaudeMediaMessage{
+				Type: "tool_use",
+				Id:   toolCall.ID,
+				Name: toolCall.Function.Name,
+			}
 			var mapParams map[string]interface{}
-			if err := json.Unmarshal([]byte(choice.Message.ParseToolCalls()[0].Function.Arguments), &mapParams); err == nil {
+			if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &mapParams); err == nil {
 				claudeContent.Input = mapParams
 			} else {
-				claudeContent.Input = choice.Message.ParseToolCalls()[0].Function.Arguments
+				claudeContent.Input = toolCall.Function.Arguments
 			}
-		} else {
-			claudeContent.Type = "text"
-			claudeContent.SetText(choice.Message.StringContent())
+			contents = append(contents, claudeContent)
 		}
-		contents = append(contents, claudeContent)
 	}
 	claudeResponse.Content = contents
 	claudeResponse.StopReason = stopReason
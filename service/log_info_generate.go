@@ -1,6 +1,7 @@
 package service
 
 import (
+	"one-api/constant"
 	"one-api/dto"
 	relaycommon "one-api/relay/common"
 
@@ -25,6 +26,16 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		other["is_model_mapped"] = true
 		other["upstream_model_name"] = relayInfo.UpstreamModelName
 	}
+	if fallbackFrom := ctx.GetString(constant.ContextKeyFallbackFrom); fallbackFrom != "" {
+		other["fallback_from"] = fallbackFrom
+		other["served_model"] = relayInfo.OriginModelName
+	}
+	if hedgeInfo, ok := ctx.Get(constant.ContextKeyHedgeInfo); ok {
+		other["hedge"] = hedgeInfo
+	}
+	if cacheHit := GetResponseCacheHit(ctx); cacheHit != nil {
+		other["response_cache"] = cacheHit
+	}
 	adminInfo := make(map[string]interface{})
 	adminInfo["use_channel"] = ctx.GetStringSlice("use_channel")
 	other["admin_info"] = adminInfo
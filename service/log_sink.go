@@ -0,0 +1,617 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"one-api/common"
+	"one-api/model"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// logSink 日志导出目标，Write 成功返回即表示整批记录已被目标接收
+type logSink interface {
+	Name() string
+	Write(ctx context.Context, records [][]byte) error
+	Close() error
+}
+
+// logSinkWorker 每个导出目标一个后台协程，按数量或时间批量发送，发送失败时退避重试直到成功。
+// 队列已满且等待超时、目标重试期间或关闭时仍未发送成功的记录写入磁盘暂存，目标恢复后重放，保证至少投递一次；
+// 目标明确拒绝的记录写入死信文件，不再重试
+type logSinkWorker struct {
+	sink          logSink
+	queue         chan []byte
+	spool         *common.Spool
+	deadLetter    *common.Spool
+	batchSize     int
+	flushInterval time.Duration
+	blockTimeout  time.Duration
+	stop          chan struct{}
+	done          chan struct{}
+	// mu 保护 closed，保证关闭后不再有记录进入队列
+	mu       sync.RWMutex
+	closed   bool
+	retrying atomic.Bool
+}
+
+// logSinkReplayBatches 每次定时重放的最大批数，避免重放期间队列积压
+const logSinkReplayBatches = 10
+
+// logSinkPermanentError 目标明确拒绝的记录，重试也不会成功
+type logSinkPermanentError struct {
+	err error
+}
+
+func (e *logSinkPermanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *logSinkPermanentError) Unwrap() error {
+	return e.err
+}
+
+func isPermanentLogSinkError(err error) bool {
+	var permanentErr *logSinkPermanentError
+	return errors.As(err, &permanentErr)
+}
+
+var (
+	logSinkWorkers   []*logSinkWorker
+	logSinkExclusive bool
+)
+
+// InitLogSinks 根据 LOG_SINKS 环境变量初始化消费与错误日志的外部导出
+func InitLogSinks() error {
+	names := strings.Split(os.Getenv("LOG_SINKS"), ",")
+	batchSize := common.GetEnvOrDefault("LOG_SINK_BATCH_SIZE", 200)
+	queueSize := common.GetEnvOrDefault("LOG_SINK_QUEUE_SIZE", 10000)
+	flushInterval := time.Duration(common.GetEnvOrDefault("LOG_SINK_FLUSH_INTERVAL", 1)) * time.Second
+	blockTimeout := time.Duration(common.GetEnvOrDefault("LOG_SINK_BLOCK_TIMEOUT_MS", 200)) * time.Millisecond
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		sink, err := newLogSink(name)
+		if err != nil {
+			return fmt.Errorf("init log sink %s failed: %w", name, err)
+		}
+		spool, err := common.NewSpool("log-sink-" + name)
+		if err != nil {
+			return fmt.Errorf("init log sink %s spool failed: %w", name, err)
+		}
+		deadLetter, err := common.NewSpool("log-sink-" + name + "-dead")
+		if err != nil {
+			return fmt.Errorf("init log sink %s dead letter failed: %w", name, err)
+		}
+		worker := &logSinkWorker{
+			sink:          sink,
+			queue:         make(chan []byte, queueSize),
+			spool:         spool,
+			deadLetter:    deadLetter,
+			batchSize:     batchSize,
+			flushInterval: flushInterval,
+			blockTimeout:  blockTimeout,
+			stop:          make(chan struct{}),
+			done:          make(chan struct{}),
+		}
+		common.RegisterLogBufferMetrics("sink_"+name, func() int {
+			return len(worker.queue)
+		})
+		go worker.run()
+		logSinkWorkers = append(logSinkWorkers, worker)
+		common.SysLog("log sink enabled: " + name)
+	}
+	if len(logSinkWorkers) == 0 {
+		return nil
+	}
+	logSinkExclusive = common.GetEnvOrDefaultBool("LOG_SINK_EXCLUSIVE", false)
+	model.SetLogExporter(ExportLog)
+	return nil
+}
+
+// CloseLogSinks 停止所有导出目标，尽量发送剩余记录，未发送成功的写入磁盘暂存
+func CloseLogSinks() {
+	for _, worker := range logSinkWorkers {
+		worker.mu.Lock()
+		worker.closed = true
+		worker.mu.Unlock()
+		close(worker.stop)
+	}
+	for _, worker := range logSinkWorkers {
+		<-worker.done
+	}
+}
+
+// ExportLog 将日志加入各导出目标的队列，仅导出模式下返回 true
+func ExportLog(log *model.Log) bool {
+	record, err := common.EncodeJson(log)
+	if err != nil {
+		common.SysError("failed to encode log for sinks: " + err.Error())
+		return false
+	}
+	for _, worker := range logSinkWorkers {
+		worker.enqueue(record)
+	}
+	return logSinkExclusive
+}
+
+func (w *logSinkWorker) enqueue(record []byte) {
+	if !w.tryEnqueue(record) {
+		w.spill(record)
+	}
+}
+
+func (w *logSinkWorker) tryEnqueue(record []byte) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return false
+	}
+	select {
+	case w.queue <- record:
+		return true
+	default:
+	}
+	// 目标重试期间队列不会被消费，直接暂存，避免每条日志都等待
+	if w.retrying.Load() {
+		return false
+	}
+	// 队列已满时阻塞等待一段时间，形成背压
+	timer := time.NewTimer(w.blockTimeout)
+	defer timer.Stop()
+	select {
+	case w.queue <- record:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (w *logSinkWorker) spill(records ...[]byte) {
+	buffer := "sink_" + w.sink.Name()
+	if err := w.spool.Append(records...); err != nil {
+		common.SysError(fmt.Sprintf("log sink %s spool failed, %d logs dropped: %s", w.sink.Name(), len(records), err.Error()))
+		common.RecordLogBufferWrite(buffer, "dropped", len(records))
+		return
+	}
+	common.RecordLogBufferWrite(buffer, "spooled", len(records))
+}
+
+func (w *logSinkWorker) discard(records [][]byte, reason error) {
+	buffer := "sink_" + w.sink.Name()
+	common.SysError(fmt.Sprintf("log sink %s rejected %d logs, moved to dead letter: %s", w.sink.Name(), len(records), reason.Error()))
+	if err := w.deadLetter.Append(records...); err != nil {
+		common.SysError(fmt.Sprintf("log sink %s dead letter failed, %d logs dropped: %s", w.sink.Name(), len(records), err.Error()))
+		common.RecordLogBufferWrite(buffer, "dropped", len(records))
+		return
+	}
+	common.RecordLogBufferWrite(buffer, "dead_letter", len(records))
+}
+
+func (w *logSinkWorker) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+	batch := make([][]byte, 0, w.batchSize)
+	for {
+		ticked := false
+		select {
+		case record := <-w.queue:
+			batch = append(batch, record)
+			if len(batch) < w.batchSize {
+				continue
+			}
+		case <-ticker.C:
+			ticked = true
+		case <-w.stop:
+			w.shutdown(batch)
+			return
+		}
+		if len(batch) > 0 {
+			if remaining := w.deliver(batch); len(remaining) > 0 {
+				w.shutdown(remaining)
+				return
+			}
+			batch = make([][]byte, 0, w.batchSize)
+		}
+		// 每次定时都重放暂存的记录，持续有流量时也能补发
+		if ticked {
+			w.replaySpool()
+		}
+	}
+}
+
+// deliver 发送一批记录，失败时指数退避重试，直到成功或收到停止信号，返回停止时仍未发送的记录
+func (w *logSinkWorker) deliver(batch [][]byte) [][]byte {
+	backoff := time.Second
+	for {
+		remaining, err := w.send(batch, 30*time.Second)
+		if err == nil {
+			w.retrying.Store(false)
+			return nil
+		}
+		batch = remaining
+		w.retrying.Store(true)
+		common.SysError(fmt.Sprintf("log sink %s write failed, retry in %s: %s", w.sink.Name(), backoff, err.Error()))
+		select {
+		case <-w.stop:
+			return batch
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 30*time.Second)
+	}
+}
+
+// send 发送一批记录，目标明确拒绝时逐条重新发送，仍被拒绝的记录写入死信文件。
+// 返回可重试的错误时同时返回尚未发送的记录
+func (w *logSinkWorker) send(batch [][]byte, timeout time.Duration) ([][]byte, error) {
+	err := w.write(batch, timeout)
+	if err == nil {
+		common.RecordLogBufferWrite("sink_"+w.sink.Name(), "written", len(batch))
+		return nil, nil
+	}
+	if !isPermanentLogSinkError(err) {
+		return batch, err
+	}
+	if len(batch) == 1 {
+		w.discard(batch, err)
+		return nil, nil
+	}
+	for i, record := range batch {
+		if err = w.write([][]byte{record}, timeout); err == nil {
+			common.RecordLogBufferWrite("sink_"+w.sink.Name(), "written", 1)
+			continue
+		}
+		if !isPermanentLogSinkError(err) {
+			return batch[i:], err
+		}
+		w.discard([][]byte{record}, err)
+	}
+	return nil, nil
+}
+
+func (w *logSinkWorker) write(batch [][]byte, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return w.sink.Write(ctx, batch)
+}
+
+func (w *logSinkWorker) replaySpool() {
+	if !w.spool.Pending() {
+		return
+	}
+	err := w.spool.Replay(w.batchSize, logSinkReplayBatches, func(records [][]byte) error {
+		_, err := w.send(records, 30*time.Second)
+		return err
+	})
+	if err != nil {
+		common.SysError(fmt.Sprintf("log sink %s replay spool failed: %s", w.sink.Name(), err.Error()))
+	}
+}
+
+func (w *logSinkWorker) shutdown(batch [][]byte) {
+	for {
+		select {
+		case record := <-w.queue:
+			batch = append(batch, record)
+			continue
+		default:
+		}
+		break
+	}
+	if len(batch) > 0 {
+		if remaining, err := w.send(batch, 5*time.Second); err != nil {
+			common.SysError(fmt.Sprintf("log sink %s flush failed, spooling %d logs: %s", w.sink.Name(), len(remaining), err.Error()))
+			w.spill(remaining...)
+		}
+	}
+	if err := w.sink.Close(); err != nil {
+		common.SysError(fmt.Sprintf("log sink %s close failed: %s", w.sink.Name(), err.Error()))
+	}
+	for _, spool := range []*common.Spool{w.spool, w.deadLetter} {
+		if err := spool.Close(); err != nil {
+			common.SysError(fmt.Sprintf("log sink %s close spool failed: %s", w.sink.Name(), err.Error()))
+		}
+	}
+}
+
+func newLogSink(name string) (logSink, error) {
+	switch name {
+	case "file":
+		logDir := *common.LogDir
+		if logDir == "" {
+			logDir = "./logs"
+		}
+		return &fileLogSink{
+			path:       common.GetEnvOrDefaultString("LOG_SINK_FILE_PATH", filepath.Join(logDir, "consume-log.jsonl")),
+			maxSize:    int64(common.GetEnvOrDefault("LOG_SINK_FILE_MAX_SIZE", 100)) << 20,
+			maxBackups: common.GetEnvOrDefault("LOG_SINK_FILE_MAX_BACKUPS", 10),
+		}, nil
+	case "syslog":
+		address := os.Getenv("LOG_SINK_SYSLOG_ADDRESS")
+		if address == "" {
+			return nil, errors.New("LOG_SINK_SYSLOG_ADDRESS is required")
+		}
+		hostname, _ := os.Hostname()
+		return &syslogLogSink{
+			network:  common.GetEnvOrDefaultString("LOG_SINK_SYSLOG_NETWORK", "tcp"),
+			address:  address,
+			hostname: hostname,
+		}, nil
+	case "kafka":
+		brokers := os.Getenv("LOG_SINK_KAFKA_BROKERS")
+		if brokers == "" {
+			return nil, errors.New("LOG_SINK_KAFKA_BROKERS is required")
+		}
+		return &kafkaLogSink{
+			writer: &kafka.Writer{
+				Addr:         kafka.TCP(strings.Split(brokers, ",")...),
+				Topic:        common.GetEnvOrDefaultString("LOG_SINK_KAFKA_TOPIC", "new-api-logs"),
+				Balancer:     &kafka.LeastBytes{},
+				RequiredAcks: kafka.RequireAll,
+				BatchTimeout: 10 * time.Millisecond,
+			},
+		}, nil
+	case "clickhouse":
+		endpoint := os.Getenv("LOG_SINK_CLICKHOUSE_URL")
+		if endpoint == "" {
+			return nil, errors.New("LOG_SINK_CLICKHOUSE_URL is required")
+		}
+		return &clickhouseLogSink{
+			endpoint: endpoint,
+			table:    common.GetEnvOrDefaultString("LOG_SINK_CLICKHOUSE_TABLE", "logs"),
+			user:     os.Getenv("LOG_SINK_CLICKHOUSE_USER"),
+			password: os.Getenv("LOG_SINK_CLICKHOUSE_PASSWORD"),
+			client:   &http.Client{Timeout: 30 * time.Second},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown log sink: %s", name)
+	}
+}
+
+// fileLogSink 以 JSONL 格式写入本地文件，超过大小后轮转，保留最近 maxBackups 个历史文件
+type fileLogSink struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func (s *fileLogSink) Name() string {
+	return "file"
+}
+
+func (s *fileLogSink) open() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+func (s *fileLogSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	s.file = nil
+	if err := os.Rename(s.path, s.path+"."+time.Now().Format("20060102-150405.000")); err != nil {
+		return err
+	}
+	backups, _ := filepath.Glob(s.path + ".*")
+	if s.maxBackups > 0 && len(backups) > s.maxBackups {
+		sort.Strings(backups)
+		for _, backup := range backups[:len(backups)-s.maxBackups] {
+			_ = os.Remove(backup)
+		}
+	}
+	return s.open()
+}
+
+func (s *fileLogSink) Write(ctx context.Context, records [][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	var batchSize int64
+	for _, record := range records {
+		batchSize += int64(len(record)) + 1
+	}
+	if s.maxSize > 0 && s.size > 0 && s.size+batchSize > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	writer := bufio.NewWriter(s.file)
+	for _, record := range records {
+		writer.Write(record)
+		writer.WriteByte('\n')
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	s.size += batchSize
+	return s.file.Sync()
+}
+
+func (s *fileLogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
+
+// syslogLogSink 以 RFC 5424 格式发送到 syslog 服务或任意 TCP/UDP 端点，每条日志一行
+type syslogLogSink struct {
+	network  string
+	address  string
+	hostname string
+	conn     net.Conn
+}
+
+func (s *syslogLogSink) Name() string {
+	return "syslog"
+}
+
+func (s *syslogLogSink) Write(ctx context.Context, records [][]byte) error {
+	if s.conn == nil {
+		dialer := net.Dialer{}
+		conn, err := dialer.DialContext(ctx, s.network, s.address)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = s.conn.SetWriteDeadline(deadline)
+	}
+	for _, record := range records {
+		// facility local0，severity info
+		message := fmt.Sprintf("<134>1 %s %s new-api - - - %s\n", time.Now().Format(time.RFC3339), s.hostname, record)
+		if _, err := io.WriteString(s.conn, message); err != nil {
+			s.conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *syslogLogSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// kafkaLogSink 发送到 Kafka 兼容的消息队列，等待所有副本确认
+type kafkaLogSink struct {
+	writer *kafka.Writer
+}
+
+func (s *kafkaLogSink) Name() string {
+	return "kafka"
+}
+
+func (s *kafkaLogSink) Write(ctx context.Context, records [][]byte) error {
+	messages := make([]kafka.Message, 0, len(records))
+	for _, record := range records {
+		messages = append(messages, kafka.Message{Value: record})
+	}
+	err := s.writer.WriteMessages(ctx, messages...)
+	if isKafkaRecordError(err) {
+		return &logSinkPermanentError{err: err}
+	}
+	return err
+}
+
+// isKafkaRecordError 消息本身不合法（如超过大小限制）导致的错误，重试不会成功
+func isKafkaRecordError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var tooLarge kafka.MessageTooLargeError
+	if errors.As(err, &tooLarge) {
+		return true
+	}
+	var writeErrors kafka.WriteErrors
+	if errors.As(err, &writeErrors) {
+		for _, writeErr := range writeErrors {
+			if writeErr != nil && isKafkaRecordError(writeErr) {
+				return true
+			}
+		}
+		return false
+	}
+	var kafkaErr kafka.Error
+	if errors.As(err, &kafkaErr) {
+		switch kafkaErr {
+		case kafka.InvalidMessage, kafka.InvalidMessageSize, kafka.MessageSizeTooLarge, kafka.RecordListTooLarge, kafka.InvalidRecord:
+			return true
+		}
+	}
+	return false
+}
+
+func (s *kafkaLogSink) Close() error {
+	return s.writer.Close()
+}
+
+// clickhouseLogSink 通过 ClickHouse HTTP 接口以 JSONEachRow 格式批量插入，表中不存在的字段会被忽略
+type clickhouseLogSink struct {
+	endpoint string
+	table    string
+	user     string
+	password string
+	client   *http.Client
+}
+
+func (s *clickhouseLogSink) Name() string {
+	return "clickhouse"
+}
+
+func (s *clickhouseLogSink) Write(ctx context.Context, records [][]byte) error {
+	query := url.Values{}
+	query.Set("query", fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow", s.table))
+	query.Set("input_format_skip_unknown_fields", "1")
+	body := append(bytes.Join(records, []byte{'\n'}), '\n')
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(s.endpoint, "/")+"/?"+query.Encode(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if s.user != "" {
+		req.Header.Set("X-ClickHouse-User", s.user)
+		req.Header.Set("X-ClickHouse-Key", s.password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		err = fmt.Errorf("clickhouse responded %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+		// 数据格式错误或请求过大时重试不会成功
+		if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusRequestEntityTooLarge {
+			return &logSinkPermanentError{err: err}
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *clickhouseLogSink) Close() error {
+	return nil
+}
@@ -0,0 +1,545 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"one-api/common"
+	"one-api/model"
+	"one-api/setting"
+	"one-api/setting/operation_setting"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const mediaUrlPath = "/v1/media/"
+
+// MediaBackend 媒体文件存储后端
+type MediaBackend interface {
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+func getMediaBackend(backend string) (MediaBackend, error) {
+	mediaSetting := operation_setting.GetMediaStoreSetting()
+	switch backend {
+	case operation_setting.MediaStoreBackendLocal:
+		if mediaSetting.LocalPath == "" {
+			return nil, errors.New("media store local_path is not configured")
+		}
+		return &localMediaBackend{dir: mediaSetting.LocalPath}, nil
+	case operation_setting.MediaStoreBackendS3:
+		if mediaSetting.S3Endpoint == "" || mediaSetting.S3Bucket == "" {
+			return nil, errors.New("media store s3_endpoint and s3_bucket are required")
+		}
+		return &s3MediaBackend{
+			endpoint:  strings.TrimSuffix(mediaSetting.S3Endpoint, "/"),
+			region:    mediaSetting.S3Region,
+			bucket:    mediaSetting.S3Bucket,
+			accessKey: mediaSetting.S3AccessKey,
+			secretKey: mediaSetting.S3SecretKey,
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown media store backend: %s", backend)
+}
+
+// localMediaBackend 本地目录存储
+type localMediaBackend struct {
+	dir string
+}
+
+func (b *localMediaBackend) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	if err := os.MkdirAll(b.dir, 0755); err != nil {
+		return err
+	}
+	target := filepath.Join(b.dir, key)
+	file, err := os.CreateTemp(b.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(file, body); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err = file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), target)
+}
+
+func (b *localMediaBackend) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(b.dir, key))
+}
+
+func (b *localMediaBackend) Delete(ctx context.Context, key string) error {
+	err := os.Remove(filepath.Join(b.dir, key))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// s3MediaBackend S3 兼容存储，使用路径风格地址与 SigV4 签名
+type s3MediaBackend struct {
+	endpoint  string
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+}
+
+func (b *s3MediaBackend) do(ctx context.Context, method string, key string, body io.Reader, size int64, contentType string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s/%s/%s", b.endpoint, b.bucket, key), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+		req.Header.Set("Content-Type", contentType)
+	}
+	payloadHash := "UNSIGNED-PAYLOAD"
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	credentials := aws.Credentials{AccessKeyID: b.accessKey, SecretAccessKey: b.secretKey}
+	err = v4.NewSigner().SignHTTP(ctx, credentials, req, payloadHash, "s3", b.region, time.Now(), func(options *v4.SignerOptions) {
+		options.DisableURIPathEscaping = true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetHttpClient().Do(req)
+}
+
+func (b *s3MediaBackend) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	resp, err := b.do(ctx, http.MethodPut, key, body, size, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		responseBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("s3 put object status code: %d, body: %s", resp.StatusCode, responseBody)
+	}
+	return nil
+}
+
+func (b *s3MediaBackend) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := b.do(ctx, http.MethodGet, key, nil, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3 get object status code: %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+func (b *s3MediaBackend) Delete(ctx context.Context, key string) error {
+	resp, err := b.do(ctx, http.MethodDelete, key, nil, 0, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("s3 delete object status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+var mediaSignSecretWarning sync.Once
+
+// IsMediaStoreEnabled 媒体存储需要显式配置签名密钥，未配置时不持久化，保留上游地址
+func IsMediaStoreEnabled() bool {
+	if !operation_setting.GetMediaStoreSetting().Enabled {
+		return false
+	}
+	if common.MediaSignSecret == "" {
+		mediaSignSecretWarning.Do(func() {
+			common.SysError("WARNING: media store is enabled but MEDIA_SIGN_SECRET, CRYPTO_SECRET and SESSION_SECRET are all unset, generated media will NOT be persisted")
+		})
+		return false
+	}
+	return true
+}
+
+// SignMediaUrl 生成由网关提供的媒体文件签名链接，链接与文件同时过期
+func SignMediaUrl(key string, expiresAt int64) string {
+	signature := common.GenerateHMACWithKey([]byte(common.MediaSignSecret), fmt.Sprintf("%s:%d", key, expiresAt))
+	return fmt.Sprintf("%s%s%s?expires=%d&signature=%s", setting.ServerAddress, mediaUrlPath, key, expiresAt, signature)
+}
+
+// VerifyMediaSignature 校验媒体链接的签名与过期时间
+func VerifyMediaSignature(key string, expires string, signature string) bool {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || expiresAt <= common.GetTimestamp() || common.MediaSignSecret == "" {
+		return false
+	}
+	expected := common.GenerateHMACWithKey([]byte(common.MediaSignSecret), fmt.Sprintf("%s:%d", key, expiresAt))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// ParseMediaUrl 从网关媒体链接中解析对象名
+func ParseMediaUrl(mediaUrl string) (string, bool) {
+	prefix := setting.ServerAddress + mediaUrlPath
+	if !strings.HasPrefix(mediaUrl, prefix) {
+		return "", false
+	}
+	key := strings.TrimPrefix(mediaUrl, prefix)
+	if i := strings.Index(key, "?"); i >= 0 {
+		key = key[:i]
+	}
+	return key, key != ""
+}
+
+// OpenMediaObject 打开未过期的媒体文件
+func OpenMediaObject(ctx context.Context, key string) (*model.MediaObject, io.ReadCloser, error) {
+	object, err := model.GetMediaObjectByKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if object.ExpiresAt <= common.GetTimestamp() {
+		return nil, nil, errors.New("media object expired")
+	}
+	backend, err := getMediaBackend(object.Backend)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader, err := backend.Open(ctx, object.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return object, reader, nil
+}
+
+// PersistMediaUrl 将上游生成结果下载到媒体存储并返回网关签名链接，
+// 未开启媒体存储或持久化失败（超过大小或用户存储上限等）时返回原地址
+func PersistMediaUrl(ctx context.Context, userId int, taskId string, sourceUrl string) string {
+	if !IsMediaStoreEnabled() || !strings.HasPrefix(sourceUrl, "http") {
+		return sourceUrl
+	}
+	if _, ok := ParseMediaUrl(sourceUrl); ok {
+		return sourceUrl
+	}
+	mediaUrl, err := persistMedia(ctx, userId, taskId, sourceUrl)
+	if err != nil {
+		common.LogError(ctx, fmt.Sprintf("persist media %s failed: %s", sourceUrl, err.Error()))
+		return sourceUrl
+	}
+	return mediaUrl
+}
+
+var (
+	taskPersistQueue chan *model.Task
+	taskPersistOnce  sync.Once
+)
+
+// PersistTaskMediaAsync 将成功任务的结果交给后台工作协程持久化，持久化完成后改写任务的结果地址并创建完成回调。
+// 返回 false 表示未排队（未开启媒体存储、任务未成功或队列已满），此时由调用方直接创建回调
+func PersistTaskMediaAsync(task *model.Task) bool {
+	if !IsMediaStoreEnabled() || task.Status != model.TaskStatusSuccess {
+		return false
+	}
+	taskPersistOnce.Do(startTaskPersistWorkers)
+	// 轮询协程在写入后仍持有任务，交给工作协程的是副本
+	taskCopy := *task
+	select {
+	case taskPersistQueue <- &taskCopy:
+		return true
+	default:
+		common.SysError(fmt.Sprintf("task media persist queue is full, keep upstream result of task %s", task.TaskID))
+		return false
+	}
+}
+
+func startTaskPersistWorkers() {
+	mediaSetting := operation_setting.GetMediaStoreSetting()
+	taskPersistQueue = make(chan *model.Task, max(mediaSetting.TaskPersistQueueSize, 1))
+	for i := 0; i < max(mediaSetting.TaskPersistWorkers, 1); i++ {
+		gopool.Go(func() {
+			for task := range taskPersistQueue {
+				persistTaskMedia(task)
+			}
+		})
+	}
+}
+
+// persistTaskMedia 持久化任务的结果地址以及结果数据中所有以 url 结尾的字段，同一地址只下载一次
+func persistTaskMedia(task *model.Task) {
+	ctx := context.Background()
+	if timeout := operation_setting.GetMediaStoreSetting().TaskPersistTimeoutSeconds; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		defer cancel()
+	}
+	persisted := make(map[string]string)
+	persist := func(sourceUrl string) string {
+		if mediaUrl, ok := persisted[sourceUrl]; ok {
+			return mediaUrl
+		}
+		mediaUrl := PersistMediaUrl(ctx, task.UserId, task.TaskID, sourceUrl)
+		persisted[sourceUrl] = mediaUrl
+		return mediaUrl
+	}
+	changed := false
+	if task.ResultUrl != "" {
+		if mediaUrl := persist(task.ResultUrl); mediaUrl != task.ResultUrl {
+			task.ResultUrl = mediaUrl
+			changed = true
+		}
+	}
+	var data any
+	if len(task.Data) > 0 && json.Unmarshal(task.Data, &data) == nil && rewriteMediaUrls(data, persist) {
+		if rewritten, err := json.Marshal(data); err == nil {
+			task.Data = rewritten
+			changed = true
+		}
+	}
+	if changed {
+		if err := model.TaskUpdateResult(task.ID, task.ResultUrl, task.Data); err != nil {
+			common.SysError(fmt.Sprintf("update task %s persisted result failed: %s", task.TaskID, err.Error()))
+		}
+	}
+	EnqueueTaskWebhook(task)
+}
+
+// rewriteMediaUrls 将 JSON 中键名以 url 结尾的 http 地址替换为 persist 的结果，返回是否有改动
+func rewriteMediaUrls(value any, persist func(string) string) bool {
+	changed := false
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if s, ok := item.(string); ok {
+				if strings.HasSuffix(strings.ToLower(key), "url") && strings.HasPrefix(s, "http") {
+					if mediaUrl := persist(s); mediaUrl != s {
+						v[key] = mediaUrl
+						changed = true
+					}
+				}
+				continue
+			}
+			changed = rewriteMediaUrls(item, persist) || changed
+		}
+	case []any:
+		for _, item := range v {
+			changed = rewriteMediaUrls(item, persist) || changed
+		}
+	}
+	return changed
+}
+
+func persistMedia(ctx context.Context, userId int, taskId string, sourceUrl string) (string, error) {
+	mediaSetting := operation_setting.GetMediaStoreSetting()
+	backend, err := getMediaBackend(mediaSetting.Backend)
+	if err != nil {
+		return "", err
+	}
+	group, err := model.GetUserGroup(userId, false)
+	if err != nil {
+		return "", err
+	}
+	limit := operation_setting.GetMediaStoreLimit(group)
+	usage, err := model.GetUserMediaUsage(userId)
+	if err != nil {
+		return "", err
+	}
+	if limit.UserQuotaBytes > 0 && usage >= limit.UserQuotaBytes {
+		return "", fmt.Errorf("user media storage quota exceeded: %d/%d bytes", usage, limit.UserQuotaBytes)
+	}
+
+	resp, err := DoDownloadRequest(sourceUrl)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	// 超时或取消时关闭响应体以中断下载
+	stopDownload := context.AfterFunc(ctx, func() {
+		resp.Body.Close()
+	})
+	defer stopDownload()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download status code: %d", resp.StatusCode)
+	}
+	maxBytes := mediaSetting.MaxObjectBytes
+	if maxBytes > 0 && resp.ContentLength > maxBytes {
+		return "", fmt.Errorf("media size %d exceeds limit %d", resp.ContentLength, maxBytes)
+	}
+
+	// 先写入临时文件以获得文件大小，S3 上传需要 Content-Length
+	tmp, err := os.CreateTemp("", "media-*")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+	var reader io.Reader = resp.Body
+	if maxBytes > 0 {
+		reader = io.LimitReader(resp.Body, maxBytes+1)
+	}
+	size, err := io.Copy(tmp, reader)
+	if err != nil {
+		return "", err
+	}
+	if maxBytes > 0 && size > maxBytes {
+		return "", fmt.Errorf("media size exceeds limit %d", maxBytes)
+	}
+	if limit.UserQuotaBytes > 0 && usage+size > limit.UserQuotaBytes {
+		return "", fmt.Errorf("user media storage quota exceeded: %d/%d bytes", usage+size, limit.UserQuotaBytes)
+	}
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	object := &model.MediaObject{
+		Key:         fmt.Sprintf("%d-%s%s", userId, common.GetUUID(), mediaExtension(sourceUrl, contentType)),
+		UserId:      userId,
+		TaskId:      taskId,
+		Backend:     mediaSetting.Backend,
+		SourceUrl:   sourceUrl,
+		ContentType: contentType,
+		Size:        size,
+		ExpiresAt:   time.Now().Add(time.Duration(limit.RetentionDays) * 24 * time.Hour).Unix(),
+	}
+	if err = backend.Put(ctx, object.Key, tmp, size, contentType); err != nil {
+		return "", err
+	}
+	// 超时后调用方已使用上游地址，不再保存
+	if err = ctx.Err(); err != nil {
+		backend.Delete(context.Background(), object.Key)
+		return "", err
+	}
+	if err = object.Insert(); err != nil {
+		backend.Delete(ctx, object.Key)
+		return "", err
+	}
+	return SignMediaUrl(object.Key, object.ExpiresAt), nil
+}
+
+// mediaExtension 优先使用源地址中的扩展名，其次根据 Content-Type 推断
+func mediaExtension(sourceUrl string, contentType string) string {
+	if u, err := url.Parse(sourceUrl); err == nil {
+		if ext := path.Ext(u.Path); ext != "" && len(ext) <= 6 {
+			return strings.ToLower(ext)
+		}
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		if exts, err := mime.ExtensionsByType(mediaType); err == nil && len(exts) > 0 {
+			return exts[0]
+		}
+	}
+	return ""
+}
+
+// PersistImageResponse 将图片生成响应中的 data[].url 并发持久化并改写为网关签名链接，无法解析的响应原样返回。
+// 持久化最多等待 ImagePersistTimeoutSeconds，超时的图片保留上游地址，避免下载耗时拖慢响应
+func PersistImageResponse(ctx context.Context, userId int, responseBody []byte) []byte {
+	var response map[string]any
+	if err := json.Unmarshal(responseBody, &response); err != nil {
+		return responseBody
+	}
+	items, ok := response["data"].([]any)
+	if !ok {
+		return responseBody
+	}
+	if timeout := operation_setting.GetMediaStoreSetting().ImagePersistTimeoutSeconds; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		defer cancel()
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	changed := false
+	for _, item := range items {
+		image, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		imageUrl, ok := image["url"].(string)
+		if !ok || imageUrl == "" {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if mediaUrl := PersistMediaUrl(ctx, userId, "", imageUrl); mediaUrl != imageUrl {
+				mu.Lock()
+				image["url"] = mediaUrl
+				changed = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if !changed {
+		return responseBody
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		return responseBody
+	}
+	return data
+}
+
+// CleanExpiredMedia 删除过期的媒体文件及其记录，返回清理的数量。
+// 单个文件删除失败时记录错误并跳过，不影响其他文件的清理，下次清理时重试
+func CleanExpiredMedia(ctx context.Context) (int, error) {
+	cleaned := 0
+	failed := 0
+	var lastId int64
+	for {
+		objects, err := model.GetExpiredMediaObjects(lastId, 100)
+		if err != nil {
+			return cleaned, err
+		}
+		if len(objects) == 0 {
+			break
+		}
+		for _, object := range objects {
+			lastId = object.Id
+			if err = deleteMediaObject(ctx, object); err != nil {
+				common.SysError(fmt.Sprintf("delete media %s failed: %s", object.Key, err.Error()))
+				failed++
+				continue
+			}
+			cleaned++
+		}
+	}
+	if failed > 0 {
+		return cleaned, fmt.Errorf("failed to delete %d expired media objects", failed)
+	}
+	return cleaned, nil
+}
+
+func deleteMediaObject(ctx context.Context, object *model.MediaObject) error {
+	backend, err := getMediaBackend(object.Backend)
+	if err != nil {
+		return err
+	}
+	if err = backend.Delete(ctx, object.Key); err != nil {
+		return err
+	}
+	return object.Delete()
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/setting/operation_setting"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ResponseCacheEntry 缓存的上游响应，流式响应保存完整的 SSE 数据
+type ResponseCacheEntry struct {
+	Body        []byte    `json:"body"`
+	ContentType string    `json:"content_type"`
+	IsStream    bool      `json:"is_stream"`
+	Usage       dto.Usage `json:"usage"`
+	ExpiresAt   int64     `json:"expires_at"`
+}
+
+const (
+	ResponseCacheTypeExact    = "exact"
+	ResponseCacheTypeSemantic = "semantic"
+)
+
+// ResponseCacheHit 命中缓存的信息，保存在请求上下文中用于计费和日志
+type ResponseCacheHit struct {
+	Type         string  `json:"type"`
+	BillingRatio float64 `json:"billing_ratio"`
+	Similarity   float64 `json:"similarity,omitempty"`
+}
+
+func GetResponseCacheHit(c *gin.Context) *ResponseCacheHit {
+	hit, ok := c.Get(constant.ContextKeyResponseCacheHit)
+	if !ok {
+		return nil
+	}
+	cacheHit, _ := hit.(*ResponseCacheHit)
+	return cacheHit
+}
+
+type responseCacheItem struct {
+	key   string
+	entry *ResponseCacheEntry
+}
+
+var (
+	responseCacheLock  sync.Mutex
+	responseCacheList  = list.New()
+	responseCacheItems = make(map[string]*list.Element)
+)
+
+// ResponseCacheKey 以分组、模型和规范化后的请求体生成缓存键，
+// 请求体中的 user 字段不影响响应内容，不参与计算
+func ResponseCacheKey(group string, model string, body []byte) (string, error) {
+	var request map[string]interface{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return "", err
+	}
+	delete(request, "user")
+	// map 序列化时按键排序，字段顺序与空白不影响缓存键
+	normalized, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	hash.Write([]byte(group))
+	hash.Write([]byte{0})
+	hash.Write([]byte(model))
+	hash.Write([]byte{0})
+	hash.Write(normalized)
+	return "response_cache:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func useRedisResponseCache() bool {
+	return common.RedisEnabled && operation_setting.GetResponseCacheSetting().Backend == operation_setting.ResponseCacheBackendRedis
+}
+
+func GetResponseCache(key string) *ResponseCacheEntry {
+	if useRedisResponseCache() {
+		value, err := common.RedisGet(key)
+		if err != nil {
+			return nil
+		}
+		entry := &ResponseCacheEntry{}
+		if err = json.Unmarshal([]byte(value), entry); err != nil {
+			return nil
+		}
+		return entry
+	}
+	responseCacheLock.Lock()
+	defer responseCacheLock.Unlock()
+	element, ok := responseCacheItems[key]
+	if !ok {
+		return nil
+	}
+	item := element.Value.(*responseCacheItem)
+	if item.entry.ExpiresAt <= time.Now().Unix() {
+		responseCacheList.Remove(element)
+		delete(responseCacheItems, key)
+		return nil
+	}
+	responseCacheList.MoveToFront(element)
+	return item.entry
+}
+
+func SetResponseCache(key string, entry *ResponseCacheEntry) {
+	setting := operation_setting.GetResponseCacheSetting()
+	if setting.MaxBodyBytes > 0 && len(entry.Body) > setting.MaxBodyBytes {
+		return
+	}
+	ttl := time.Duration(setting.TTLSeconds) * time.Second
+	cached := *entry
+	entry = &cached
+	entry.ExpiresAt = time.Now().Add(ttl).Unix()
+	if useRedisResponseCache() {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return
+		}
+		if err = common.RedisSet(key, string(data), ttl); err != nil {
+			common.SysError("failed to set response cache: " + err.Error())
+		}
+		return
+	}
+	responseCacheLock.Lock()
+	defer responseCacheLock.Unlock()
+	if element, ok := responseCacheItems[key]; ok {
+		element.Value.(*responseCacheItem).entry = entry
+		responseCacheList.MoveToFront(element)
+		return
+	}
+	responseCacheItems[key] = responseCacheList.PushFront(&responseCacheItem{key: key, entry: entry})
+	for setting.MaxEntries > 0 && responseCacheList.Len() > setting.MaxEntries {
+		oldest := responseCacheList.Back()
+		responseCacheList.Remove(oldest)
+		delete(responseCacheItems, oldest.Value.(*responseCacheItem).key)
+	}
+}
@@ -0,0 +1,620 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"strings"
+)
+
+type responsesInputItem struct {
+	Type      string          `json:"type"`
+	Role      string          `json:"role"`
+	Content   json.RawMessage `json:"content"`
+	CallId    string          `json:"call_id"`
+	Name      string          `json:"name"`
+	Arguments string          `json:"arguments"`
+	Output    json.RawMessage `json:"output"`
+}
+
+type responsesInputContent struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	Refusal  string `json:"refusal"`
+	ImageUrl string `json:"image_url"`
+	Detail   string `json:"detail"`
+	FileId   string `json:"file_id"`
+	FileData string `json:"file_data"`
+	Filename string `json:"filename"`
+}
+
+type responsesTextFormat struct {
+	Format *struct {
+		Type        string `json:"type"`
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Schema      any    `json:"schema"`
+		Strict      any    `json:"strict"`
+	} `json:"format"`
+}
+
+func GenerateResponsesId(prefix string) string {
+	return prefix + "_" + common.GetRandomString(32)
+}
+
+// rawJSONString 原始 JSON 为字符串时返回字符串内容，否则返回 JSON 文本
+func rawJSONString(raw json.RawMessage) (string, bool) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, true
+	}
+	return string(raw), false
+}
+
+func responsesContent2Message(role string, raw json.RawMessage) (dto.Message, error) {
+	message := dto.Message{Role: role}
+	if text, ok := rawJSONString(raw); ok {
+		message.SetStringContent(text)
+		return message, nil
+	}
+	var contents []responsesInputContent
+	if err := json.Unmarshal(raw, &contents); err != nil {
+		return message, fmt.Errorf("invalid input content: %w", err)
+	}
+	mediaContents := make([]dto.MediaContent, 0, len(contents))
+	onlyText := true
+	var texts []string
+	for _, content := range contents {
+		switch content.Type {
+		case "input_text", "output_text":
+			mediaContents = append(mediaContents, dto.MediaContent{Type: dto.ContentTypeText, Text: content.Text})
+			texts = append(texts, content.Text)
+		case "refusal":
+			mediaContents = append(mediaContents, dto.MediaContent{Type: dto.ContentTypeText, Text: content.Refusal})
+			texts = append(texts, content.Refusal)
+		case "input_image":
+			if content.ImageUrl == "" {
+				return message, fmt.Errorf("input_image without image_url is not supported")
+			}
+			onlyText = false
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type:     dto.ContentTypeImageURL,
+				ImageUrl: &dto.MessageImageUrl{Url: content.ImageUrl, Detail: content.Detail},
+			})
+		case "input_file":
+			onlyText = false
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type: dto.ContentTypeFile,
+				File: &dto.MessageFile{FileName: content.Filename, FileData: content.FileData, FileId: content.FileId},
+			})
+		default:
+			return message, fmt.Errorf("unsupported input content type: %s", content.Type)
+		}
+	}
+	if onlyText {
+		message.SetStringContent(strings.Join(texts, ""))
+	} else {
+		message.SetMediaContent(mediaContents)
+	}
+	return message, nil
+}
+
+// ResponsesInput2Messages 将 Responses API 的 input 转换为对话消息，连续的 function_call 合并为一条助手消息
+func ResponsesInput2Messages(input json.RawMessage) ([]dto.Message, error) {
+	if text, ok := rawJSONString(input); ok {
+		message := dto.Message{Role: "user"}
+		message.SetStringContent(text)
+		return []dto.Message{message}, nil
+	}
+	var items []responsesInputItem
+	if err := json.Unmarshal(input, &items); err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+	messages := make([]dto.Message, 0, len(items))
+	for _, item := range items {
+		switch item.Type {
+		case "", "message":
+			role := item.Role
+			if role == "developer" {
+				role = "system"
+			}
+			message, err := responsesContent2Message(role, item.Content)
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages, message)
+		case "function_call":
+			toolCall := dto.ToolCallRequest{
+				ID:   item.CallId,
+				Type: "function",
+				Function: dto.FunctionRequest{
+					Name:      item.Name,
+					Arguments: item.Arguments,
+				},
+			}
+			if n := len(messages); n > 0 && messages[n-1].Role == "assistant" && len(messages[n-1].ToolCalls) > 0 {
+				messages[n-1].SetToolCalls(append(messages[n-1].ParseToolCalls(), toolCall))
+			} else {
+				message := dto.Message{Role: "assistant"}
+				message.SetToolCalls([]dto.ToolCallRequest{toolCall})
+				messages = append(messages, message)
+			}
+		case "function_call_output":
+			output, _ := rawJSONString(item.Output)
+			message := dto.Message{Role: "tool", ToolCallId: item.CallId}
+			message.SetStringContent(output)
+			messages = append(messages, message)
+		case "reasoning", "item_reference":
+			// 思考内容与条目引用不回传给上游
+		default:
+			return nil, fmt.Errorf("unsupported input item type: %s", item.Type)
+		}
+	}
+	return messages, nil
+}
+
+func responsesToolChoice2OpenAI(raw json.RawMessage) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	if choice, ok := rawJSONString(raw); ok {
+		return choice
+	}
+	var choice struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(raw, &choice); err != nil || choice.Type != "function" {
+		return nil
+	}
+	return map[string]any{
+		"type": "function",
+		"function": map[string]any{
+			"name": choice.Name,
+		},
+	}
+}
+
+// ResponsesRequestToOpenAIRequest 将 Responses API 请求转换为对话补全请求，history 为 previous_response_id 对应的历史消息。
+// 同时返回本次请求新增的消息（不含 instructions），用于保存对话
+func ResponsesRequestToOpenAIRequest(request *dto.OpenAIResponsesRequest, history []dto.Message) (*dto.GeneralOpenAIRequest, []dto.Message, error) {
+	openAIRequest := &dto.GeneralOpenAIRequest{
+		Model:     request.Model,
+		Stream:    request.Stream,
+		MaxTokens: request.MaxOutputTokens,
+		TopP:      request.TopP,
+		User:      request.User,
+	}
+	if request.Temperature != 0 {
+		openAIRequest.Temperature = common.GetPointer(request.Temperature)
+	}
+	if request.Reasoning != nil {
+		openAIRequest.ReasoningEffort = request.Reasoning.Effort
+	}
+	if len(request.Text) > 0 {
+		var text responsesTextFormat
+		if err := json.Unmarshal(request.Text, &text); err == nil && text.Format != nil {
+			switch text.Format.Type {
+			case "json_schema":
+				openAIRequest.ResponseFormat = &dto.ResponseFormat{
+					Type: "json_schema",
+					JsonSchema: &dto.FormatJsonSchema{
+						Name:        text.Format.Name,
+						Description: text.Format.Description,
+						Schema:      text.Format.Schema,
+						Strict:      text.Format.Strict,
+					},
+				}
+			case "json_object":
+				openAIRequest.ResponseFormat = &dto.ResponseFormat{Type: "json_object"}
+			}
+		}
+	}
+
+	for _, tool := range request.Tools {
+		if tool.Type != "function" {
+			return nil, nil, fmt.Errorf("tool type %s is not supported by this channel", tool.Type)
+		}
+		openAIRequest.Tools = append(openAIRequest.Tools, dto.ToolCallRequest{
+			Type: "function",
+			Function: dto.FunctionRequest{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	if len(openAIRequest.Tools) > 0 {
+		openAIRequest.ToolChoice = responsesToolChoice2OpenAI(request.ToolChoice)
+	}
+
+	input, err := ResponsesInput2Messages(request.Input)
+	if err != nil {
+		return nil, nil, err
+	}
+	messages := make([]dto.Message, 0, len(history)+len(input)+1)
+	if len(request.Instructions) > 0 {
+		if instructions, _ := rawJSONString(request.Instructions); instructions != "" && instructions != "null" {
+			message := dto.Message{Role: "system"}
+			message.SetStringContent(instructions)
+			messages = append(messages, message)
+		}
+	}
+	messages = append(messages, history...)
+	messages = append(messages, input...)
+	openAIRequest.Messages = messages
+	return openAIRequest, input, nil
+}
+
+// NewResponsesResponse 根据请求生成 Responses API 响应对象
+func NewResponsesResponse(id string, request *dto.OpenAIResponsesRequest, status string) *dto.OpenAIResponsesResponse {
+	instructions, _ := rawJSONString(request.Instructions)
+	toolChoice := "auto"
+	if choice, ok := rawJSONString(request.ToolChoice); ok && choice != "" {
+		toolChoice = choice
+	}
+	response := &dto.OpenAIResponsesResponse{
+		ID:                 id,
+		Object:             "response",
+		CreatedAt:          int(common.GetTimestamp()),
+		Status:             status,
+		Instructions:       instructions,
+		MaxOutputTokens:    int(request.MaxOutputTokens),
+		Model:              request.Model,
+		Output:             make([]dto.ResponsesOutput, 0),
+		ParallelToolCalls:  request.ParallelToolCalls,
+		PreviousResponseID: request.PreviousResponseID,
+		Reasoning:          request.Reasoning,
+		Store:              request.Store,
+		Temperature:        request.Temperature,
+		ToolChoice:         toolChoice,
+		Tools:              request.Tools,
+		TopP:               request.TopP,
+		Truncation:         request.Truncation,
+		Metadata:           request.Metadata,
+	}
+	if response.Tools == nil {
+		response.Tools = make([]dto.ResponsesToolsCall, 0)
+	}
+	if request.User != "" {
+		response.User, _ = json.Marshal(request.User)
+	}
+	return response
+}
+
+// SetResponsesUsage 将对话补全用量转换为 Responses API 的用量字段
+func SetResponsesUsage(response *dto.OpenAIResponsesResponse, usage *dto.Usage) {
+	if usage == nil {
+		return
+	}
+	responsesUsage := *usage
+	responsesUsage.InputTokens = usage.PromptTokens
+	responsesUsage.OutputTokens = usage.CompletionTokens
+	responsesUsage.InputTokensDetails = &responsesUsage.PromptTokensDetails
+	response.Usage = &responsesUsage
+}
+
+func newResponsesMessageItem(status string, text string) dto.ResponsesOutput {
+	return dto.ResponsesOutput{
+		Type:   "message",
+		ID:     GenerateResponsesId("msg"),
+		Status: status,
+		Role:   "assistant",
+		Content: []dto.ResponsesOutputContent{
+			{Type: "output_text", Text: text, Annotations: make([]interface{}, 0)},
+		},
+	}
+}
+
+func newResponsesReasoningItem(text string) dto.ResponsesOutput {
+	return dto.ResponsesOutput{
+		Type:    "reasoning",
+		ID:      GenerateResponsesId("rs"),
+		Summary: []dto.ResponsesOutputContent{{Type: "summary_text", Text: text}},
+	}
+}
+
+func newResponsesFunctionCallItem(status string, callId string, name string, arguments string) dto.ResponsesOutput {
+	return dto.ResponsesOutput{
+		Type:      "function_call",
+		ID:        GenerateResponsesId("fc"),
+		Status:    status,
+		CallId:    callId,
+		Name:      name,
+		Arguments: arguments,
+	}
+}
+
+// ResponseOpenAI2ResponsesOutput 将对话补全响应的第一个选项转换为 Responses API 的输出项
+func ResponseOpenAI2ResponsesOutput(response *dto.OpenAITextResponse) []dto.ResponsesOutput {
+	output := make([]dto.ResponsesOutput, 0)
+	if len(response.Choices) == 0 {
+		return output
+	}
+	message := response.Choices[0].Message
+	reasoning := message.ReasoningContent
+	if reasoning == "" {
+		reasoning = message.Reasoning
+	}
+	if reasoning != "" {
+		output = append(output, newResponsesReasoningItem(reasoning))
+	}
+	if text := message.StringContent(); text != "" {
+		output = append(output, newResponsesMessageItem("completed", text))
+	}
+	for _, toolCall := range message.ParseToolCalls() {
+		output = append(output, newResponsesFunctionCallItem("completed", toolCall.ID, toolCall.Function.Name, toolCall.Function.Arguments))
+	}
+	return output
+}
+
+// ResponsesOutput2Messages 将输出项转换为助手消息，用于保存对话供 previous_response_id 续接
+func ResponsesOutput2Messages(output []dto.ResponsesOutput) []dto.Message {
+	message := dto.Message{Role: "assistant"}
+	var texts []string
+	var toolCalls []dto.ToolCallRequest
+	for _, item := range output {
+		switch item.Type {
+		case "message":
+			for _, content := range item.Content {
+				texts = append(texts, content.Text)
+			}
+		case "function_call":
+			toolCalls = append(toolCalls, dto.ToolCallRequest{
+				ID:   item.CallId,
+				Type: "function",
+				Function: dto.FunctionRequest{
+					Name:      item.Name,
+					Arguments: item.Arguments,
+				},
+			})
+		}
+	}
+	if len(texts) == 0 && len(toolCalls) == 0 {
+		return nil
+	}
+	if len(texts) > 0 {
+		message.SetStringContent(strings.Join(texts, ""))
+	}
+	if len(toolCalls) > 0 {
+		message.SetToolCalls(toolCalls)
+	}
+	return []dto.Message{message}
+}
+
+// ResponsesStreamConverter 将对话补全流式分片转换为 Responses API 的流式事件，仅转换第一个选项
+type ResponsesStreamConverter struct {
+	Response *dto.OpenAIResponsesResponse
+	sequence int
+	// openIndex 当前未结束的输出项下标，-1 表示没有
+	openIndex   int
+	toolIndexes map[int]int
+	usage       *dto.Usage
+	incomplete  bool
+}
+
+func NewResponsesStreamConverter(response *dto.OpenAIResponsesResponse) *ResponsesStreamConverter {
+	return &ResponsesStreamConverter{
+		Response:    response,
+		openIndex:   -1,
+		toolIndexes: make(map[int]int),
+	}
+}
+
+func (s *ResponsesStreamConverter) event(event dto.ResponsesStreamResponse) dto.ResponsesStreamResponse {
+	event.SequenceNumber = s.sequence
+	s.sequence++
+	return event
+}
+
+// cloneOutputItem 复制输出项，事件中的输出项不能与后续继续累积的内容共享切片
+func cloneOutputItem(item dto.ResponsesOutput) *dto.ResponsesOutput {
+	item.Content = append([]dto.ResponsesOutputContent(nil), item.Content...)
+	item.Summary = append([]dto.ResponsesOutputContent(nil), item.Summary...)
+	return &item
+}
+
+func (s *ResponsesStreamConverter) snapshot() *dto.OpenAIResponsesResponse {
+	response := *s.Response
+	response.Output = make([]dto.ResponsesOutput, 0, len(s.Response.Output))
+	for _, item := range s.Response.Output {
+		response.Output = append(response.Output, *cloneOutputItem(item))
+	}
+	return &response
+}
+
+// Start 返回 response.created 与 response.in_progress 事件
+func (s *ResponsesStreamConverter) Start() []dto.ResponsesStreamResponse {
+	s.Response.Status = "in_progress"
+	return []dto.ResponsesStreamResponse{
+		s.event(dto.ResponsesStreamResponse{Type: "response.created", Response: s.snapshot()}),
+		s.event(dto.ResponsesStreamResponse{Type: "response.in_progress", Response: s.snapshot()}),
+	}
+}
+
+func (s *ResponsesStreamConverter) openItem(item dto.ResponsesOutput) []dto.ResponsesStreamResponse {
+	events := s.closeItem()
+	s.Response.Output = append(s.Response.Output, item)
+	s.openIndex = len(s.Response.Output) - 1
+	index := s.openIndex
+	events = append(events, s.event(dto.ResponsesStreamResponse{
+		Type:        dto.ResponsesOutputTypeItemAdded,
+		OutputIndex: common.GetPointer(index),
+		Item:        cloneOutputItem(item),
+	}))
+	switch item.Type {
+	case "message":
+		events = append(events, s.event(dto.ResponsesStreamResponse{
+			Type:         "response.content_part.added",
+			ItemId:       item.ID,
+			OutputIndex:  common.GetPointer(index),
+			ContentIndex: common.GetPointer(0),
+			Part:         &dto.ResponsesOutputContent{Type: "output_text", Annotations: make([]interface{}, 0)},
+		}))
+	case "reasoning":
+		events = append(events, s.event(dto.ResponsesStreamResponse{
+			Type:         "response.reasoning_summary_part.added",
+			ItemId:       item.ID,
+			OutputIndex:  common.GetPointer(index),
+			SummaryIndex: common.GetPointer(0),
+			Part:         &dto.ResponsesOutputContent{Type: "summary_text"},
+		}))
+	}
+	return events
+}
+
+func (s *ResponsesStreamConverter) closeItem() []dto.ResponsesStreamResponse {
+	if s.openIndex == -1 {
+		return nil
+	}
+	index := s.openIndex
+	s.openIndex = -1
+	item := &s.Response.Output[index]
+	var events []dto.ResponsesStreamResponse
+	switch item.Type {
+	case "message":
+		item.Status = "completed"
+		part := item.Content[0]
+		events = append(events,
+			s.event(dto.ResponsesStreamResponse{
+				Type:         "response.output_text.done",
+				ItemId:       item.ID,
+				OutputIndex:  common.GetPointer(index),
+				ContentIndex: common.GetPointer(0),
+				Text:         common.GetPointer(part.Text),
+			}),
+			s.event(dto.ResponsesStreamResponse{
+				Type:         "response.content_part.done",
+				ItemId:       item.ID,
+				OutputIndex:  common.GetPointer(index),
+				ContentIndex: common.GetPointer(0),
+				Part:         &part,
+			}),
+		)
+	case "reasoning":
+		part := item.Summary[0]
+		events = append(events,
+			s.event(dto.ResponsesStreamResponse{
+				Type:         "response.reasoning_summary_text.done",
+				ItemId:       item.ID,
+				OutputIndex:  common.GetPointer(index),
+				SummaryIndex: common.GetPointer(0),
+				Text:         common.GetPointer(part.Text),
+			}),
+			s.event(dto.ResponsesStreamResponse{
+				Type:         "response.reasoning_summary_part.done",
+				ItemId:       item.ID,
+				OutputIndex:  common.GetPointer(index),
+				SummaryIndex: common.GetPointer(0),
+				Part:         &part,
+			}),
+		)
+	case "function_call":
+		item.Status = "completed"
+		events = append(events, s.event(dto.ResponsesStreamResponse{
+			Type:        "response.function_call_arguments.done",
+			ItemId:      item.ID,
+			OutputIndex: common.GetPointer(index),
+			Arguments:   common.GetPointer(item.Arguments),
+		}))
+	}
+	events = append(events, s.event(dto.ResponsesStreamResponse{
+		Type:        dto.ResponsesOutputTypeItemDone,
+		OutputIndex: common.GetPointer(index),
+		Item:        cloneOutputItem(*item),
+	}))
+	return events
+}
+
+func (s *ResponsesStreamConverter) isOpen(itemType string) bool {
+	return s.openIndex != -1 && s.Response.Output[s.openIndex].Type == itemType
+}
+
+// Convert 转换一个对话补全流式分片
+func (s *ResponsesStreamConverter) Convert(response *dto.ChatCompletionsStreamResponse) []dto.ResponsesStreamResponse {
+	if ValidUsage(response.Usage) {
+		s.usage = response.Usage
+	}
+	var events []dto.ResponsesStreamResponse
+	for _, choice := range response.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		if reasoning := choice.Delta.GetReasoningContent(); reasoning != "" {
+			if !s.isOpen("reasoning") {
+				events = append(events, s.openItem(newResponsesReasoningItem(""))...)
+			}
+			item := &s.Response.Output[s.openIndex]
+			item.Summary[0].Text += reasoning
+			events = append(events, s.event(dto.ResponsesStreamResponse{
+				Type:         "response.reasoning_summary_text.delta",
+				ItemId:       item.ID,
+				OutputIndex:  common.GetPointer(s.openIndex),
+				SummaryIndex: common.GetPointer(0),
+				Delta:        reasoning,
+			}))
+		}
+		if text := choice.Delta.GetContentString(); text != "" {
+			if !s.isOpen("message") {
+				events = append(events, s.openItem(newResponsesMessageItem("in_progress", ""))...)
+			}
+			item := &s.Response.Output[s.openIndex]
+			item.Content[0].Text += text
+			events = append(events, s.event(dto.ResponsesStreamResponse{
+				Type:         "response.output_text.delta",
+				ItemId:       item.ID,
+				OutputIndex:  common.GetPointer(s.openIndex),
+				ContentIndex: common.GetPointer(0),
+				Delta:        text,
+			}))
+		}
+		for _, toolCall := range choice.Delta.ToolCalls {
+			toolIndex := 0
+			if toolCall.Index != nil {
+				toolIndex = *toolCall.Index
+			}
+			outputIndex, ok := s.toolIndexes[toolIndex]
+			if !ok || (toolCall.ID != "" && toolCall.ID != s.Response.Output[outputIndex].CallId) {
+				events = append(events, s.openItem(newResponsesFunctionCallItem("in_progress", toolCall.ID, toolCall.Function.Name, ""))...)
+				outputIndex = s.openIndex
+				s.toolIndexes[toolIndex] = outputIndex
+			}
+			item := &s.Response.Output[outputIndex]
+			if toolCall.Function.Name != "" {
+				item.Name = toolCall.Function.Name
+			}
+			if toolCall.Function.Arguments != "" {
+				item.Arguments += toolCall.Function.Arguments
+				events = append(events, s.event(dto.ResponsesStreamResponse{
+					Type:        "response.function_call_arguments.delta",
+					ItemId:      item.ID,
+					OutputIndex: common.GetPointer(outputIndex),
+					Delta:       toolCall.Function.Arguments,
+				}))
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason == constant.FinishReasonLength {
+			s.incomplete = true
+		}
+	}
+	return events
+}
+
+// Finish 结束未完成的输出项并返回 response.completed（或 response.incomplete）事件，usage 为适配器统计的最终用量
+func (s *ResponsesStreamConverter) Finish(usage *dto.Usage) []dto.ResponsesStreamResponse {
+	events := s.closeItem()
+	if usage == nil {
+		usage = s.usage
+	}
+	SetResponsesUsage(s.Response, usage)
+	eventType := "response.completed"
+	s.Response.Status = "completed"
+	if s.incomplete {
+		eventType = "response.incomplete"
+		s.Response.Status = "incomplete"
+		s.Response.IncompleteDetails = &dto.IncompleteDetails{Reasoning: "max_output_tokens"}
+	}
+	return append(events, s.event(dto.ResponsesStreamResponse{Type: eventType, Response: s.snapshot()}))
+}
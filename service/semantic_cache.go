@@ -0,0 +1,132 @@
+package service
+
+import (
+	"math"
+	"one-api/setting/operation_setting"
+	"sync"
+	"time"
+)
+
+type semanticCacheItem struct {
+	scope  string
+	vector []float64
+	norm   float64
+	entry  *ResponseCacheEntry
+}
+
+var (
+	semanticCacheLock  sync.RWMutex
+	semanticCacheItems []*semanticCacheItem
+)
+
+type semanticCacheEmbedding struct {
+	vector    []float64
+	expiresAt int64
+}
+
+// 按文本哈希缓存的向量，相同的提示词不再重复计算
+var (
+	semanticEmbeddingLock  sync.Mutex
+	semanticEmbeddings     = make(map[string]*semanticCacheEmbedding)
+	semanticEmbeddingOrder []string
+)
+
+func vectorNorm(vector []float64) float64 {
+	var sum float64
+	for _, v := range vector {
+		sum += v * v
+	}
+	return math.Sqrt(sum)
+}
+
+func cosineSimilarity(a []float64, aNorm float64, b []float64, bNorm float64) float64 {
+	if len(a) != len(b) || aNorm == 0 || bNorm == 0 {
+		return 0
+	}
+	var dot float64
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	return dot / (aNorm * bNorm)
+}
+
+// HasSemanticCache 相同上下文（scope）是否有未过期的缓存条目，没有时无需计算向量查找
+func HasSemanticCache(scope string) bool {
+	now := time.Now().Unix()
+	semanticCacheLock.RLock()
+	defer semanticCacheLock.RUnlock()
+	for _, item := range semanticCacheItems {
+		if item.scope == scope && item.entry.ExpiresAt > now {
+			return true
+		}
+	}
+	return false
+}
+
+// GetSemanticCacheEmbedding 返回已缓存的文本向量，key 为 embedding 模型与文本的哈希
+func GetSemanticCacheEmbedding(key string) []float64 {
+	semanticEmbeddingLock.Lock()
+	defer semanticEmbeddingLock.Unlock()
+	embedding, ok := semanticEmbeddings[key]
+	if !ok || embedding.expiresAt <= time.Now().Unix() {
+		return nil
+	}
+	return embedding.vector
+}
+
+// SetSemanticCacheEmbedding 缓存文本向量，有效期与条目数上限与语义缓存相同，超出时淘汰最早的向量
+func SetSemanticCacheEmbedding(key string, vector []float64) {
+	setting := operation_setting.GetSemanticCacheSetting()
+	semanticEmbeddingLock.Lock()
+	defer semanticEmbeddingLock.Unlock()
+	if _, ok := semanticEmbeddings[key]; !ok {
+		semanticEmbeddingOrder = append(semanticEmbeddingOrder, key)
+	}
+	semanticEmbeddings[key] = &semanticCacheEmbedding{vector: vector, expiresAt: time.Now().Unix() + int64(setting.TTLSeconds)}
+	for setting.MaxEntries > 0 && len(semanticEmbeddingOrder) > setting.MaxEntries {
+		delete(semanticEmbeddings, semanticEmbeddingOrder[0])
+		semanticEmbeddingOrder = semanticEmbeddingOrder[1:]
+	}
+}
+
+// GetSemanticCache 在相同上下文（scope）的缓存中查找与向量最相似的条目，相似度未达到阈值时返回 nil
+func GetSemanticCache(scope string, vector []float64, threshold float64) (*ResponseCacheEntry, float64) {
+	norm := vectorNorm(vector)
+	now := time.Now().Unix()
+	var best *ResponseCacheEntry
+	bestSimilarity := threshold
+	semanticCacheLock.RLock()
+	defer semanticCacheLock.RUnlock()
+	for _, item := range semanticCacheItems {
+		if item.scope != scope || item.entry.ExpiresAt <= now {
+			continue
+		}
+		if similarity := cosineSimilarity(vector, norm, item.vector, item.norm); similarity >= bestSimilarity {
+			best = item.entry
+			bestSimilarity = similarity
+		}
+	}
+	return best, bestSimilarity
+}
+
+// AddSemanticCache 添加缓存条目，同时清理过期条目，超出最大条目数时淘汰最早的条目
+func AddSemanticCache(scope string, vector []float64, entry *ResponseCacheEntry) {
+	setting := operation_setting.GetSemanticCacheSetting()
+	now := time.Now().Unix()
+	cached := *entry
+	cached.ExpiresAt = now + int64(setting.TTLSeconds)
+	item := &semanticCacheItem{scope: scope, vector: vector, norm: vectorNorm(vector), entry: &cached}
+	semanticCacheLock.Lock()
+	defer semanticCacheLock.Unlock()
+	items := semanticCacheItems[:0]
+	for _, existing := range semanticCacheItems {
+		if existing.entry.ExpiresAt > now {
+			items = append(items, existing)
+		}
+	}
+	items = append(items, item)
+	if setting.MaxEntries > 0 && len(items) > setting.MaxEntries {
+		items = items[len(items)-setting.MaxEntries:]
+	}
+	semanticCacheItems = items
+}
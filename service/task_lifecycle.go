@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"one-api/common"
+	"one-api/model"
+	"one-api/setting/operation_setting"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TaskCancelledReason 用户主动取消任务时记录的失败原因
+const TaskCancelledReason = "task cancelled by user"
+
+// IsTaskExpired 未完成的任务是否已超过配置的最长存活时间
+func IsTaskExpired(task *model.Task) bool {
+	maxAge := operation_setting.GetTaskLifecycleSetting().MaxTaskAgeSeconds
+	if maxAge <= 0 || task.IsFinished() {
+		return false
+	}
+	submitTime := task.SubmitTime
+	if submitTime == 0 {
+		submitTime = task.CreatedAt
+	}
+	return submitTime > 0 && time.Now().Unix()-submitTime > int64(maxAge)
+}
+
+// ErrTaskAlreadyFinished 任务已被其他路径（轮询或取消）写入终态
+var ErrTaskAlreadyFinished = errors.New("task is already finished")
+
+// FailTask 将任务标记为失败，退还额度并创建完成回调。任务已被其他路径写入终态时返回 ErrTaskAlreadyFinished
+func FailTask(ctx context.Context, task *model.Task, reason string) error {
+	task.Status = model.TaskStatusFailure
+	task.Progress = "100%"
+	task.FailReason = reason
+	if task.FinishTime == 0 {
+		task.FinishTime = time.Now().Unix()
+	}
+	if err := UpdateFinishedTask(ctx, task); err != nil {
+		return err
+	}
+	RefundTaskQuota(ctx, task)
+	return nil
+}
+
+// UpdateFinishedTask 轮询得到任务的最新状态后条件写入，任务已被其他路径写入终态时返回 ErrTaskAlreadyFinished。
+// 写入成功且任务进入终态时创建完成回调，开启媒体存储的成功任务先在后台持久化结果再回调；
+// 失败任务的退款由调用方在写入成功后进行
+func UpdateFinishedTask(ctx context.Context, task *model.Task) error {
+	updated, err := task.UpdateUnfinished()
+	if err != nil {
+		return err
+	}
+	if !updated {
+		common.LogInfo(ctx, fmt.Sprintf("task %s was finished concurrently, skip updating", task.TaskID))
+		return ErrTaskAlreadyFinished
+	}
+	if !PersistTaskMediaAsync(task) {
+		EnqueueTaskWebhook(task)
+	}
+	return nil
+}
+
+// CancelTask 将已在上游取消的任务标记为已取消，按取消时的任务状态退还未消耗的额度并创建完成回调
+func CancelTask(ctx context.Context, task *model.Task) error {
+	refundQuota := GetTaskCancelRefundQuota(task)
+	task.Status = model.TaskStatusFailure
+	task.Progress = "100%"
+	task.FailReason = TaskCancelledReason
+	if task.FinishTime == 0 {
+		task.FinishTime = time.Now().Unix()
+	}
+	if err := UpdateFinishedTask(ctx, task); err != nil {
+		return err
+	}
+	logContent := fmt.Sprintf("异步任务取消 %s，退还未消耗额度 %s", task.TaskID, common.LogQuota(refundQuota))
+	refundTaskQuota(ctx, task, refundQuota, logContent)
+	return nil
+}
+
+// GetTaskCancelRefundQuota 计算取消任务时应退还的额度：尚未开始执行的任务全额退还，
+// 执行中的任务按未完成的进度比例退还
+func GetTaskCancelRefundQuota(task *model.Task) int {
+	switch task.Status {
+	case model.TaskStatusInProgress, model.TaskStatusUnknown:
+		if !operation_setting.GetTaskLifecycleSetting().CancelRefundByProgress {
+			return task.Quota
+		}
+		progress, err := strconv.Atoi(strings.TrimSuffix(task.Progress, "%"))
+		if err != nil || progress < 0 {
+			progress = 0
+		} else if progress > 100 {
+			progress = 100
+		}
+		return task.Quota * (100 - progress) / 100
+	default:
+		return task.Quota
+	}
+}
+
+// RefundTaskQuota 将失败任务的额度退还给用户与令牌，并记录退款日志。
+// 退款前先通过条件更新抢占任务的退款标记，保证无论由哪个轮询路径触发，同一任务只退款一次
+func RefundTaskQuota(ctx context.Context, task *model.Task) {
+	logContent := fmt.Sprintf("异步任务执行失败 %s，补偿 %s", task.TaskID, common.LogQuota(task.Quota))
+	refundTaskQuota(ctx, task, task.Quota, logContent)
+}
+
+func refundTaskQuota(ctx context.Context, task *model.Task, quota int, logContent string) {
+	if quota <= 0 || task.Refunded {
+		return
+	}
+	ok, err := model.TaskSetRefunded(task.ID, true)
+	if err != nil {
+		common.LogError(ctx, fmt.Sprintf("mark task %s refunded failed: %s", task.TaskID, err.Error()))
+		return
+	}
+	task.Refunded = true
+	if !ok {
+		return
+	}
+	if err = model.IncreaseUserQuota(task.UserId, quota, false); err != nil {
+		common.LogError(ctx, fmt.Sprintf("refund task %s user quota failed: %s", task.TaskID, err.Error()))
+		if _, err = model.TaskSetRefunded(task.ID, false); err == nil {
+			task.Refunded = false
+		}
+		return
+	}
+	if task.TokenId != 0 {
+		if err = model.IncreaseTokenQuota(task.TokenId, task.TokenKey, quota); err != nil {
+			common.LogError(ctx, fmt.Sprintf("refund task %s token quota failed: %s", task.TaskID, err.Error()))
+		}
+	}
+	modelName := task.Properties.Model
+	if modelName == "" {
+		modelName = task.Action
+	}
+	other := map[string]interface{}{
+		"task_id":     task.TaskID,
+		"platform":    string(task.Platform),
+		"fail_reason": task.FailReason,
+	}
+	model.RecordRefundLog(task.UserId, task.TokenId, task.ChannelId, modelName, quota, logContent, other)
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"math/rand"
+	"one-api/common"
+	"one-api/model"
+	"one-api/setting/operation_setting"
+	"sync/atomic"
+	"time"
+)
+
+const taskPollLeaderKey = "task_poll:leader"
+
+// taskPollNodeId 当前实例竞选轮询主节点时使用的标识
+var taskPollNodeId = common.GetRandomString(16)
+
+// IsTaskPollLeader 竞选或续期轮询主节点，保证多实例部署时同一任务只被一个实例轮询；未启用 Redis 时视为单实例直接返回 true
+func IsTaskPollLeader() bool {
+	if !common.RedisEnabled {
+		return true
+	}
+	// 与 StartTaskPollLease 的续期周期一致，租约过短时续期不及时会频繁切换主节点
+	lease := time.Duration(max(operation_setting.GetTaskPollSetting().LeaderLeaseSeconds, 3)) * time.Second
+	ok, err := common.RedisAcquireLease(taskPollLeaderKey, taskPollNodeId, lease)
+	if err != nil {
+		common.SysError("acquire task poll leader failed: " + err.Error())
+		return false
+	}
+	return ok
+}
+
+// TaskPollLease 一轮轮询期间持有的主节点租约，后台按租约时长的三分之一续期，续期失败后视为失去主节点身份
+type TaskPollLease struct {
+	lost atomic.Bool
+	stop chan struct{}
+	done chan struct{}
+}
+
+// StartTaskPollLease 在一轮轮询开始时启动租约续期，轮询结束后需调用 Stop；未启用 Redis 时不续期，始终视为持有
+func StartTaskPollLease() *TaskPollLease {
+	lease := &TaskPollLease{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if !common.RedisEnabled {
+		close(lease.done)
+		return lease
+	}
+	leaseSeconds := max(operation_setting.GetTaskPollSetting().LeaderLeaseSeconds, 3)
+	go func() {
+		defer close(lease.done)
+		ticker := time.NewTicker(time.Duration(leaseSeconds) * time.Second / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-lease.stop:
+				return
+			case <-ticker.C:
+				if !IsTaskPollLeader() {
+					common.SysError("task poll leader lease lost, aborting current round")
+					lease.lost.Store(true)
+					return
+				}
+			}
+		}
+	}()
+	return lease
+}
+
+// Held 本轮轮询是否仍持有主节点租约，失去后应停止发起新的轮询请求
+func (l *TaskPollLease) Held() bool {
+	return !l.lost.Load()
+}
+
+// Stop 停止续期
+func (l *TaskPollLease) Stop() {
+	select {
+	case <-l.stop:
+	default:
+		close(l.stop)
+	}
+	<-l.done
+}
+
+// GetTaskPollInterval 计算任务下一次轮询的间隔：任务每运行 BackoffStepSeconds 间隔翻倍，不超过 MaxIntervalSeconds，并叠加随机抖动
+func GetTaskPollInterval(task *model.Task, now int64) time.Duration {
+	pollSetting := operation_setting.GetTaskPollSetting()
+	interval := int64(max(pollSetting.BaseIntervalSeconds, 1))
+	maxInterval := int64(pollSetting.MaxIntervalSeconds)
+	submitTime := task.SubmitTime
+	if submitTime == 0 {
+		submitTime = task.CreatedAt
+	}
+	if pollSetting.BackoffStepSeconds > 0 && submitTime > 0 && now > submitTime {
+		steps := (now - submitTime) / int64(pollSetting.BackoffStepSeconds)
+		for i := int64(0); i < steps && i < 16; i++ {
+			if maxInterval > 0 && interval >= maxInterval {
+				break
+			}
+			interval *= 2
+		}
+	}
+	if maxInterval > 0 && interval > maxInterval {
+		interval = maxInterval
+	}
+	jitter := max(1+(rand.Float64()*2-1)*pollSetting.JitterRatio, 0)
+	return time.Duration(float64(interval) * jitter * float64(time.Second))
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/model"
+	"one-api/setting/operation_setting"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	TaskWebhookEventSucceeded = "task.succeeded"
+	TaskWebhookEventFailed    = "task.failed"
+)
+
+// TaskWebhookPayload 异步任务回调的负载，Data 为任务的原始结果
+type TaskWebhookPayload struct {
+	Type       string          `json:"type"`
+	TaskId     string          `json:"task_id"`
+	Platform   string          `json:"platform"`
+	Action     string          `json:"action"`
+	Model      string          `json:"model,omitempty"`
+	Status     string          `json:"status"`
+	Progress   string          `json:"progress"`
+	FailReason string          `json:"fail_reason,omitempty"`
+	SubmitTime int64           `json:"submit_time"`
+	StartTime  int64           `json:"start_time"`
+	FinishTime int64           `json:"finish_time"`
+	ResultUrl  string          `json:"result_url,omitempty"`
+	Data       json.RawMessage `json:"data,omitempty"`
+	Timestamp  int64           `json:"timestamp"`
+}
+
+// taskWebhookBlockedNets 除 net.IP 自带分类外需要拒绝的网段：运营商级 NAT（部分云厂商的元数据地址位于此段）、
+// 本网络与 IETF 保留及基准测试地址
+var taskWebhookBlockedNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{"0.0.0.0/8", "100.64.0.0/10", "192.0.0.0/24", "198.18.0.0/15", "240.0.0.0/4"} {
+		_, ipNet, _ := net.ParseCIDR(cidr)
+		nets = append(nets, ipNet)
+	}
+	return nets
+}()
+
+// taskWebhookClient 投递任务回调的客户端，在建立连接时校验实际连接的地址以防御 DNS 重绑定，且不跟随重定向
+var taskWebhookClient = &http.Client{
+	Timeout: 5 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || isTaskWebhookIpBlocked(ip) {
+					return fmt.Errorf("callback address %s is not allowed", host)
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// isTaskWebhookIpBlocked 回环、内网、链路本地（含云元数据地址 169.254.169.254）、组播与保留地址不允许作为回调目标
+func isTaskWebhookIpBlocked(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, ipNet := range taskWebhookBlockedNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// errTaskWebhookUnresolved 回调主机暂时无法解析，投递时按普通失败重试
+var errTaskWebhookUnresolved = errors.New("resolve callback_url host failed")
+
+// checkTaskWebhookUrl 校验回调地址的协议与主机白名单，resolve 为 true 时解析主机并拒绝指向内部地址的域名
+func checkTaskWebhookUrl(ctx context.Context, rawUrl string, resolve bool) error {
+	callbackUrl, err := url.Parse(rawUrl)
+	if err != nil || (callbackUrl.Scheme != "http" && callbackUrl.Scheme != "https") || callbackUrl.Hostname() == "" {
+		return errors.New("callback_url must be a valid http or https url")
+	}
+	host := callbackUrl.Hostname()
+	if !operation_setting.IsTaskWebhookHostAllowed(host) {
+		return fmt.Errorf("callback_url host %s is not allowed", host)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if isTaskWebhookIpBlocked(ip) {
+			return fmt.Errorf("callback_url host %s is not allowed", host)
+		}
+		return nil
+	}
+	if !resolve {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errTaskWebhookUnresolved, err.Error())
+	}
+	for _, addr := range addrs {
+		if isTaskWebhookIpBlocked(addr.IP) {
+			return fmt.Errorf("callback_url host %s resolves to a disallowed address", host)
+		}
+	}
+	return nil
+}
+
+// getTaskWebhookSecret 读取用户设置的 webhook 密钥，回调使用该密钥签名
+func getTaskWebhookSecret(userId int) string {
+	userSetting, err := model.GetUserSetting(userId, false)
+	if err != nil {
+		return ""
+	}
+	secret, _ := userSetting[constant.UserSettingWebhookSecret].(string)
+	return secret
+}
+
+// GetTaskCallbackUrl 读取提交任务时请求体中的 callback_url，仅支持 http 与 https 地址，
+// 需要管理员开启任务回调且用户已设置 webhook 密钥，指向内部地址的回调会被拒绝
+func GetTaskCallbackUrl(c *gin.Context) (string, error) {
+	var request struct {
+		CallbackUrl string `json:"callback_url"`
+	}
+	if err := common.UnmarshalBodyReusable(c, &request); err != nil || request.CallbackUrl == "" {
+		return "", nil
+	}
+	if !operation_setting.GetTaskWebhookSetting().Enabled {
+		return "", nil
+	}
+	if len(request.CallbackUrl) > 1024 {
+		return "", errors.New("callback_url is too long")
+	}
+	if err := checkTaskWebhookUrl(c.Request.Context(), request.CallbackUrl, true); err != nil {
+		return "", err
+	}
+	if getTaskWebhookSecret(c.GetInt("id")) == "" {
+		return "", errors.New("callback_url requires a webhook secret in user settings")
+	}
+	return request.CallbackUrl, nil
+}
+
+// EnqueueTaskWebhook 任务进入终态且提交时指定了 callback_url 时，创建待投递的回调记录，由 DeliverTaskWebhook 投递
+func EnqueueTaskWebhook(task *model.Task) {
+	if !operation_setting.GetTaskWebhookSetting().Enabled || task.Properties.CallbackUrl == "" || !task.IsFinished() {
+		return
+	}
+	event := TaskWebhookEventSucceeded
+	if task.Status == model.TaskStatusFailure {
+		event = TaskWebhookEventFailed
+	}
+	payload, err := json.Marshal(TaskWebhookPayload{
+		Type:       event,
+		TaskId:     task.TaskID,
+		Platform:   string(task.Platform),
+		Action:     task.Action,
+		Model:      task.Properties.Model,
+		Status:     string(task.Status),
+		Progress:   task.Progress,
+		FailReason: task.FailReason,
+		SubmitTime: task.SubmitTime,
+		StartTime:  task.StartTime,
+		FinishTime: task.FinishTime,
+		ResultUrl:  task.ResultUrl,
+		Data:       task.Data,
+		Timestamp:  common.GetTimestamp(),
+	})
+	if err != nil {
+		common.SysError(fmt.Sprintf("marshal task %s webhook payload failed: %s", task.TaskID, err.Error()))
+		return
+	}
+	now := common.GetTimestamp()
+	webhook := &model.TaskWebhook{
+		Id:            task.ID,
+		UserId:        task.UserId,
+		TaskId:        task.TaskID,
+		Platform:      string(task.Platform),
+		Url:           task.Properties.CallbackUrl,
+		Event:         event,
+		Payload:       string(payload),
+		Status:        model.TaskWebhookStatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if _, err = webhook.Insert(); err != nil {
+		common.SysError(fmt.Sprintf("create task %s webhook failed: %s", task.TaskID, err.Error()))
+	}
+}
+
+// DeliverTaskWebhook 投递一次回调并记录结果，失败且未达到最大次数时按指数退避安排下次重试
+func DeliverTaskWebhook(webhook *model.TaskWebhook) {
+	// 投递时重新校验，避免域名在提交后改为指向内部地址；连接阶段由 taskWebhookClient 再次校验实际地址
+	secret := getTaskWebhookSecret(webhook.UserId)
+	err := checkTaskWebhookUrl(context.Background(), webhook.Url, true)
+	if err == nil && secret == "" {
+		err = errors.New("webhook secret is not set")
+	}
+	webhook.Attempts++
+	if err != nil && !errors.Is(err, errTaskWebhookUnresolved) {
+		// 地址或密钥不满足要求时重试也无法成功，直接标记为失败
+		webhook.Status = model.TaskWebhookStatusFailed
+		webhook.LastError = err.Error()
+		common.SysError(fmt.Sprintf("task %s webhook rejected: %s", webhook.TaskId, err.Error()))
+	} else {
+		webhook.LastStatusCode = 0
+		if err == nil {
+			webhook.LastStatusCode, err = postWebhook(taskWebhookClient, webhook.Url, secret, []byte(webhook.Payload))
+		}
+		if err == nil {
+			webhook.Status = model.TaskWebhookStatusSucceeded
+			webhook.LastError = ""
+			webhook.DeliveredAt = common.GetTimestamp()
+		} else {
+			webhook.LastError = err.Error()
+			if webhook.Attempts >= operation_setting.GetTaskWebhookSetting().MaxAttempts {
+				webhook.Status = model.TaskWebhookStatusFailed
+				common.SysError(fmt.Sprintf("task %s webhook failed after %d attempts: %s", webhook.TaskId, webhook.Attempts, err.Error()))
+			} else {
+				webhook.NextAttemptAt = common.GetTimestamp() + operation_setting.GetTaskWebhookBackoffSeconds(webhook.Attempts)
+			}
+		}
+	}
+	if err = webhook.Update(); err != nil {
+		common.SysError(fmt.Sprintf("update task %s webhook failed: %s", webhook.TaskId, err.Error()))
+	}
+}
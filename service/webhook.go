@@ -52,6 +52,13 @@ func SendWebhookNotify(webhookURL string, secret string, data dto.Notify) error
 		return fmt.Errorf("failed to marshal webhook payload: %v", err)
 	}
 
+	_, err = postWebhook(GetImpatientHttpClient(), webhookURL, secret, payloadBytes)
+	return err
+}
+
+// postWebhook 使用 client 投递 webhook 请求，secret 不为空时附带签名，返回响应状态码
+func postWebhook(client *http.Client, webhookURL string, secret string, payloadBytes []byte) (int, error) {
+	var err error
 	// 创建 HTTP 请求
 	var req *http.Request
 	var resp *http.Response
@@ -72,23 +79,22 @@ func SendWebhookNotify(webhookURL string, secret string, data dto.Notify) error
 		if secret != "" {
 			signature := generateSignature(secret, payloadBytes)
 			workerReq.Headers["X-Webhook-Signature"] = signature
-			workerReq.Headers["Authorization"] = "Bearer " + secret
 		}
 
 		resp, err = DoWorkerRequest(workerReq)
 		if err != nil {
-			return fmt.Errorf("failed to send webhook request through worker: %v", err)
+			return 0, fmt.Errorf("failed to send webhook request through worker: %v", err)
 		}
 		defer resp.Body.Close()
 
 		// 检查响应状态
 		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			return fmt.Errorf("webhook request failed with status code: %d", resp.StatusCode)
+			return resp.StatusCode, fmt.Errorf("webhook request failed with status code: %d", resp.StatusCode)
 		}
 	} else {
 		req, err = http.NewRequest(http.MethodPost, webhookURL, bytes.NewBuffer(payloadBytes))
 		if err != nil {
-			return fmt.Errorf("failed to create webhook request: %v", err)
+			return 0, fmt.Errorf("failed to create webhook request: %v", err)
 		}
 
 		// 设置请求头
@@ -101,18 +107,17 @@ func SendWebhookNotify(webhookURL string, secret string, data dto.Notify) error
 		}
 
 		// 发送请求
-		client := GetImpatientHttpClient()
 		resp, err = client.Do(req)
 		if err != nil {
-			return fmt.Errorf("failed to send webhook request: %v", err)
+			return 0, fmt.Errorf("failed to send webhook request: %v", err)
 		}
 		defer resp.Body.Close()
 
 		// 检查响应状态
 		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			return fmt.Errorf("webhook request failed with status code: %d", resp.StatusCode)
+			return resp.StatusCode, fmt.Errorf("webhook request failed with status code: %d", resp.StatusCode)
 		}
 	}
 
-	return nil
+	return resp.StatusCode, nil
 }
@@ -0,0 +1,73 @@
+package model_setting
+
+import (
+	"one-api/setting/config"
+)
+
+// FallbackPolicy 单个模型的降级策略
+type FallbackPolicy struct {
+	// RetryTimes 该模型内部的渠道重试次数，为 nil 时使用全局重试次数
+	RetryTimes *int `json:"retry_times,omitempty"`
+	// StatusCodes 触发降级到下一个模型的状态码，为空时所有可重试的错误都会触发降级
+	StatusCodes []int `json:"status_codes,omitempty"`
+}
+
+// FallbackSettings 跨渠道模型降级链配置
+type FallbackSettings struct {
+	Enabled bool `json:"enabled"`
+	// Chains 模型 -> 依次尝试的降级模型，例如 {"gpt-4o": ["claude-sonnet-4", "gemini-2.5-pro"]}
+	Chains   map[string][]string       `json:"chains"`
+	Policies map[string]FallbackPolicy `json:"policies"`
+}
+
+// 默认配置
+var defaultFallbackSettings = FallbackSettings{
+	Enabled:  false,
+	Chains:   map[string][]string{},
+	Policies: map[string]FallbackPolicy{},
+}
+
+// 全局实例
+var fallbackSettings = defaultFallbackSettings
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("fallback", &fallbackSettings)
+}
+
+func GetFallbackSettings() *FallbackSettings {
+	return &fallbackSettings
+}
+
+// GetFallbackModels 返回依次尝试的模型列表，第一个始终为原始请求模型，重复的模型会被忽略
+func GetFallbackModels(modelName string) []string {
+	models := []string{modelName}
+	if !fallbackSettings.Enabled {
+		return models
+	}
+	seen := map[string]bool{modelName: true}
+	for _, m := range fallbackSettings.Chains[modelName] {
+		if m == "" || seen[m] {
+			continue
+		}
+		seen[m] = true
+		models = append(models, m)
+	}
+	return models
+}
+
+// GetFallbackRetryTimes 获取模型内部的渠道重试次数
+func GetFallbackRetryTimes(modelName string, defaultRetryTimes int) int {
+	if policy, ok := fallbackSettings.Policies[modelName]; ok && policy.RetryTimes != nil && *policy.RetryTimes >= 0 {
+		return *policy.RetryTimes
+	}
+	return defaultRetryTimes
+}
+
+// GetFallbackStatusCodes 获取触发降级的状态码，返回 nil 表示使用默认的重试判断
+func GetFallbackStatusCodes(modelName string) []int {
+	if policy, ok := fallbackSettings.Policies[modelName]; ok {
+		return policy.StatusCodes
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package operation_setting
+
+import (
+	"one-api/common"
+	"one-api/setting/config"
+	"slices"
+	"sync"
+)
+
+// BodyLogRedactRule 请求体记录的脱敏规则，匹配 Pattern 的内容替换为 Replacement，
+// Luhn 为 true 时只替换数字部分通过 Luhn 校验的匹配，避免把时间戳、数字 id 当作卡号
+type BodyLogRedactRule struct {
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+	Luhn        bool   `json:"luhn,omitempty"`
+}
+
+// BodyLogSetting 请求与响应内容记录配置，用于账单争议或问题排查时回溯实际发送的内容。
+// 仅对开启了记录的令牌、Users 中的用户或 Groups 中的分组生效
+type BodyLogSetting struct {
+	Enabled bool `json:"enabled"`
+	// UserIds 记录请求内容的用户
+	UserIds []int `json:"user_ids"`
+	// Groups 记录请求内容的分组
+	Groups []string `json:"groups"`
+	// MaxBodyBytes 请求体与响应体各自的最大记录大小，超出部分截断
+	MaxBodyBytes int `json:"max_body_bytes"`
+	// RetentionDays 记录保留天数，过期后由后台清理，0 表示不清理
+	RetentionDays int `json:"retention_days"`
+	// Encrypt 是否加密存储，密钥来自 BODY_LOG_SECRET 环境变量，未设置时依次使用 CRYPTO_SECRET、SESSION_SECRET，
+	// 均未设置时不记录内容
+	Encrypt bool `json:"encrypt"`
+	// RedactFields 需要脱敏的 JSON 字段名，字段值会被替换为 [REDACTED]
+	RedactFields []string `json:"redact_fields"`
+	// RedactRules 正则脱敏规则
+	RedactRules []BodyLogRedactRule `json:"redact_rules"`
+}
+
+// 默认配置
+var bodyLogSetting = BodyLogSetting{
+	Enabled:       false,
+	UserIds:       []int{},
+	Groups:        []string{},
+	MaxBodyBytes:  64 << 10,
+	RetentionDays: 30,
+	Encrypt:       true,
+	RedactFields:  []string{"api_key", "password", "secret", "access_token"},
+	RedactRules: []BodyLogRedactRule{
+		{Name: "email", Pattern: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`, Replacement: "[EMAIL]"},
+		{Name: "phone", Pattern: `\b1[3-9]\d{9}\b`, Replacement: "[PHONE]"},
+		{Name: "card", Pattern: `\b(?:\d[ -]?){13,19}\b`, Replacement: "[CARD]", Luhn: true},
+		{Name: "api_key", Pattern: `\bsk-[A-Za-z0-9_-]{16,}`, Replacement: "[API_KEY]"},
+	},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("body_log_setting", &bodyLogSetting)
+}
+
+func GetBodyLogSetting() *BodyLogSetting {
+	return &bodyLogSetting
+}
+
+var bodyLogSecretWarning sync.Once
+
+// IsBodyLogEnabledFor 判断是否需要记录该请求的内容，tokenOptIn 为令牌是否开启了内容记录
+func IsBodyLogEnabledFor(userId int, group string, tokenOptIn bool) bool {
+	if !bodyLogSetting.Enabled {
+		return false
+	}
+	if bodyLogSetting.Encrypt && common.BodyLogSecret == "" {
+		bodyLogSecretWarning.Do(func() {
+			common.SysError("WARNING: body log encryption is enabled but BODY_LOG_SECRET, CRYPTO_SECRET and SESSION_SECRET are all unset, body logs will NOT be recorded")
+		})
+		return false
+	}
+	return tokenOptIn || slices.Contains(bodyLogSetting.UserIds, userId) || slices.Contains(bodyLogSetting.Groups, group)
+}
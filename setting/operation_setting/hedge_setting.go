@@ -0,0 +1,44 @@
+package operation_setting
+
+import "one-api/setting/config"
+
+// HedgeSetting 流式请求对冲配置：主请求在延迟时间内未返回首字节时，向另一个渠道发送相同请求，
+// 先返回首字节的一方胜出，另一方被取消，仅对胜出的响应计费
+type HedgeSetting struct {
+	Enabled bool `json:"enabled"`
+	// DelayMilliseconds 发出对冲请求前等待主请求首字节的时间
+	DelayMilliseconds int `json:"delay_milliseconds"`
+	// Models 启用对冲的模型，为空表示所有模型
+	Models []string `json:"models"`
+}
+
+// 默认配置
+var hedgeSetting = HedgeSetting{
+	Enabled:           false,
+	DelayMilliseconds: 2000,
+	Models:            []string{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("hedge_setting", &hedgeSetting)
+}
+
+func GetHedgeSetting() *HedgeSetting {
+	return &hedgeSetting
+}
+
+func IsHedgeEnabledForModel(model string) bool {
+	if !hedgeSetting.Enabled || hedgeSetting.DelayMilliseconds <= 0 {
+		return false
+	}
+	if len(hedgeSetting.Models) == 0 {
+		return true
+	}
+	for _, m := range hedgeSetting.Models {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
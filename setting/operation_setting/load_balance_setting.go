@@ -0,0 +1,44 @@
+package operation_setting
+
+import "one-api/setting/config"
+
+const (
+	LoadBalanceModeWeight   = "weight"
+	LoadBalanceModeAdaptive = "adaptive"
+)
+
+// LoadBalanceSetting 渠道负载均衡配置
+// adaptive 模式下根据滑动窗口内的延迟、首字时间和错误率调整权重，并对错误率过高的渠道进行临时熔断
+type LoadBalanceSetting struct {
+	Mode string `json:"mode"`
+	// WindowSeconds 统计滑动窗口长度（秒）
+	WindowSeconds int `json:"window_seconds"`
+	// MinRequests 窗口内请求数达到该值后才参与错误率判断
+	MinRequests int `json:"min_requests"`
+	// ErrorRateThreshold 错误率达到该值时熔断渠道
+	ErrorRateThreshold float64 `json:"error_rate_threshold"`
+	// EjectSeconds 熔断时长（秒），到期后进入半开状态，只放行一个试探请求，成功则恢复，失败则继续熔断
+	EjectSeconds int `json:"eject_seconds"`
+}
+
+// 默认配置
+var loadBalanceSetting = LoadBalanceSetting{
+	Mode:               LoadBalanceModeWeight,
+	WindowSeconds:      60,
+	MinRequests:        10,
+	ErrorRateThreshold: 0.5,
+	EjectSeconds:       30,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("load_balance_setting", &loadBalanceSetting)
+}
+
+func GetLoadBalanceSetting() *LoadBalanceSetting {
+	return &loadBalanceSetting
+}
+
+func IsAdaptiveLoadBalanceEnabled() bool {
+	return loadBalanceSetting.Mode == LoadBalanceModeAdaptive
+}
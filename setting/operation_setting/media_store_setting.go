@@ -0,0 +1,88 @@
+package operation_setting
+
+import "one-api/setting/config"
+
+const (
+	MediaStoreBackendLocal = "local"
+	MediaStoreBackendS3    = "s3"
+)
+
+// MediaStoreLimit 媒体文件的保留天数与用户存储上限（字节），0 表示使用全局配置
+type MediaStoreLimit struct {
+	RetentionDays  int   `json:"retention_days"`
+	UserQuotaBytes int64 `json:"user_quota_bytes"`
+}
+
+// MediaStoreSetting 生成结果持久化配置：开启后异步任务结果与图片生成结果会下载到本地目录或 S3 兼容存储，
+// 并改写为由网关提供的签名链接，过期的文件由后台定期清理
+type MediaStoreSetting struct {
+	Enabled bool   `json:"enabled"`
+	Backend string `json:"backend"`
+	// LocalPath 本地存储目录
+	LocalPath string `json:"local_path"`
+	// S3 兼容存储配置，使用路径风格访问，可对接 MinIO 等服务
+	S3Endpoint  string `json:"s3_endpoint"`
+	S3Region    string `json:"s3_region"`
+	S3Bucket    string `json:"s3_bucket"`
+	S3AccessKey string `json:"s3_access_key"`
+	S3SecretKey string `json:"s3_secret_key"`
+	// MaxObjectBytes 单个文件的大小上限，超过时保留上游地址
+	MaxObjectBytes int64 `json:"max_object_bytes"`
+	// RetentionDays 与 UserQuotaBytes 为全局的保留天数与每个用户的存储上限
+	RetentionDays  int   `json:"retention_days"`
+	UserQuotaBytes int64 `json:"user_quota_bytes"`
+	// GroupLimits 按用户分组覆盖保留天数与存储上限
+	GroupLimits map[string]MediaStoreLimit `json:"group_limits"`
+	// GCIntervalSeconds 清理过期文件的间隔
+	GCIntervalSeconds int `json:"gc_interval_seconds"`
+	// ImagePersistTimeoutSeconds 图片生成响应等待持久化的最长时间，超时的图片返回上游地址，0 表示不限制
+	ImagePersistTimeoutSeconds int `json:"image_persist_timeout_seconds"`
+	// TaskPersistWorkers 与 TaskPersistQueueSize 为异步任务结果后台持久化的并发数与队列长度，队列已满时保留上游地址，修改后重启生效
+	TaskPersistWorkers   int `json:"task_persist_workers"`
+	TaskPersistQueueSize int `json:"task_persist_queue_size"`
+	// TaskPersistTimeoutSeconds 单个任务结果持久化的最长时间，超时的文件保留上游地址
+	TaskPersistTimeoutSeconds int `json:"task_persist_timeout_seconds"`
+}
+
+// 默认配置
+var mediaStoreSetting = MediaStoreSetting{
+	Enabled:                    false,
+	Backend:                    MediaStoreBackendLocal,
+	LocalPath:                  "./data/media",
+	S3Region:                   "us-east-1",
+	MaxObjectBytes:             200 << 20,
+	RetentionDays:              7,
+	UserQuotaBytes:             1 << 30,
+	GroupLimits:                map[string]MediaStoreLimit{},
+	GCIntervalSeconds:          600,
+	ImagePersistTimeoutSeconds: 10,
+	TaskPersistWorkers:         4,
+	TaskPersistQueueSize:       1000,
+	TaskPersistTimeoutSeconds:  600,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("media_store_setting", &mediaStoreSetting)
+}
+
+func GetMediaStoreSetting() *MediaStoreSetting {
+	return &mediaStoreSetting
+}
+
+// GetMediaStoreLimit 返回指定分组生效的保留天数与存储上限
+func GetMediaStoreLimit(group string) MediaStoreLimit {
+	limit := MediaStoreLimit{
+		RetentionDays:  mediaStoreSetting.RetentionDays,
+		UserQuotaBytes: mediaStoreSetting.UserQuotaBytes,
+	}
+	if groupLimit, ok := mediaStoreSetting.GroupLimits[group]; ok {
+		if groupLimit.RetentionDays > 0 {
+			limit.RetentionDays = groupLimit.RetentionDays
+		}
+		if groupLimit.UserQuotaBytes > 0 {
+			limit.UserQuotaBytes = groupLimit.UserQuotaBytes
+		}
+	}
+	return limit
+}
@@ -0,0 +1,49 @@
+package operation_setting
+
+import (
+	"one-api/common"
+	"one-api/setting/config"
+)
+
+// RealtimeBridgeSetting Realtime API 桥接配置：所选渠道不支持 OpenAI realtime 时，由网关直接处理 WebSocket 会话，
+// 依次调用语音识别、对话补全与语音合成渠道完成一轮对话，各环节按对应模型分别计费
+type RealtimeBridgeSetting struct {
+	Enabled bool `json:"enabled"`
+	// TranscriptionModel 语音识别使用的模型，会话中设置了 input_audio_transcription.model 时优先使用会话设置
+	TranscriptionModel string `json:"transcription_model"`
+	// SpeechModel 语音合成使用的模型，需要支持 pcm 输出格式
+	SpeechModel string `json:"speech_model"`
+	// DefaultVoice 会话未指定音色时使用的音色
+	DefaultVoice string `json:"default_voice"`
+	// Models 即使渠道原生支持 realtime 也强制桥接的模型
+	Models []string `json:"models"`
+	// MaxInputAudioSeconds 单次提交的输入音频最大时长（秒）
+	MaxInputAudioSeconds int `json:"max_input_audio_seconds"`
+}
+
+// 默认配置
+var realtimeBridgeSetting = RealtimeBridgeSetting{
+	Enabled:              false,
+	TranscriptionModel:   "whisper-1",
+	SpeechModel:          "tts-1",
+	DefaultVoice:         "alloy",
+	Models:               []string{},
+	MaxInputAudioSeconds: 300,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("realtime_bridge_setting", &realtimeBridgeSetting)
+}
+
+func GetRealtimeBridgeSetting() *RealtimeBridgeSetting {
+	return &realtimeBridgeSetting
+}
+
+// ShouldBridgeRealtime 判断 realtime 会话是否由网关桥接，nativeSupported 为所选渠道是否原生支持 realtime
+func ShouldBridgeRealtime(model string, nativeSupported bool) bool {
+	if !realtimeBridgeSetting.Enabled {
+		return false
+	}
+	return !nativeSupported || common.StringsContains(realtimeBridgeSetting.Models, model)
+}
@@ -0,0 +1,64 @@
+package operation_setting
+
+import "one-api/setting/config"
+
+const (
+	ResponseCacheBackendMemory = "memory"
+	ResponseCacheBackendRedis  = "redis"
+)
+
+// ResponseCacheSetting 确定性请求（temperature 为 0 的对话补全、embedding）的响应缓存配置，
+// 以分组、模型和规范化后的请求体作为缓存键，命中时直接回放缓存的响应并按折扣倍率计费
+type ResponseCacheSetting struct {
+	Enabled bool `json:"enabled"`
+	// Backend 缓存后端 memory 或 redis，选择 redis 但未启用 Redis 时使用内存
+	Backend string `json:"backend"`
+	// TTLSeconds 缓存有效期（秒）
+	TTLSeconds int `json:"ttl_seconds"`
+	// MaxEntries 内存缓存最大条目数，超出后按 LRU 淘汰
+	MaxEntries int `json:"max_entries"`
+	// MaxBodyBytes 单个响应的最大缓存大小，超出则不缓存
+	MaxBodyBytes int `json:"max_body_bytes"`
+	// Models 启用缓存的模型，为空表示所有模型
+	Models []string `json:"models"`
+	// TokenOptIn 为 true 时仅对开启了响应缓存的令牌生效
+	TokenOptIn bool `json:"token_opt_in"`
+	// BillingRatio 命中缓存时的计费倍率，0 表示免费
+	BillingRatio float64 `json:"billing_ratio"`
+}
+
+// 默认配置
+var responseCacheSetting = ResponseCacheSetting{
+	Enabled:      false,
+	Backend:      ResponseCacheBackendMemory,
+	TTLSeconds:   3600,
+	MaxEntries:   1000,
+	MaxBodyBytes: 1 << 20,
+	Models:       []string{},
+	TokenOptIn:   false,
+	BillingRatio: 0.1,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("response_cache_setting", &responseCacheSetting)
+}
+
+func GetResponseCacheSetting() *ResponseCacheSetting {
+	return &responseCacheSetting
+}
+
+func IsResponseCacheEnabledForModel(model string) bool {
+	if !responseCacheSetting.Enabled || responseCacheSetting.TTLSeconds <= 0 {
+		return false
+	}
+	if len(responseCacheSetting.Models) == 0 {
+		return true
+	}
+	for _, m := range responseCacheSetting.Models {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
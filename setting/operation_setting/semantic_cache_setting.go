@@ -0,0 +1,72 @@
+package operation_setting
+
+import (
+	"one-api/common"
+	"one-api/setting/config"
+)
+
+// SemanticCacheSetting 对话补全的语义缓存配置：通过 embedding 模型计算最后一条用户消息的向量，
+// 与上下文相同的历史请求比较余弦相似度，超过阈值时直接返回缓存的响应。
+// temperature 大于 0 或携带工具定义的请求结果不确定，不使用语义缓存
+type SemanticCacheSetting struct {
+	Enabled bool `json:"enabled"`
+	// EmbeddingModel 计算向量使用的模型，需要有可用的 embedding 渠道。
+	// 每个使用语义缓存的请求最多产生一次 embedding 调用，按该模型正常计费并计入发起请求的用户：
+	// 上下文相同的请求已有缓存时在查找前同步计算（增加一次 embedding 请求的延迟），否则在响应写入缓存时于后台计算，
+	// 相同文本的向量在缓存有效期内复用，不重复计费
+	EmbeddingModel string `json:"embedding_model"`
+	// TTLSeconds 缓存有效期（秒）
+	TTLSeconds int `json:"ttl_seconds"`
+	// MaxEntries 最大缓存条目数，超出后淘汰最早的条目
+	MaxEntries int `json:"max_entries"`
+	// Threshold 默认相似度阈值
+	Threshold float64 `json:"threshold"`
+	// ModelThresholds 按模型设置的相似度阈值，覆盖默认阈值
+	ModelThresholds map[string]float64 `json:"model_thresholds"`
+	// Models 启用语义缓存的模型，为空表示所有模型
+	Models []string `json:"models"`
+	// Groups 启用语义缓存的分组，为空表示所有分组
+	Groups []string `json:"groups"`
+	// TokenOptIn 为 true 时仅对开启了语义缓存的令牌生效
+	TokenOptIn bool `json:"token_opt_in"`
+	// BillingRatio 命中缓存时的计费倍率，0 表示免费
+	BillingRatio float64 `json:"billing_ratio"`
+}
+
+// 默认配置
+var semanticCacheSetting = SemanticCacheSetting{
+	Enabled:         false,
+	EmbeddingModel:  "text-embedding-3-small",
+	TTLSeconds:      3600,
+	MaxEntries:      1000,
+	Threshold:       0.95,
+	ModelThresholds: map[string]float64{},
+	Models:          []string{},
+	Groups:          []string{},
+	TokenOptIn:      false,
+	BillingRatio:    0.1,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("semantic_cache_setting", &semanticCacheSetting)
+}
+
+func GetSemanticCacheSetting() *SemanticCacheSetting {
+	return &semanticCacheSetting
+}
+
+func IsSemanticCacheEnabled(model string, group string) bool {
+	if !semanticCacheSetting.Enabled || semanticCacheSetting.TTLSeconds <= 0 || semanticCacheSetting.EmbeddingModel == "" {
+		return false
+	}
+	return (len(semanticCacheSetting.Models) == 0 || common.StringsContains(semanticCacheSetting.Models, model)) &&
+		(len(semanticCacheSetting.Groups) == 0 || common.StringsContains(semanticCacheSetting.Groups, group))
+}
+
+func GetSemanticCacheThreshold(model string) float64 {
+	if threshold, ok := semanticCacheSetting.ModelThresholds[model]; ok {
+		return threshold
+	}
+	return semanticCacheSetting.Threshold
+}
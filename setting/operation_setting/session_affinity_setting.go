@@ -0,0 +1,31 @@
+package operation_setting
+
+import "one-api/setting/config"
+
+// SessionAffinitySetting 会话粘性路由配置，将同一会话的请求固定到同一渠道以命中上游提示词缓存
+type SessionAffinitySetting struct {
+	Enabled bool `json:"enabled"`
+	// TTLSeconds 会话与渠道绑定的有效期（秒），每次命中后续期
+	TTLSeconds int `json:"ttl_seconds"`
+	// SessionHeader 客户端传递会话 id 的请求头
+	SessionHeader string `json:"session_header"`
+	// PrefixMessages 未提供会话 id 时，取消息列表前 N 条计算哈希作为会话标识，为 0 时不使用消息前缀
+	PrefixMessages int `json:"prefix_messages"`
+}
+
+// 默认配置
+var sessionAffinitySetting = SessionAffinitySetting{
+	Enabled:        false,
+	TTLSeconds:     300,
+	SessionHeader:  "X-Session-Id",
+	PrefixMessages: 2,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("session_affinity_setting", &sessionAffinitySetting)
+}
+
+func GetSessionAffinitySetting() *SessionAffinitySetting {
+	return &sessionAffinitySetting
+}
@@ -0,0 +1,26 @@
+package operation_setting
+
+import "one-api/setting/config"
+
+// TaskLifecycleSetting 异步任务生命周期配置：超过最长存活时间仍未完成的任务会被标记为失败并退还额度
+type TaskLifecycleSetting struct {
+	// MaxTaskAgeSeconds 任务从提交起的最长存活时间，0 表示不限制
+	MaxTaskAgeSeconds int `json:"max_task_age_seconds"`
+	// CancelRefundByProgress 取消执行中的任务时是否只按未完成的进度比例退还额度，关闭时全额退还
+	CancelRefundByProgress bool `json:"cancel_refund_by_progress"`
+}
+
+// 默认配置
+var taskLifecycleSetting = TaskLifecycleSetting{
+	MaxTaskAgeSeconds:      86400,
+	CancelRefundByProgress: true,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("task_lifecycle_setting", &taskLifecycleSetting)
+}
+
+func GetTaskLifecycleSetting() *TaskLifecycleSetting {
+	return &taskLifecycleSetting
+}
@@ -0,0 +1,47 @@
+package operation_setting
+
+import "one-api/setting/config"
+
+// TaskPollSetting 异步任务轮询调度配置：任务按已运行时长指数退避轮询，并限制每个渠道的并发请求数
+type TaskPollSetting struct {
+	// TickSeconds 调度器扫描未完成任务的周期
+	TickSeconds int `json:"tick_seconds"`
+	// ScanLimit 每次扫描的未完成任务数上限，超过上限的任务在后续轮次按 id 依次扫描
+	ScanLimit int `json:"scan_limit"`
+	// ChannelConcurrency 每个渠道同时进行的轮询请求数
+	ChannelConcurrency int `json:"channel_concurrency"`
+	// ChannelBatchSize 每次轮询请求携带的最大任务数
+	ChannelBatchSize int `json:"channel_batch_size"`
+	// BaseIntervalSeconds 新提交任务的轮询间隔
+	BaseIntervalSeconds int `json:"base_interval_seconds"`
+	// MaxIntervalSeconds 轮询间隔上限
+	MaxIntervalSeconds int `json:"max_interval_seconds"`
+	// BackoffStepSeconds 任务每运行该时长，轮询间隔翻倍
+	BackoffStepSeconds int `json:"backoff_step_seconds"`
+	// JitterRatio 轮询间隔的随机抖动比例，避免大量任务同时轮询
+	JitterRatio float64 `json:"jitter_ratio"`
+	// LeaderLeaseSeconds 多实例部署时轮询主节点租约时长，需大于 TickSeconds
+	LeaderLeaseSeconds int `json:"leader_lease_seconds"`
+}
+
+// 默认配置
+var taskPollSetting = TaskPollSetting{
+	TickSeconds:         5,
+	ScanLimit:           1000,
+	ChannelConcurrency:  2,
+	ChannelBatchSize:    50,
+	BaseIntervalSeconds: 15,
+	MaxIntervalSeconds:  300,
+	BackoffStepSeconds:  120,
+	JitterRatio:         0.2,
+	LeaderLeaseSeconds:  30,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("task_poll_setting", &taskPollSetting)
+}
+
+func GetTaskPollSetting() *TaskPollSetting {
+	return &taskPollSetting
+}
@@ -0,0 +1,71 @@
+package operation_setting
+
+import (
+	"one-api/setting/config"
+	"strings"
+)
+
+// TaskWebhookSetting 异步任务完成回调配置：任务进入成功或失败状态后，向提交时指定的 callback_url 投递结果，
+// 使用用户设置的 webhook 密钥签名，失败时按指数退避重试
+type TaskWebhookSetting struct {
+	Enabled bool `json:"enabled"`
+	// AllowedHosts 允许回调的主机名（包含其子域名），为空时不限制主机，回环、内网与云元数据地址始终被拒绝
+	AllowedHosts []string `json:"allowed_hosts"`
+	// MaxAttempts 最大投递次数，包含首次投递
+	MaxAttempts int `json:"max_attempts"`
+	// InitialBackoffSeconds 首次重试前的等待时间，之后每次翻倍
+	InitialBackoffSeconds int `json:"initial_backoff_seconds"`
+	// MaxBackoffSeconds 单次重试等待时间的上限
+	MaxBackoffSeconds int `json:"max_backoff_seconds"`
+}
+
+// 默认配置
+var taskWebhookSetting = TaskWebhookSetting{
+	Enabled:               false,
+	AllowedHosts:          []string{},
+	MaxAttempts:           6,
+	InitialBackoffSeconds: 10,
+	MaxBackoffSeconds:     3600,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("task_webhook_setting", &taskWebhookSetting)
+}
+
+func GetTaskWebhookSetting() *TaskWebhookSetting {
+	return &taskWebhookSetting
+}
+
+// GetTaskWebhookBackoffSeconds 第 attempts 次投递失败后到下次重试的等待时间
+func GetTaskWebhookBackoffSeconds(attempts int) int64 {
+	backoff := int64(taskWebhookSetting.InitialBackoffSeconds)
+	if backoff <= 0 {
+		backoff = 1
+	}
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if taskWebhookSetting.MaxBackoffSeconds > 0 && backoff >= int64(taskWebhookSetting.MaxBackoffSeconds) {
+			return int64(taskWebhookSetting.MaxBackoffSeconds)
+		}
+	}
+	return backoff
+}
+
+// IsTaskWebhookHostAllowed 判断主机是否在回调主机白名单内，白名单为空时允许所有主机
+func IsTaskWebhookHostAllowed(host string) bool {
+	if len(taskWebhookSetting.AllowedHosts) == 0 {
+		return true
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, allowed := range taskWebhookSetting.AllowedHosts {
+		allowed = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(allowed), "."))
+		if allowed == "" {
+			continue
+		}
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
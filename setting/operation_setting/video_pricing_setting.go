@@ -0,0 +1,47 @@
+package operation_setting
+
+import "one-api/setting/config"
+
+// VideoModelPricing 视频模型按秒计费的价格（美元/秒），ResolutionPrices 按分辨率（如 1280x720）配置每秒价格，优先于 PricePerSecond
+type VideoModelPricing struct {
+	PricePerSecond   float64            `json:"price_per_second"`
+	ResolutionPrices map[string]float64 `json:"resolution_prices,omitempty"`
+}
+
+// VideoPricingSetting 视频生成接口的计费配置，未配置的模型按模型固定价格计费
+type VideoPricingSetting struct {
+	// DefaultSeconds 请求未指定时长时的默认秒数
+	DefaultSeconds int                          `json:"default_seconds"`
+	Models         map[string]VideoModelPricing `json:"models"`
+}
+
+// 默认配置
+var videoPricingSetting = VideoPricingSetting{
+	DefaultSeconds: 5,
+	Models:         map[string]VideoModelPricing{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("video_pricing_setting", &videoPricingSetting)
+}
+
+func GetVideoPricingSetting() *VideoPricingSetting {
+	return &videoPricingSetting
+}
+
+// GetVideoPrice 按时长与分辨率计算视频模型的价格，模型未配置按秒计费时返回 false
+func GetVideoPrice(model string, size string, seconds int) (float64, bool) {
+	pricing, ok := videoPricingSetting.Models[model]
+	if !ok {
+		return 0, false
+	}
+	if seconds <= 0 {
+		seconds = videoPricingSetting.DefaultSeconds
+	}
+	pricePerSecond := pricing.PricePerSecond
+	if price, ok := pricing.ResolutionPrices[size]; ok {
+		pricePerSecond = price
+	}
+	return pricePerSecond * float64(seconds), true
+}
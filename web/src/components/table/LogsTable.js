@@ -105,6 +105,12 @@ const LogsTable = () => {
             {t('错误')}
           </Tag>
         );
+      case 6:
+        return (
+          <Tag color='teal' size='large' shape='circle'>
+            {t('退款')}
+          </Tag>
+        );
       default:
         return (
           <Tag color='grey' size='large' shape='circle'>
@@ -918,6 +924,46 @@ const LogsTable = () => {
     }
   };
 
+  const showBodyLog = async (requestId) => {
+    const res = await API.get(`/api/log/body/${requestId}`);
+    const { success, message, data } = res.data;
+    if (!success) {
+      showError(message);
+      return;
+    }
+    const preStyle = {
+      maxHeight: 300,
+      overflow: 'auto',
+      whiteSpace: 'pre-wrap',
+      wordBreak: 'break-all',
+      background: 'var(--semi-color-fill-0)',
+      padding: 8,
+      borderRadius: 4,
+    };
+    Modal.info({
+      title: t('请求内容'),
+      width: 800,
+      content: (
+        <div>
+          <p>
+            {data.path} · {t('状态码')}: {data.status_code}
+          </p>
+          <p>
+            {t('请求体')}
+            {data.request_truncated ? ` (${t('已截断')})` : ''}
+          </p>
+          <pre style={preStyle}>{data.request_body}</pre>
+          <p>
+            {t('响应体')}
+            {data.response_truncated ? ` (${t('已截断')})` : ''}
+          </p>
+          <pre style={preStyle}>{data.response_body}</pre>
+        </div>
+      ),
+      centered: true,
+    });
+  };
+
   const setLogsFormat = (logs) => {
     let expandDatesLocal = {};
     for (let i = 0; i < logs.length; i++) {
@@ -1090,6 +1136,20 @@ const LogsTable = () => {
           });
         }
       }
+      if (isAdminUser && other?.body_log_id) {
+        expandDataLocal.push({
+          key: t('请求内容'),
+          value: (
+            <Button
+              size='small'
+              theme='borderless'
+              onClick={() => showBodyLog(other.body_log_id)}
+            >
+              {t('查看')}
+            </Button>
+          ),
+        });
+      }
       expandDatesLocal[logs[i].key] = expandDataLocal;
     }
 
@@ -1364,6 +1424,9 @@ const LogsTable = () => {
                       <Form.Select.Option value='5'>
                         {t('错误')}
                       </Form.Select.Option>
+                      <Form.Select.Option value='6'>
+                        {t('退款')}
+                      </Form.Select.Option>
                     </Form.Select>
                   </div>
 
@@ -15,7 +15,8 @@ import {
   Video,
   Sparkles,
   Zap,
-  Settings
+  Settings,
+  Palette
 } from 'lucide-react';
 import {
   API,
@@ -255,6 +256,12 @@ const LogsTable = () => {
             CustomPass
           </Tag>
         );
+      case 'mj':
+        return (
+          <Tag color='orange' size='large' shape='circle' prefixIcon={<Palette size={14} />}>
+            Midjourney
+          </Tag>
+        );
       default:
         return (
           <Tag color='white' size='large' shape='circle' prefixIcon={<HelpCircle size={14} />}>
@@ -96,6 +96,7 @@ export const CHANNEL_OPTIONS = [
   { value: 42, color: 'blue', label: 'Mistral AI' },
   { value: 8, color: 'pink', label: '自定义渠道' },
   { value: 51, color: 'orange', label: '自定义透传渠道' },
+  { value: 52, color: 'amber', label: '声明式任务渠道' },
   {
     value: 22,
     color: 'blue',